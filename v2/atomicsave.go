@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// backupOnSave is set by the -b flag, to keep the previous version of a file as "filename~" when saving
+var backupOnSave bool
+
+// resolveSymlinks returns the file that the given filename points to, if it is a symlink.
+// Symlinks that point to files that do not exist yet are also followed.
+func resolveSymlinks(filename string) string {
+	for i := 0; i < 255; i++ { // the same limit as on Linux, to avoid looping forever
+		fi, err := os.Lstat(filename)
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			return filename
+		}
+		target, err := os.Readlink(filename)
+		if err != nil {
+			return filename
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(filename), target)
+		}
+		filename = target
+	}
+	return filename
+}
+
+// withExecutableBits returns the given file mode, with the executable bits set where the read bits are set,
+// or with all the executable bits cleared
+func withExecutableBits(m os.FileMode, executable bool) os.FileMode {
+	if executable {
+		return m | (m&0o444)>>2
+	}
+	return m &^ 0o111
+}
+
+// WriteFileAtomic writes the given data to the given file, in a way that never leaves a half-written file behind.
+// The data is written to a temporary file in the same directory, which is synced to disk and then renamed to
+// the given filename. Symlinks are followed, so that the file they point to is replaced instead of the symlink.
+// The permissions and owner of an existing file are kept, while perm is used for new files.
+// Files with more than one hard link, and files where the owner can not be kept, are written in place instead.
+// If backup is true, the previous contents of the file are kept in a file with the same name, ending with "~".
+func WriteFileAtomic(filename string, data []byte, perm os.FileMode, backup bool) error {
+	filename = resolveSymlinks(filename)
+	fi, err := os.Stat(filename)
+	exists := err == nil
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if exists && !fi.Mode().IsRegular() {
+		return errors.New(filename + " is not a regular file")
+	}
+
+	if exists && backup {
+		if err := copyFileContents(filename, filename+"~", fi.Mode().Perm()); err != nil {
+			return fmt.Errorf("could not keep a backup: %w", err)
+		}
+	}
+
+	if exists {
+		if _, _, links, ok := fileOwner(fi); ok && links > 1 {
+			// Replacing the file would break the hard links
+			return writeFileInPlace(filename, data, perm)
+		}
+	}
+
+	tempFile, err := createTempFile(filename, perm)
+	if err != nil {
+		// The directory may not be writable, even if the file is
+		if exists {
+			return writeFileInPlace(filename, data, perm)
+		}
+		return err
+	}
+	tempFilename := tempFile.Name()
+	removeTempFile := func() {
+		tempFile.Close()
+		os.Remove(tempFilename)
+	}
+
+	if exists {
+		// Keep the permissions, including the setuid, setgid and sticky bits
+		if err := tempFile.Chmod(fi.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)); err != nil {
+			removeTempFile()
+			return err
+		}
+		// Keep the owner and group, or write the file in place if that is not possible
+		if uid, gid, _, ok := fileOwner(fi); ok && (uid != os.Getuid() || gid != os.Getgid()) {
+			if err := tempFile.Chown(uid, gid); err != nil {
+				removeTempFile()
+				return writeFileInPlace(filename, data, perm)
+			}
+		}
+	}
+
+	if _, err := tempFile.Write(data); err != nil {
+		removeTempFile()
+		return err
+	}
+	if err := tempFile.Sync(); err != nil {
+		removeTempFile()
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		os.Remove(tempFilename)
+		return err
+	}
+	if err := os.Rename(tempFilename, filename); err != nil {
+		os.Remove(tempFilename)
+		return err
+	}
+	// Sync the directory too, so that the rename is stored on disk. This is not possible on all platforms.
+	if dir, err := os.Open(filepath.Dir(filename)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+// createTempFile creates a new hidden file in the same directory as the given filename, with the given permissions.
+// The permissions are masked by the umask, like for regular new files.
+func createTempFile(filename string, perm os.FileMode) (*os.File, error) {
+	dir, base := filepath.Split(filename)
+	for i := 0; ; i++ {
+		tempFilename := filepath.Join(dir, fmt.Sprintf(".%s.%d.%d.tmp", base, os.Getpid(), time.Now().UnixNano()+int64(i)))
+		f, err := os.OpenFile(tempFilename, os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+		if err == nil || !errors.Is(err, fs.ErrExist) || i >= 100 {
+			return f, err
+		}
+	}
+}
+
+// writeFileInPlace truncates and writes the given file, then syncs it to disk
+func writeFileInPlace(filename string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// copyFileContents copies the contents of one file to another, which is created with the given permissions if needed
+func copyFileContents(src, dst string, perm os.FileMode) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return writeFileInPlace(dst, data, perm)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "file.txt")
+
+	// A new file
+	if err := WriteFileAtomic(filename, []byte("first\n"), 0o600, false); err != nil {
+		t.Fatal(err)
+	}
+	// The permissions of the existing file are kept
+	if err := os.Chmod(filename, 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileAtomic(filename, []byte("second\n"), 0o644, true); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(filename); err != nil || fi.Mode().Perm() != 0o640 {
+		t.Errorf("expected the permissions to be kept, got %v", fi.Mode())
+	}
+	if data, _ := os.ReadFile(filename); string(data) != "second\n" {
+		t.Errorf("unexpected contents: %q", data)
+	}
+	if data, _ := os.ReadFile(filename + "~"); string(data) != "first\n" {
+		t.Errorf("expected the backup to contain the previous version, got %q", data)
+	}
+
+	// Symlinks are followed, and kept as symlinks
+	link := filepath.Join(dir, "link.txt")
+	if err := os.Symlink("file.txt", link); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileAtomic(link, []byte("third\n"), 0o644, false); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Lstat(link); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Error("expected the symlink to be kept")
+	}
+	if data, _ := os.ReadFile(filename); string(data) != "third\n" {
+		t.Errorf("expected the file that the symlink points to to be written, got %q", data)
+	}
+
+	// Hard links are kept
+	hardlink := filepath.Join(dir, "hardlink.txt")
+	if err := os.Link(filename, hardlink); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileAtomic(filename, []byte("fourth\n"), 0o644, false); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(hardlink); string(data) != "fourth\n" {
+		t.Errorf("expected the hard link to point to the new contents, got %q", data)
+	}
+
+	// No temporary files are left behind
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 {
+		t.Errorf("expected 4 files, got %d", len(entries))
+	}
+}
+
+func TestWithExecutableBits(t *testing.T) {
+	if m := withExecutableBits(0o640, true); m != 0o750 {
+		t.Errorf("expected 0750, got %o", m)
+	}
+	if m := withExecutableBits(0o755, false); m != 0o644 {
+		t.Errorf("expected 0644, got %o", m)
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xyproto/vt100"
+)
+
+// maxBookmarkChoices is the number of bookmarks that are listed in the bookmark menu
+const maxBookmarkChoices = 20
+
+var (
+	bookmarksFilename = filepath.Join(userCacheDir, "o", "bookmarks.txt")
+	bookmarks         Bookmarks // named bookmarks in all files, loaded when the editor starts
+)
+
+// Bookmark is a named line in a file. When the file is open, the bookmark follows the line
+// as lines are inserted or deleted above it.
+type Bookmark struct {
+	Name      string
+	Filename  string    // the absolute path
+	LineIndex LineIndex // the line when the bookmark was last saved
+	Text      string    // the contents of the line when the bookmark was last saved, for finding it again if the file has changed
+	lines     *Journal  // the lines of the open file, if the bookmark is attached to it
+	mark      *LineMark
+}
+
+// Bookmarks is a list of named bookmarks, sorted by name
+type Bookmarks []*Bookmark
+
+// Line returns the current line index of the bookmark
+func (b *Bookmark) Line() LineIndex {
+	if b.mark != nil {
+		return b.mark.LineIndex()
+	}
+	return b.LineIndex
+}
+
+// attach starts following the bookmarked line in the given lines. If the line no longer has the same contents,
+// the closest line with the same contents is used instead.
+func (b *Bookmark) attach(lines *Journal) {
+	if b.lines != nil && b.mark != nil {
+		b.lines.Unmark(b.mark)
+	}
+	y := int(b.LineIndex)
+	if b.Text != "" {
+		if found, ok := findClosestLine(lines.Buffer, b.Text, y); ok {
+			y = found
+		}
+	}
+	if last := lines.Len() - 1; y > last {
+		y = last
+	}
+	if y < 0 {
+		y = 0
+	}
+	b.lines = lines
+	b.mark = lines.Mark(y)
+}
+
+// detach stops following the bookmarked line
+func (b *Bookmark) detach() {
+	b.update()
+	if b.lines != nil && b.mark != nil {
+		b.lines.Unmark(b.mark)
+	}
+	b.lines = nil
+	b.mark = nil
+}
+
+// update stores the current line index and contents of the bookmarked line, if the bookmark is attached
+func (b *Bookmark) update() {
+	if b.mark == nil {
+		return
+	}
+	b.LineIndex = b.mark.LineIndex()
+	if runes, ok := b.lines.Line(int(b.LineIndex)); ok {
+		b.Text = string(runes)
+	}
+}
+
+// CurrentText returns the current contents of the bookmarked line
+func (b *Bookmark) CurrentText() string {
+	if b.lines != nil {
+		if runes, ok := b.lines.Line(int(b.Line())); ok {
+			return string(runes)
+		}
+	}
+	return b.Text
+}
+
+// cleanBookmarkName replaces the characters that can not be used in a bookmark name with spaces
+func cleanBookmarkName(name string) string {
+	return strings.TrimSpace(strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(name))
+}
+
+// Find returns the index of the bookmark with the given name, or -1
+func (bs Bookmarks) Find(name string) int {
+	for i, b := range bs {
+		if b.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Has checks if there are bookmarks in the given file
+func (bs Bookmarks) Has(absFilename string) bool {
+	for _, b := range bs {
+		if b.Filename == absFilename {
+			return true
+		}
+	}
+	return false
+}
+
+// Set adds a bookmark with the given name for the given line in the given lines of a file,
+// or moves the bookmark if there already is one with the same name
+func (bs *Bookmarks) Set(name, absFilename string, lines *Journal, y LineIndex) *Bookmark {
+	var b *Bookmark
+	if i := bs.Find(name); i >= 0 {
+		b = (*bs)[i]
+		b.detach()
+	} else {
+		b = &Bookmark{Name: name}
+		*bs = append(*bs, b)
+		sort.SliceStable(*bs, func(i, j int) bool {
+			return (*bs)[i].Name < (*bs)[j].Name
+		})
+	}
+	b.Filename = absFilename
+	b.LineIndex = y
+	b.Text = ""
+	b.attach(lines)
+	b.update()
+	return b
+}
+
+// Remove removes the bookmark with the given name. Returns false if there is none.
+func (bs *Bookmarks) Remove(name string) bool {
+	i := bs.Find(name)
+	if i < 0 {
+		return false
+	}
+	(*bs)[i].detach()
+	*bs = append((*bs)[:i], (*bs)[i+1:]...)
+	return true
+}
+
+// Attach lets the bookmarks in the given file follow their lines in the given lines of the open file
+func (bs Bookmarks) Attach(absFilename string, lines *Journal) {
+	for _, b := range bs {
+		if b.Filename == absFilename && b.lines != lines {
+			b.update()
+			b.attach(lines)
+		}
+	}
+}
+
+// At returns the bookmarks on the given line of the given file
+func (bs Bookmarks) At(absFilename string, y LineIndex) []*Bookmark {
+	var found []*Bookmark
+	for _, b := range bs {
+		if b.Filename == absFilename && b.Line() == y {
+			found = append(found, b)
+		}
+	}
+	return found
+}
+
+// Save writes the bookmarks to the given file, with one "line number, name, filename, line contents" line per bookmark,
+// separated by tabs
+func (bs Bookmarks) Save(filename string) error {
+	if noWriteToCache {
+		return nil
+	}
+	// First create the folder, if needed, in a best effort attempt
+	os.MkdirAll(filepath.Dir(filename), os.ModePerm)
+	var sb strings.Builder
+	for _, b := range bs {
+		b.update()
+		sb.WriteString(fmt.Sprintf("%d\t%s\t%s\t%s\n", b.LineIndex.LineNumber(), b.Name, b.Filename, b.Text))
+	}
+	return os.WriteFile(filename, []byte(sb.String()), 0o600)
+}
+
+// LoadBookmarks reads the bookmarks from the given file. The returned list can be empty.
+func LoadBookmarks(filename string) (Bookmarks, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return Bookmarks{}, err
+	}
+	var bs Bookmarks
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.SplitN(line, "\t", 4)
+		if len(fields) != 4 || fields[1] == "" || !filepath.IsAbs(fields[2]) {
+			continue
+		}
+		lineNumber, err := strconv.Atoi(fields[0])
+		if err != nil || lineNumber < 1 {
+			continue
+		}
+		bs = append(bs, &Bookmark{Name: fields[1], Filename: fields[2], LineIndex: LineNumber(lineNumber).LineIndex(), Text: fields[3]})
+	}
+	sort.SliceStable(bs, func(i, j int) bool {
+		return bs[i].Name < bs[j].Name
+	})
+	return bs, nil
+}
+
+// AttachBookmarks lets the bookmarks in the current file follow their lines as the file is edited
+func (e *Editor) AttachBookmarks() {
+	if absFilename := e.lspFilename(); absFilename != "" {
+		bookmarks.Attach(absFilename, e.lines)
+	}
+}
+
+// AddBookmark adds a named bookmark for the current line. If no name is given, the user is asked for one,
+// and if none is entered, the filename and line number is used.
+func (e *Editor) AddBookmark(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, name string) {
+	absFilename := e.lspFilename()
+	if absFilename == "" {
+		status.SetErrorMessage("Only lines in files with a name can be bookmarked")
+		status.ShowNoTimeout(c, e)
+		return
+	}
+	if name == "" {
+		var ok bool
+		if name, ok = e.UserInput(c, tty, status, "Bookmark name", []string{}, false); !ok {
+			return
+		}
+	}
+	if name = cleanBookmarkName(name); name == "" {
+		name = fmt.Sprintf("%s:%d", filepath.Base(absFilename), e.LineNumber())
+	}
+	bookmarks.Set(name, absFilename, e.lines, e.DataY())
+	if err := bookmarks.Save(bookmarksFilename); err != nil {
+		status.SetError(err)
+		status.ShowNoTimeout(c, e)
+		return
+	}
+	status.SetMessageAfterRedraw("Bookmarked line " + e.LineNumber().String() + " as " + name)
+}
+
+// RemoveBookmark removes the bookmark with the given name. If no name is given, the bookmarks on the current line
+// are removed, or if there are none, the user can choose a bookmark to remove.
+func (e *Editor) RemoveBookmark(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, name string) {
+	var names []string
+	if name = cleanBookmarkName(name); name != "" {
+		names = append(names, name)
+	} else {
+		for _, b := range bookmarks.At(e.lspFilename(), e.DataY()) {
+			names = append(names, b.Name)
+		}
+	}
+	if len(names) == 0 {
+		b := e.chooseBookmark(c, tty, status, "Remove bookmark")
+		if b == nil {
+			return
+		}
+		names = append(names, b.Name)
+	}
+	for _, name := range names {
+		if !bookmarks.Remove(name) {
+			status.SetErrorMessage("No bookmark named " + name)
+			status.ShowNoTimeout(c, e)
+			return
+		}
+	}
+	if err := bookmarks.Save(bookmarksFilename); err != nil {
+		status.SetError(err)
+		status.ShowNoTimeout(c, e)
+		return
+	}
+	status.SetMessageAfterRedraw("Removed bookmark " + strings.Join(names, ", "))
+}
+
+// sortedBookmarks returns the bookmarks with the ones in the current file first, by line, and then the rest by name
+func (e *Editor) sortedBookmarks() Bookmarks {
+	absFilename := e.lspFilename()
+	sorted := make(Bookmarks, len(bookmarks))
+	copy(sorted, bookmarks)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if (a.Filename == absFilename) != (b.Filename == absFilename) {
+			return a.Filename == absFilename
+		}
+		if a.Filename == absFilename {
+			return a.Line() < b.Line()
+		}
+		return a.Name < b.Name
+	})
+	return sorted
+}
+
+// chooseBookmark lets the user choose one of the bookmarks from a menu. Returns nil if there are none, or if the menu was cancelled.
+func (e *Editor) chooseBookmark(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, title string) *Bookmark {
+	if len(bookmarks) == 0 {
+		status.SetMessageAfterRedraw("No bookmarks")
+		return nil
+	}
+	sorted := e.sortedBookmarks()
+	if len(sorted) > maxBookmarkChoices {
+		title = fmt.Sprintf("%s (the first %d of %d)", title, maxBookmarkChoices, len(sorted))
+		sorted = sorted[:maxBookmarkChoices]
+	}
+	choices := make([]string, len(sorted))
+	for i, b := range sorted {
+		text := shortenText(strings.TrimSpace(b.CurrentText()), 40)
+		choices[i] = fmt.Sprintf("%s - %s:%d: %s", b.Name, shortPath(b.Filename), b.Line().LineNumber(), text)
+	}
+	choice := e.Menu(status, tty, title, choices, e.Background, e.MenuTitleColor, e.MenuArrowColor, e.MenuTextColor, e.MenuHighlightColor, e.MenuSelectedColor, 0, false)
+	e.redraw = true
+	e.redrawCursor = true
+	if choice < 0 {
+		return nil
+	}
+	return sorted[choice]
+}
+
+// BookmarkMenu lets the user choose one of the bookmarks, and jumps to it, also if it is in another file
+func (e *Editor) BookmarkMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) {
+	b := e.chooseBookmark(c, tty, status, "Bookmarks")
+	if b == nil {
+		return
+	}
+	// The line of a bookmark in another file is only known for sure after the file has been opened
+	from := e.CurrentJump()
+	if b.Filename != e.lspFilename() {
+		if err := e.Switch(c, tty, status, fileLock, b.Filename); err != nil {
+			status.SetError(err)
+			status.ShowNoTimeout(c, e)
+			return
+		}
+		e.AttachBookmarks()
+	}
+	jumpList.Add(from)
+	if err := e.GoToJump(c, tty, status, Jump{Filename: b.Filename, LineIndex: b.Line()}); err != nil {
+		status.SetError(err)
+		status.ShowNoTimeout(c, e)
+		return
+	}
+	status.SetMessageAfterRedraw("Jumped to bookmark " + b.Name)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLineMarks(t *testing.T) {
+	j := NewJournal(NewLineRope(runeLines([]string{"a", "b", "c", "d"})))
+	m := j.Mark(2) // "c"
+
+	j.InsertLine(0, []rune("new"))
+	if m.LineIndex() != 3 {
+		t.Errorf("expected the mark to move down when a line is inserted above it, got %d", m.LineIndex())
+	}
+	j.InsertLine(4, []rune("below"))
+	j.DeleteLine(0)
+	if m.LineIndex() != 2 {
+		t.Errorf("expected the mark to move up when a line is deleted above it, got %d", m.LineIndex())
+	}
+
+	// Undoing and redoing the changes also moves the mark
+	ops := j.TakeOps()
+	j.Revert(ops)
+	if m.LineIndex() != 2 {
+		t.Errorf("expected the mark to be back on line index 2 after reverting, got %d", m.LineIndex())
+	}
+	j.Apply(ops)
+	if m.LineIndex() != 2 {
+		t.Errorf("expected the mark to be on line index 2 after applying, got %d", m.LineIndex())
+	}
+
+	// Replacing the entire buffer moves the mark to the closest line with the same contents
+	j.Replace(NewLineRope(runeLines([]string{"x", "c", "y", "a", "b", "y", "c"})))
+	if m.LineIndex() != 1 {
+		t.Errorf("expected the mark to move to the closest line with the same contents, got %d", m.LineIndex())
+	}
+	j.Unmark(m)
+	j.DeleteLine(0)
+	if m.LineIndex() != 1 {
+		t.Error("expected the mark to no longer move after it has been removed")
+	}
+}
+
+func TestBookmarks(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "bookmarks.txt")
+	const absFilename = "/src/main.go"
+
+	var bs Bookmarks
+	lines := NewJournal(NewLineRope(runeLines([]string{"package main", "", "func main() {", "\tprintln(\"hi\")", "}"})))
+	bs.Set("main", absFilename, lines, 2)
+	bs.Set("print", absFilename, lines, 3)
+	bs.Set("main", absFilename, lines, 2) // the same name again moves the bookmark
+	if len(bs) != 2 || bs.Find("main") != 0 || bs.Find("print") != 1 {
+		t.Fatalf("unexpected bookmarks: %+v", bs)
+	}
+
+	lines.InsertLine(1, []rune("// Package main prints something"))
+	lines.InsertLine(1, []rune(""))
+	if got := bs.At(absFilename, 4); len(got) != 1 || got[0].Name != "main" || got[0].CurrentText() != "func main() {" {
+		t.Errorf("expected the main bookmark to follow its line, got %+v", got)
+	}
+	if err := bs.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+	if !bs.Remove("print") || bs.Remove("print") {
+		t.Error("expected the bookmark to be removed once")
+	}
+
+	loaded, err := LoadBookmarks(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 2 || loaded[0].Name != "main" || loaded[0].LineIndex != 4 || loaded[1].Text != "\tprintln(\"hi\")" {
+		t.Fatalf("unexpected bookmarks after loading: %+v", loaded)
+	}
+
+	// The file has changed since the bookmarks were saved, so the lines are found by their contents
+	changed := NewJournal(NewLineRope(runeLines([]string{"package main", "", "func main() {", "\tprintln(\"hi\")", "}"})))
+	loaded.Attach(absFilename, changed)
+	loaded.Attach("/src/other.go", NewJournal(NewLineRope(nil)))
+	if loaded[0].Line() != 2 || loaded[1].Line() != 3 {
+		t.Errorf("expected the bookmarks to be found on line index 2 and 3, got %d and %d", loaded[0].Line(), loaded[1].Line())
+	}
+	changed.DeleteLine(0)
+	if loaded[0].Line() != 1 || loaded[1].Line() != 2 {
+		t.Errorf("expected the attached bookmarks to follow their lines, got %d and %d", loaded[0].Line(), loaded[1].Line())
+	}
+}
@@ -229,3 +229,64 @@ func (e *Editor) DrawTitle(bt *BoxTheme, c *vt100.Canvas, r *Box, title string)
 	e.Say(bt, c, r.X+(r.W-len(titleWithSpaces))/2, r.Y, titleWithSpaces)
 	bt.Text = tmp
 }
+
+// ShowLines displays the given lines in a box that can be scrolled with the arrow keys,
+// until esc, return, q or ctrl-q is pressed. The lineColor function returns the color of each line,
+// and can be nil for using the text color of the box theme.
+func (e *Editor) ShowLines(c *vt100.Canvas, tty *vt100.TTY, title string, lines []string, lineColor func(bt *BoxTheme, line string) vt100.AttributeColor) {
+	bt := e.NewBoxTheme()
+	canvasBox := NewCanvasBox(c)
+	textBox := NewBox()
+	textBox.FillWithMargins(canvasBox, 2, 1)
+	listBox := NewBox()
+	listBox.FillWithMargins(textBox, 2, 1)
+	if listBox.W < 1 || listBox.H < 1 {
+		return
+	}
+
+	offset := 0
+	maxOffset := len(lines) - listBox.H
+	if maxOffset < 0 {
+		maxOffset = 0
+	}
+	for {
+		e.DrawBox(bt, c, textBox)
+		e.DrawTitle(bt, c, textBox, title)
+		for i := 0; i < listBox.H && offset+i < len(lines); i++ {
+			line := lines[offset+i]
+			if runes := []rune(line); len(runes) > listBox.W {
+				line = string(runes[:listBox.W])
+			}
+			fg := *bt.Text
+			if lineColor != nil {
+				fg = lineColor(bt, line)
+			}
+			c.Write(uint(listBox.X), uint(listBox.Y+i), fg, *bt.Background, line)
+		}
+		c.Draw()
+
+		switch ReadKey(tty) {
+		case "↑", "c:16": // up or ctrl-p
+			if offset > 0 {
+				offset--
+			}
+		case "↓", "c:14": // down or ctrl-n
+			if offset < maxOffset {
+				offset++
+			}
+		case " ", "c:4": // space or ctrl-d, one page down
+			offset += listBox.H
+			if offset > maxOffset {
+				offset = maxOffset
+			}
+		case "c:21": // ctrl-u, one page up
+			offset -= listBox.H
+			if offset < 0 {
+				offset = 0
+			}
+		case "c:27", "c:13", "q", "c:17": // esc, return, q or ctrl-q
+			e.redraw = true
+			return
+		}
+	}
+}
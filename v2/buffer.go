@@ -0,0 +1,206 @@
+package main
+
+import (
+	"math/rand"
+)
+
+// Buffer is a line-oriented document store.
+// Lines are counted from 0 and a Buffer never has gaps between the lines.
+// The rune slices that are passed in or returned must not be modified afterwards,
+// since they may be shared with copies of the buffer (for instance in the undo history).
+type Buffer interface {
+	// Len returns the number of lines
+	Len() int
+	// Line returns the line at the given index, and true if the line exists
+	Line(y int) ([]rune, bool)
+	// SetLine replaces the line at the given index. If y is after the last line,
+	// empty lines are added in between.
+	SetLine(y int, runes []rune)
+	// InsertLine inserts a line before the given index. If y is after the last line,
+	// empty lines are added in between.
+	InsertLine(y int, runes []rune)
+	// DeleteLine removes the line at the given index, and moves the lines below it up
+	DeleteLine(y int)
+	// Truncate removes all lines from the given index and out
+	Truncate(y int)
+	// Copy returns a copy of the buffer
+	Copy() Buffer
+}
+
+// LineRope is a Buffer that stores lines in an immutable, randomized and size-balanced binary tree.
+// Looking up, replacing, inserting and deleting a line all take O(log n) time,
+// and copying the entire LineRope is O(1), since the nodes are shared between copies.
+type LineRope struct {
+	root *ropeNode
+}
+
+// ropeNode is a node in a LineRope. Nodes are never modified after they have been created.
+type ropeNode struct {
+	left  *ropeNode
+	right *ropeNode
+	line  []rune
+	size  int // the number of lines in this subtree
+}
+
+// NewLineRope returns a new LineRope, containing the given lines
+func NewLineRope(lines [][]rune) *LineRope {
+	return &LineRope{buildRope(lines)}
+}
+
+// buildRope creates a perfectly balanced tree from the given lines, in O(n) time
+func buildRope(lines [][]rune) *ropeNode {
+	if len(lines) == 0 {
+		return nil
+	}
+	mid := len(lines) / 2
+	return newRopeNode(buildRope(lines[:mid]), lines[mid], buildRope(lines[mid+1:]))
+}
+
+// newRopeNode creates a new node and calculates the size of the subtree
+func newRopeNode(left *ropeNode, line []rune, right *ropeNode) *ropeNode {
+	return &ropeNode{left, right, line, left.Size() + 1 + right.Size()}
+}
+
+// Size returns the number of lines in the subtree, or 0 if n is nil
+func (n *ropeNode) Size() int {
+	if n == nil {
+		return 0
+	}
+	return n.size
+}
+
+// split returns a tree with the first k lines and a tree with the remaining lines
+func split(n *ropeNode, k int) (*ropeNode, *ropeNode) {
+	if n == nil {
+		return nil, nil
+	}
+	leftSize := n.left.Size()
+	if k <= leftSize {
+		a, b := split(n.left, k)
+		return a, newRopeNode(b, n.line, n.right)
+	}
+	a, b := split(n.right, k-leftSize-1)
+	return newRopeNode(n.left, n.line, a), b
+}
+
+// merge joins two trees, where all lines in a come before the lines in b.
+// The new root is picked at random, weighted by the size of the trees, which keeps the tree balanced.
+func merge(a, b *ropeNode) *ropeNode {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	if rand.Intn(a.size+b.size) < a.size {
+		return newRopeNode(a.left, a.line, merge(a.right, b))
+	}
+	return newRopeNode(merge(a, b.left), b.line, b.right)
+}
+
+// Len returns the number of lines
+func (r *LineRope) Len() int {
+	return r.root.Size()
+}
+
+// Line returns the line at the given index, and true if the line exists
+func (r *LineRope) Line(y int) ([]rune, bool) {
+	if y < 0 || y >= r.root.Size() {
+		return nil, false
+	}
+	n := r.root
+	for n != nil {
+		leftSize := n.left.Size()
+		switch {
+		case y < leftSize:
+			n = n.left
+		case y == leftSize:
+			return n.line, true
+		default:
+			y -= leftSize + 1
+			n = n.right
+		}
+	}
+	// This should never happen
+	return nil, false
+}
+
+// setLine returns a new tree where the line at index y has been replaced
+func setLine(n *ropeNode, y int, line []rune) *ropeNode {
+	leftSize := n.left.Size()
+	switch {
+	case y < leftSize:
+		return newRopeNode(setLine(n.left, y, line), n.line, n.right)
+	case y == leftSize:
+		return newRopeNode(n.left, line, n.right)
+	default:
+		return newRopeNode(n.left, n.line, setLine(n.right, y-leftSize-1, line))
+	}
+}
+
+// fill adds empty lines at the end, until there are at least n lines
+func (r *LineRope) fill(n int) {
+	l := r.root.Size()
+	if l >= n {
+		return
+	}
+	emptyLines := make([][]rune, n-l)
+	for i := range emptyLines {
+		emptyLines[i] = []rune{}
+	}
+	r.root = merge(r.root, buildRope(emptyLines))
+}
+
+// SetLine replaces the line at the given index.
+// If y is after the last line, empty lines are added in between.
+func (r *LineRope) SetLine(y int, runes []rune) {
+	if y < 0 {
+		return
+	}
+	if runes == nil {
+		runes = []rune{}
+	}
+	if y >= r.root.Size() {
+		r.fill(y)
+		r.root = merge(r.root, newRopeNode(nil, runes, nil))
+		return
+	}
+	r.root = setLine(r.root, y, runes)
+}
+
+// InsertLine inserts a line before the given index.
+// If y is after the last line, empty lines are added in between.
+func (r *LineRope) InsertLine(y int, runes []rune) {
+	if y < 0 {
+		return
+	}
+	if runes == nil {
+		runes = []rune{}
+	}
+	r.fill(y)
+	a, b := split(r.root, y)
+	r.root = merge(merge(a, newRopeNode(nil, runes, nil)), b)
+}
+
+// DeleteLine removes the line at the given index, and moves the lines below it up
+func (r *LineRope) DeleteLine(y int) {
+	if y < 0 || y >= r.root.Size() {
+		return
+	}
+	a, b := split(r.root, y)
+	_, b = split(b, 1)
+	r.root = merge(a, b)
+}
+
+// Truncate removes all lines from the given index and out
+func (r *LineRope) Truncate(y int) {
+	if y < 0 {
+		y = 0
+	}
+	r.root, _ = split(r.root, y)
+}
+
+// Copy returns a copy of the LineRope, in O(1) time
+func (r *LineRope) Copy() Buffer {
+	return &LineRope{r.root}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func ropeString(b Buffer) string {
+	s := ""
+	for y := 0; y < b.Len(); y++ {
+		line, _ := b.Line(y)
+		s += string(line) + "\n"
+	}
+	return s
+}
+
+func TestLineRope(t *testing.T) {
+	r := NewLineRope([][]rune{[]rune("a"), []rune("b"), []rune("c")})
+	if r.Len() != 3 {
+		t.Fatalf("expected 3 lines, got %d", r.Len())
+	}
+	r.InsertLine(1, []rune("x"))
+	if s := ropeString(r); s != "a\nx\nb\nc\n" {
+		t.Errorf("unexpected contents after InsertLine: %q", s)
+	}
+	snapshot := r.Copy()
+	r.DeleteLine(0)
+	r.SetLine(5, []rune("z"))
+	if s := ropeString(r); s != "x\nb\nc\n\n\nz\n" {
+		t.Errorf("unexpected contents after DeleteLine and SetLine: %q", s)
+	}
+	if s := ropeString(snapshot); s != "a\nx\nb\nc\n" {
+		t.Errorf("the copy was modified: %q", s)
+	}
+	r.Truncate(2)
+	if s := ropeString(r); s != "x\nb\n" {
+		t.Errorf("unexpected contents after Truncate: %q", s)
+	}
+	if _, ok := r.Line(2); ok {
+		t.Error("expected line 2 to be missing")
+	}
+}
+
+func TestLineRopeMany(t *testing.T) {
+	const n = 10000
+	var (
+		r        = NewLineRope(nil)
+		expected [][]rune
+	)
+	for i := 0; i < n; i++ {
+		line := []rune(fmt.Sprintf("%d", i))
+		y := i / 2
+		r.InsertLine(y, line)
+		expected = append(expected[:y], append([][]rune{line}, expected[y:]...)...)
+	}
+	for i := 0; i < n/2; i++ {
+		y := (i * 7) % len(expected)
+		r.DeleteLine(y)
+		expected = append(expected[:y], expected[y+1:]...)
+	}
+	if r.Len() != len(expected) {
+		t.Fatalf("expected %d lines, got %d", len(expected), r.Len())
+	}
+	for y, expectedLine := range expected {
+		if line, _ := r.Line(y); string(line) != string(expectedLine) {
+			t.Fatalf("line %d: expected %s, got %s", y, string(expectedLine), string(line))
+		}
+	}
+}
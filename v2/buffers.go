@@ -0,0 +1,353 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/xyproto/vt100"
+)
+
+// OpenBuffer is a file that is open in this session, together with its own undo history.
+// The file that is currently being edited lives in the Editor struct that the main loop uses,
+// while the other open files are kept here until they are switched to.
+type OpenBuffer struct {
+	editor          *Editor
+	undo            *Undo
+	absFilename     string
+	lockTimestamp   time.Time // when the file was locked, or a blank timestamp if it was not locked by this session
+	lockedElsewhere bool      // was the file already locked by another instance of the editor?
+	stdin           bool      // was the data read from stdin?
+}
+
+// BufferList keeps track of the files that are open in this session
+type BufferList struct {
+	buffers []*OpenBuffer
+	current int // the index of the buffer that is currently being edited
+}
+
+// The files that are open in this session
+var bufferList = &BufferList{}
+
+// Add adds a buffer to the list and makes it the current one
+func (bl *BufferList) Add(b *OpenBuffer) {
+	bl.buffers = append(bl.buffers, b)
+	bl.current = len(bl.buffers) - 1
+}
+
+// Len returns the number of open buffers
+func (bl *BufferList) Len() int {
+	return len(bl.buffers)
+}
+
+// Current returns the buffer that is currently being edited, or nil if there are no buffers
+func (bl *BufferList) Current() *OpenBuffer {
+	if bl.current < 0 || bl.current >= len(bl.buffers) {
+		return nil
+	}
+	return bl.buffers[bl.current]
+}
+
+// Index returns the index of the buffer with the given absolute filename, or -1
+func (bl *BufferList) Index(absFilename string) int {
+	for i, b := range bl.buffers {
+		if b.absFilename == absFilename && !b.stdin {
+			return i
+		}
+	}
+	return -1
+}
+
+// IndexOf returns the index of the given buffer, or -1
+func (bl *BufferList) IndexOf(b *OpenBuffer) int {
+	for i, b2 := range bl.buffers {
+		if b2 == b {
+			return i
+		}
+	}
+	return -1
+}
+
+// Stash stores a copy of the given editor and the current undo history in the current buffer,
+// so that all buffers are up to date
+func (bl *BufferList) Stash(e *Editor) {
+	if b := bl.Current(); b != nil {
+		e1 := *e
+		b.editor = &e1
+		b.undo = undo
+	}
+}
+
+// Remove removes the buffer at the given index from the list.
+// The current buffer index is adjusted so that it points to the same buffer, or the one before it.
+func (bl *BufferList) Remove(i int) {
+	bl.buffers = append(bl.buffers[:i], bl.buffers[i+1:]...)
+	if bl.current >= i && bl.current > 0 {
+		bl.current--
+	}
+}
+
+// Unsaved returns the buffers that have changes that have not been saved. Stash must be called first.
+func (bl *BufferList) Unsaved() []*OpenBuffer {
+	var unsaved []*OpenBuffer
+	for _, b := range bl.buffers {
+		if b.editor != nil && b.editor.changed && !b.stdin {
+			unsaved = append(unsaved, b)
+		}
+	}
+	return unsaved
+}
+
+// Close unlocks the file of the given buffer and saves its location and undo history
+func (b *OpenBuffer) Close(lk *LockKeeper, forced bool) {
+	if !b.lockTimestamp.IsZero() {
+		// Start by loading the lock overview, just in case something has happened in the mean time
+		lk.Load()
+		// If the file has not been locked externally since it was opened, unlock it and save the lock overview
+		if !forced || b.lockTimestamp == lk.GetTimestamp(b.absFilename) {
+			lk.Unlock(b.absFilename)
+			lk.Save()
+		}
+	}
+	if b.stdin {
+		return
+	}
+	// The unsaved changes are not kept when the file is closed
+	swapWriter.Remove(b.absFilename)
+	fileWatcher.Unwatch(b.absFilename)
+	// Save the current location in the location history and write it to file
+	b.editor.SaveLocation(b.absFilename, locationHistory)
+	// Save the undo history, so that changes can be undone the next time this file is opened
+	b.undo.SaveHistory(b.editor, b.absFilename)
+}
+
+// use replaces the current editor and undo history with the ones from the buffer at the given index
+func (e *Editor) use(i int) {
+	b := bufferList.buffers[i]
+	*e = *b.editor
+	undo = b.undo
+	bufferList.current = i
+	fnord := FilenameOrData{b.absFilename, []byte{}, 0, b.stdin}
+	fnord.SetTitle()
+	e.redraw = true
+	e.redrawCursor = true
+}
+
+// Switch replaces the current editor with the one for the given file, opening it if it is not already open.
+// Each open file keeps its own position, mode, lock and undo history.
+// The current file is saved first, if it has been changed. If that fails, the changes are still kept in memory.
+func (e *Editor) Switch(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *LockKeeper, filenameToOpen string) error {
+	if b := bufferList.Current(); b != nil && !b.stdin && e.changed && !e.readOnly {
+		if err := e.Save(c, tty); err != nil {
+			status.SetError(err)
+		}
+	}
+	const offerRecovery = true
+	return e.switchTo(c, tty, status, lk, filenameToOpen, offerRecovery)
+}
+
+// switchTo is like Switch, but the current file is not saved, only kept with its unsaved changes in the list of
+// open files. Unsaved changes from a previous session are only offered to be recovered if offerRecovery is true,
+// since that needs to read keys.
+func (e *Editor) switchTo(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *LockKeeper, filenameToOpen string, offerRecovery bool) error {
+	absFilename, err := filepath.Abs(filenameToOpen)
+	if err != nil {
+		return err
+	}
+	absFilename = filepath.Clean(absFilename)
+
+	// Is the file already being edited?
+	if b := bufferList.Current(); b != nil && b.absFilename == absFilename && !b.stdin {
+		return nil
+	}
+
+	bufferList.Stash(e)
+
+	// Is the file already open?
+	if i := bufferList.Index(absFilename); i >= 0 {
+		e.use(i)
+		return nil
+	}
+
+	fnord := FilenameOrData{filenameToOpen, []byte{}, 0, false}
+	e2, statusMessage, displayedImage, err := NewEditor(tty, c, fnord, LineNumber(0), ColNumber(0), e.Theme, e.syntaxHighlight, false, nil, nil)
+	if err != nil {
+		return err
+	} else if displayedImage {
+		return errors.New("can not edit an image: " + filenameToOpen)
+	}
+
+	// Lock the file, unless it is already being edited by another instance of the editor
+	var (
+		lockTimestamp   time.Time
+		lockedElsewhere bool
+	)
+	lk.Load()
+	if err := lk.Lock(absFilename); err == nil {
+		lk.Save()
+		lockTimestamp = lk.GetTimestamp(absFilename)
+	} else {
+		statusMessage = filepath.Base(absFilename) + " is locked by another instance of this editor"
+		lockedElsewhere = true
+	}
+
+	// Load the undo history from the previous session, if the file has not changed since then
+	u := NewUndo(undoSize, defaultUndoMemory)
+	u.LoadHistory(e2, absFilename)
+
+	bufferList.Add(&OpenBuffer{editor: e2, undo: u, absFilename: absFilename, lockTimestamp: lockTimestamp, lockedElsewhere: lockedElsewhere})
+	fileWatcher.Watch(absFilename, e2.lines.Buffer)
+	e.use(bufferList.current)
+
+	// Offer to recover unsaved changes from a previous session that did not end well
+	if !lockTimestamp.IsZero() && offerRecovery {
+		e.OfferSwapRecovery(c, tty, status, absFilename)
+	}
+
+	if statusMessage != "" {
+		status.SetMessageAfterRedraw(statusMessage)
+	}
+	return nil
+}
+
+// CloseBuffer closes the file that is currently being edited and switches to the previous one in the buffer list.
+// If there are unsaved changes, the user is asked if they should be saved first.
+// The last open file can not be closed, the editor must be quit instead.
+func (e *Editor) CloseBuffer(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *LockKeeper, forced bool) {
+	if bufferList.Len() < 2 {
+		status.SetErrorMessage("This is the only open file")
+		status.Show(c, e)
+		return
+	}
+	if e.changed {
+		menuChoices := []string{"Save and close", "Close without saving"}
+		switch e.Menu(status, tty, "Unsaved changes in "+filepath.Base(e.filename), menuChoices, e.Background, e.MenuTitleColor, e.MenuArrowColor, e.MenuTextColor, e.MenuHighlightColor, e.MenuSelectedColor, 0, false) {
+		case 0:
+			if err := e.Save(c, tty); err != nil {
+				status.SetError(err)
+				status.Show(c, e)
+				return
+			}
+		case 1:
+		default:
+			e.redraw = true
+			return
+		}
+	}
+	bufferList.Stash(e)
+	i := bufferList.current
+	bufferList.buffers[i].Close(lk, forced)
+	bufferList.Remove(i)
+	e.use(bufferList.current)
+}
+
+// bufferTitle returns the title of the given buffer, for use in menus
+func bufferTitle(b *OpenBuffer) string {
+	title := b.absFilename
+	if wd, err := filepath.Abs("."); err == nil {
+		if rel, err := filepath.Rel(wd, b.absFilename); err == nil && !strings.HasPrefix(rel, "..") {
+			title = rel
+		}
+	}
+	if b.stdin {
+		title = "stdin"
+	}
+	if b.editor != nil && b.editor.changed {
+		title += " (modified)"
+	}
+	return title
+}
+
+// OpenFilePrompt asks the user for a filename, then opens that file in a new buffer
+func (e *Editor) OpenFilePrompt(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *LockKeeper) {
+	filename, ok := e.UserInput(c, tty, status, "Open file", []string{}, false)
+	if !ok || strings.TrimSpace(filename) == "" {
+		status.ClearAll(c)
+		return
+	}
+	fnord := FilenameOrData{strings.TrimSpace(filename), []byte{}, 0, false}
+	fnord.ExpandUser()
+	if err := e.Switch(c, tty, status, lk, fnord.filename); err != nil {
+		status.SetError(err)
+		status.ShowNoTimeout(c, e)
+	}
+}
+
+// BufferMenu lists the open files, and lets the user switch to one of them, open another file
+// or close the current file
+func (e *Editor) BufferMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *LockKeeper, forced bool) {
+	bufferList.Stash(e)
+	var menuChoices []string
+	for _, b := range bufferList.buffers {
+		menuChoices = append(menuChoices, bufferTitle(b))
+	}
+	openIndex := len(menuChoices)
+	menuChoices = append(menuChoices, "Open another file...")
+	closeIndex := len(menuChoices)
+	menuChoices = append(menuChoices, "Close "+filepath.Base(e.filename))
+	title := fmt.Sprintf("%d open files", bufferList.Len())
+	selected := e.Menu(status, tty, title, menuChoices, e.Background, e.MenuTitleColor, e.MenuArrowColor, e.MenuTextColor, e.MenuHighlightColor, e.MenuSelectedColor, bufferList.current, false)
+	switch {
+	case selected < 0:
+	case selected == openIndex:
+		e.OpenFilePrompt(c, tty, status, lk)
+	case selected == closeIndex:
+		e.CloseBuffer(c, tty, status, lk, forced)
+	case selected != bufferList.current:
+		e.use(selected)
+	}
+	e.redraw = true
+	e.redrawCursor = true
+}
+
+// ConfirmQuit asks the user what to do if more than one file is open and some of them have unsaved changes.
+// Returns false if the user cancels quitting.
+func (e *Editor) ConfirmQuit(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) bool {
+	if bufferList.Len() < 2 {
+		return true
+	}
+	bufferList.Stash(e)
+	unsaved := bufferList.Unsaved()
+	if len(unsaved) == 0 {
+		return true
+	}
+	names := make([]string, len(unsaved))
+	for i, b := range unsaved {
+		names[i] = filepath.Base(b.absFilename)
+	}
+	menuChoices := []string{"Save all and quit", "Quit without saving", "Cancel"}
+	switch e.Menu(status, tty, "Unsaved changes in "+strings.Join(names, ", "), menuChoices, e.Background, e.MenuTitleColor, e.MenuArrowColor, e.MenuTextColor, e.MenuHighlightColor, e.MenuSelectedColor, 0, false) {
+	case 0:
+		for _, b := range unsaved {
+			if b == bufferList.Current() {
+				if err := e.Save(c, tty); err != nil {
+					status.SetError(err)
+					status.ShowNoTimeout(c, e)
+					return false
+				}
+				continue
+			}
+			if err := b.editor.Save(c, tty); err != nil {
+				status.SetError(err)
+				status.ShowNoTimeout(c, e)
+				return false
+			}
+		}
+		return true
+	case 1:
+		return true
+	}
+	e.redraw = true
+	e.redrawCursor = true
+	return false
+}
+
+// CloseAllBuffers unlocks all open files and saves their locations and undo histories, for when quitting
+func (e *Editor) CloseAllBuffers(lk *LockKeeper, forced bool) {
+	bufferList.Stash(e)
+	for _, b := range bufferList.buffers {
+		b.Close(lk, forced)
+	}
+}
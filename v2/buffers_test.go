@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestBufferList(t *testing.T) {
+	defer func(bl *BufferList, u *Undo) {
+		bufferList, undo = bl, u
+	}(bufferList, undo)
+	bufferList = &BufferList{}
+
+	e1 := NewSimpleEditor(80)
+	e1.SetLine(0, "first")
+	undo1 := NewUndo(10, 0)
+	bufferList.Add(&OpenBuffer{editor: e1, undo: undo1, absFilename: "/tmp/first.txt"})
+
+	e2 := NewSimpleEditor(80)
+	e2.SetLine(0, "second")
+	e2.changed = false
+	undo2 := NewUndo(10, 0)
+	bufferList.Add(&OpenBuffer{editor: e2, undo: undo2, absFilename: "/tmp/second.txt"})
+
+	if bufferList.Len() != 2 || bufferList.Index("/tmp/first.txt") != 0 || bufferList.Index("/tmp/missing.txt") != -1 {
+		t.Fatal("unexpected buffer list contents")
+	}
+
+	// Edit the second buffer, then switch to the first one
+	e := NewSimpleEditor(80)
+	*e = *e2
+	undo = undo2
+	e.SetLine(0, "changed")
+	if err := e.switchTo(nil, nil, nil, nil, "/tmp/first.txt", false); err != nil {
+		t.Fatal(err)
+	}
+	if e.Line(0) != "first" || undo != undo1 || bufferList.current != 0 {
+		t.Errorf("expected the first buffer to be in use, got %q", e.Line(0))
+	}
+
+	// The changes to the second buffer are kept
+	e.use(1)
+	if e.Line(0) != "changed" || undo != undo2 {
+		t.Errorf("expected the changes to the second buffer to be kept, got %q", e.Line(0))
+	}
+	bufferList.Stash(e)
+	if unsaved := bufferList.Unsaved(); len(unsaved) != 2 {
+		t.Errorf("expected both buffers to have unsaved changes, got %d", len(unsaved))
+	}
+
+	bufferList.Remove(1)
+	if bufferList.Len() != 1 || bufferList.current != 0 || bufferList.Current().absFilename != "/tmp/first.txt" {
+		t.Error("expected only the first buffer to be left")
+	}
+}
@@ -695,6 +695,7 @@ func (e *Editor) BuildOrExport(c *vt100.Canvas, tty *vt100.TTY, status *StatusBa
 								// Move to (x, y), line number first and then column number
 								if i, err := strconv.Atoi(lineNumberString); err == nil {
 									foundY := LineIndex(i - 1)
+									e.RecordJump()
 									e.redraw, _ = e.GoTo(foundY, c, status)
 									e.redrawCursor = e.redraw
 									if x, err := strconv.Atoi(lineColumnString); err == nil { // no error
@@ -844,6 +845,7 @@ func (e *Editor) BuildOrExport(c *vt100.Canvas, tty *vt100.TTY, status *StatusBa
 					// Move to (x, y), line number first and then column number
 					if i, err := strconv.Atoi(lineNumberString); err == nil {
 						foundY := LineIndex(i - 1)
+						e.RecordJump()
 						e.redraw, _ = e.GoTo(foundY, c, status)
 						e.redrawCursor = e.redraw
 						if x, err := strconv.Atoi(lineColumnString); err == nil { // no error
@@ -867,6 +869,7 @@ func (e *Editor) BuildOrExport(c *vt100.Canvas, tty *vt100.TTY, status *StatusBa
 
 					if i, err := strconv.Atoi(parts[2]); err == nil {
 						foundY := LineIndex(i - 1)
+						e.RecordJump()
 						e.redraw, _ = e.GoTo(foundY, c, status)
 						e.redrawCursor = e.redraw
 					}
@@ -903,6 +906,7 @@ func (e *Editor) BuildOrExport(c *vt100.Canvas, tty *vt100.TTY, status *StatusBa
 			if y, err := strconv.Atoi(fields[1]); err == nil { // no error
 
 				foundY := LineIndex(y - 1)
+				e.RecordJump()
 				e.redraw, _ = e.GoTo(foundY, c, status)
 				e.redrawCursor = e.redraw
 
@@ -936,6 +940,7 @@ func (e *Editor) BuildOrExport(c *vt100.Canvas, tty *vt100.TTY, status *StatusBa
 				var foundY LineIndex
 				if y, err := strconv.Atoi(fields[1]); err == nil { // no error
 					foundY = LineIndex(y - 1)
+					e.RecordJump()
 					e.redraw, _ = e.GoTo(foundY, c, status)
 					e.redrawCursor = e.redraw
 					foundX := -1
@@ -976,6 +981,7 @@ func (e *Editor) BuildOrExport(c *vt100.Canvas, tty *vt100.TTY, status *StatusBa
 					var foundY LineIndex
 					if y, err := strconv.Atoi(errorY); err == nil { // no error
 						foundY = LineIndex(y - 1)
+						e.RecordJump()
 						e.redraw, _ = e.GoTo(foundY, c, status)
 						e.redrawCursor = e.redraw
 						foundX := -1
@@ -270,7 +270,6 @@ func (e *Editor) GenerateCodeOrText(c *vt100.Canvas, status *StatusBar, bookmark
 				e.SetCurrentLine(currentLeadingWhitespace + e.AddSpaceAfterComments(generatedLine))
 			}
 			// "refresh"
-			e.MakeConsistent()
 			e.DrawLines(c, true, false)
 			e.redrawCursor = true
 		}); err != nil {
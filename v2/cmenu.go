@@ -54,7 +54,11 @@ func NewActions2(actionTitles []string, actionFunctions []func()) (*Actions, err
 // UserSave saves the file and the location history
 func (e *Editor) UserSave(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) {
 	// Save the file
-	if err := e.Save(c, tty); err != nil {
+	err := e.Save(c, tty)
+	if err != nil && e.OfferPrivilegedSave(c, tty, status, err) {
+		err = e.Save(c, tty)
+	}
+	if err != nil {
 		status.SetError(err)
 		status.Show(c, e)
 		return
@@ -134,8 +138,111 @@ func (e *Editor) CommandMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar,
 	// TODO: Create a string->[]string map from title to command, then add them
 	// TODO: Add the 6 first arguments to a context struct instead
 	actions.AddCommand(e, c, tty, status, bookmark, undo, "Save and quit", "savequitclear")
+	// List, switch between and close the open files, if there are more than one
+	if bufferList.Len() > 1 {
+		actions.Add(fmt.Sprintf("Switch between the %d open files...", bufferList.Len()), func() {
+			e.BufferMenu(c, tty, status, lk, forced)
+		})
+	}
+	actions.Add("Open another file...", func() {
+		e.OpenFilePrompt(c, tty, status, lk)
+	})
+	actions.Add("Save as...", func() {
+		e.SaveAsPrompt(c, tty, status, lk, "", false)
+	})
+	if b := bufferList.Current(); b != nil && !b.stdin {
+		actions.Add("Rename...", func() {
+			e.SaveAsPrompt(c, tty, status, lk, "", true)
+		})
+	}
+	// Make it possible to edit and save a read-only file that belongs to another user, like /etc/fstab
+	if e.CanEditPrivileged() {
+		actions.Add("Edit with "+elevationName(), func() {
+			e.EditPrivileged()
+			status.SetMessageAfterRedraw(e.filename + " will be saved with " + elevationName())
+		})
+	}
+	// Split the view, so that two parts of a file, or two files, can be seen at the same time
+	actions.Add("Split the view horizontally", func() {
+		e.SplitPane(c, status, false)
+	})
+	actions.Add("Split the view vertically", func() {
+		e.SplitPane(c, status, true)
+	})
+	if panes.Split() {
+		actions.Add("Close the current pane", func() {
+			e.ClosePane(c)
+		})
+	}
+	// Convert between LF and CRLF line endings
+	if !e.binaryFile {
+		if e.lineEndings != LF {
+			actions.AddCommand(e, c, tty, status, bookmark, undo, "Convert the line endings from "+e.lineEndings.String()+" to LF", "tolf")
+		}
+		if e.lineEndings != CRLF {
+			actions.AddCommand(e, c, tty, status, bookmark, undo, "Convert the line endings from "+e.lineEndings.String()+" to CRLF", "tocrlf")
+		}
+	}
+	// Save the file as UTF-8 from now on, if it was loaded with another charset
+	if !isUTF8(e.charset) && !e.binaryFile {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Convert from "+charsetName(e.charset)+" to UTF-8", "toutf8")
+	}
 	actions.AddCommand(e, c, tty, status, bookmark, undo, "Sort strings on the current line", "sortwords")
-	actions.AddCommand(e, c, tty, status, bookmark, undo, "Sort the current block of lines", "sortblock")
+	if e.HasSelection() {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Sort the selected lines", "sortblock")
+		// Let the user type in a command, like "!sort -r", that the selected text is filtered through
+		actions.Add("Filter the selected text through a command...", func() {
+			e.CommandPrompt(c, tty, status, bookmark, undo)
+		})
+	} else {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Sort the current block of lines", "sortblock")
+	}
+
+	// Add cursors at every match of the current search term, for editing all of the matches at once
+	if searchTerm := e.SearchTerm(); !e.readOnly && (searchTerm != "" || e.stickySearchTerm != "") {
+		if searchTerm == "" {
+			searchTerm = e.stickySearchTerm
+		}
+		actions.Add("Add cursors at every match of \""+searchTerm+"\"", func() {
+			n := e.AddCursorsAtMatches(c, status, searchTerm)
+			status.SetMessageAfterRedraw(fmt.Sprintf("Placed cursors at %d matches", n))
+		})
+	}
+
+	// Ask the language server about the symbol at the cursor, if there is a language server for this file
+	if e.HasLanguageServer() {
+		if word := e.WordAtCursor(); word != "" {
+			actions.AddCommand(e, c, tty, status, bookmark, undo, "Find references to "+word, "references")
+			actions.AddCommand(e, c, tty, status, bookmark, undo, "Show information about "+word, "hover")
+			if !e.readOnly {
+				actions.AddCommand(e, c, tty, status, bookmark, undo, "Rename "+word+"...", "renamesymbol")
+			}
+		}
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Show the problems found by "+filepath.Base(e.languageServerCommand()[0]), "diagnostics")
+	}
+
+	// Named bookmarks, that are remembered between sessions and can be in any file
+	if e.lspFilename() != "" {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Add a named bookmark...", "bookmark")
+	}
+	if len(bookmarks) > 0 {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Go to a bookmark...", "bookmarks")
+		if len(bookmarks.At(e.lspFilename(), e.DataY())) > 0 {
+			actions.AddCommand(e, c, tty, status, bookmark, undo, "Remove the bookmark on this line", "unbookmark")
+		} else {
+			actions.AddCommand(e, c, tty, status, bookmark, undo, "Remove a bookmark...", "unbookmark")
+		}
+	}
+
+	// Write or update the tag file that ctrl-g uses for going to definitions, if universal-ctags is installed
+	if e.lspFilename() != "" && universalCtags() != "" {
+		if e.HasTags() {
+			actions.AddCommand(e, c, tty, status, bookmark, undo, "Update the tags", "ctags")
+		} else {
+			actions.AddCommand(e, c, tty, status, bookmark, undo, "Generate tags with ctags", "ctags")
+		}
+	}
+
 	actions.AddCommand(e, c, tty, status, bookmark, undo, "Insert \""+insertFilename+"\" at the current line", "insertfile", insertFilename)
 	actions.AddCommand(e, c, tty, status, bookmark, undo, "Insert the current date", "insertdate") // in the RFC 3339 format
 	actions.AddCommand(e, c, tty, status, bookmark, undo, "Insert the current time", "inserttime")
@@ -221,11 +328,7 @@ func (e *Editor) CommandMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar,
 			if f, err = os.CreateTemp(tempDir, "__o*"+"guessica"); err == nil {
 				// no error, everything is fine
 				tempFilename = f.Name()
-				// TODO: Implement e.SaveAs
-				oldFilename := e.filename
-				e.filename = tempFilename
-				err = e.Save(c, tty)
-				e.filename = oldFilename
+				err = e.SaveCopy(c, tty, tempFilename)
 			}
 			if err != nil {
 				status.SetError(err)
@@ -347,31 +450,22 @@ func (e *Editor) CommandMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar,
 	// Delete the rest of the file
 	actions.Add("Delete the rest of the file", func() { // copy file to clipboard
 
-		prepareFunction := func() {
+		// Get the current index and remove the rest of the lines
+		currentLineIndex := int(e.DataY())
+
+		// Only make changes if there are lines to be removed
+		if currentLineIndex < e.lines.Len() {
 			// Prepare to delete all lines from this one and out
 			undo.Snapshot(e)
 			// Also close the portal, if any
 			e.ClosePortal()
 			// Mark the file as changed
 			e.changed = true
-		}
 
-		// Get the current index and remove the rest of the lines
-		currentLineIndex := int(e.DataY())
-
-		for y := range e.lines {
-			if y >= currentLineIndex {
-				// Run the prepareFunction, but only once, if there was changes to be made
-				if prepareFunction != nil {
-					prepareFunction()
-					prepareFunction = nil
-				}
-				delete(e.lines, y)
-			}
+			e.lines.Truncate(currentLineIndex)
 		}
 
 		if e.changed {
-			e.MakeConsistent()
 			e.redraw = true
 			e.redrawCursor = true
 		}
@@ -497,6 +591,8 @@ func (e *Editor) CommandMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar,
 		})
 	}
 
+	actions.AddCommand(e, c, tty, status, bookmark, undo, "Show the key bindings", "keys")
+
 	searchProcessNames := []string{"ag", "find", "rg"}
 
 	// Only show the menu option for killing the parent process if the parent process is "ag", "find" or "rg"
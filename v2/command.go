@@ -33,7 +33,12 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 				cmd.Args = args[1:]
 			}
 
-			// Now run the cmd with the current block of lines as input
+			// Now run the cmd with the selected text, or the current block of lines, as input
+			input := e.Block(e.LineIndex())
+			hasSelection := e.HasSelection()
+			if hasSelection {
+				input = e.SelectedText()
+			}
 			stdin, err := cmd.StdinPipe()
 			if err != nil {
 				status.Clear(c)
@@ -43,7 +48,7 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 			}
 			go func() {
 				defer stdin.Close()
-				io.WriteString(stdin, e.Block(e.LineIndex()))
+				io.WriteString(stdin, input)
 			}()
 
 			// Gather the output in the same way as CombinedOutput and Run
@@ -94,6 +99,10 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 			}
 
 			undo.Snapshot(e)
+			if hasSelection {
+				e.ReplaceSelection(c, status, bookmark, outputString)
+				return
+			}
 			e.ReplaceBlock(c, status, bookmark, outputString)
 		}, nil
 	}
@@ -104,6 +113,12 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 		if len(args) != 2 {
 			return nil, fmt.Errorf("%s requires a filename as the second argument", trimmedCommand)
 		}
+	case "bookmark", "mark", "bm", "unbookmark", "unmark", "delmark", "rmbookmark":
+		// the bookmark name may contain spaces
+	case "saveas", "sas", "as", "rename", "ren", "mv", "move":
+		if len(args) > 2 {
+			return nil, fmt.Errorf("%s takes a filename as the only argument", trimmedCommand)
+		}
 	default:
 		if len(args) != 1 {
 			return nil, fmt.Errorf("%s takes no arguments", args[0])
@@ -112,23 +127,43 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 
 	const (
 		nothing = iota
+		addbookmark
 		build
+		bookmarkmenu
 		copyall
+		diagnostics
+		generatetags
 		help
+		hover
 		insertdate
 		insertfile
 		inserttime
+		keys
 		quit
+		references
+		removebookmark
+		rename
+		renamesymbol
 		save
+		saveas
 		savequit
 		savequitclear
 		sortblock
 		sortstrings
+		tocrlf
+		tolf
+		toutf8
 		version
 	)
 
 	// Define args and corresponding functions
 	commandLookup := map[int]func(){
+		addbookmark: func() { // add a named bookmark for the current line, the name is asked for if not given
+			e.AddBookmark(c, tty, status, strings.Join(args[1:], " "))
+		},
+		bookmarkmenu: func() { // choose a bookmark and jump to it, also in other files
+			e.BookmarkMenu(c, tty, status)
+		},
 		build: func() { // build
 			if e.Empty() {
 				// Empty file, nothing to build
@@ -169,9 +204,18 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 				status.SetMessageAfterRedraw("Copied everything")
 			}
 		},
+		diagnostics: func() { // list the problems that the language server has found
+			e.ShowDiagnostics(c, tty, status)
+		},
+		generatetags: func() { // write or update the tag file for the current project, with universal-ctags
+			e.GenerateTagsFile(c, status)
+		},
 		help: func() { // display an informative status message
 			// TODO: Draw the same type of box that is used in debug mode, listing all possible commands
-			status.SetMessageAfterRedraw("sq, wq, savequit, s, save, q, quit, h, help, sort, v, version, date, insertfile [filename], build")
+			status.SetMessageAfterRedraw("sq, wq, savequit, s, save, q, quit, h, help, sort, v, version, date, insertfile [filename], saveas [filename], rename [filename], build, keys, references, hover, renamesymbol, diagnostics, ctags, bookmark [name], bookmarks, unbookmark [name], utf8, lf, crlf")
+		},
+		hover: func() { // show information about the symbol at the cursor, from the language server
+			e.ShowHover(c, tty, status)
 		},
 		insertdate: func() { // insert the current date
 			undo.Snapshot(e)
@@ -198,9 +242,35 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 			e.InsertString(c, timeString)
 			e.addSpace = true
 		},
+		keys: func() { // show the effective key bindings
+			e.ShowKeyBindings(c, tty)
+		},
+		references: func() { // find the places where the symbol at the cursor is used, with the language server
+			e.FindReferences(c, tty, status)
+		},
+		removebookmark: func() { // remove the named bookmark, or the bookmarks on the current line
+			e.RemoveBookmark(c, tty, status, strings.Join(args[1:], " "))
+		},
+		rename: func() { // rename the current file, the new filename is asked for if not given
+			var newFilename string
+			if len(args) > 1 {
+				newFilename = args[1]
+			}
+			e.SaveAsPrompt(c, tty, status, fileLock, newFilename, true)
+		},
+		renamesymbol: func() { // rename the symbol at the cursor everywhere, with the language server
+			e.RenameSymbol(c, tty, status)
+		},
 		save: func() { // save the current file
 			e.UserSave(c, tty, status)
 		},
+		saveas: func() { // save the current file with a new name, the new filename is asked for if not given
+			var newFilename string
+			if len(args) > 1 {
+				newFilename = args[1]
+			}
+			e.SaveAsPrompt(c, tty, status, fileLock, newFilename, false)
+		},
 		savequit: func() { // save and quit
 			e.UserSave(c, tty, status)
 			e.quit = true
@@ -210,8 +280,12 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 			e.quit = true
 			e.clearOnQuit = true
 		},
-		sortblock: func() { // sort the current block of lines, until the next blank line or EOF
+		sortblock: func() { // sort the selected lines, or the current block of lines, until the next blank line or EOF
 			undo.Snapshot(e)
+			if e.HasSelection() {
+				e.SortSelection(c, status)
+				return
+			}
 			e.SortBlock(c, status, bookmark)
 		},
 		sortstrings: func() { // sort the words on the current line
@@ -220,6 +294,24 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 			e.redraw = true
 			e.redrawCursor = true
 		},
+		tocrlf: func() { // save the file with CRLF line endings from now on
+			e.ConvertLineEndings(CRLF)
+			status.SetMessageAfterRedraw("The file will be saved with CRLF line endings")
+		},
+		tolf: func() { // save the file with LF line endings from now on
+			e.ConvertLineEndings(LF)
+			status.SetMessageAfterRedraw("The file will be saved with LF line endings")
+		},
+		toutf8: func() { // save the file as UTF-8 from now on
+			if isUTF8(e.charset) {
+				status.SetMessageAfterRedraw("Already UTF-8")
+				return
+			}
+			status.SetMessageAfterRedraw("Converted from " + charsetName(e.charset) + " to UTF-8")
+			e.charset = "utf-8"
+			e.changed = true
+			e.redraw = true
+		},
 		quit: func() { // quit
 			e.quit = true
 		},
@@ -248,16 +340,44 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 		functionID = insertdate
 	case "inserttime", "time", "t", "ti", "tim":
 		functionID = inserttime
+	case "keys", "k", "keybindings", "bindings", "keymap":
+		functionID = keys
+	case "references", "refs", "ref", "usages":
+		functionID = references
+	case "hover", "info", "doc":
+		functionID = hover
+	case "renamesymbol", "renames", "rs":
+		functionID = renamesymbol
+	case "bookmark", "mark", "bm":
+		functionID = addbookmark
+	case "bookmarks", "marks", "bms":
+		functionID = bookmarkmenu
+	case "unbookmark", "unmark", "delmark", "rmbookmark":
+		functionID = removebookmark
+	case "diagnostics", "diag", "problems", "errors":
+		functionID = diagnostics
+	case "ctags", "tags", "generatetags", "gentags":
+		functionID = generatetags
 	case "qs", "byes", "cus", "exitsave", "quitandsave", "quitsave", "qw", "saq", "saveandquit", "saveexit", "saveq", "savequit", "savq", "sq", "wq", "↑":
 		functionID = savequit
 	case "s", "sa", "sav", "save", "w", "ww", "↓":
 		functionID = save
+	case "saveas", "sas", "as":
+		functionID = saveas
+	case "rename", "ren", "mv", "move":
+		functionID = rename
 	case "sb", "so", "sor", "sort", "sortblock":
 		functionID = sortblock
 	case "sortstrings", "sortw", "sortwords", "sow", "ss", "sw", "sortfields", "sf":
 		functionID = sortstrings
 	case "sqc", "savequitclear":
 		functionID = savequitclear
+	case "crlf", "tocrlf", "dos", "unix2dos":
+		functionID = tocrlf
+	case "lf", "tolf", "unix", "dos2unix":
+		functionID = tolf
+	case "utf8", "utf-8", "toutf8", "u8":
+		functionID = toutf8
 	case "v", "ver", "vv", "version":
 		functionID = version
 	default:
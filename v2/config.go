@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/xyproto/mode"
+)
+
+// projectConfigName is the name of the per-project configuration files, that are looked for
+// in the directory of the edited file and in the directories above it
+const projectConfigName = ".o.toml"
+
+var (
+	// configFilename is the user configuration file
+	configFilename = filepath.Join(userConfigDir, "o", "config.toml")
+
+	// commandSettings are the per-mode settings that run commands, which are only read from the user configuration file
+	commandSettings = map[string]bool{"formatter": true, "language_server": true}
+)
+
+// Config contains the settings from the user configuration file and the per-project configuration files
+// that apply to a file. Settings that run commands, like formatter and language_server, can only be set in the
+// user configuration file, so that opening a file in a cloned repository can not run commands. The files use
+// a simple subset of TOML, with "key = value" lines and [mode] sections:
+//
+//	theme = "synthwave"
+//	scroll_speed = 10
+//	wrap_width = 100
+//	undo_size = 4096
+//	rainbow_parentheses = true
+//	write_to_cache = true
+//
+//	[python]
+//	indent_style = "space"
+//	indent_size = 4
+//	formatter = "black -q"
+//	language_server = "pylsp"
+//
+//	[keys]
+//	ctrl-z = "none"
+//	"ctrl-]" = "build"
+//
+// Unset values are blank, 0 or nil.
+type Config struct {
+	theme              string                    // the name of a theme, like in O_THEME
+	scrollSpeed        int                       // the number of lines to scroll with ctrl-n and ctrl-p
+	wrapWidth          int                       // the column to word wrap at
+	undoSize           int                       // the number of undo actions to keep
+	rainbowParentheses *bool                     // should parentheses be colored by how deep they are nested?
+	writeToCache       *bool                     // should the location history, swap files and so on be written?
+	modes              map[mode.Mode]*modeConfig // per-mode settings
+	keys               map[string]string         // key bindings, from keys as returned by ReadKey to action names
+}
+
+// modeConfig contains the settings for a single mode
+type modeConfig struct {
+	indentStyle        string   // "space" or "tab"
+	indentSize         int      // the number of spaces per indentation level, or the width of a tab
+	wrapWidth          int      // the column to word wrap at
+	rainbowParentheses *bool    // should parentheses be colored by how deep they are nested?
+	formatter          []string // the formatting command, that is given the filename as the last argument
+	languageServer     []string // the language server command, or "none"
+}
+
+// FindConfig reads the user configuration file and then the .o.toml files from the outermost directory
+// down to the directory of the given file, where the files closer to the given file take precedence.
+// Files that do not exist are skipped. Returns the collected settings, and the first error, if any.
+func FindConfig(filename string) (*Config, error) {
+	configFiles := []string{configFilename}
+	if absFilename, err := filepath.Abs(filename); err == nil {
+		var projectFiles []string
+		for dir := filepath.Dir(absFilename); ; dir = filepath.Dir(dir) {
+			projectFiles = append(projectFiles, filepath.Join(dir, projectConfigName))
+			if parent := filepath.Dir(dir); parent == dir {
+				break
+			}
+		}
+		// Apply the outermost file first
+		for i := len(projectFiles) - 1; i >= 0; i-- {
+			configFiles = append(configFiles, projectFiles[i])
+		}
+	}
+	cfg := &Config{}
+	var firstErr error
+	for _, configFile := range configFiles {
+		trusted := configFile == configFilename
+		if err := cfg.readFile(configFile, trusted); err != nil && !os.IsNotExist(err) && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return cfg, firstErr
+}
+
+// readFile reads the settings from the given configuration file, on top of the current settings.
+// Settings that run commands are only accepted if the file is trusted.
+// Lines with errors are skipped, and the first error is returned.
+func (cfg *Config) readFile(configFile string, trusted bool) error {
+	f, err := os.Open(configFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var (
+		section  string
+		firstErr error
+		y        int
+	)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		y++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.ToLower(strings.TrimSpace(line[1 : len(line)-1]))
+			continue
+		}
+		if err := cfg.setLine(section, line, trusted); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("%s:%d: %w", configFile, y, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return firstErr
+}
+
+// setLine parses a "key = value" line and applies the setting.
+// Settings that run commands are only accepted if the line is from a trusted file.
+func (cfg *Config) setLine(section, line string, trusted bool) error {
+	// Keys may be quoted, and then they may contain "="
+	i := strings.Index(line, "=")
+	if strings.HasPrefix(line, "\"") || strings.HasPrefix(line, "'") {
+		if end := quoteEnd(line); end >= 0 {
+			i = strings.Index(line[end:], "=")
+			if i >= 0 {
+				i += end
+			}
+		}
+	}
+	if i < 0 {
+		return fmt.Errorf("expected key = value, got %q", line)
+	}
+	fields := []string{line[:i], line[i+1:]}
+	key, err := configString(fields[0])
+	if err != nil {
+		return err
+	}
+	value, err := configString(fields[1])
+	if err != nil {
+		return err
+	}
+	if section == "keys" {
+		return cfg.bindKey(key, value)
+	}
+	key = strings.ToLower(key)
+	if section == "" {
+		return cfg.set(key, value)
+	}
+	m, ok := modeByName(section)
+	if !ok {
+		return fmt.Errorf("unknown mode: %s", section)
+	}
+	if commandSettings[key] && !trusted {
+		return fmt.Errorf("%s can only be set in %s", key, configFilename)
+	}
+	if cfg.modes == nil {
+		cfg.modes = make(map[mode.Mode]*modeConfig)
+	}
+	mc, ok := cfg.modes[m]
+	if !ok {
+		mc = &modeConfig{}
+		cfg.modes[m] = mc
+	}
+	return mc.set(key, value)
+}
+
+// set applies a setting that is not specific to a mode
+func (cfg *Config) set(key, value string) error {
+	var err error
+	switch key {
+	case "theme":
+		cfg.theme = strings.ToLower(value)
+	case "scroll_speed":
+		cfg.scrollSpeed, err = configPositive(value)
+	case "wrap_width":
+		cfg.wrapWidth, err = configPositive(value)
+	case "undo_size":
+		cfg.undoSize, err = configPositive(value)
+	case "rainbow_parentheses":
+		cfg.rainbowParentheses, err = configBool(value)
+	case "write_to_cache":
+		cfg.writeToCache, err = configBool(value)
+	default:
+		return fmt.Errorf("unknown setting: %s", key)
+	}
+	return err
+}
+
+// bindKey binds the given key to the given action, from a line in the [keys] section
+func (cfg *Config) bindKey(keyString, actionName string) error {
+	key, actionName, err := parseKeyBinding(keyString, actionName)
+	if err != nil {
+		return err
+	}
+	if cfg.keys == nil {
+		cfg.keys = make(map[string]string)
+	}
+	cfg.keys[key] = actionName
+	return nil
+}
+
+// set applies a setting for a mode
+func (mc *modeConfig) set(key, value string) error {
+	var err error
+	switch key {
+	case "indent_style":
+		if value = strings.ToLower(value); value != "space" && value != "tab" {
+			return fmt.Errorf("indent_style must be \"space\" or \"tab\", not %q", value)
+		}
+		mc.indentStyle = value
+	case "indent_size":
+		mc.indentSize, err = configPositive(value)
+	case "wrap_width":
+		mc.wrapWidth, err = configPositive(value)
+	case "rainbow_parentheses":
+		mc.rainbowParentheses, err = configBool(value)
+	case "formatter":
+		mc.formatter = strings.Fields(value)
+	case "language_server":
+		mc.languageServer = strings.Fields(value)
+	default:
+		return fmt.Errorf("unknown setting: %s", key)
+	}
+	return err
+}
+
+// quoteEnd returns the index of the quote that ends the quoted string at the start of s, or -1.
+// Backslashes escape characters in strings with double quotes, but not in strings with single quotes.
+func quoteEnd(s string) int {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		if s[i] == '\\' && quote == '"' {
+			i++
+		} else if s[i] == quote {
+			return i
+		}
+	}
+	return -1
+}
+
+// configString trims a key or a value, and removes the quotes around it, if any.
+// Comments that start with # after the value are removed.
+func configString(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "\"") && !strings.HasPrefix(s, "'") {
+		if i := strings.Index(s, "#"); i >= 0 {
+			s = strings.TrimSpace(s[:i])
+		}
+		return s, nil
+	}
+	end := quoteEnd(s)
+	if end < 0 {
+		return "", fmt.Errorf("missing end quote: %s", s)
+	}
+	if rest := strings.TrimSpace(s[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+		return "", fmt.Errorf("unexpected text after the quote: %s", rest)
+	}
+	if s[0] == '\'' {
+		return s[1:end], nil
+	}
+	return strconv.Unquote(s[:end+1])
+}
+
+// configPositive parses a positive number
+func configPositive(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("expected a positive number, got %q", value)
+	}
+	return n, nil
+}
+
+// configBool parses true or false
+func configBool(value string) (*bool, error) {
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("expected true or false, got %q", value)
+	}
+	return &b, nil
+}
+
+// modeByName finds the mode with the given name, like "go" or "c++", or with the given file extension, like "py"
+func modeByName(name string) (mode.Mode, bool) {
+	name = strings.ToLower(name)
+	for m := mode.Mode(mode.Blank + 1); m <= mode.Zig; m++ {
+		if s := strings.ToLower(m.String()); s == name || strings.ReplaceAll(s, " ", "") == name {
+			return m, true
+		}
+	}
+	if m := mode.Detect("file." + name); m != mode.Blank {
+		return m, true
+	}
+	return mode.Blank, false
+}
+
+// mode returns the settings for the given mode, or nil
+func (cfg *Config) mode(m mode.Mode) *modeConfig {
+	if cfg == nil {
+		return nil
+	}
+	return cfg.modes[m]
+}
+
+// Theme returns the name of the theme that should be used, or a blank string
+func (cfg *Config) Theme() string {
+	if cfg == nil {
+		return ""
+	}
+	return cfg.theme
+}
+
+// ScrollSpeed returns the number of lines to scroll, or the given default value
+func (cfg *Config) ScrollSpeed(defaultSpeed int) int {
+	if cfg == nil || cfg.scrollSpeed == 0 {
+		return defaultSpeed
+	}
+	return cfg.scrollSpeed
+}
+
+// UndoSize returns the number of undo actions to keep, or the given default value
+func (cfg *Config) UndoSize(defaultSize int) int {
+	if cfg == nil || cfg.undoSize == 0 {
+		return defaultSize
+	}
+	return cfg.undoSize
+}
+
+// WriteToCache checks if writing to the cache directory is allowed, which is the default
+func (cfg *Config) WriteToCache() bool {
+	return cfg == nil || cfg.writeToCache == nil || *cfg.writeToCache
+}
+
+// KeyBindings returns the key bindings that override the default key bindings, from key to action name
+func (cfg *Config) KeyBindings() map[string]string {
+	if cfg == nil {
+		return nil
+	}
+	return cfg.keys
+}
+
+// Indentation returns the indentation for the given mode, based on the given default indentation
+func (cfg *Config) Indentation(m mode.Mode, ts mode.TabsSpaces) mode.TabsSpaces {
+	mc := cfg.mode(m)
+	if mc == nil {
+		return ts
+	}
+	switch mc.indentStyle {
+	case "space":
+		ts.Spaces = true
+	case "tab":
+		ts.Spaces = false
+	}
+	if mc.indentSize > 0 {
+		ts.PerTab = mc.indentSize
+	}
+	return ts
+}
+
+// WrapWidth returns the column to word wrap at for the given mode, or the given current value.
+// The global setting is not used for git commit messages and e-mails, which have their own conventions.
+func (cfg *Config) WrapWidth(m mode.Mode, current int) int {
+	if mc := cfg.mode(m); mc != nil && mc.wrapWidth > 0 {
+		return mc.wrapWidth
+	}
+	if cfg == nil || cfg.wrapWidth == 0 || m == mode.Git || m == mode.Email {
+		return current
+	}
+	return cfg.wrapWidth
+}
+
+// RainbowParentheses checks if rainbow parentheses should be used for the given mode.
+// The global setting can only turn them off, while the per-mode setting decides.
+func (cfg *Config) RainbowParentheses(m mode.Mode, current bool) bool {
+	if mc := cfg.mode(m); mc != nil && mc.rainbowParentheses != nil {
+		return *mc.rainbowParentheses
+	}
+	if cfg != nil && cfg.rainbowParentheses != nil && !*cfg.rainbowParentheses {
+		return false
+	}
+	return current
+}
+
+// Formatter returns the formatting command for the given mode, or nil
+func (cfg *Config) Formatter(m mode.Mode) []string {
+	if mc := cfg.mode(m); mc != nil {
+		return mc.formatter
+	}
+	return nil
+}
+
+// LanguageServer returns the language server command for the given mode, or nil
+func (cfg *Config) LanguageServer(m mode.Mode) []string {
+	if mc := cfg.mode(m); mc != nil {
+		return mc.languageServer
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xyproto/mode"
+)
+
+func TestFindConfig(t *testing.T) {
+	defer func(filename string) {
+		configFilename = filename
+	}(configFilename)
+
+	dir := t.TempDir()
+	project := filepath.Join(dir, "project")
+	if err := os.Mkdir(project, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	configFilename = filepath.Join(dir, "config.toml")
+	user := "# User settings\ntheme = \"synthwave\"\nscroll_speed = 5\nwrap_width = 100 # columns\nundo_size = 4096\nrainbow_parentheses = false\nwrite_to_cache = false\n\n[go]\nformatter = \"gofumpt -w\"\n\n[py]\nindent_style = 'space'\nindent_size = 2\n"
+	inner := "# Closer files take precedence\nscroll_speed = 20\n\n[python]\nindent_size = 4\nrainbow_parentheses = true\n"
+	if err := os.WriteFile(configFilename, []byte(user), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(project, projectConfigName), []byte(inner), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := FindConfig(filepath.Join(project, "main.py"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Theme() != "synthwave" || cfg.ScrollSpeed(10) != 20 || cfg.UndoSize(1024) != 4096 || cfg.WriteToCache() {
+		t.Errorf("unexpected global settings: %+v", cfg)
+	}
+	if ts := cfg.Indentation(mode.Python, mode.TabsSpaces{PerTab: 8, Spaces: false}); !ts.Spaces || ts.PerTab != 4 {
+		t.Errorf("unexpected indentation for Python: %+v", ts)
+	}
+	if !cfg.RainbowParentheses(mode.Python, false) || cfg.RainbowParentheses(mode.Go, true) {
+		t.Error("expected rainbow parentheses for Python only")
+	}
+	if cfg.WrapWidth(mode.Go, 79) != 100 || cfg.WrapWidth(mode.Git, 72) != 72 {
+		t.Error("expected the wrap width to be used for Go, but not for git commit messages")
+	}
+	if args := cfg.Formatter(mode.Go); len(args) != 2 || args[0] != "gofumpt" {
+		t.Errorf("unexpected formatter for Go: %v", args)
+	}
+
+	// Commands can only be set in the user configuration file, not in the configuration file of a project
+	if err := os.WriteFile(filepath.Join(project, projectConfigName), []byte(inner+"\n[go]\nformatter = \"sh -c 'make format'\"\nlanguage_server = \"./gopls\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err = FindConfig(filepath.Join(project, "main.go"))
+	if err == nil || !strings.Contains(err.Error(), "formatter can only be set in") {
+		t.Errorf("expected an error about the formatter, got %v", err)
+	}
+	if args := cfg.Formatter(mode.Go); len(args) != 2 || args[0] != "gofumpt" {
+		t.Errorf("expected the formatter from the project configuration file to be ignored, got %v", args)
+	}
+	if command := cfg.LanguageServer(mode.Go); command != nil {
+		t.Errorf("expected the language server from the project configuration file to be ignored, got %v", command)
+	}
+
+	// A file outside of the project only uses the user configuration file
+	if cfg, _ := FindConfig(filepath.Join(dir, "main.py")); cfg.ScrollSpeed(10) != 5 {
+		t.Errorf("expected the user scroll speed, got %d", cfg.ScrollSpeed(10))
+	}
+
+	// Errors mention the file and the line number, and the other lines are still used
+	if err := os.WriteFile(configFilename, []byte("scroll_speed = fast\nwrap_width = 90\n[nosuchmode]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err = FindConfig(filepath.Join(dir, "main.py"))
+	if err == nil || err.Error() != configFilename+":1: expected a positive number, got \"fast\"" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if cfg.WrapWidth(mode.Go, 79) != 90 {
+		t.Error("expected the lines without errors to be used")
+	}
+}
+
+func TestConfigString(t *testing.T) {
+	tests := []struct {
+		in, out string
+		ok      bool
+	}{
+		{"value", "value", true},
+		{" 42 # comment", "42", true},
+		{`"a \"quoted\" # string" # comment`, `a "quoted" # string`, true},
+		{`'C:\path'`, `C:\path`, true},
+		{`"missing`, "", false},
+		{`"a" b`, "", false},
+	}
+	for _, test := range tests {
+		out, err := configString(test.in)
+		if (err == nil) != test.ok || out != test.out {
+			t.Errorf("configString(%q) = %q, %v", test.in, out, err)
+		}
+	}
+}
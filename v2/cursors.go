@@ -0,0 +1,301 @@
+package main
+
+import (
+	"sort"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/xyproto/vt100"
+)
+
+// HasCursors checks if there are extra cursors, in addition to the regular one
+func (e *Editor) HasCursors() bool {
+	return len(e.cursors) > 0
+}
+
+// ClearCursors removes all the extra cursors. Returns true if there were any.
+func (e *Editor) ClearCursors() bool {
+	hadCursors := len(e.cursors) > 0
+	e.cursors = nil
+	return hadCursors
+}
+
+// AddCursor adds an extra cursor at the given position
+func (e *Editor) AddCursor(p TextPosition) {
+	e.cursors = append(e.cursors, p)
+	e.sortCursors()
+}
+
+// sortCursors sorts the extra cursors, and removes the ones that are at the same position
+// as another cursor or at the same position as the regular cursor
+func (e *Editor) sortCursors() {
+	main := e.CursorTextPosition()
+	sort.Slice(e.cursors, func(i, j int) bool {
+		return e.cursors[i].Before(e.cursors[j])
+	})
+	cursors := e.cursors[:0]
+	for i, p := range e.cursors {
+		if p == main || (i > 0 && p == e.cursors[i-1]) {
+			continue
+		}
+		cursors = append(cursors, p)
+	}
+	e.cursors = cursors
+}
+
+// AddCursorVertically adds an extra cursor at the current position, then moves the regular cursor
+// to the same screen column on the line above or below. Returns false if there is no line there.
+func (e *Editor) AddCursorVertically(c *vt100.Canvas, down bool) bool {
+	p := e.CursorTextPosition()
+	y := p.y - 1
+	if down {
+		y = p.y + 1
+	}
+	if y < 0 || int(y) >= e.Len() {
+		return false
+	}
+	col := e.pos.sx + e.pos.offsetX
+	e.cursors = append(e.cursors, p)
+	e.GoTo(y, c, nil)
+	line, _ := e.lines.Line(int(y))
+	x, _ := e.columnIndex(line, col)
+	e.pos.SetX(c, e.ScreenColumn(x, y))
+	e.sortCursors()
+	e.redraw = true
+	e.redrawCursor = true
+	return true
+}
+
+// AddCursorsAtMatches places a cursor at the start of every match of the given search term, with the current search options.
+// The regular cursor is moved to the first match at or after the current position.
+// Returns the number of matches.
+func (e *Editor) AddCursorsAtMatches(c *vt100.Canvas, status *StatusBar, term string) int {
+	if term == "" {
+		return 0
+	}
+	var matches []TextPosition
+	for y := 0; y < e.Len(); y++ {
+		line := e.Line(LineIndex(y))
+		for _, m := range searchOptions.FindAll(line, term) {
+			matches = append(matches, TextPosition{utf8.RuneCountInString(line[:m[0]]), LineIndex(y)})
+		}
+	}
+	if len(matches) == 0 {
+		return 0
+	}
+	here := e.CursorTextPosition()
+	mainIndex := 0
+	for i, p := range matches {
+		if !p.Before(here) {
+			mainIndex = i
+			break
+		}
+	}
+	e.GoToTextPosition(c, status, matches[mainIndex])
+	e.cursors = append(e.cursors, matches...)
+	e.sortCursors()
+	e.redraw = true
+	return len(matches)
+}
+
+// placeCursor moves the regular cursor to the given position, without scrolling.
+// The cursor may then be outside of the screen, but DataX and DataY can be used as usual.
+func (e *Editor) placeCursor(p TextPosition) {
+	line, _ := e.lines.Line(int(p.y))
+	if p.x > len(line) {
+		p.x = len(line)
+	}
+	e.pos.sy = int(p.y) - e.pos.offsetY
+	e.pos.sx = e.ScreenColumn(p.x, p.y) - e.pos.offsetX
+}
+
+// ForEachCursor calls the given function once for each cursor, including the regular one,
+// with the regular cursor placed at that cursor. The given position points to the cursor,
+// which is moved along with the text when Insert, Delete, InsertLineBelow and the other
+// editing functions are used, but it may also be changed by the function.
+// Afterwards, the regular cursor is placed where it ended up.
+func (e *Editor) ForEachCursor(c *vt100.Canvas, f func(p *TextPosition)) {
+	offsetX, offsetY := e.pos.offsetX, e.pos.offsetY
+	e.cursors = append(e.cursors, e.CursorTextPosition())
+	mainIndex := len(e.cursors) - 1
+	for i := range e.cursors {
+		e.placeCursor(e.cursors[i])
+		f(&e.cursors[i])
+	}
+	main := e.cursors[mainIndex]
+	e.cursors = append(e.cursors[:mainIndex], e.cursors[mainIndex+1:]...)
+	e.pos.offsetX, e.pos.offsetY = offsetX, offsetY
+	e.GoToTextPosition(c, nil, main)
+	for i, p := range e.cursors {
+		line, _ := e.lines.Line(int(p.y))
+		if p.x > len(line) {
+			e.cursors[i].x = len(line)
+		}
+	}
+	e.sortCursors()
+	e.redraw = true
+}
+
+// InsertAtCursors inserts the given rune at all of the cursors
+func (e *Editor) InsertAtCursors(c *vt100.Canvas, r rune) {
+	e.ForEachCursor(c, func(*TextPosition) {
+		e.Insert(r)
+	})
+}
+
+// DeleteAtCursors deletes the rune at all of the cursors, or joins the line below if a cursor is at the end of a line
+func (e *Editor) DeleteAtCursors(c *vt100.Canvas) {
+	e.ForEachCursor(c, func(*TextPosition) {
+		e.Delete()
+	})
+}
+
+// BackspaceAtCursors deletes the rune to the left of all of the cursors,
+// or joins the line with the line above if a cursor is at the start of a line
+func (e *Editor) BackspaceAtCursors(c *vt100.Canvas) {
+	e.ForEachCursor(c, func(p *TextPosition) {
+		if p.x > 0 {
+			e.placeCursor(TextPosition{p.x - 1, p.y})
+		} else if p.y > 0 {
+			line, _ := e.lines.Line(int(p.y - 1))
+			e.placeCursor(TextPosition{len(line), p.y - 1})
+		} else {
+			return
+		}
+		e.Delete()
+	})
+}
+
+// NewLineAtCursors splits the line at all of the cursors, and indents the new lines like the lines they came from
+func (e *Editor) NewLineAtCursors(c *vt100.Canvas) {
+	const indent = true
+	e.newLineAtCursors(c, indent)
+}
+
+// newLineAtCursors splits the line at all of the cursors, and indents the new lines if indent is true
+func (e *Editor) newLineAtCursors(c *vt100.Canvas, indent bool) {
+	e.ForEachCursor(c, func(p *TextPosition) {
+		y := p.y
+		line, _ := e.lines.Line(int(y))
+		indentation := []rune{}
+		for _, r := range line[:p.x] {
+			if !indent || !unicode.IsSpace(r) {
+				break
+			}
+			indentation = append(indentation, r)
+		}
+		if p.x >= len(line) {
+			e.InsertLineBelow()
+			e.SetLine(y+1, string(indentation))
+			*p = TextPosition{len(indentation), y + 1}
+			return
+		}
+		if !e.SplitLine() {
+			// The line is too short to be split, so the cursor is at the start of it
+			e.InsertLineAbove()
+		}
+		if len(indentation) > 0 {
+			e.SetLine(y+1, string(indentation)+e.Line(y+1))
+			e.cursorsInserted(y+1, 0, len(indentation))
+		}
+	})
+}
+
+// MoveCursors moves all of the cursors the given number of runes to the left or right, within their lines
+func (e *Editor) MoveCursors(c *vt100.Canvas, dx int) {
+	e.ForEachCursor(c, func(p *TextPosition) {
+		line, _ := e.lines.Line(int(p.y))
+		p.x += dx
+		if p.x < 0 {
+			p.x = 0
+		} else if p.x > len(line) {
+			p.x = len(line)
+		}
+	})
+}
+
+// cursorsInserted moves the extra cursors when n runes have been inserted at the given position
+func (e *Editor) cursorsInserted(y LineIndex, x, n int) {
+	for i, p := range e.cursors {
+		if p.y == y && p.x >= x {
+			e.cursors[i].x += n
+		}
+	}
+}
+
+// cursorsDeleted moves the extra cursors when n runes have been removed from the given position
+func (e *Editor) cursorsDeleted(y LineIndex, x, n int) {
+	for i, p := range e.cursors {
+		if p.y == y && p.x > x {
+			e.cursors[i].x -= n
+			if e.cursors[i].x < x {
+				e.cursors[i].x = x
+			}
+		}
+	}
+}
+
+// cursorsLineInserted moves the extra cursors when a line has been inserted at the given line index
+func (e *Editor) cursorsLineInserted(y LineIndex) {
+	for i, p := range e.cursors {
+		if p.y >= y {
+			e.cursors[i].y++
+		}
+	}
+}
+
+// cursorsLineDeleted moves the extra cursors when the line at the given line index has been removed.
+// The cursors that were on that line are moved to the start of the line that took its place.
+func (e *Editor) cursorsLineDeleted(y LineIndex) {
+	for i, p := range e.cursors {
+		if p.y > y {
+			e.cursors[i].y--
+		} else if p.y == y {
+			e.cursors[i].x = 0
+		}
+	}
+}
+
+// cursorsLineJoined moves the extra cursors when the line below the given line index
+// has been appended to it, at the given rune index, but before the line below is removed
+func (e *Editor) cursorsLineJoined(y LineIndex, x int) {
+	for i, p := range e.cursors {
+		if p.y == y+1 {
+			e.cursors[i] = TextPosition{x + p.x, y}
+		}
+	}
+}
+
+// cursorsLineSplit moves the extra cursors when the line at the given line index has been split in two
+// at the given rune index, by inserting a new line above it. The cursors on the line below that are
+// before the split are moved up, the rest are moved to the left.
+func (e *Editor) cursorsLineSplit(y LineIndex, x int) {
+	for i, p := range e.cursors {
+		if p.y != y+1 {
+			continue
+		}
+		if p.x < x {
+			e.cursors[i].y = y
+		} else {
+			e.cursors[i].x -= x
+		}
+	}
+}
+
+// drawCursors draws the extra cursors that are on the given line index, at the given canvas row
+func (e *Editor) drawCursors(c *vt100.Canvas, y LineIndex, cx, cy, cw uint) {
+	for _, p := range e.cursors {
+		if p.y != y {
+			continue
+		}
+		col := e.ScreenColumn(p.x, p.y) - e.pos.offsetX
+		if col < 0 || cx+uint(col) >= cw {
+			continue
+		}
+		r, err := c.At(cx+uint(col), cy)
+		if err != nil || r == 0 {
+			r = ' '
+		}
+		c.WriteRuneB(cx+uint(col), cy, e.Foreground, vt100.Reverse, r)
+	}
+}
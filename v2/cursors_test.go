@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+)
+
+func newCursorsTestEditor() *Editor {
+	e := NewSimpleEditor(80)
+	e.SetLine(0, "a := 1")
+	e.SetLine(1, "b := 2")
+	e.SetLine(2, "c := 3")
+	return e
+}
+
+func TestInsertAtCursors(t *testing.T) {
+	e := newCursorsTestEditor()
+	e.AddCursor(TextPosition{1, 1})
+	e.AddCursor(TextPosition{1, 2})
+	e.pos.sx = 1
+	e.InsertAtCursors(nil, 'x')
+	e.InsertAtCursors(nil, 'y')
+	if s := e.String(); s != "axy := 1\nbxy := 2\ncxy := 3\n" {
+		t.Errorf("unexpected contents: %q", s)
+	}
+	if p := e.CursorTextPosition(); p != (TextPosition{3, 0}) {
+		t.Errorf("unexpected cursor position: %v", p)
+	}
+	e.BackspaceAtCursors(nil)
+	if s := e.String(); s != "ax := 1\nbx := 2\ncx := 3\n" {
+		t.Errorf("unexpected contents after backspace: %q", s)
+	}
+	if len(e.cursors) != 2 || e.cursors[0] != (TextPosition{2, 1}) || e.cursors[1] != (TextPosition{2, 2}) {
+		t.Errorf("unexpected cursors after backspace: %v", e.cursors)
+	}
+}
+
+func TestNewLineAtCursors(t *testing.T) {
+	e := newCursorsTestEditor()
+	e.AddCursorsAtMatches(nil, nil, ":=")
+	if !e.HasCursors() || len(e.cursors) != 2 {
+		t.Fatalf("expected two extra cursors, got %v", e.cursors)
+	}
+	e.NewLineAtCursors(nil)
+	if s := e.String(); s != "a\n:= 1\nb\n:= 2\nc\n:= 3\n" {
+		t.Errorf("unexpected contents: %q", s)
+	}
+	if e.DataY() != 1 || e.cursors[0] != (TextPosition{0, 3}) || e.cursors[1] != (TextPosition{0, 5}) {
+		t.Errorf("unexpected cursors: %v and %v", e.CursorTextPosition(), e.cursors)
+	}
+	e.BackspaceAtCursors(nil)
+	if s := e.String(); s != "a:= 1\nb:= 2\nc:= 3\n" {
+		t.Errorf("unexpected contents after joining the lines: %q", s)
+	}
+}
+
+func TestUndoCursors(t *testing.T) {
+	e := newCursorsTestEditor()
+	undo := NewUndo(10, 0)
+	e.AddCursorVertically(nil, true)
+	undo.Snapshot(e)
+	e.DeleteAtCursors(nil)
+	if s := e.String(); s != " := 1\n := 2\nc := 3\n" {
+		t.Errorf("unexpected contents: %q", s)
+	}
+	e.ClearCursors()
+	if err := undo.Restore(e); err != nil {
+		t.Fatal(err)
+	}
+	if s := e.String(); s != "a := 1\nb := 2\nc := 3\n" {
+		t.Errorf("unexpected contents after undo: %q", s)
+	}
+	if len(e.cursors) != 1 || e.cursors[0] != (TextPosition{0, 0}) {
+		t.Errorf("expected the cursors to be restored, got %v", e.cursors)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xyproto/vt100"
+)
+
+// maxDiffCells is the largest number of line pairs that LineDiff will compare, to limit the memory usage.
+// If the changed part of two texts is larger than this, all of it is shown as removed and then added.
+const maxDiffCells = 4 * 1024 * 1024
+
+// DiffLine is a line in a line-based diff
+type DiffLine struct {
+	Op   byte // ' ' for lines that are the same, '-' for removed lines and '+' for added lines
+	Text string
+}
+
+// LineDiff finds the differences between two texts, given as lines.
+// The common lines at the start and at the end are skipped before the longest common subsequence
+// of the remaining lines is found.
+func LineDiff(a, b []string) []DiffLine {
+	var diff []DiffLine
+
+	// Skip the common prefix and suffix
+	start := 0
+	for start < len(a) && start < len(b) && a[start] == b[start] {
+		diff = append(diff, DiffLine{' ', a[start]})
+		start++
+	}
+	endA, endB := len(a), len(b)
+	for endA > start && endB > start && a[endA-1] == b[endB-1] {
+		endA--
+		endB--
+	}
+	ma, mb := a[start:endA], b[start:endB]
+
+	if len(ma)*len(mb) > maxDiffCells {
+		for _, line := range ma {
+			diff = append(diff, DiffLine{'-', line})
+		}
+		for _, line := range mb {
+			diff = append(diff, DiffLine{'+', line})
+		}
+	} else {
+		// lcs[i][j] is the length of the longest common subsequence of ma[i:] and mb[j:]
+		lcs := make([][]int, len(ma)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(mb)+1)
+		}
+		for i := len(ma) - 1; i >= 0; i-- {
+			for j := len(mb) - 1; j >= 0; j-- {
+				if ma[i] == mb[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else if lcs[i+1][j] >= lcs[i][j+1] {
+					lcs[i][j] = lcs[i+1][j]
+				} else {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(ma) && j < len(mb) {
+			switch {
+			case ma[i] == mb[j]:
+				diff = append(diff, DiffLine{' ', ma[i]})
+				i++
+				j++
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				diff = append(diff, DiffLine{'-', ma[i]})
+				i++
+			default:
+				diff = append(diff, DiffLine{'+', mb[j]})
+				j++
+			}
+		}
+		for ; i < len(ma); i++ {
+			diff = append(diff, DiffLine{'-', ma[i]})
+		}
+		for ; j < len(mb); j++ {
+			diff = append(diff, DiffLine{'+', mb[j]})
+		}
+	}
+
+	for i := endA; i < len(a); i++ {
+		diff = append(diff, DiffLine{' ', a[i]})
+	}
+	return diff
+}
+
+// FormatDiff returns the changed lines in the given diff, with the given number of unchanged lines around them.
+// Each group of changes starts with a "@@ -n +m @@" line, with the line numbers in the old and in the new text.
+func FormatDiff(diff []DiffLine, context int) []string {
+	// Find out which lines should be shown
+	show := make([]bool, len(diff))
+	for i, dl := range diff {
+		if dl.Op == ' ' {
+			continue
+		}
+		for j := i - context; j <= i+context; j++ {
+			if j >= 0 && j < len(diff) {
+				show[j] = true
+			}
+		}
+	}
+	var (
+		lines      []string
+		lineA      = 1
+		lineB      = 1
+		previousOK = false
+	)
+	for i, dl := range diff {
+		if show[i] {
+			if !previousOK {
+				lines = append(lines, fmt.Sprintf("@@ -%d +%d @@", lineA, lineB))
+			}
+			lines = append(lines, string(dl.Op)+" "+dl.Text)
+		}
+		previousOK = show[i]
+		if dl.Op != '+' {
+			lineA++
+		}
+		if dl.Op != '-' {
+			lineB++
+		}
+	}
+	return lines
+}
+
+// ShowDiff displays the differences between two texts in a box that can be scrolled with the arrow keys,
+// until esc, return, q or ctrl-q is pressed
+func (e *Editor) ShowDiff(c *vt100.Canvas, tty *vt100.TTY, title string, a, b []string) {
+	lines := FormatDiff(LineDiff(a, b), 3)
+	if len(lines) == 0 {
+		lines = []string{"No differences"}
+	}
+	e.ShowLines(c, tty, title, lines, func(bt *BoxTheme, line string) vt100.AttributeColor {
+		switch {
+		case strings.HasPrefix(line, "+"):
+			return vt100.LightGreen
+		case strings.HasPrefix(line, "-"):
+			return vt100.LightRed
+		case strings.HasPrefix(line, "@@"):
+			return *bt.UpperEdge
+		}
+		return *bt.Text
+	})
+}
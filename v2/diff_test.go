@@ -0,0 +1,31 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLineDiff(t *testing.T) {
+	a := []string{"a", "b", "c", "d", "e"}
+	b := []string{"a", "c", "x", "d", "e", "f"}
+	var sb strings.Builder
+	for _, dl := range LineDiff(a, b) {
+		sb.WriteString(string(dl.Op) + dl.Text + "\n")
+	}
+	if expected := " a\n-b\n c\n+x\n d\n e\n+f\n"; sb.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, sb.String())
+	}
+}
+
+func TestFormatDiff(t *testing.T) {
+	a := []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"}
+	b := []string{"1", "2", "3", "4", "5", "6", "7", "8", "nine", "10"}
+	lines := FormatDiff(LineDiff(a, b), 1)
+	expected := []string{"@@ -8 +8 @@", "  8", "- 9", "+ nine", "  10"}
+	if !equalStrings(lines, expected) {
+		t.Errorf("expected %q, got %q", expected, lines)
+	}
+	if lines := FormatDiff(LineDiff(a, a), 3); len(lines) != 0 {
+		t.Errorf("expected no lines for equal texts, got %q", lines)
+	}
+}
@@ -20,12 +20,19 @@ import (
 
 // Editor represents the contents and editor settings, but not settings related to the viewport or scrolling
 type Editor struct {
-	detectedTabs       *bool           // were tab or space indentations detected when loading the data?
+	editorConfig       *EditorConfig   // settings from .editorconfig files, or nil
+	config             *Config         // settings from the user configuration file and the per-project configuration files
+	mixedEndings       lineEndingMap   // the line endings of each line, for files with mixed line endings
+	lineEndings        LineEndings     // LF, CRLF, CR or mixed line endings
+	charset            string          // the charset that the file was loaded with and will be saved with, blank for UTF-8
+	detectedIndent     mode.TabsSpaces // the indentation that was detected when loading the data, PerTab is 0 if none was detected
 	breakpoint         *Position       // for the breakpoint/jump functionality in debug mode
 	gdb                *gdb.Gdb        // connection to gdb, if debugMode is enabled
 	sameFilePortal     *Portal         // a portal that points to the same file
-	lines              map[int][]rune  // the contents of the current document
+	lines              *Journal        // the contents of the current document, with a record of the changes
 	macro              *Macro          // the contents of the current macro (will be cleared when esc is pressed)
+	selectionAnchor    *TextPosition   // where the text selection was started, or nil if no text is selected
+	cursors            []TextPosition  // extra cursors, where text is also typed and deleted
 	filename           string          // the current filename
 	searchTerm         string          // the current search term, used when searching
 	stickySearchTerm   string          // used when going to the next match with ctrl-n, unless esc has been pressed
@@ -51,6 +58,7 @@ type Editor struct {
 	quit               bool            // for indicating if the user wants to end the editor session
 	changed            bool            // has the contents changed, since last save?
 	readOnly           bool            // is the file read-only when initializing o?
+	privileged         bool            // save the file with sudo, doas or run0, since it can only be written by another user?
 	debugHideOutput    bool            // hide the GDB stdout pane when in debug mode?
 	binaryFile         bool            // is this a binary file, or a text file?
 	wrapWhenTyping     bool            // wrap text at a certain limit when typing
@@ -62,6 +70,7 @@ type Editor struct {
 	generatingTokens   bool            // is code or text being generated right now?
 	redrawCursor       bool            // if the cursor should be moved to the location it is supposed to be
 	fixAsYouType       bool            // fix each line as you type it in, using AI?
+	columnSelection    bool            // is the selection a rectangle, from the anchor column to the cursor column?
 }
 
 // NewCustomEditor takes:
@@ -81,7 +90,7 @@ type Editor struct {
 func NewCustomEditor(indentation mode.TabsSpaces, scrollSpeed int, m mode.Mode, theme Theme, syntaxHighlight, rainbowParenthesis bool) *Editor {
 	e := &Editor{}
 	e.SetTheme(theme)
-	e.lines = make(map[int][]rune)
+	e.lines = NewJournal(NewLineRope(nil))
 	e.indentation = indentation
 	e.syntaxHighlight = syntaxHighlight
 	e.rainbowParenthesis = rainbowParenthesis
@@ -118,50 +127,33 @@ func NewSimpleEditor(wordWrapLimit int) *Editor {
 	return e
 }
 
-// CopyLines will create a new map[int][]rune struct that is the copy of all the lines in the editor
-func (e *Editor) CopyLines() map[int][]rune {
-	lines2 := make(map[int][]rune)
-	for key, runes := range e.lines {
-		runes2 := make([]rune, len(runes))
-		copy(runes2, runes)
-		lines2[key] = runes2
-	}
-	return lines2
+// CopyLines will return a copy of all the lines in the editor.
+// This is cheap, since the lines are shared with the editor until they are changed.
+func (e *Editor) CopyLines() Buffer {
+	return e.lines.Copy()
 }
 
 // Set will store a rune in the editor data, at the given data coordinates
 func (e *Editor) Set(x int, index LineIndex, r rune) {
 	y := int(index)
-	if e.lines == nil {
-		e.lines = make(map[int][]rune)
-	}
-	_, ok := e.lines[y]
-	if !ok {
-		e.lines[y] = make([]rune, 0, x+1)
-	}
-	l := len(e.lines[y])
-	if x < l {
-		e.lines[y][x] = r
-		e.changed = true
-		return
-	}
+	line, _ := e.lines.Line(y)
+	newLine := make([]rune, len(line), len(line)+1)
+	copy(newLine, line)
 	// If the line is too short, fill it up with spaces
-	if l <= x {
+	if l := len(newLine); l <= x {
 		n := (x + 1) - l
-		e.lines[y] = append(e.lines[y], []rune(strings.Repeat(" ", n))...)
+		newLine = append(newLine, []rune(strings.Repeat(" ", n))...)
 	}
 
 	// Set the rune
-	e.lines[y][x] = r
+	newLine[x] = r
+	e.lines.SetLine(y, newLine)
 	e.changed = true
 }
 
 // Get will retrieve a rune from the editor data, at the given coordinates
 func (e *Editor) Get(x int, y LineIndex) rune {
-	if e.lines == nil {
-		return ' '
-	}
-	runes, ok := e.lines[int(y)]
+	runes, ok := e.lines.Line(int(y))
 	if !ok {
 		return ' '
 	}
@@ -178,7 +170,7 @@ func (e *Editor) Changed() bool {
 
 // Line returns the contents of line number N, counting from 0
 func (e *Editor) Line(n LineIndex) string {
-	line, ok := e.lines[int(n)]
+	line, ok := e.lines.Line(int(n))
 	if !ok {
 		return ""
 	}
@@ -188,7 +180,7 @@ func (e *Editor) Line(n LineIndex) string {
 // ScreenLine returns the screen contents of line number N, counting from 0.
 // The tabs are expanded.
 func (e *Editor) ScreenLine(n int) string {
-	line, ok := e.lines[n]
+	line, ok := e.lines.Line(n)
 	if ok {
 		var sb strings.Builder
 		skipX := e.pos.offsetX
@@ -259,7 +251,7 @@ func (e *Editor) FirstDataPosition(n LineIndex) int {
 // CountRune will count the number of instances of the rune r in the line n
 func (e *Editor) CountRune(r rune, n LineIndex) int {
 	var counter int
-	line, ok := e.lines[int(n)]
+	line, ok := e.lines.Line(int(n))
 	if ok {
 		for _, l := range line {
 			if l == r {
@@ -270,15 +262,12 @@ func (e *Editor) CountRune(r rune, n LineIndex) int {
 	return counter
 }
 
-// Len returns the number of lines
+// Len returns the number of lines. An empty document counts as one line.
 func (e *Editor) Len() int {
-	maxy := 0
-	for y := range e.lines {
-		if y > maxy {
-			maxy = y
-		}
+	if l := e.lines.Len(); l > 0 {
+		return l
 	}
-	return maxy + 1
+	return 1
 }
 
 // String returns the contents of the editor
@@ -315,7 +304,7 @@ func (e *Editor) ContentsAndReverseSearchPrefix(prefix string) (string, LineInde
 
 // Clear removes all data from the editor
 func (e *Editor) Clear() {
-	e.lines = make(map[int][]rune)
+	e.lines.Replace(NewLineRope(nil))
 	e.changed = true
 }
 
@@ -345,8 +334,12 @@ func (e *Editor) Load(c *vt100.Canvas, tty *vt100.TTY, fnord FilenameOrData) (st
 		// Load the data (and make opinionated replacements if it's a text file + set e.binaryFile if it's binary)
 		e.LoadBytes(fnord.data)
 	} else if fnord.stdin {
-		// Load the data that has already been read from stdin
-		// (and make opinionated replacements if it's a text file + set e.binaryFile if it's binary)
+		// Decode the data that has already been read from stdin, if it is not UTF-8
+		e.charset = detectCharset(fnord.data)
+		if data, err := decodeCharset(fnord.data, e.charset); err == nil {
+			fnord.data = data
+		}
+		// Load the data (and make opinionated replacements if it's a text file + set e.binaryFile if it's binary)
 		e.LoadBytes(fnord.data)
 	} else if fnord.Empty() {
 		// Load the file (and make opinionated replacements if it's a text file + set e.binaryFile if it's binary)
@@ -408,11 +401,24 @@ func (e *Editor) PrepareEmpty() (mode.Mode, error) {
 // Save will try to save the current editor contents to file.
 // It needs a canvas in case trailing spaces are stripped and the cursor needs to move to the end.
 func (e *Editor) Save(c *vt100.Canvas, tty *vt100.TTY) error {
+	return e.save(c, tty, e.filename, false)
+}
+
+// SaveCopy writes the current editor contents to the given file, in the same way as Save, but without changing
+// which file is being edited and without marking the contents as saved. Useful for passing the contents to other programs.
+func (e *Editor) SaveCopy(c *vt100.Canvas, tty *vt100.TTY, filename string) error {
+	return e.save(c, tty, filename, true)
+}
+
+// save writes the current editor contents to the given file.
+// If copyOnly is true, the contents are not marked as saved, and the swap file and file watcher are left alone.
+func (e *Editor) save(c *vt100.Canvas, tty *vt100.TTY, filename string, copyOnly bool) error {
 	var (
-		bookmark = e.pos.Copy() // Save the current position
-		changed  bool
-		shebang  bool
-		data     []byte
+		bookmark     = e.pos.Copy() // Save the current position
+		changed      bool
+		shebang      bool
+		data         []byte
+		mixedEndings lineEndingMap
 	)
 	quitMut.Lock()
 	defer quitMut.Unlock()
@@ -420,47 +426,45 @@ func (e *Editor) Save(c *vt100.Canvas, tty *vt100.TTY) error {
 	if e.binaryFile {
 		data = []byte(e.String())
 	} else {
-		// Strip trailing spaces on all lines
-		l := e.Len()
-		for i := 0; i < l; i++ {
-			if e.TrimRight(LineIndex(i)) {
-				changed = true
+		s := e.String()
+
+		// Strip trailing spaces on all lines, unless .editorconfig says otherwise
+		if e.editorConfig.TrimTrailingWhitespace() {
+			l := e.Len()
+			for i := 0; i < l; i++ {
+				if e.TrimRight(LineIndex(i)) {
+					changed = true
+				}
 			}
-		}
 
-		// Trim away trailing whitespace
-		s := strings.TrimRightFunc(e.String(), unicode.IsSpace)
+			// Trim away trailing whitespace
+			s = strings.TrimRightFunc(e.String(), unicode.IsSpace)
+		} else {
+			s = strings.TrimSuffix(s, "\n")
+		}
 
-		// Make additional replacements, and add a final newline
-		s = opinionatedStringReplacer.Replace(s) + "\n"
+		// Make additional replacements
+		s = opinionatedLineReplacer.Replace(s)
 
-		// TODO: Auto-detect tabs/spaces instead of per-language assumptions
-		if e.mode.Spaces() {
-			// NOTE: This is a hack, that can only replace 10 levels deep.
-			for level := 10; level > 0; level-- {
-				fromString := "\n" + strings.Repeat("\t", level)
-				toString := "\n" + strings.Repeat(" ", level*e.indentation.PerTab)
-				s = strings.ReplaceAll(s, fromString, toString)
-			}
-		} else if e.mode == mode.Make || e.mode == mode.Just {
-			// NOTE: This is a hack, that can only replace 10 levels deep.
-			for level := 10; level > 0; level-- {
-				fromString := "\n" + strings.Repeat(" ", level*e.indentation.PerTab)
-				toString := "\n" + strings.Repeat("\t", level)
-				s = strings.ReplaceAll(s, fromString, toString)
-			}
+		// Add a final newline, unless .editorconfig says otherwise
+		if e.editorConfig.InsertFinalNewline() {
+			s += "\n"
 		}
 
+		// The indentation is saved as it is. It was detected when the file was loaded,
+		// so that new lines are indented the same way as the rest of the file.
+
 		// Should the file be saved with the executable bit enabled?
 		// (Does it either start with a shebang or reside in a common bin directory like /usr/bin?)
-		shebang = aBinDirectory(e.filename) || strings.HasPrefix(s, "#!")
-
-		data = []byte(s)
-	}
+		shebang = aBinDirectory(filename) || strings.HasPrefix(s, "#!")
 
-	// Mark the data as "not changed" if it's not a binary file
-	if !e.binaryFile {
-		e.changed = false
+		// Keep the line endings that the file had when it was loaded
+		s, mixedEndings = joinLineEndings(s, e.lineEndings, e.mixedEndings)
+		// Save the file with the same charset as it was loaded with
+		var err error
+		if data, err = encodeCharset(s, e.charset); err != nil {
+			return fmt.Errorf("%w (the file can be converted to UTF-8 from the menu)", err)
+		}
 	}
 
 	// Shell scripts that contains the word "source" typically needs to be sourced and should not be "chmod +x"-ed
@@ -479,13 +483,18 @@ func (e *Editor) Save(c *vt100.Canvas, tty *vt100.TTY) error {
 	}
 
 	// If it's not a binary file OR the file has changed: save the data
-	if !e.binaryFile || e.changed {
+	if !e.binaryFile || e.changed || copyOnly {
 
-		// Start a spinner, in a short while
-		quitChan := Spinner(c, tty, fmt.Sprintf("Saving %s... ", e.filename), fmt.Sprintf("saving %s: stopped by user", e.filename), 200*time.Millisecond, e.ItalicsColor)
+		// Start a spinner, in a short while.
+		// The elevation command may ask for a password when saving as root, so then the spinner is not drawn.
+		spinnerCanvas := c
+		if e.privileged && !copyOnly {
+			spinnerCanvas = nil
+		}
+		quitChan := Spinner(spinnerCanvas, tty, fmt.Sprintf("Saving %s... ", filename), fmt.Sprintf("saving %s: stopped by user", filename), 200*time.Millisecond, e.ItalicsColor)
 
 		// Prepare gzipped data
-		if strings.HasSuffix(e.filename, ".gz") {
+		if strings.HasSuffix(filename, ".gz") {
 			var err error
 			data, err = gZipData(data)
 			if err != nil {
@@ -494,27 +503,56 @@ func (e *Editor) Save(c *vt100.Canvas, tty *vt100.TTY) error {
 			}
 		}
 
-		// Save the file and return any errors
-		if err := os.WriteFile(e.filename, data, fileMode); err != nil {
+		// Save the file, by writing to a temporary file and then moving it in place, and return any errors.
+		// Files that can only be written by another user are copied in place with sudo, doas or run0 instead.
+		var err error
+		if e.privileged && !copyOnly {
+			err = e.writePrivileged(c, filename, data, fileMode)
+		} else {
+			err = WriteFileAtomic(filename, data, fileMode, backupOnSave && !copyOnly)
+		}
+		if err != nil {
 			// Stop the spinner and return
 			quitChan <- true
 			return err
 		}
 
-		// This file should not be considered read-only, since saving went fine
-		e.readOnly = false
+		if !copyOnly {
+			// Mark the data as "not changed" if it's not a binary file
+			if !e.binaryFile {
+				e.changed = false
+			}
 
-		// TODO: Consider the previous fileMode of the file when doing chmod +x instead of just setting 0755 or 0644
+			// This file should not be considered read-only, since saving went fine
+			e.readOnly = false
+
+			// The changes are saved, so the swap file is no longer needed,
+			// and the file on disk is now the base for noticing and merging changes made by other programs
+			if absFilename, err := e.AbsFilename(); err == nil {
+				swapWriter.Remove(absFilename)
+				fileWatcher.Watch(absFilename, e.lines.Buffer)
+				notifyLanguageServers(absFilename, e.String())
+				// Store where the bookmarks in this file are, now that the lines are saved
+				if bookmarks.Has(absFilename) {
+					bookmarks.Save(bookmarksFilename)
+				}
+			}
+
+			// Remember the line endings of each line, as they were saved, for files with mixed line endings
+			e.mixedEndings = mixedEndings
+		}
 
 		// "chmod +x" or "chmod -x". This is needed after saving the file, in order to toggle the executable bit.
+		// The other permission bits are kept as they were.
 		// rust source may start with something like "#![feature(core_intrinsics)]", so avoid that.
-		if shebang && e.mode != mode.Rust && e.mode != mode.Python && e.mode != mode.Mojo && !e.readOnly {
-			// Call Chmod, but ignore errors (since this is just a bonus and not critical)
-			os.Chmod(e.filename, fileMode)
-			e.syntaxHighlight = true
-		} else if e.mode == mode.Make || e.mode == mode.Just || e.mode == mode.Markdown || e.mode == mode.Doc || e.mode == mode.ReStructured || filepath.Base(e.filename) == "PKGBUILD" || filepath.Base(e.filename) == "APKBUILD" {
-			fileMode = 0o644
-			os.Chmod(e.filename, fileMode)
+		if fi, err := os.Stat(filename); err == nil {
+			if shebang && e.mode != mode.Rust && e.mode != mode.Python && e.mode != mode.Mojo && !e.readOnly {
+				// Call Chmod, but ignore errors (since this is just a bonus and not critical)
+				os.Chmod(filename, withExecutableBits(fi.Mode(), fileMode&0o111 != 0))
+				e.syntaxHighlight = true
+			} else if e.mode == mode.Make || e.mode == mode.Just || e.mode == mode.Markdown || e.mode == mode.Doc || e.mode == mode.ReStructured || filepath.Base(filename) == "PKGBUILD" || filepath.Base(filename) == "APKBUILD" {
+				os.Chmod(filename, withExecutableBits(fi.Mode(), false))
+			}
 		}
 
 		// Stop the spinner
@@ -545,13 +583,13 @@ func (e *Editor) Save(c *vt100.Canvas, tty *vt100.TTY) error {
 // Returns true if the line was trimmed
 func (e *Editor) TrimRight(index LineIndex) bool {
 	n := int(index)
-	line, ok := e.lines[n]
+	line, ok := e.lines.Line(n)
 	if !ok {
 		return false
 	}
 	trimmedLine := []rune(strings.TrimRightFunc(string(line), unicode.IsSpace))
 	if len(trimmedLine) != len(line) {
-		e.lines[n] = trimmedLine
+		e.lines.SetLine(n, trimmedLine)
 		return true
 	}
 	return false
@@ -562,11 +600,11 @@ func (e *Editor) TrimRight(index LineIndex) bool {
 func (e *Editor) TrimLeft(index LineIndex) bool {
 	changed := false
 	n := int(index)
-	if line, ok := e.lines[n]; ok {
+	if line, ok := e.lines.Line(n); ok {
 		newRunes := []rune(strings.TrimLeftFunc(string(line), unicode.IsSpace))
 		// TODO: Just compare lengths instead of contents?
 		if string(newRunes) != string(line) {
-			e.lines[n] = newRunes
+			e.lines.SetLine(n, newRunes)
 			changed = true
 		}
 	}
@@ -592,24 +630,15 @@ func (e *Editor) DeleteRestOfLine() {
 		return
 	}
 	y := int(e.DataY())
-	if e.lines == nil {
-		e.lines = make(map[int][]rune)
-	}
-	v, ok := e.lines[y]
+	line, ok := e.lines.Line(y)
 	if !ok {
 		return
 	}
-	if v == nil {
-		e.lines[y] = make([]rune, 0)
-	}
-	if x > len(e.lines[y]) {
+	if x > len(line) {
 		return
 	}
-	e.lines[y] = e.lines[y][:x]
+	e.lines.SetLine(y, line[:x:x])
 	e.changed = true
-
-	// Make sure no lines are nil
-	e.MakeConsistent()
 }
 
 // DeleteLine will delete the given line index
@@ -620,43 +649,17 @@ func (e *Editor) DeleteLine(n LineIndex) {
 	}
 	lastLineIndex := LineIndex(e.Len() - 1)
 	endOfDocument := n >= lastLineIndex
+	e.cursorsLineDeleted(n)
 	if endOfDocument {
 		// Just delete this line
-		delete(e.lines, int(n))
+		e.lines.DeleteLine(int(n))
 		return
 	}
-	// TODO: Rely on the length of the hash map for finding the index instead of
-	//       searching through each line number key.
-	var maxIndex LineIndex
-	found := false
-	for k := range e.lines {
-		if LineIndex(k) > maxIndex {
-			maxIndex = LineIndex(k)
-			found = true
-		}
-	}
-	if !found {
-		// This should never happen
-		return
-	}
-	if _, ok := e.lines[int(maxIndex)]; !ok {
-		// The line numbers and the length of e.lines does not match
-		return
-	}
-	// Shift all lines after y:
-	// shift all lines after n one step closer to n, overwriting e.lines[n]
-	for index := n; index <= (maxIndex - 1); index++ {
-		i := int(index)
-		e.lines[i] = e.lines[i+1]
-	}
-	// Then delete the final item
-	delete(e.lines, int(maxIndex))
+	// Remove the line and move all lines after n one step up
+	e.lines.DeleteLine(int(n))
 
 	// This changes the document
 	e.changed = true
-
-	// Make sure no lines are nil
-	e.MakeConsistent()
 }
 
 // DeleteLineMoveBookmark will delete the given line index and also move the bookmark if it's after n
@@ -676,79 +679,72 @@ func (e *Editor) DeleteCurrentLineMoveBookmark(bookmark *Position) {
 // Delete will delete a character at the given position
 func (e *Editor) Delete() {
 	y := int(e.DataY())
-	lineLen := len(e.lines[y])
-	if _, ok := e.lines[y]; !ok || lineLen == 0 || (lineLen == 1 && unicode.IsSpace(e.lines[y][0])) {
-		// All keys in the map that are > y should be shifted -1.
-		// This also overwrites e.lines[y].
+	line, ok := e.lines.Line(y)
+	lineLen := len(line)
+	if !ok || lineLen == 0 || (lineLen == 1 && unicode.IsSpace(line[0])) {
+		// All lines that are below y are moved one step up.
+		// This also removes line y.
 		e.DeleteLine(LineIndex(y))
 		e.changed = true
 		return
 	}
 	x, err := e.DataX()
-	if err != nil || x > len(e.lines[y])-1 {
+	if err != nil || x > lineLen-1 {
 		// on the last index, just use every element but x
-		e.lines[y] = e.lines[y][:x]
-		// check if the next line exists
-		if _, ok := e.lines[y+1]; ok {
-			// then add the contents of the next line, if available
-			nextLine, ok := e.lines[y+1]
-			if ok && len(nextLine) > 0 {
-				e.lines[y] = append(e.lines[y], nextLine...)
-				// then delete the next line
-				e.DeleteLine(LineIndex(y + 1))
-			}
+		line = line[:x:x]
+		// then add the contents of the next line, if available
+		nextLine, ok := e.lines.Line(y + 1)
+		joinNextLine := ok && len(nextLine) > 0
+		if joinNextLine {
+			line = append(line, nextLine...)
+		}
+		e.lines.SetLine(y, line)
+		if joinNextLine {
+			e.cursorsLineJoined(LineIndex(y), x)
+			// then delete the next line
+			e.DeleteLine(LineIndex(y + 1))
 		}
 		e.changed = true
 		return
 	}
 	// Delete just this character
-	e.lines[y] = append(e.lines[y][:x], e.lines[y][x+1:]...)
+	newLine := make([]rune, 0, lineLen-1)
+	newLine = append(newLine, line[:x]...)
+	newLine = append(newLine, line[x+1:]...)
+	e.lines.SetLine(y, newLine)
+	e.cursorsDeleted(LineIndex(y), x, 1)
 	e.changed = true
-
-	// Make sure no lines are nil
-	e.MakeConsistent()
 }
 
 // Empty will check if the current editor contents are empty or not.
 // If there's only one line left and it is only whitespace, that will be considered empty as well.
 func (e *Editor) Empty() bool {
-	l := len(e.lines)
+	l := e.lines.Len()
 	if l == 0 {
 		return true
 	}
 	if l == 1 {
-		// Regardless of line number key, check the contents of the one remaining trimmed line
-		for _, line := range e.lines {
-			return len(strings.TrimSpace(string(line))) == 0
-		}
+		// Check the contents of the one remaining trimmed line
+		line, _ := e.lines.Line(0)
+		return len(strings.TrimSpace(string(line))) == 0
 	}
 	// > 1 lines
 	return false
 }
 
-// MakeConsistent creates an empty slice of runes for any empty lines,
-// to make sure that no line number below e.Len() points to a nil map.
-func (e *Editor) MakeConsistent() {
-	// Check if the keys in the map are consistent
-	for i := 0; i < len(e.lines); i++ {
-		if _, found := e.lines[i]; !found {
-			e.lines[i] = make([]rune, 0)
-			e.changed = true
-		}
-	}
-}
-
 // WithinLimit will check if a line is within the word wrap limit,
 // given a Y position.
 func (e *Editor) WithinLimit(y LineIndex) bool {
-	return len(e.lines[int(y)]) < e.wrapWidth
+	line, _ := e.lines.Line(int(y))
+	return len(line) < e.wrapWidth
 }
 
 // LastWord will return the last word of a line,
 // given a Y position. Returns an empty string if there is no last word.
 func (e *Editor) LastWord(y int) string {
 	// TODO: Use a faster method
-	words := strings.Fields(strings.TrimSpace(string(e.lines[y])))
+	line, _ := e.lines.Line(y)
+	words := strings.Fields(strings.TrimSpace(string(line)))
 	if len(words) > 0 {
 		return words[len(words)-1]
 	}
@@ -763,12 +759,12 @@ func (e *Editor) LastWord(y int) string {
 func (e *Editor) SplitOvershoot(index LineIndex, isSpace bool) ([]rune, []rune, bool) {
 	hasSpace := false
 
-	y := int(index)
+	line, _ := e.lines.Line(int(index))
 
 	// Maximum word length to not keep as one word
 	maxDistance := e.wrapWidth / 2
 	if e.WithinLimit(index) {
-		return e.lines[y], make([]rune, 0), false
+		return line, make([]rune, 0), false
 	}
 	splitPosition := e.wrapWidth
 	if isSpace {
@@ -778,7 +774,7 @@ func (e *Editor) SplitOvershoot(index LineIndex, isSpace bool) ([]rune, []rune,
 		// If a space is reached, check if it is too far away from n to be used as a split position, or not.
 		spacePosition := -1
 		for i := splitPosition; i >= 0; i-- {
-			if i < len(e.lines[y]) && unicode.IsSpace(e.lines[y][i]) {
+			if i < len(line) && unicode.IsSpace(line[i]) {
 				// Found a space at position i
 				spacePosition = i
 				break
@@ -799,11 +795,11 @@ func (e *Editor) SplitOvershoot(index LineIndex, isSpace bool) ([]rune, []rune,
 
 	n := splitPosition
 	// Make space for the two parts
-	first := make([]rune, len(e.lines[y][:n]))
-	second := make([]rune, len(e.lines[y][n:]))
+	first := make([]rune, len(line[:n]))
+	second := make([]rune, len(line[n:]))
 	// Copy the line into first and second
-	copy(first, e.lines[y][:n])
-	copy(second, e.lines[y][n:])
+	copy(first, line[:n])
+	copy(second, line[n:])
 
 	// If the second part starts with a space, remove it
 	if len(second) > 0 && unicode.IsSpace(second[0]) {
@@ -831,11 +827,12 @@ func (e *Editor) WrapAllLines() bool {
 
 		if len(first) > 0 && len(second) > 0 {
 
-			e.lines[i] = first
+			e.lines.SetLine(i, first)
 			if spaceBetween {
 				second = append(second, ' ')
 			}
-			e.lines[i+1] = append(second, e.lines[i+1]...)
+			nextLine, _ := e.lines.Line(i + 1)
+			e.lines.SetLine(i+1, append(second, nextLine...))
 			e.InsertLineBelowAt(LineIndex(i + 1))
 
 			// This isn't perfect, but it helps move the cursor somewhere in
@@ -854,16 +851,13 @@ func (e *Editor) WrapAllLines() bool {
 		e.pos.sy += insertedLines
 		if e.pos.sy < 0 {
 			e.pos.sy = 0
-		} else if e.pos.sy >= len(e.lines) {
-			e.pos.sy = len(e.lines) - 1
+		} else if e.pos.sy >= e.lines.Len() {
+			e.pos.sy = e.lines.Len() - 1
 		}
 		e.redraw = true
 		e.redrawCursor = true
 	}
 
-	// This appears to be needed as well
-	e.MakeConsistent()
-
 	return wrapped
 }
 
@@ -887,50 +881,30 @@ func (e *Editor) InsertLineAbove() {
 
 	y := int(lineIndex)
 
-	// Create new set of lines
-	lines2 := make(map[int][]rune)
+	// Insert a blank line above, shifting the current line and the lines below it down by 1
+	e.lines.InsertLine(y, []rune{})
+	e.cursorsLineInserted(lineIndex)
 
-	// If at the first line, just add a line at the top
+	// If at the first line, the blank line at the top should be kept
 	if y == 0 {
-
-		// Insert a blank line
-		lines2[0] = make([]rune, 0)
-		// Then insert all the other lines, shifted by 1
-		for k, v := range e.lines {
-			lines2[k+1] = v
-		}
 		y++
-
-	} else {
-		// For each line in the old map, if at (y-1), insert a blank line
-		// (insert a blank line above)
-		for k, v := range e.lines {
-			if k < (y - 1) {
-				lines2[k] = v
-			} else if k == (y - 1) {
-				lines2[k] = v
-				lines2[k+1] = make([]rune, 0)
-			} else if k > (y - 1) {
-				lines2[k+1] = v
-			}
-		}
 	}
 
-	// Use the new set of lines
-	e.lines = lines2
+	// Skip trailing newlines after this line
+	e.trimTrailingEmptyLines(y)
 
-	// Make sure no lines are nil
-	e.MakeConsistent()
+	e.changed = true
+}
 
-	// Skip trailing newlines after this line
-	for i := len(e.lines); i > y; i-- {
-		if len(e.lines[i]) == 0 {
-			delete(e.lines, i)
-		} else {
+// trimTrailingEmptyLines removes empty lines from the end of the document,
+// but never the line at the given index or any lines above it
+func (e *Editor) trimTrailingEmptyLines(y int) {
+	for i := e.lines.Len() - 1; i > y; i-- {
+		if line, _ := e.lines.Line(i); len(line) != 0 {
 			break
 		}
+		e.lines.DeleteLine(i)
 	}
-	e.changed = true
 }
 
 // InsertLineBelow will attempt to insert a new line below the current position
@@ -946,96 +920,55 @@ func (e *Editor) InsertLineBelow() {
 func (e *Editor) InsertLineBelowAt(index LineIndex) {
 	y := int(index)
 
-	// Make sure no lines are nil
-	e.MakeConsistent()
+	e.cursorsLineInserted(index + 1)
 
 	// If we are the the last line, add an empty line at the end and return
-	if y == (len(e.lines) - 1) {
-		e.lines[int(y)+1] = make([]rune, 0)
+	if y == (e.lines.Len() - 1) {
+		e.lines.InsertLine(y+1, []rune{})
 		e.changed = true
 		return
 	}
 
-	// Create new set of lines, with room for one more
-	lines2 := make(map[int][]rune, len(e.lines)+1)
-
-	// For each line in the old map, if at y, insert a blank line
-	// (insert a blank line below)
-	for k, v := range e.lines {
-		if k < y {
-			lines2[k] = v
-		} else if k == y {
-			lines2[k] = v
-			lines2[k+1] = make([]rune, 0)
-		} else if k > y {
-			lines2[k+1] = v
-		}
-	}
-	// Use the new set of lines
-	e.lines = lines2
+	// Insert a blank line below
+	e.lines.InsertLine(y+1, []rune{})
 
 	// Skip trailing newlines after this line
-	for i := len(e.lines); i > y; i-- {
-		if len(e.lines[i]) == 0 {
-			delete(e.lines, i)
-		} else {
-			break
-		}
-	}
+	e.trimTrailingEmptyLines(y)
 
 	e.changed = true
 }
 
-// Insert will insert a rune at the given position, with no word wrap,
-// but MakeConsisten will be called.
+// Insert will insert a rune at the given position, with no word wrap
 func (e *Editor) Insert(r rune) {
 	// Ignore it if the current position is out of bounds
 	x, _ := e.DataX()
 
 	y := int(e.DataY())
 
-	// If there are no lines, initialize and set the 0th rune to the given one
-	if e.lines == nil {
-		e.lines = make(map[int][]rune)
-		e.lines[0] = []rune{r}
-		return
-	}
-
-	// If the current line is empty, initialize it with a line that is just the given rune
-	_, ok := e.lines[y]
+	// If the current line is missing, initialize it with a line that is just the given rune
+	line, ok := e.lines.Line(y)
 	if !ok {
-		e.lines[y] = []rune{r}
+		e.lines.SetLine(y, []rune{r})
 		return
 	}
-	if len(e.lines[y]) < x {
+	if len(line) < x {
 		// Can only insert in the existing block of text
 		return
 	}
-	newlineLength := len(e.lines[y]) + 1
-	newline := make([]rune, newlineLength)
-	for i := 0; i < x; i++ {
-		newline[i] = e.lines[y][i]
-	}
+	newline := make([]rune, len(line)+1)
+	copy(newline, line[:x])
 	newline[x] = r
-	for i := x + 1; i < newlineLength; i++ {
-		newline[i] = e.lines[y][i-1]
-	}
-	e.lines[y] = newline
+	copy(newline[x+1:], line[x:])
+	e.lines.SetLine(y, newline)
+	e.cursorsInserted(LineIndex(y), x, 1)
 
 	e.changed = true
-
-	// Make sure no lines are nil
-	e.MakeConsistent()
 }
 
 // CreateLineIfMissing will create a line at the given Y index, if it's missing
 func (e *Editor) CreateLineIfMissing(n LineIndex) {
-	if e.lines == nil {
-		e.lines = make(map[int][]rune)
-	}
-	_, ok := e.lines[int(n)]
-	if !ok {
-		e.lines[int(n)] = make([]rune, 0)
+	if _, ok := e.lines.Line(int(n)); !ok {
+		e.lines.SetLine(int(n), []rune{})
 		e.changed = true
 	}
 }
@@ -1064,13 +997,9 @@ func (e *Editor) SetRainbow(rainbowParenthesis bool) {
 // Any previous contents of that line is removed.
 func (e *Editor) SetLine(n LineIndex, s string) {
 	e.CreateLineIfMissing(n)
-	e.lines[int(n)] = make([]rune, 0)
-	counter := 0
-	// It's important not to use the index value when looping over a string,
-	// unless the byte index is what one's after, as opposed to the rune index.
-	for _, letter := range s {
-		e.Set(counter, n, letter)
-		counter++
+	e.lines.SetLine(int(n), []rune(s))
+	if s != "" {
+		e.changed = true
 	}
 }
 
@@ -1091,7 +1020,7 @@ func (e *Editor) SplitLine() bool {
 	y := e.DataY()
 
 	// Get the contents of this line
-	runeLine := e.lines[int(y)]
+	runeLine, _ := e.lines.Line(int(y))
 	if len(runeLine) < 2 {
 		// Did not split
 		return false
@@ -1103,6 +1032,7 @@ func (e *Editor) SplitLine() bool {
 	// Replace this line with the left contents
 	e.SetLine(y, leftContents)
 	e.SetLine(y+1, rightContents)
+	e.cursorsLineSplit(y, x)
 	// Splitted
 	return true
 }
@@ -1118,7 +1048,8 @@ func (e *Editor) DataX() (int, error) {
 	found := false
 	dataX := 0
 	runeCounter := 0
-	for _, r := range e.lines[dataY] {
+	line, _ := e.lines.Line(dataY)
+	for _, r := range line {
 		// When we reached the correct screen position, use i as the data position
 		if screenCounter == (e.pos.sx + e.pos.offsetX) {
 			dataX = runeCounter
@@ -1163,30 +1094,30 @@ func (e *Editor) NextLine(y LineIndex, c *vt100.Canvas, status *StatusBar) {
 // InsertBelow will insert the given rune at the start of the line below,
 // starting a new line if required.
 func (e *Editor) InsertBelow(y int, r rune) {
-	if _, ok := e.lines[y+1]; !ok {
+	if nextLine, ok := e.lines.Line(y + 1); !ok {
 		// If the next line does not exist, create one containing just "r"
-		e.lines[y+1] = []rune{r}
-	} else if len(e.lines[y+1]) > 0 {
+		e.lines.SetLine(y+1, []rune{r})
+	} else if len(nextLine) > 0 {
 		// If the next line is non-empty, insert "r" at the start
-		e.lines[y+1] = append([]rune{r}, e.lines[y+1][:]...)
+		e.lines.SetLine(y+1, append([]rune{r}, nextLine...))
 	} else {
 		// The next line exists, but is of length 0, should not happen, just replace it
-		e.lines[y+1] = []rune{r}
+		e.lines.SetLine(y+1, []rune{r})
 	}
 }
 
 // InsertStringBelow will insert the given string at the start of the line below,
 // starting a new line if required.
 func (e *Editor) InsertStringBelow(y int, s string) {
-	if _, ok := e.lines[y+1]; !ok {
+	if nextLine, ok := e.lines.Line(y + 1); !ok {
 		// If the next line does not exist, create one containing the string
-		e.lines[y+1] = []rune(s)
-	} else if len(e.lines[y+1]) > 0 {
+		e.lines.SetLine(y+1, []rune(s))
+	} else if len(nextLine) > 0 {
 		// If the next line is non-empty, insert the string at the start
-		e.lines[y+1] = append([]rune(s), e.lines[y+1][:]...)
+		e.lines.SetLine(y+1, append([]rune(s), nextLine...))
 	} else {
 		// The next line exists, but is of length 0, should not happen, just replace it
-		e.lines[y+1] = []rune(s)
+		e.lines.SetLine(y+1, []rune(s))
 	}
 }
 
@@ -1205,6 +1136,34 @@ func (e *Editor) InsertStringAndMove(c *vt100.Canvas, s string) {
 	}
 }
 
+// InsertText will insert a string the same way as pasted text is inserted: over the selected text or rectangle,
+// if there is one, or else at each of the cursors. Each newline splits the line, and CRLF and CR line endings are
+// treated as newlines. Afterwards, the cursor is placed at the end of the inserted text.
+func (e *Editor) InsertText(c *vt100.Canvas, status *StatusBar, s string) {
+	s = strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\r", "\n")
+	switch {
+	case e.HasColumnSelection():
+		e.PasteRectangle(c, strings.Split(s, "\n"))
+	case e.HasSelection():
+		e.ReplaceSelection(c, status, nil, s)
+	case e.HasCursors():
+		for _, r := range s {
+			if r == '\n' {
+				const indent = false
+				e.newLineAtCursors(c, indent)
+			} else {
+				e.InsertAtCursors(c, r)
+			}
+		}
+	default:
+		p := e.CursorTextPosition()
+		e.GoToTextPosition(c, status, e.ReplaceRange(p, p, s, nil))
+	}
+	e.changed = true
+	e.redraw = true
+	e.redrawCursor = true
+}
+
 // InsertString will insert a string without newlines at the current data position.
 // his will also call e.WriteRune and e.Next, as needed.
 func (e *Editor) InsertString(c *vt100.Canvas, s string) {
@@ -1231,7 +1190,7 @@ func (e *Editor) LeftRune() rune {
 	x, err := e.DataX()
 	if err != nil {
 		// This is after the line contents, return the last rune
-		runes, ok := e.lines[int(y)]
+		runes, ok := e.lines.Line(int(y))
 		if !ok || len(runes) == 0 {
 			return rune(0)
 		}
@@ -1452,7 +1411,7 @@ func (e *Editor) ScrollDown(c *vt100.Canvas, status *StatusBar, scrollSpeed int)
 	canScroll := scrollSpeed
 
 	// Last y position in the canvas
-	canvasLastY := int(c.H() - 1)
+	canvasLastY := viewHeight(c) - 1
 
 	// Retrieve the current editor scroll offset offset
 	mut.RLock()
@@ -1611,7 +1570,7 @@ func (e *Editor) AfterLineScreenContents() bool {
 func (e *Editor) AfterScreenWidth(c *vt100.Canvas) bool {
 	w := 80 // default width
 	if c != nil {
-		w = int(c.W())
+		w = viewWidth(c)
 	}
 	return e.pos.sx >= w
 }
@@ -1692,7 +1651,7 @@ func (e *Editor) GoTo(dataY LineIndex, c *vt100.Canvas, status *StatusBar) (bool
 	h := 25
 	if c != nil {
 		// Get the current terminal height
-		h = int(c.Height())
+		h = viewHeight(c)
 	}
 
 	// Is the place we want to go within the current scroll window?
@@ -1836,12 +1795,14 @@ func (e *Editor) ColIndex() ColIndex {
 // * the current word count
 // * the currently detected file mode
 // * the current indentation mode (tabs or spaces)
+// * the charset that the file will be saved with
+// * the line endings that the file will be saved with
 func (e *Editor) PositionAndModeInfo() string {
-	indentation := "spaces"
-	if !e.indentation.Spaces {
-		indentation = "tabs"
+	indentation := "tabs"
+	if e.indentation.Spaces {
+		indentation = fmt.Sprintf("%d spaces", e.indentation.PerTab)
 	}
-	return fmt.Sprintf("line %d col %d rune %U words %d, [%s] %s", e.LineNumber(), e.ColNumber(), e.Rune(), e.WordCount(), e.mode, indentation)
+	return fmt.Sprintf("line %d col %d rune %U words %d, [%s] %s, %s, %s", e.LineNumber(), e.ColNumber(), e.Rune(), e.WordCount(), e.mode, indentation, charsetName(e.charset), e.lineEndings)
 }
 
 // GoToPosition can go to the given position struct and use it as the new position
@@ -1901,7 +1862,7 @@ func (e *Editor) Center(c *vt100.Canvas) {
 	// Find the terminal height
 	h := 25
 	if c != nil {
-		h = int(c.Height())
+		h = viewHeight(c)
 	}
 
 	// General information about how the positions and offsets relate:
@@ -1935,34 +1896,38 @@ func (e *Editor) Center(c *vt100.Canvas) {
 	e.pos.sy = newScreenY
 }
 
-// CommentOn will insert a comment marker (like # or //) in front of a line
-func (e *Editor) CommentOn(commentMarker string) {
+// commented returns the given line with a comment marker (like # or //) in front of it
+func (e *Editor) commented(line, commentMarker string) string {
 	space := " "
 	if e.mode == mode.Config { // For config files, assume things will be toggled in and out, without a space
 		space = ""
 	}
-	e.SetCurrentLine(commentMarker + space + e.CurrentLine())
+	return commentMarker + space + line
 }
 
-// CommentOff will remove "//" or "// " from the front of the line if "//" is given
-func (e *Editor) CommentOff(commentMarker string) {
-	var (
-		changed      bool
-		newContents  string
-		contents     = e.CurrentLine()
-		trimContents = strings.TrimSpace(contents)
-	)
+// uncommented returns the given line with "//" or "// " removed from the front, if "//" is given.
+// Returns false if the line was not commented out.
+func (e *Editor) uncommented(line, commentMarker string) (string, bool) {
+	trimContents := strings.TrimSpace(line)
 	commentMarkerPlusSpace := commentMarker + " "
 	if strings.HasPrefix(trimContents, commentMarkerPlusSpace) {
 		// toggle off comment
-		newContents = strings.Replace(contents, commentMarkerPlusSpace, "", 1)
-		changed = true
+		return strings.Replace(line, commentMarkerPlusSpace, "", 1), true
 	} else if strings.HasPrefix(trimContents, commentMarker) {
 		// toggle off comment
-		newContents = strings.Replace(contents, commentMarker, "", 1)
-		changed = true
+		return strings.Replace(line, commentMarker, "", 1), true
 	}
-	if changed {
+	return line, false
+}
+
+// CommentOn will insert a comment marker (like # or //) in front of a line
+func (e *Editor) CommentOn(commentMarker string) {
+	e.SetCurrentLine(e.commented(e.CurrentLine(), commentMarker))
+}
+
+// CommentOff will remove "//" or "// " from the front of the line if "//" is given
+func (e *Editor) CommentOff(commentMarker string) {
+	if newContents, changed := e.uncommented(e.CurrentLine(), commentMarker); changed {
 		e.SetCurrentLine(newContents)
 		// If the line was shortened and the cursor ended up after the line, move it
 		if e.AfterEndOfLine() {
@@ -2010,7 +1975,7 @@ func (e *Editor) Block(n LineIndex) string {
 		s      string
 	)
 	for {
-		line, ok = e.lines[int(n)]
+		line, ok = e.lines.Line(int(n))
 		n++
 		if !ok || len(line) == 0 {
 			// End of document, empty line or invalid line: end of block
@@ -2108,7 +2073,7 @@ func (e *Editor) HorizontalScrollIfNeeded(c *vt100.Canvas) {
 	x := e.pos.sx
 	w := 80
 	if c != nil {
-		w = int(c.W())
+		w = viewWidth(c)
 	}
 	if x < w {
 		e.pos.offsetX = 0
@@ -2125,7 +2090,7 @@ func (e *Editor) VerticalScrollIfNeeded(c *vt100.Canvas) {
 	y := e.pos.sy
 	h := 25
 	if c != nil {
-		h = int(c.H())
+		h = viewHeight(c)
 	}
 	if y < h {
 		e.pos.offsetY = 0
@@ -2158,66 +2123,6 @@ func (e *Editor) AbsFilename() (string, error) {
 	return filepath.Clean(absFilename), nil
 }
 
-// Switch replaces the current editor with a new Editor that opens the given file.
-// The undo stack is also swapped.
-// Only works for switching to one file, and then back again.
-func (e *Editor) Switch(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *LockKeeper, filenameToOpen string) error {
-	absFilename, err := e.AbsFilename()
-	if err != nil {
-		return err
-	}
-
-	// About to switch from absFilename to filenameToOpen
-
-	// Unlock and save the lock file
-	lk.Unlock(absFilename)
-	lk.Save()
-	// Now open the header filename instead of the current file. Save the current file first.
-	e.Save(c, tty)
-	// Save the current location in the location history and write it to file
-	e.SaveLocation(absFilename, locationHistory)
-
-	var (
-		e2             *Editor
-		statusMessage  string
-		displayedImage bool
-	)
-
-	if switchBuffer.Len() == 1 {
-		// Load the Editor from the switchBuffer if switchBuffer has length 1, then use that editor.
-		switchBuffer.Restore(e)
-		undo, switchUndoBackup = switchUndoBackup, undo
-	} else {
-		fnord := FilenameOrData{filenameToOpen, []byte{}, 0, false}
-		e2, statusMessage, displayedImage, err = NewEditor(tty, c, fnord, LineNumber(0), ColNumber(0), e.Theme, e.syntaxHighlight, false)
-		if err == nil { // no issue
-			// Save the current Editor to the switchBuffer if switchBuffer if empty, then use the new editor.
-			switchBuffer.Snapshot(e)
-
-			// Now use e2 as the current editor
-			*e = *e2
-			(*e).lines = (*e2).lines
-			(*e).pos = (*e2).pos
-		} else if displayedImage {
-			panic("displayed an image while switching from one Editor struct to another")
-		} else {
-			// logf("While switching from %s to %s, got error: %s\n", absFilename, filenameToOpen, err)
-			panic(err)
-		}
-		fnord.SetTitle()
-		undo, switchUndoBackup = switchUndoBackup, undo
-	}
-
-	if statusMessage != "" {
-		status.SetMessageAfterRedraw(statusMessage)
-	}
-
-	e.redraw = true
-	e.redrawCursor = true
-
-	return err
-}
-
 // TrimmedLine returns the current line, trimmed in both ends
 func (e *Editor) TrimmedLine() string {
 	return strings.TrimSpace(e.CurrentLine())
@@ -2242,7 +2147,7 @@ func (e *Editor) LineContentsFromCursorPosition() string {
 // The word may contain numbers or dashes, but not spaces or special characters.
 func (e *Editor) WordAtCursor() string {
 	y := int(e.DataY())
-	runes, ok := e.lines[y]
+	runes, ok := e.lines.Line(y)
 	if !ok {
 		// This should never happen
 		return ""
@@ -2301,7 +2206,7 @@ func (e *Editor) WordAtCursor() string {
 // LettersBeforeCursor returns the current word up until the cursor (for autocompletion)
 func (e *Editor) LettersBeforeCursor() string {
 	y := int(e.DataY())
-	runes, ok := e.lines[y]
+	runes, ok := e.lines.Line(y)
 	if !ok {
 		// This should never happen
 		return ""
@@ -2336,7 +2241,7 @@ func (e *Editor) LettersBeforeCursor() string {
 // Will also include ".".
 func (e *Editor) LettersOrDotBeforeCursor() string {
 	y := int(e.DataY())
-	runes, ok := e.lines[y]
+	runes, ok := e.lines.Line(y)
 	if !ok {
 		// This should never happen
 		return ""
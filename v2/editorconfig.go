@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// EditorConfig contains the settings from .editorconfig files that apply to a single file.
+// See https://editorconfig.org for the file format. Unset values are blank, 0 or nil.
+type EditorConfig struct {
+	insertFinalNewline     *bool  // should the file end with a newline, or not?
+	trimTrailingWhitespace *bool  // should trailing whitespace be removed from each line when saving?
+	indentStyle            string // "space" or "tab"
+	endOfLine              string // "lf", "crlf" or "cr"
+	charset                string // "utf-8", "utf-8-bom", "latin1", "utf-16le" or "utf-16be"
+	indentSize             int    // the number of columns per indentation level
+	tabWidth               int    // the number of columns that a tab character is displayed as
+	maxLineLength          int    // the column to word wrap at
+}
+
+// editorConfigSection is a [glob] section in an .editorconfig file, with its properties
+type editorConfigSection struct {
+	re         *regexp.Regexp
+	properties [][2]string // key and value pairs, in the order they appear in the file
+}
+
+// FindEditorConfig looks for .editorconfig files in the directory of the given file and in the
+// directories above it, until a file with "root = true" is found. The properties that apply to
+// the given file are collected, where the files closer to the given file take precedence.
+// Returns nil if no properties apply.
+func FindEditorConfig(filename string) *EditorConfig {
+	absFilename, err := filepath.Abs(filename)
+	if err != nil {
+		return nil
+	}
+	var configFiles []string
+	for dir := filepath.Dir(absFilename); ; dir = filepath.Dir(dir) {
+		configFilename := filepath.Join(dir, ".editorconfig")
+		if root, err := editorConfigIsRoot(configFilename); err == nil {
+			configFiles = append(configFiles, configFilename)
+			if root {
+				break
+			}
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			break
+		}
+	}
+	properties := make(map[string]string)
+	// Apply the outermost file first, so that the files closer to the given file override it
+	for i := len(configFiles) - 1; i >= 0; i-- {
+		sections, err := parseEditorConfig(configFiles[i])
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(filepath.Dir(configFiles[i]), absFilename)
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		for _, section := range sections {
+			if !section.re.MatchString(rel) {
+				continue
+			}
+			for _, kv := range section.properties {
+				if kv[1] == "unset" {
+					// Remove the effect of the property, as if it had never been set
+					delete(properties, kv[0])
+					continue
+				}
+				properties[kv[0]] = kv[1]
+			}
+		}
+	}
+	return newEditorConfig(properties)
+}
+
+// editorConfigIsRoot checks if the given .editorconfig file has "root = true" before the first section.
+// Returns an error if the file can not be read.
+func editorConfigIsRoot(configFilename string) (bool, error) {
+	f, err := os.Open(configFilename)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			break
+		}
+		if key, value, ok := editorConfigProperty(line); ok && key == "root" {
+			return value == "true", nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// editorConfigProperty splits a "key = value" line into a lowercase key and a value.
+// Values are lowercased too, since all the supported values are case-insensitive.
+func editorConfigProperty(line string) (string, string, bool) {
+	if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+		return "", "", false
+	}
+	fields := strings.SplitN(line, "=", 2)
+	if len(fields) != 2 {
+		return "", "", false
+	}
+	key := strings.ToLower(strings.TrimSpace(fields[0]))
+	value := strings.ToLower(strings.TrimSpace(fields[1]))
+	return key, value, key != ""
+}
+
+// parseEditorConfig reads the sections of the given .editorconfig file
+func parseEditorConfig(configFilename string) ([]editorConfigSection, error) {
+	f, err := os.Open(configFilename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var (
+		sections []editorConfigSection
+		current  = -1 // the index of the current section
+	)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			re, err := regexp.Compile(editorConfigGlobToRegexp(line[1 : len(line)-1]))
+			if err != nil {
+				// Skip the properties in sections that can not be parsed
+				current = -1
+				continue
+			}
+			sections = append(sections, editorConfigSection{re: re})
+			current = len(sections) - 1
+			continue
+		}
+		if key, value, ok := editorConfigProperty(line); ok && current >= 0 {
+			sections[current].properties = append(sections[current].properties, [2]string{key, value})
+		}
+	}
+	return sections, scanner.Err()
+}
+
+// editorConfigGlobToRegexp converts a section name from an .editorconfig file to a regular expression,
+// that matches paths relative to the directory of the .editorconfig file, with / as the separator.
+// Globs without a / match files with that name in any directory.
+func editorConfigGlobToRegexp(glob string) string {
+	var sb strings.Builder
+	if strings.Contains(glob, "/") {
+		glob = strings.TrimPrefix(glob, "/")
+		sb.WriteString("^")
+	} else {
+		sb.WriteString("^(.*/)?")
+	}
+	runes := []rune(glob)
+	braceDepth := 0
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch r {
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+				sb.WriteString(regexp.QuoteMeta(string(runes[i])))
+			}
+		case '*':
+			if i+1 < len(runes) && runes[i+1] == '*' {
+				sb.WriteString(".*")
+				i++
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			end := indexRuneFrom(runes, i+1, ']')
+			if end < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := runes[i+1 : end]
+			sb.WriteString("[")
+			if len(class) > 0 && class[0] == '!' {
+				sb.WriteString("^")
+				class = class[1:]
+			}
+			sb.WriteString(strings.ReplaceAll(string(class), `\`, `\\`))
+			sb.WriteString("]")
+			i = end
+		case '{':
+			if end := indexRuneFrom(runes, i+1, '}'); end >= 0 {
+				inner := string(runes[i+1 : end])
+				if numbers := strings.SplitN(inner, "..", 2); len(numbers) == 2 {
+					from, err1 := strconv.Atoi(numbers[0])
+					to, err2 := strconv.Atoi(numbers[1])
+					if err1 == nil && err2 == nil && from <= to && to-from <= 1000 {
+						var alternatives []string
+						for n := from; n <= to; n++ {
+							alternatives = append(alternatives, strconv.Itoa(n))
+						}
+						sb.WriteString("(" + strings.Join(alternatives, "|") + ")")
+						i = end
+						continue
+					}
+				}
+				if !strings.ContainsAny(inner, ",{") {
+					// A single word in braces is matched literally
+					sb.WriteString(regexp.QuoteMeta("{" + inner + "}"))
+					i = end
+					continue
+				}
+			}
+			braceDepth++
+			sb.WriteString("(")
+		case '}':
+			if braceDepth > 0 {
+				braceDepth--
+				sb.WriteString(")")
+			} else {
+				sb.WriteString(`\}`)
+			}
+		case ',':
+			if braceDepth > 0 {
+				sb.WriteString("|")
+			} else {
+				sb.WriteString(",")
+			}
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	// Leave any unclosed braces as groups, so that the expression can still be compiled
+	sb.WriteString(strings.Repeat(")", braceDepth))
+	sb.WriteString("$")
+	return sb.String()
+}
+
+// indexRuneFrom returns the index of the first r in runes, starting at the given index, or -1
+func indexRuneFrom(runes []rune, from int, r rune) int {
+	for i := from; i < len(runes); i++ {
+		if runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
+
+// newEditorConfig creates an EditorConfig from the given properties, or returns nil if none of them are supported
+func newEditorConfig(properties map[string]string) *EditorConfig {
+	var (
+		ec    EditorConfig
+		found bool
+	)
+	positive := func(value string) int {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			found = true
+			return n
+		}
+		return 0
+	}
+	boolean := func(value string) *bool {
+		if value != "true" && value != "false" {
+			return nil
+		}
+		found = true
+		b := value == "true"
+		return &b
+	}
+	if value := properties["indent_style"]; value == "space" || value == "tab" {
+		ec.indentStyle = value
+		found = true
+	}
+	ec.tabWidth = positive(properties["tab_width"])
+	if properties["indent_size"] == "tab" {
+		ec.indentSize = ec.tabWidth
+	} else {
+		ec.indentSize = positive(properties["indent_size"])
+	}
+	// tab_width defaults to indent_size
+	if ec.tabWidth == 0 {
+		ec.tabWidth = ec.indentSize
+	}
+	if value := properties["end_of_line"]; value == "lf" || value == "crlf" || value == "cr" {
+		ec.endOfLine = value
+		found = true
+	}
+	switch value := properties["charset"]; value {
+	case "utf-8", "utf-8-bom", "latin1", "utf-16le", "utf-16be":
+		ec.charset = value
+		found = true
+	}
+	ec.insertFinalNewline = boolean(properties["insert_final_newline"])
+	ec.trimTrailingWhitespace = boolean(properties["trim_trailing_whitespace"])
+	ec.maxLineLength = positive(properties["max_line_length"])
+	if !found {
+		return nil
+	}
+	return &ec
+}
+
+// TrimTrailingWhitespace checks if trailing whitespace should be removed when saving, which is the default
+func (ec *EditorConfig) TrimTrailingWhitespace() bool {
+	return ec == nil || ec.trimTrailingWhitespace == nil || *ec.trimTrailingWhitespace
+}
+
+// InsertFinalNewline checks if the file should end with a newline when saving, which is the default
+func (ec *EditorConfig) InsertFinalNewline() bool {
+	return ec == nil || ec.insertFinalNewline == nil || *ec.insertFinalNewline
+}
+
+// LineEndings returns the line endings that should be used when saving, and true if they are set
+func (ec *EditorConfig) LineEndings() (LineEndings, bool) {
+	if ec == nil {
+		return LF, false
+	}
+	switch ec.endOfLine {
+	case "lf":
+		return LF, true
+	case "crlf":
+		return CRLF, true
+	case "cr":
+		return CR, true
+	}
+	return LF, false
+}
+
+// Charset returns the charset that the file should be saved with, or a blank string for UTF-8
+func (ec *EditorConfig) Charset() string {
+	if ec == nil {
+		return ""
+	}
+	return ec.charset
+}
+
+// applyEditorConfig changes the indentation, word wrap and line ending settings according to the .editorconfig
+// files that apply to the current file, if any
+func (e *Editor) applyEditorConfig() {
+	ec := e.editorConfig
+	if ec == nil {
+		return
+	}
+	switch ec.indentStyle {
+	case "space":
+		e.indentation.Spaces = true
+	case "tab":
+		e.indentation.Spaces = false
+	}
+	if e.indentation.Spaces && ec.indentSize > 0 {
+		e.indentation.PerTab = ec.indentSize
+	} else if !e.indentation.Spaces && ec.tabWidth > 0 {
+		e.indentation.PerTab = ec.tabWidth
+	}
+	if ec.maxLineLength > 0 {
+		e.wrapWidth = ec.maxLineLength
+	}
+	if le, ok := ec.LineEndings(); ok {
+		e.ConvertLineEndings(le)
+		e.changed = false
+	}
+}
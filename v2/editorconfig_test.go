@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestEditorConfigGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		glob    string
+		path    string
+		matches bool
+	}{
+		{"*", "main.go", true},
+		{"*", "cmd/main.go", true},
+		{"*.go", "cmd/main.go", true},
+		{"*.go", "main.c", false},
+		{"*.{js,py}", "lib/a.py", true},
+		{"*.{js,py}", "lib/a.rs", false},
+		{"Makefile", "sub/Makefile", true},
+		{"/Makefile", "sub/Makefile", false},
+		{"lib/**.js", "lib/a/b/c.js", true},
+		{"lib/*.js", "lib/a/b.js", false},
+		{"file[0-9].txt", "file3.txt", true},
+		{"file[!0-9].txt", "file3.txt", false},
+		{"v{1..3}.txt", "v2.txt", true},
+		{"v{1..3}.txt", "v4.txt", false},
+		{"a?c", "abc", true},
+	}
+	for _, test := range tests {
+		if re, err := regexp.Compile(editorConfigGlobToRegexp(test.glob)); err != nil {
+			t.Errorf("could not compile %q: %v", test.glob, err)
+		} else if re.MatchString(test.path) != test.matches {
+			t.Errorf("expected %q matching %q to be %v", test.glob, test.path, test.matches)
+		}
+	}
+}
+
+func TestFindEditorConfig(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	outer := "root = true\n\n[*]\nindent_style = space\nindent_size = 4\ninsert_final_newline = true\n\n[*.go]\nindent_style = tab\n"
+	inner := "# Closer files take precedence\n[*.py]\nindent_size = 2\nmax_line_length = 100\nend_of_line = crlf\ntrim_trailing_whitespace = false\n"
+	if err := os.WriteFile(filepath.Join(dir, ".editorconfig"), []byte(outer), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sub, ".editorconfig"), []byte(inner), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ec := FindEditorConfig(filepath.Join(sub, "main.py"))
+	if ec == nil {
+		t.Fatal("expected .editorconfig settings for main.py")
+	}
+	if ec.indentStyle != "space" || ec.indentSize != 2 || ec.maxLineLength != 100 || ec.endOfLine != "crlf" || ec.TrimTrailingWhitespace() || !ec.InsertFinalNewline() {
+		t.Errorf("unexpected settings for main.py: %+v", ec)
+	}
+
+	e := NewSimpleEditor(80)
+	e.editorConfig = FindEditorConfig(filepath.Join(sub, "main.go"))
+	e.applyEditorConfig()
+	if e.indentation.Spaces || e.indentation.PerTab != 4 {
+		t.Errorf("expected tabs that are 4 wide for main.go, got %v", e.indentation)
+	}
+
+	// Properties can be unset by the files that are closer to the given file
+	if err := os.WriteFile(filepath.Join(sub, ".editorconfig"), []byte("[*.md]\nindent_style = unset\nindent_size = unset\ninsert_final_newline = unset\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if ec := FindEditorConfig(filepath.Join(sub, "README.md")); ec != nil {
+		t.Errorf("expected no settings for README.md, got %+v", ec)
+	}
+	if ec := FindEditorConfig(filepath.Join(sub, "main.go")); ec == nil || ec.indentStyle != "tab" || ec.indentSize != 4 {
+		t.Errorf("expected the settings for main.go to be kept, got %+v", ec)
+	}
+
+	var nothing *EditorConfig
+	if _, set := nothing.LineEndings(); set || !nothing.TrimTrailingWhitespace() || !nothing.InsertFinalNewline() || nothing.Charset() != "" {
+		t.Error("expected the default settings when there is no .editorconfig")
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+var (
+	// utf8BOM is the byte order mark that some editors place at the start of UTF-8 files
+	utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+	// utf16LEBOM and utf16BEBOM are the byte order marks for little endian and big endian UTF-16
+	utf16LEBOM = []byte{0xff, 0xfe}
+	utf16BEBOM = []byte{0xfe, 0xff}
+
+	// windows1252 maps the bytes 0x80 to 0x9f to runes, for Windows-1252.
+	// The bytes that are not used by Windows-1252 are mapped to the same code points as in Latin-1.
+	windows1252 = [32]rune{
+		'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0x8d, 'Ž', 0x8f,
+		0x90, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0x9d, 'ž', 'Ÿ',
+	}
+
+	// charsetNames are the names of the charsets, for displaying in the status bar
+	charsetNames = map[string]string{
+		"":             "UTF-8",
+		"utf-8":        "UTF-8",
+		"utf-8-bom":    "UTF-8 with BOM",
+		"latin1":       "ISO-8859-1",
+		"windows-1252": "Windows-1252",
+		"utf-16le":     "UTF-16LE",
+		"utf-16be":     "UTF-16BE",
+		"utf-16le-bom": "UTF-16LE with BOM",
+		"utf-16be-bom": "UTF-16BE with BOM",
+	}
+)
+
+// charsetName returns a name for the given charset, for displaying to the user
+func charsetName(charset string) string {
+	if name, ok := charsetNames[strings.ToLower(charset)]; ok {
+		return name
+	}
+	return charset
+}
+
+// isUTF8 checks if the given charset is UTF-8 without a byte order mark, which is the default
+func isUTF8(charset string) bool {
+	return charset == "" || strings.ToLower(charset) == "utf-8"
+}
+
+// detectCharset tries to find out which charset the given data is encoded with, by looking for
+// a byte order mark, for UTF-16 text without a byte order mark and for text that is not valid UTF-8.
+// Returns a blank string for UTF-8, and for data that looks like it is binary.
+func detectCharset(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, utf8BOM):
+		return "utf-8-bom"
+	case bytes.HasPrefix(data, utf16LEBOM):
+		return "utf-16le-bom"
+	case bytes.HasPrefix(data, utf16BEBOM):
+		return "utf-16be-bom"
+	}
+	if charset := detectUTF16(data); charset != "" {
+		return charset
+	}
+	if utf8.Valid(data) || !singleByteText(data) {
+		return ""
+	}
+	// The bytes 0x80 to 0x9f are control characters in Latin-1, but printable in Windows-1252
+	for _, b := range data {
+		if b >= 0x80 && b <= 0x9f {
+			return "windows-1252"
+		}
+	}
+	return "latin1"
+}
+
+// detectUTF16 checks if the given data looks like UTF-16 text without a byte order mark,
+// by counting the zero bytes in the first part of the data. Text with mostly ASCII letters has
+// a zero byte in every other position. Returns "utf-16le", "utf-16be" or a blank string.
+func detectUTF16(data []byte) string {
+	const maxBytes = 4096
+	if len(data) < 4 || len(data)%2 != 0 {
+		return ""
+	}
+	if len(data) > maxBytes {
+		data = data[:maxBytes]
+	}
+	var evenZeros, oddZeros int
+	for i := 0; i+1 < len(data); i += 2 {
+		if data[i] == 0 {
+			evenZeros++
+		}
+		if data[i+1] == 0 {
+			oddZeros++
+		}
+	}
+	pairs := len(data) / 2
+	switch {
+	case oddZeros*10 >= pairs*4 && evenZeros*20 < pairs:
+		return "utf-16le"
+	case evenZeros*10 >= pairs*4 && oddZeros*20 < pairs:
+		return "utf-16be"
+	}
+	return ""
+}
+
+// singleByteText checks if the given data looks like text in a single-byte charset,
+// by checking that there are no null bytes and no unusual control characters
+func singleByteText(data []byte) bool {
+	for _, b := range data {
+		if b < 0x20 && b != '\t' && b != '\n' && b != '\r' && b != '\f' && b != '\v' && b != 0x1b {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeCharset encodes the given text with the given charset, which can be "utf-8", "utf-8-bom",
+// "latin1", "utf-16le" or "utf-16be", as used in .editorconfig files, or "windows-1252",
+// "utf-16le-bom" or "utf-16be-bom". A blank charset is the same as "utf-8".
+func encodeCharset(s, charset string) ([]byte, error) {
+	switch strings.ToLower(charset) {
+	case "", "utf-8":
+		return []byte(s), nil
+	case "utf-8-bom":
+		return append(append([]byte{}, utf8BOM...), s...), nil
+	case "latin1":
+		data := make([]byte, 0, len(s))
+		for _, r := range s {
+			if r > 0xff {
+				return nil, errors.New("the text contains " + string(r) + ", which can not be saved as latin1")
+			}
+			data = append(data, byte(r))
+		}
+		return data, nil
+	case "windows-1252":
+		data := make([]byte, 0, len(s))
+	NEXT:
+		for _, r := range s {
+			for i, r2 := range windows1252 {
+				if r == r2 {
+					data = append(data, byte(0x80+i))
+					continue NEXT
+				}
+			}
+			if r > 0xff || (r >= 0x80 && r <= 0x9f) {
+				return nil, errors.New("the text contains " + string(r) + ", which can not be saved as Windows-1252")
+			}
+			data = append(data, byte(r))
+		}
+		return data, nil
+	case "utf-16le", "utf-16be", "utf-16le-bom", "utf-16be-bom":
+		bigEndian := strings.HasPrefix(strings.ToLower(charset), "utf-16be")
+		units := utf16.Encode([]rune(s))
+		data := make([]byte, 0, len(units)*2+2)
+		if strings.HasSuffix(strings.ToLower(charset), "-bom") {
+			units = append([]uint16{0xfeff}, units...)
+		}
+		for _, u := range units {
+			if bigEndian {
+				data = append(data, byte(u>>8), byte(u))
+			} else {
+				data = append(data, byte(u), byte(u>>8))
+			}
+		}
+		return data, nil
+	}
+	return nil, errors.New("unsupported charset: " + charset)
+}
+
+// decodeCharset decodes the given data from the given charset to UTF-8.
+// See encodeCharset for the supported charsets.
+func decodeCharset(data []byte, charset string) ([]byte, error) {
+	switch strings.ToLower(charset) {
+	case "", "utf-8", "utf-8-bom":
+		return bytes.TrimPrefix(data, utf8BOM), nil
+	case "latin1":
+		var buf bytes.Buffer
+		for _, b := range data {
+			buf.WriteRune(rune(b))
+		}
+		return buf.Bytes(), nil
+	case "windows-1252":
+		var buf bytes.Buffer
+		for _, b := range data {
+			if b >= 0x80 && b <= 0x9f {
+				buf.WriteRune(windows1252[b-0x80])
+			} else {
+				buf.WriteRune(rune(b))
+			}
+		}
+		return buf.Bytes(), nil
+	case "utf-16le", "utf-16be", "utf-16le-bom", "utf-16be-bom":
+		if len(data)%2 != 0 {
+			return nil, errors.New("the data has an odd length, and is not " + charsetName(charset))
+		}
+		bigEndian := strings.HasPrefix(strings.ToLower(charset), "utf-16be")
+		units := make([]uint16, len(data)/2)
+		for i := range units {
+			if bigEndian {
+				units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+			} else {
+				units[i] = uint16(data[2*i+1])<<8 | uint16(data[2*i])
+			}
+		}
+		// Skip the byte order mark, if there is one
+		if len(units) > 0 && units[0] == 0xfeff {
+			units = units[1:]
+		}
+		var buf bytes.Buffer
+		for _, r := range utf16.Decode(units) {
+			buf.WriteRune(r)
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, errors.New("unsupported charset: " + charset)
+}
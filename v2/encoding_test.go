@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCharsetRoundTrip(t *testing.T) {
+	const s = "blåbærsyltetøy\n"
+	for _, charset := range []string{"utf-8", "utf-8-bom", "latin1", "utf-16le", "utf-16be"} {
+		data, err := encodeCharset(s, charset)
+		if err != nil {
+			t.Fatalf("%s: %v", charset, err)
+		}
+		decoded, err := decodeCharset(data, charset)
+		if err != nil {
+			t.Fatalf("%s: %v", charset, err)
+		}
+		if string(decoded) != s {
+			t.Errorf("%s: expected %q, got %q", charset, s, decoded)
+		}
+	}
+	if data, _ := encodeCharset("æ", "latin1"); !bytes.Equal(data, []byte{0xe6}) {
+		t.Errorf("unexpected latin1 encoding: %v", data)
+	}
+	if _, err := encodeCharset("→", "latin1"); err == nil {
+		t.Error("expected an error when encoding an arrow as latin1")
+	}
+}
+
+func TestDetectCharset(t *testing.T) {
+	utf16le, _ := encodeCharset("hello there\n", "utf-16le")
+	utf16be, _ := encodeCharset("hello there\n", "utf-16be")
+	tests := []struct {
+		data     []byte
+		expected string
+	}{
+		{[]byte("plain ascii\n"), ""},
+		{[]byte("blåbær\n"), ""},
+		{append(append([]byte{}, utf8BOM...), "x\n"...), "utf-8-bom"},
+		{append([]byte{0xff, 0xfe}, utf16le...), "utf-16le-bom"},
+		{append([]byte{0xfe, 0xff}, utf16be...), "utf-16be-bom"},
+		{utf16le, "utf-16le"},
+		{utf16be, "utf-16be"},
+		{[]byte("bl\xe5b\xe6r\n"), "latin1"},
+		{[]byte("\x93quoted\x94\n"), "windows-1252"},
+		{[]byte{0x7f, 'E', 'L', 'F', 0x02, 0x01, 0x01, 0x00, 0xff}, ""},
+	}
+	for _, test := range tests {
+		if charset := detectCharset(test.data); charset != test.expected {
+			t.Errorf("expected %q for %q, got %q", test.expected, test.data, charset)
+		}
+	}
+	// Loading and saving again gives the same bytes
+	for _, test := range tests[2:9] {
+		decoded, err := decodeCharset(test.data, test.expected)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoded, err := encodeCharset(string(decoded), test.expected)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(encoded, test.data) {
+			t.Errorf("%s: expected %v, got %v", test.expected, test.data, encoded)
+		}
+	}
+}
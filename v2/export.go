@@ -51,19 +51,13 @@ func (e *Editor) exportAdoc(c *vt100.Canvas, tty *vt100.TTY, manFilename string)
 		return errors.New(tmpfn + " already exists, please remove it")
 	}
 
-	// TODO: Write a SaveAs function for the Editor
-	oldFilename := e.filename
-	e.filename = tmpfn
-	err := e.Save(c, tty)
-	if err != nil {
-		e.filename = oldFilename
+	if err := e.SaveCopy(c, tty, tmpfn); err != nil {
 		return err
 	}
-	e.filename = oldFilename
 
 	// Run asciidoctor
 	adocCommand := exec.Command("asciidoctor", "-b", "manpage", "-o", manFilename, tmpfn)
-	if err = adocCommand.Run(); err != nil {
+	if err := adocCommand.Run(); err != nil {
 		_ = os.Remove(tmpfn) // Try removing the temporary filename if pandoc fails
 		return err
 	}
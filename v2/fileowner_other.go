@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly && !solaris && !aix
+
+package main
+
+import "os"
+
+// fileOwner returns the owner and group of the given file, and the number of hard links to it,
+// but this is not available on this platform
+func fileOwner(fi os.FileInfo) (uid, gid int, links uint64, ok bool) {
+	return 0, 0, 0, false
+}
+
+// fileInode returns the inode number of the given file, but this is not available on this platform
+func fileInode(fi os.FileInfo) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,26 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly || solaris || aix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileOwner returns the owner and group of the given file, and the number of hard links to it
+func fileOwner(fi os.FileInfo) (uid, gid int, links uint64, ok bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, 0, false
+	}
+	return int(st.Uid), int(st.Gid), uint64(st.Nlink), true
+}
+
+// fileInode returns the inode number of the given file
+func fileInode(fi os.FileInfo) (uint64, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Ino), true
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/xyproto/vt100"
+)
+
+const (
+	// pollInterval is how often the open files are checked for changes, when inotify can not be used
+	pollInterval = 2 * time.Second
+
+	// settleDelay is how long to wait after a change is noticed, before checking the files,
+	// so that programs that write a file in several steps are done
+	settleDelay = 200 * time.Millisecond
+)
+
+var (
+	// fileWatcher keeps an eye on the open files, for noticing when other programs change them
+	fileWatcher = NewFileWatcher()
+
+	// keyLoopMut is locked while the main loop handles a key, and unlocked while it waits for the next key.
+	// Background goroutines that change the editor must lock it first.
+	keyLoopMut sync.Mutex
+)
+
+// FileStamp is what is known about a file on disk, for noticing when it is changed by another program
+type FileStamp struct {
+	modTime time.Time
+	size    int64
+	inode   uint64
+	exists  bool
+}
+
+// watchedFile is a file that is watched for changes
+type watchedFile struct {
+	stamp   FileStamp
+	base    Buffer // the contents when the file was loaded or saved, for merging
+	changed bool   // has the file been changed on disk, without the change being handled?
+}
+
+// FileWatcher notices when the watched files are changed on disk, by using inotify on Linux
+// and by checking the modification time, size and inode of the files regularly on other platforms
+type FileWatcher struct {
+	files     map[string]*watchedFile
+	onChange  func(absFilename string)
+	timer     *time.Timer
+	scheduled bool // is a check scheduled to happen soon?
+	started   bool
+	polling   bool // are the files checked regularly, for when inotify can not be used for all of them?
+	mut       sync.Mutex
+}
+
+// NewFileWatcher creates a new FileWatcher
+func NewFileWatcher() *FileWatcher {
+	return &FileWatcher{files: make(map[string]*watchedFile)}
+}
+
+// statFileStamp finds the modification time, size and inode of the given file
+func statFileStamp(filename string) FileStamp {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return FileStamp{}
+	}
+	inode, _ := fileInode(fi)
+	return FileStamp{modTime: fi.ModTime(), size: fi.Size(), inode: inode, exists: true}
+}
+
+// Equal checks if two file stamps are the same
+func (fs FileStamp) Equal(other FileStamp) bool {
+	return fs.exists == other.exists && fs.size == other.size && fs.inode == other.inode && fs.modTime.Equal(other.modTime)
+}
+
+// Watch starts watching the given file, or updates what is known about it, for when it has been loaded or saved.
+// The given contents are used as the common base when merging changes.
+func (fw *FileWatcher) Watch(absFilename string, contents Buffer) {
+	fw.mut.Lock()
+	defer fw.mut.Unlock()
+	_, known := fw.files[absFilename]
+	fw.files[absFilename] = &watchedFile{stamp: statFileStamp(absFilename), base: contents.Copy()}
+	if !known && fw.started && !fw.addWatch(absFilename) {
+		fw.startPolling()
+	}
+}
+
+// Handled marks the change on disk to the given file as handled, without changing the common base that is used
+// when merging changes. This is for when the file could not be read, and the unsaved changes are kept.
+func (fw *FileWatcher) Handled(absFilename string) {
+	fw.mut.Lock()
+	defer fw.mut.Unlock()
+	if wf, ok := fw.files[absFilename]; ok {
+		wf.stamp = statFileStamp(absFilename)
+		wf.changed = false
+	}
+}
+
+// Unwatch stops watching the given file
+func (fw *FileWatcher) Unwatch(absFilename string) {
+	fw.mut.Lock()
+	defer fw.mut.Unlock()
+	delete(fw.files, absFilename)
+}
+
+// Changed checks if the given file has been changed on disk, without the change having been handled
+func (fw *FileWatcher) Changed(absFilename string) bool {
+	fw.mut.Lock()
+	defer fw.mut.Unlock()
+	wf, ok := fw.files[absFilename]
+	return ok && wf.changed
+}
+
+// Base returns the contents of the given file when it was last loaded or saved, or nil
+func (fw *FileWatcher) Base(absFilename string) Buffer {
+	fw.mut.Lock()
+	defer fw.mut.Unlock()
+	if wf, ok := fw.files[absFilename]; ok {
+		return wf.base
+	}
+	return nil
+}
+
+// Start starts watching the files in the background. The given function is called from
+// a background goroutine when one of the files has been changed on disk.
+func (fw *FileWatcher) Start(onChange func(absFilename string)) {
+	fw.mut.Lock()
+	fw.onChange = onChange
+	if fw.started {
+		fw.mut.Unlock()
+		return
+	}
+	fw.started = true
+	useInotify := fw.startInotify()
+	for absFilename := range fw.files {
+		if !fw.addWatch(absFilename) {
+			useInotify = false
+		}
+	}
+	if !useInotify {
+		fw.startPolling()
+	}
+	fw.mut.Unlock()
+}
+
+// startPolling starts checking the files regularly in the background, if that has not already been started.
+// This is for when inotify can not be used for all of the files. The mutex must be locked.
+func (fw *FileWatcher) startPolling() {
+	if fw.polling {
+		return
+	}
+	fw.polling = true
+	go func() {
+		for range time.Tick(pollInterval) {
+			fw.check()
+		}
+	}()
+}
+
+// checkSoon checks the files after a short while, so that several changes in a row are handled once
+func (fw *FileWatcher) checkSoon() {
+	fw.mut.Lock()
+	defer fw.mut.Unlock()
+	if fw.scheduled {
+		return
+	}
+	fw.scheduled = true
+	if fw.timer == nil {
+		fw.timer = time.AfterFunc(settleDelay, fw.check)
+	} else {
+		fw.timer.Reset(settleDelay)
+	}
+}
+
+// check compares the watched files with what is known about them, and calls the onChange function
+// for each file that has changed since it was loaded or saved
+func (fw *FileWatcher) check() {
+	var changedFiles []string
+	fw.mut.Lock()
+	fw.scheduled = false
+	for absFilename, wf := range fw.files {
+		if wf.changed {
+			continue
+		}
+		if stamp := statFileStamp(absFilename); !stamp.Equal(wf.stamp) {
+			wf.changed = true
+			changedFiles = append(changedFiles, absFilename)
+		}
+	}
+	onChange := fw.onChange
+	fw.mut.Unlock()
+	if onChange != nil {
+		for _, absFilename := range changedFiles {
+			onChange(absFilename)
+		}
+	}
+}
+
+// readFromDisk reads the current contents of the file on disk, in the same way as it was loaded,
+// and returns an editor with those contents, that is otherwise a copy of this editor
+func (e *Editor) readFromDisk() (*Editor, error) {
+	e2 := *e
+	e2.lines = NewJournal(NewLineRope(nil))
+	if err := e2.ReadFileAndProcessLines(e.filename); err != nil {
+		return nil, err
+	}
+	return &e2, nil
+}
+
+// useContentsFrom replaces the contents of this editor with the contents of the given editor,
+// as an action that can be undone
+func (e *Editor) useContentsFrom(e2 *Editor, u *Undo) {
+	u.Snapshot(e)
+	e.lines.Replace(e2.lines.Buffer.Copy())
+	e.binaryFile = e2.binaryFile
+	e.lineEndings = e2.lineEndings
+	e.mixedEndings = e2.mixedEndings
+	if e.DataY() >= LineIndex(e.Len()) {
+		e.pos.sy = 0
+		e.pos.offsetY = 0
+	}
+	e.redraw = true
+	e.redrawCursor = true
+}
+
+// ExternalChange is called from a background goroutine, with keyLoopMut locked, when the given file has been
+// changed on disk. Files without unsaved changes are reloaded, while for files with unsaved changes,
+// the user is notified and asked what to do when the next key is pressed.
+func (e *Editor) ExternalChange(c *vt100.Canvas, status *StatusBar, absFilename string) {
+	i := bufferList.Index(absFilename)
+	if i < 0 || !fileWatcher.Changed(absFilename) {
+		return
+	}
+	current := i == bufferList.current
+	ed, u := bufferList.buffers[i].editor, bufferList.buffers[i].undo
+	if current {
+		ed, u = e, undo
+	}
+	name := filepath.Base(absFilename)
+
+	var msg string
+	if disk, err := ed.readFromDisk(); err != nil {
+		msg = name + " was removed or can not be read"
+		fileWatcher.Handled(absFilename)
+	} else if equalStrings(bufferLines(disk.lines.Buffer), bufferLines(ed.lines.Buffer)) {
+		// Only the modification time was changed
+		fileWatcher.Watch(absFilename, disk.lines.Buffer)
+		return
+	} else if !ed.changed {
+		ed.useContentsFrom(disk, u)
+		ed.changed = false
+		fileWatcher.Watch(absFilename, disk.lines.Buffer)
+		msg = "Reloaded " + name + ", since it was changed on disk"
+	} else if current {
+		msg = name + " was changed on disk. Press any key to reload, keep or merge."
+	} else {
+		msg = name + " was changed on disk, and has unsaved changes"
+	}
+
+	status.ClearAll(c)
+	status.SetMessageAfterRedraw(msg)
+	e.RedrawAtEndOfKeyLoop(c, status)
+}
+
+// HandleExternalChange asks the user what to do if the current file has been changed on disk while it
+// has unsaved changes: reload it, keep the unsaved changes or merge the changes on disk with them.
+// Returns true if the user was asked.
+func (e *Editor) HandleExternalChange(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) bool {
+	b := bufferList.Current()
+	if b == nil || b.stdin || !fileWatcher.Changed(b.absFilename) {
+		return false
+	}
+	absFilename := b.absFilename
+	disk, err := e.readFromDisk()
+	if err != nil {
+		fileWatcher.Handled(absFilename)
+		return false
+	} else if !e.changed {
+		// This has already been handled by ExternalChange
+		fileWatcher.Watch(absFilename, e.lines.Buffer)
+		return false
+	}
+	name := filepath.Base(absFilename)
+	mine, theirs := bufferLines(e.lines.Buffer), bufferLines(disk.lines.Buffer)
+	menuChoices := []string{"Reload " + name + " and lose my changes", "Keep my changes", "Merge the changes on disk with my changes", "Show the differences"}
+	for {
+		switch e.Menu(status, tty, name+" was changed on disk", menuChoices, e.Background, e.MenuTitleColor, e.MenuArrowColor, e.MenuTextColor, e.MenuHighlightColor, e.MenuSelectedColor, 0, false) {
+		case 0:
+			e.useContentsFrom(disk, undo)
+			e.changed = false
+			fileWatcher.Watch(absFilename, disk.lines.Buffer)
+			status.SetMessageAfterRedraw("Reloaded " + name)
+		case 2:
+			var baseLines []string
+			if base := fileWatcher.Base(absFilename); base != nil {
+				baseLines = bufferLines(base)
+			}
+			merged, conflicts := MergeLines(baseLines, mine, theirs)
+			fileWatcher.Watch(absFilename, disk.lines.Buffer)
+			disk.lines = NewJournal(NewLineRope(runeLines(merged)))
+			e.useContentsFrom(disk, undo)
+			e.changed = true
+			if conflicts > 0 {
+				for y, line := range merged {
+					if line == conflictStartMarker {
+						e.GoTo(LineIndex(y), c, status)
+						break
+					}
+				}
+				status.SetMessageAfterRedraw(fmt.Sprintf("Merged the changes, with %d conflicts", conflicts))
+			} else {
+				status.SetMessageAfterRedraw("Merged the changes")
+			}
+		case 3:
+			e.ShowDiff(c, tty, "My changes → changes on disk", mine, theirs)
+			continue
+		default:
+			// Keep my changes, and ask again only if the file is changed on disk again
+			base := fileWatcher.Base(absFilename)
+			if base == nil {
+				base = disk.lines.Buffer
+			}
+			fileWatcher.Watch(absFilename, base)
+		}
+		break
+	}
+	e.redraw = true
+	e.redrawCursor = true
+	return true
+}
@@ -0,0 +1,48 @@
+//go:build linux
+
+package main
+
+import (
+	"path/filepath"
+	"syscall"
+)
+
+// inotifyFd is the inotify instance that the watched directories are added to, or -1
+var inotifyFd = -1
+
+// startInotify starts reading inotify events in the background, and returns true if inotify can be used.
+// The directories of the watched files are watched, since files are often replaced instead of written to.
+func (fw *FileWatcher) startInotify() bool {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return false
+	}
+	inotifyFd = fd
+	go func() {
+		buf := make([]byte, 64*1024)
+		for {
+			n, err := syscall.Read(fd, buf)
+			if err == syscall.EINTR {
+				continue
+			}
+			if err != nil || n <= 0 {
+				return
+			}
+			// Any change in the watched directories makes the watched files be checked
+			fw.checkSoon()
+		}
+	}()
+	return true
+}
+
+// addWatch watches the directory of the given file with inotify, and returns false if that is not possible,
+// for instance if inotify is not used, or if the limit for the number of watches has been reached
+func (fw *FileWatcher) addWatch(absFilename string) bool {
+	if inotifyFd < 0 {
+		return false
+	}
+	const mask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_ATTRIB
+	// Adding the same directory twice is fine, the existing watch is used
+	_, err := syscall.InotifyAddWatch(inotifyFd, filepath.Dir(absFilename), mask)
+	return err == nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+// startInotify returns false, since inotify is only available on Linux, and the files are polled instead
+func (fw *FileWatcher) startInotify() bool {
+	return false
+}
+
+// addWatch returns false, since the files are polled on this platform
+func (fw *FileWatcher) addWatch(absFilename string) bool {
+	return false
+}
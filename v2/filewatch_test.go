@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileWatcherCheck(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "main.go")
+	if err := os.WriteFile(filename, []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var changedFiles []string
+	fw := NewFileWatcher()
+	fw.onChange = func(absFilename string) {
+		changedFiles = append(changedFiles, absFilename)
+	}
+	fw.Watch(filename, NewLineRope(runeLines([]string{"package main"})))
+
+	fw.check()
+	if len(changedFiles) != 0 || fw.Changed(filename) {
+		t.Fatal("expected the file to be unchanged")
+	}
+
+	// Change the file, and make sure that the modification time is different
+	if err := os.WriteFile(filename, []byte("package main\n\nfunc main() {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(filename, time.Now(), time.Now().Add(time.Second))
+	fw.check()
+	fw.check()
+	if len(changedFiles) != 1 || !fw.Changed(filename) {
+		t.Fatalf("expected the change to be noticed once, got %q", changedFiles)
+	}
+
+	// Handling a change that could not be read keeps the base for merging
+	fw.Handled(filename)
+	if fw.Changed(filename) || fw.Base(filename) == nil || !equalStrings(bufferLines(fw.Base(filename)), []string{"package main"}) {
+		t.Error("expected the file to not be changed after the change was handled, with the same base as before")
+	}
+	os.Chtimes(filename, time.Now(), time.Now().Add(2*time.Second))
+	fw.check()
+	if len(changedFiles) != 2 {
+		t.Fatalf("expected the next change to be noticed, got %q", changedFiles)
+	}
+
+	// Watching the file again, for when it has been reloaded or saved, means that it is no longer changed
+	fw.Watch(filename, NewLineRope(nil))
+	if fw.Changed(filename) {
+		t.Error("expected the file to not be changed after it has been watched again")
+	}
+}
@@ -57,11 +57,7 @@ func (e *Editor) formatWithUtility(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 		defer os.Remove(tempFilename)
 		defer f.Close()
 
-		// TODO: Implement e.SaveAs
-		oldFilename := e.filename
-		e.filename = tempFilename
-		err := e.Save(c, tty)
-		e.filename = oldFilename
+		err := e.SaveCopy(c, tty, tempFilename)
 
 		if err == nil {
 			// Add the filename of the temporary file to the command
@@ -223,6 +219,20 @@ func formatHTML(data []byte) ([]byte, error) {
 
 func (e *Editor) formatCode(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, jsonFormatToggle *bool) {
 
+	// Use the formatting command from the configuration files, if one is set for this mode
+	if args := e.config.Formatter(e.mode); len(args) > 0 {
+		extOrBaseFilename := filepath.Ext(e.filename)
+		if extOrBaseFilename == "" {
+			extOrBaseFilename = filepath.Base(e.filename)
+		}
+		if err := e.formatWithUtility(c, tty, status, *exec.Command(args[0], args[1:]...), extOrBaseFilename); err != nil {
+			status.ClearAll(c)
+			status.SetMessage(err.Error())
+			status.Show(c, e)
+		}
+		return
+	}
+
 	// Format JSON
 	if e.mode == mode.JSON {
 		data, err := formatJSON([]byte(e.String()), jsonFormatToggle, e.indentation.PerTab)
@@ -9,12 +9,34 @@ import (
 	"github.com/xyproto/vt100"
 )
 
-var backFunctions []func()
+// jumpToFileLocation goes to the given line and column in the given file, opening the file if needed,
+// and adds the current location to the jump list, so that ctrl-t can jump back
+func (e *Editor) jumpToFileLocation(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, absFilename string, lineIndex LineIndex, x ColIndex) error {
+	from := e.CurrentJump()
+	if err := e.GoToJump(c, tty, status, Jump{Filename: absFilename, LineIndex: lineIndex, X: x}); err != nil {
+		return err
+	}
+	from.definition = true
+	jumpList.Add(from)
+	return nil
+}
 
 // GoToDefinition tries to find the definition of the given string, saves the current location and jumps to the location of the definition.
 // Returns true if it was possible to go to the definition.
-// This function is currently very experimental and may only work for a few languages, and for a few definitions!
+// If there is a language server for the current file, it is asked. If not, the tag files in the directory
+// of the current file and above are used. If there are none, the search below
+// is currently very experimental and may only work for a few languages, and for a few definitions!
 func (e *Editor) GoToDefinition(tty *vt100.TTY, c *vt100.Canvas, status *StatusBar) bool {
+	// Ask the language server, if there is one, and if there is a word under the cursor
+	if e.WordAtCursor() != "" && e.LSPGoToDefinition(c, tty, status) {
+		return true
+	}
+
+	// Look up the word in the tags or TAGS files, if there are any
+	if e.WordAtCursor() != "" && e.TagsGoToDefinition(c, tty, status) {
+		return true
+	}
+
 	// FuncPrefix may return strings with a leading or trailing blank
 	funcPrefix := e.FuncPrefix()
 
@@ -72,25 +94,14 @@ func (e *Editor) GoToDefinition(tty *vt100.TTY, c *vt100.Canvas, status *StatusB
 						if strings.HasPrefix(trimmedLine, funcPrefix) && strings.Contains(trimmedLine, " "+name+"(") {
 							//logf("PROLLY FUNC: %s LINE %d WORD %s NAME %s\n", goFile, i+1, word, name)
 
-							oldFilename := e.filename
-							oldLineIndex := e.LineIndex()
+							// Remember where to go back to
+							e.RecordDefinitionJump()
 
-							if goFile != oldFilename {
+							if goFile != e.filename {
 								e.Switch(c, tty, status, fileLock, goFile)
 							}
 							e.redraw, _ = e.GoTo(LineIndex(i), c, status)
 
-							// Push a function for how to go back
-							backFunctions = append(backFunctions, func() {
-								oldFilename := oldFilename
-								oldLineIndex := oldLineIndex
-								goFile := goFile
-								if goFile != oldFilename {
-									e.Switch(c, tty, status, fileLock, oldFilename)
-								}
-								e.redraw, _ = e.GoTo(oldLineIndex, c, status)
-							})
-
 							return true
 						}
 
@@ -98,25 +109,14 @@ func (e *Editor) GoToDefinition(tty *vt100.TTY, c *vt100.Canvas, status *StatusB
 						if !functionCall && emptyBeforeWord && !strings.Contains(trimmedLine, ":") && !strings.Contains(trimmedLine, "=") && !strings.Contains(trimmedLine, ",") {
 							//logf("PROLLY TYPE: %s LINE %d WORD %s NAME %s\n", goFile, i+1, word, name)
 
-							oldFilename := e.filename
-							oldLineIndex := e.LineIndex()
+							// Remember where to go back to
+							e.RecordDefinitionJump()
 
-							if goFile != oldFilename {
+							if goFile != e.filename {
 								e.Switch(c, tty, status, fileLock, goFile)
 							}
 							e.redraw, _ = e.GoTo(LineIndex(i), c, status)
 
-							// Push a function for how to go back
-							backFunctions = append(backFunctions, func() {
-								oldFilename := oldFilename
-								oldLineIndex := oldLineIndex
-								goFile := goFile
-								if goFile != oldFilename {
-									e.Switch(c, tty, status, fileLock, oldFilename)
-								}
-								e.redraw, _ = e.GoTo(oldLineIndex, c, status)
-							})
-
 							return true
 						}
 					}
@@ -171,7 +171,8 @@ func (e *Editor) GoToDefinition(tty *vt100.TTY, c *vt100.Canvas, status *StatusB
 		return false
 	}
 
-	// Go to the found match
+	// Remember where to go back to, and go to the found match
+	e.RecordDefinitionJump()
 	e.redraw, _ = e.GoTo(foundY, c, status)
 	if foundX != -1 {
 		tabs := strings.Count(e.Line(foundY), "\t")
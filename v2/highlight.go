@@ -26,8 +26,9 @@ var (
 	colorTagRegex = regexp.MustCompile(`<([a-nA-Np-zP-Z]\w+)>`) // not starting with "o"
 )
 
-// WriteLines will draw editor lines from "fromline" to and up to "toline" to the canvas, at cx, cy
-func (e *Editor) WriteLines(c *vt100.Canvas, fromline, toline LineIndex, cx, cy uint) {
+// WriteLines will draw editor lines from "fromline" to and up to "toline" to the canvas, at cx, cy,
+// within the given width
+func (e *Editor) WriteLines(c *vt100.Canvas, fromline, toline LineIndex, cx, cy, w uint) {
 	bg := e.Background.Background()
 	tabString := strings.Repeat(" ", e.indentation.PerTab)
 	inCodeBlock := false // used when highlighting Doc, Markdown, Python, Nim or Mojo
@@ -36,7 +37,10 @@ func (e *Editor) WriteLines(c *vt100.Canvas, fromline, toline LineIndex, cx, cy
 	resizeMut.Lock()
 	defer resizeMut.Unlock()
 
-	cw := c.Width()
+	cw := cx + w // the canvas column right after the area that is drawn in
+	if cw > c.Width() {
+		cw = c.Width()
+	}
 	if fromline >= toline {
 		return // errors.New("fromline >= toline in WriteLines")
 	}
@@ -124,11 +128,20 @@ func (e *Editor) WriteLines(c *vt100.Canvas, fromline, toline LineIndex, cx, cy
 		unEscapeFunction = ShUnEscape
 	}
 
+	// The selected text, if any, is drawn with a different background color
+	selectionFrom, selectionTo, hasSelection := e.SelectionRange()
+
 	// Loop from 0 to numlines (used as y+offset in the loop) to draw the text
 	for y := LineIndex(0); y < numLinesToDraw; y++ {
 		lineRuneCount = 0   // per line rune counter, for drawing spaces afterwards (does not handle wide runes)
 		lineStringCount = 0 // per line string counter, for drawing spaces afterwards (handles wide runes)
 
+		// The selected screen columns on this line, if any
+		selStart, selEnd, lineHasSelection := 0, 0, false
+		if hasSelection {
+			selStart, selEnd, lineHasSelection = e.selectedColumns(y+offsetY, selectionFrom, selectionTo)
+		}
+
 		line = e.Line(LineIndex(y + offsetY))
 
 		line = strings.TrimRightFunc(line, unicode.IsSpace)
@@ -144,7 +157,7 @@ func (e *Editor) WriteLines(c *vt100.Canvas, fromline, toline LineIndex, cx, cy
 			// textWithTags must be unescaped if there is not an error.
 			if textWithTags, err := syntax.AsText([]byte(escapeFunction(line)), e.mode); err != nil {
 				// Only output the line up to the width of the canvas
-				screenLine = e.ChopLine(line, int(cw))
+				screenLine = e.ChopLine(line, int(cw-cx))
 				// TODO: Check if just "fmt.Print" works here, for several terminal emulators
 				fmt.Println(screenLine)
 				lineRuneCount += uint(utf8.RuneCountInString(screenLine))
@@ -449,8 +462,15 @@ func (e *Editor) WriteLines(c *vt100.Canvas, fromline, toline LineIndex, cx, cy
 					}
 				}
 
-				// Search term highlighting
-				searchTermRunes := []rune(e.searchTerm)
+				// Search term highlighting, with the rune index and length of each match
+				var searchMatches map[int]int
+				if e.searchTerm != "" {
+					runes := make([]rune, len(runesAndAttributes))
+					for i, ra := range runesAndAttributes {
+						runes[i] = ra.R
+					}
+					searchMatches = e.searchMatchRunes(runes)
+				}
 				matchForAnotherN := 0
 
 				// Output a line with the chars (Rune + AttributeColor)
@@ -469,28 +489,10 @@ func (e *Editor) WriteLines(c *vt100.Canvas, fromline, toline LineIndex, cx, cy
 						// Coloring an already found match
 						fg = e.SearchHighlight
 						matchForAnotherN--
-					} else if len(e.searchTerm) > 0 && letter == searchTermRunes[0] {
-						// Potential search highlight match
-						length := utf8.RuneCountInString(e.searchTerm)
-						counter := 0
-						match := true
-						for i := runeIndex; i < (runeIndex + length); i++ {
-							if i >= len(runesAndAttributes) {
-								match = false
-								break
-							}
-							ra2 := runesAndAttributes[i]
-							if ra2.R != []rune(e.searchTerm)[counter] {
-								// mismatch, not a hit
-								match = false
-								break
-							}
-							counter++
-						}
-						if match {
-							fg = e.SearchHighlight
-							matchForAnotherN = length - 1
-						}
+					} else if length := searchMatches[runeIndex]; length > 0 {
+						// Found a match
+						fg = e.SearchHighlight
+						matchForAnotherN = length - 1
 					}
 					if letter == '\t' {
 						c.Write(cx+lineRuneCount, cy+uint(y), fg, e.Background, tabString)
@@ -503,7 +505,11 @@ func (e *Editor) WriteLines(c *vt100.Canvas, fromline, toline LineIndex, cx, cy
 						tx := cx + lineRuneCount
 						ty := cy + uint(y)
 						if tx < cw {
-							c.WriteRuneBNoLock(tx, ty, fg, bg, letter)
+							if lineHasSelection && runeIndex >= selStart && runeIndex < selEnd {
+								c.WriteRuneBNoLock(tx, ty, fg, e.SelectionBackground, letter)
+							} else {
+								c.WriteRuneBNoLock(tx, ty, fg, bg, letter)
+							}
 							lineRuneCount++                              // 1 rune
 							lineStringCount += uint(len(string(letter))) // 1 rune, expanded
 						}
@@ -516,8 +522,16 @@ func (e *Editor) WriteLines(c *vt100.Canvas, fromline, toline LineIndex, cx, cy
 				line = handleManPageEscape(line)
 			}
 			// Output a regular line, scrolled to the current e.pos.offsetX
-			screenLine = e.ChopLine(line, int(cw))
+			screenLine = e.ChopLine(line, int(cw-cx))
 			c.Write(cx+lineRuneCount, cy+uint(y), e.Foreground, e.Background, screenLine)
+			if lineHasSelection {
+				// Draw the selected part of the line again, with the selection background color
+				for i, r := range []rune(screenLine) {
+					if column := i + e.pos.offsetX; column >= selStart && column < selEnd {
+						c.WriteRuneB(cx+lineRuneCount+uint(i), cy+uint(y), e.Foreground, e.SelectionBackground, r)
+					}
+				}
+			}
 			lineRuneCount += uint(utf8.RuneCountInString(screenLine)) // rune count
 		}
 
@@ -525,7 +539,21 @@ func (e *Editor) WriteLines(c *vt100.Canvas, fromline, toline LineIndex, cx, cy
 		// TODO: This may draw the wrong number of blanks, since lineRuneCount should really be the number of visible glyphs at this point
 		yp := cy + uint(y)
 		xp := cx + lineRuneCount
-		c.WriteRunesB(xp, yp, e.Foreground, bg, ' ', cw-lineRuneCount)
+		if xp < cw {
+			c.WriteRunesB(xp, yp, e.Foreground, bg, ' ', cw-xp)
+		}
+
+		// Draw the selected columns after the end of the text, like the newline at the end of a selected line
+		if lineHasSelection {
+			for x := lineRuneCount; cx+x < cw && int(x)+e.pos.offsetX < selEnd; x++ {
+				if int(x)+e.pos.offsetX >= selStart {
+					c.WriteRuneB(cx+x, yp, e.Foreground, e.SelectionBackground, ' ')
+				}
+			}
+		}
+
+		// Draw the extra cursors, if any
+		e.drawCursors(c, y+offsetY, cx, yp, cw)
 
 	}
 }
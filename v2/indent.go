@@ -0,0 +1,104 @@
+package main
+
+import (
+	"github.com/xyproto/mode"
+)
+
+// spaceIndentationWidths are the indentation widths that can be detected when a file is indented with spaces
+var spaceIndentationWidths = []int{8, 4, 3, 2, 1}
+
+// leadingIndentation returns the number of leading tabs and spaces for the given line,
+// and the first rune after the indentation, or 0 if the line is blank
+func leadingIndentation(line []rune) (tabs, spaces int, first rune) {
+	for _, r := range line {
+		switch r {
+		case '\t':
+			tabs++
+		case ' ':
+			spaces++
+		default:
+			return tabs, spaces, r
+		}
+	}
+	return tabs, spaces, 0
+}
+
+// DetectIndentation examines the leading whitespace of the given lines and tries to find out
+// if they are indented with tabs or with spaces, and how many spaces are used per indentation level.
+// Returns false if there are too few indented lines to tell.
+func DetectIndentation(lines [][]rune) (mode.TabsSpaces, bool) {
+	var (
+		tabLines, spaceLines int
+		prevSpaces           int
+		widthCounts          = make(map[int]int)
+	)
+	for _, line := range lines {
+		tabs, spaces, first := leadingIndentation(line)
+		if first == 0 {
+			// Blank lines do not say anything about the indentation
+			continue
+		}
+		if first == '*' {
+			// Skip the continuation lines of C-style block comments, like " * ", since they are offset by one space
+			continue
+		}
+		if tabs > 0 && line[0] == '\t' {
+			tabLines++
+			prevSpaces = 0
+			continue
+		}
+		if spaces > 0 && tabs == 0 {
+			spaceLines++
+		}
+		if tabs == 0 {
+			// Count how much the indentation grows from one line to the next
+			if delta := spaces - prevSpaces; delta > 0 {
+				widthCounts[delta]++
+			}
+			prevSpaces = spaces
+		}
+	}
+	if tabLines == 0 && spaceLines == 0 {
+		return mode.TabsSpaces{}, false
+	}
+	if tabLines >= spaceLines {
+		return mode.TabsSpaces{PerTab: mode.DefaultTabsSpaces.PerTab, Spaces: false}, true
+	}
+	// Find the most common indentation step, preferring the wider one if there is a tie
+	bestWidth, bestCount := 0, 0
+	for _, width := range spaceIndentationWidths {
+		if count := widthCounts[width]; count > bestCount {
+			bestWidth, bestCount = width, count
+		}
+	}
+	if bestWidth == 0 {
+		return mode.TabsSpaces{}, false
+	}
+	return mode.TabsSpaces{PerTab: bestWidth, Spaces: true}, true
+}
+
+// detectIndentation detects the indentation of the current contents, if they are not binary,
+// and uses it for the editor
+func (e *Editor) detectIndentation(lines [][]rune) {
+	if e.binaryFile {
+		return
+	}
+	if detected, found := DetectIndentation(lines); found {
+		e.detectedIndent = detected
+		e.useDetectedIndentation()
+	}
+}
+
+// useDetectedIndentation makes the editor indent like the loaded file, if the indentation was detected.
+// The width of a tab stays as it is, when the file is indented with tabs.
+// Makefiles and Justfiles are always indented with tabs.
+func (e *Editor) useDetectedIndentation() {
+	detected := e.detectedIndent
+	if detected.PerTab == 0 || e.mode == mode.Make || e.mode == mode.Just {
+		return
+	}
+	e.indentation.Spaces = detected.Spaces
+	if detected.Spaces {
+		e.indentation.PerTab = detected.PerTab
+	}
+}
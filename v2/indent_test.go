@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xyproto/mode"
+)
+
+func linesOf(s string) [][]rune {
+	var lines [][]rune
+	for _, line := range strings.Split(s, "\n") {
+		lines = append(lines, []rune(line))
+	}
+	return lines
+}
+
+func TestDetectIndentation(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected mode.TabsSpaces
+		found    bool
+	}{
+		{"func main() {\n\tif true {\n\t\tfmt.Println()\n\t}\n}", mode.TabsSpaces{PerTab: 4, Spaces: false}, true},
+		{"def f():\n    if x:\n        return 1\n    return 2\n", mode.TabsSpaces{PerTab: 4, Spaces: true}, true},
+		{"a:\n  b:\n    c: 1\n  d: 2\n", mode.TabsSpaces{PerTab: 2, Spaces: true}, true},
+		{"procedure P is\nbegin\n   X := 1;\n   if X then\n      Y;\n   end if;\nend P;", mode.TabsSpaces{PerTab: 3, Spaces: true}, true},
+		{"fn f() {\n        x\n}\n", mode.TabsSpaces{PerTab: 8, Spaces: true}, true},
+		{"/*\n * A comment\n */\nint x;\nvoid f() {\n  g();\n}", mode.TabsSpaces{PerTab: 2, Spaces: true}, true},
+		{"no\nindentation\nhere\n", mode.TabsSpaces{}, false},
+	}
+	for _, test := range tests {
+		ts, found := DetectIndentation(linesOf(test.source))
+		if found != test.found || (found && ts != test.expected) {
+			t.Errorf("expected %v (%v) for %q, got %v (%v)", test.expected, test.found, test.source, ts, found)
+		}
+	}
+}
+
+func TestLoadBytesIndentation(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.mode = mode.Python
+	e.LoadBytes([]byte("def f():\n\tif x:\n\t\treturn 1\n"))
+	if e.indentation.Spaces {
+		t.Error("expected tab indentation to be detected")
+	}
+	e.LoadBytes([]byte("def f():\n  if x:\n    return 1\n"))
+	if !e.indentation.Spaces || e.indentation.PerTab != 2 {
+		t.Errorf("expected 2 space indentation to be detected, got %v", e.indentation)
+	}
+}
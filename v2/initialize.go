@@ -23,8 +23,10 @@ var (
 )
 
 // NewEditor takes a filename and a line number to jump to (may be 0)
+// cfg and cfgErr are the settings from the configuration files that apply to the file, and the error from reading them.
+// If cfg is nil, the configuration files are read.
 // Returns an Editor, a status message for the user, a bool that is true if an image was displayed instead and the finally an error type.
-func NewEditor(tty *vt100.TTY, c *vt100.Canvas, fnord FilenameOrData, lineNumber LineNumber, colNumber ColNumber, theme Theme, origSyntaxHighlight, discoverBGColor bool) (*Editor, string, bool, error) {
+func NewEditor(tty *vt100.TTY, c *vt100.Canvas, fnord FilenameOrData, lineNumber LineNumber, colNumber ColNumber, theme Theme, origSyntaxHighlight, discoverBGColor bool, cfg *Config, cfgErr error) (*Editor, string, bool, error) {
 	var (
 		startTime          = time.Now()
 		createdNewFile     bool   // used for indicating that a new file was created
@@ -58,7 +60,12 @@ func NewEditor(tty *vt100.TTY, c *vt100.Canvas, fnord FilenameOrData, lineNumber
 
 	adjustSyntaxHighlightingKeywords(m) // no theme changes, just language detection and keyword configuration
 
-	indentation := m.TabsSpaces()
+	// Find the settings from the user configuration file and the per-project configuration files, if needed
+	if cfg == nil {
+		cfg, cfgErr = FindConfig(fnord.filename)
+	}
+
+	indentation := cfg.Indentation(m, m.TabsSpaces())
 
 	// Additional per-mode considerations, before launching the editor
 	rainbowParenthesis := syntaxHighlight // rainbow parenthesis
@@ -69,9 +76,9 @@ func NewEditor(tty *vt100.TTY, c *vt100.Canvas, fnord FilenameOrData, lineNumber
 		readOnly = true
 	}
 
-	// New editor struct. Scroll 10 lines at a time, no word wrap.
+	// New editor struct. Scroll 10 lines at a time, unless configured otherwise, no word wrap.
 	e := NewCustomEditor(indentation,
-		scrollSpeed,
+		cfg.ScrollSpeed(scrollSpeed),
 		m,
 		theme,
 		syntaxHighlight,
@@ -81,6 +88,8 @@ func NewEditor(tty *vt100.TTY, c *vt100.Canvas, fnord FilenameOrData, lineNumber
 		e.readOnly = true
 	}
 
+	e.config = cfg
+
 	// For non-highlighted files, adjust the word wrap
 	if !e.syntaxHighlight {
 		// Adjust the word wrap if the terminal is too narrow
@@ -99,6 +108,12 @@ func NewEditor(tty *vt100.TTY, c *vt100.Canvas, fnord FilenameOrData, lineNumber
 	// Set the editor filename
 	e.filename = fnord.filename
 
+	// Find the settings from .editorconfig files that apply to this file, if any
+	if !fnord.stdin {
+		e.editorConfig = FindEditorConfig(fnord.filename)
+		e.charset = e.editorConfig.Charset()
+	}
+
 	// We wish to redraw the canvas and reposition the cursor
 	e.redraw = true
 	e.redrawCursor = true
@@ -224,16 +239,14 @@ func NewEditor(tty *vt100.TTY, c *vt100.Canvas, fnord FilenameOrData, lineNumber
 	adjustSyntaxHighlightingKeywords(e.mode)
 
 	// Additional per-mode considerations, before launching the editor
-	e.indentation = m.TabsSpaces()
-	if e.detectedTabs != nil {
-		detectedTabs := *(e.detectedTabs)
-		e.indentation.Spaces = !detectedTabs
-	}
+	e.indentation = e.config.Indentation(m, m.TabsSpaces())
+	e.useDetectedIndentation()
 
 	switch e.mode {
 	case mode.Blank, mode.Doc, mode.Email, mode.Markdown, mode.Text, mode.ReStructured:
 		e.rainbowParenthesis = false
 	}
+	e.rainbowParenthesis = e.config.RainbowParentheses(e.mode, e.rainbowParenthesis) && e.syntaxHighlight
 
 	// If we're editing a git commit message, add a newline and enable word-wrap at 72
 	if e.mode == mode.Git {
@@ -252,6 +265,10 @@ func NewEditor(tty *vt100.TTY, c *vt100.Canvas, fnord FilenameOrData, lineNumber
 		e.wrapWhenTyping = true
 		e.GoToEnd(c, nil)
 	}
+	e.wrapWidth = e.config.WrapWidth(e.mode, e.wrapWidth)
+
+	// Settings from .editorconfig take precedence over the per-mode settings and the detected indentation
+	e.applyEditorConfig()
 
 	// If the file starts with a hash bang, enable syntax highlighting
 	if strings.HasPrefix(strings.TrimSpace(e.Line(0)), "#!") && !e.readOnly {
@@ -263,7 +280,7 @@ func NewEditor(tty *vt100.TTY, c *vt100.Canvas, fnord FilenameOrData, lineNumber
 	// TERMINAL_EMULATOR is set to "JetBrains-JediTerm",
 	// because $COLORFGBG is "15;0" even though the background is white.
 	if !e.readOnly && (!specificLetter || editTheme) {
-		themeEnv := env.StrAlt("O_THEME", "THEME")
+		themeEnv := env.StrAlt("O_THEME", "THEME", e.config.Theme())
 		if themeEnv == "redblack" {
 			b := false
 			initialLightBackground = &b
@@ -436,5 +453,13 @@ func NewEditor(tty *vt100.TTY, c *vt100.Canvas, fnord FilenameOrData, lineNumber
 		}
 	}
 
+	// Mention the first error in the configuration files, if any
+	if cfgErr != nil {
+		statusMessage += " (" + cfgErr.Error() + ")"
+	}
+
+	// Loading and preparing the initial contents should not be possible to undo
+	e.lines.TakeOps()
+
 	return e, statusMessage, false, nil
 }
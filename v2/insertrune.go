@@ -47,7 +47,7 @@ func (e *Editor) InsertRune(c *vt100.Canvas, r rune) bool {
 
 		h := 80
 		if c != nil {
-			h = int(c.Height())
+			h = viewHeight(c)
 		}
 		if e.pos.sy >= (h - 1) {
 			e.ScrollDown(c, nil, 1)
@@ -66,7 +66,7 @@ func (e *Editor) InsertRune(c *vt100.Canvas, r rune) bool {
 	// Scroll right when reaching 95% of the terminal width
 	wf := 80.0
 	if c != nil {
-		wf = float64(c.Width())
+		wf = float64(viewWidth(c))
 	}
 	if e.pos.sx > int(wf*0.95) {
 		// scroll
@@ -0,0 +1,249 @@
+package main
+
+// bufferOpKind is the kind of change that a BufferOp represents
+type bufferOpKind int
+
+const (
+	opSetLine bufferOpKind = iota
+	opInsertLine
+	opDeleteLine
+	opReplace
+)
+
+// BufferOp is a single change to a Buffer, which also contains what is needed to revert the change
+type BufferOp struct {
+	oldBuffer Buffer // the previous buffer, for opReplace
+	buffer    Buffer // the new buffer, for opReplace
+	oldLine   []rune // the previous line, for opSetLine and opDeleteLine
+	line      []rune // the new line, for opSetLine and opInsertLine
+	kind      bufferOpKind
+	y         int // the line index
+}
+
+// Journal is a Buffer that records all changes that are made to an underlying Buffer,
+// so that they can later be undone and redone. It also keeps line marks on their lines.
+type Journal struct {
+	Buffer
+	ops   []BufferOp
+	marks []*LineMark
+}
+
+// LineMark is a line index that stays on the same line when lines are inserted or deleted above it
+type LineMark struct {
+	y int
+}
+
+// LineIndex returns the current index of the marked line
+func (m *LineMark) LineIndex() LineIndex {
+	return LineIndex(m.y)
+}
+
+// NewJournal wraps the given Buffer in a Journal
+func NewJournal(b Buffer) *Journal {
+	return &Journal{Buffer: b}
+}
+
+// Mark returns a mark for the line at the given index, that follows the line as the buffer is changed
+func (j *Journal) Mark(y int) *LineMark {
+	m := &LineMark{y}
+	j.marks = append(j.marks, m)
+	return m
+}
+
+// Unmark stops moving the given mark when the buffer is changed
+func (j *Journal) Unmark(m *LineMark) {
+	for i, other := range j.marks {
+		if other == m {
+			j.marks = append(j.marks[:i], j.marks[i+1:]...)
+			return
+		}
+	}
+}
+
+// lineInserted moves the marks at or below the given line index one line down
+func (j *Journal) lineInserted(y int) {
+	for _, m := range j.marks {
+		if m.y >= y {
+			m.y++
+		}
+	}
+}
+
+// lineDeleted moves the marks below the given line index one line up. Marks on the deleted line
+// end up on the line that took its place.
+func (j *Journal) lineDeleted(y int) {
+	last := j.Buffer.Len() - 1
+	for _, m := range j.marks {
+		if m.y > y {
+			m.y--
+		}
+		if m.y > last && last >= 0 {
+			m.y = last
+		}
+	}
+}
+
+// relocateMarks moves the marks to the closest line with the same contents as the marked line had
+// in the given old buffer, after the entire buffer has been replaced. Marks stay where they are
+// if the contents can not be found.
+func (j *Journal) relocateMarks(oldBuffer Buffer) {
+	for _, m := range j.marks {
+		oldLine, ok := oldBuffer.Line(m.y)
+		if !ok {
+			continue
+		}
+		if y, found := findClosestLine(j.Buffer, string(oldLine), m.y); found {
+			m.y = y
+		} else if last := j.Buffer.Len() - 1; m.y > last && last >= 0 {
+			m.y = last
+		}
+	}
+}
+
+// findClosestLine finds the line with the given contents that is closest to the given line index
+func findClosestLine(b Buffer, line string, y int) (int, bool) {
+	n := b.Len()
+	for d := 0; y-d >= 0 || y+d < n; d++ {
+		for _, candidate := range []int{y - d, y + d} {
+			if runes, ok := b.Line(candidate); ok && string(runes) == line {
+				return candidate, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// record adds a change to the list of changes
+func (j *Journal) record(op BufferOp) {
+	j.ops = append(j.ops, op)
+}
+
+// recordReplace performs a change that is recorded as a replacement of the entire buffer.
+// This is used for changes that does not have a simple inverse, since copying a Buffer is cheap.
+func (j *Journal) recordReplace(change func(b Buffer)) {
+	oldBuffer := j.Buffer.Copy()
+	change(j.Buffer)
+	j.record(BufferOp{kind: opReplace, oldBuffer: oldBuffer, buffer: j.Buffer.Copy()})
+	j.relocateMarks(oldBuffer)
+}
+
+// SetLine replaces the line at the given index, and records the change
+func (j *Journal) SetLine(y int, runes []rune) {
+	if oldLine, ok := j.Buffer.Line(y); ok {
+		j.record(BufferOp{kind: opSetLine, y: y, oldLine: oldLine, line: runes})
+		j.Buffer.SetLine(y, runes)
+		return
+	}
+	// Setting a line after the end of the buffer adds empty lines in between
+	j.recordReplace(func(b Buffer) {
+		b.SetLine(y, runes)
+	})
+}
+
+// InsertLine inserts a line before the given index, and records the change
+func (j *Journal) InsertLine(y int, runes []rune) {
+	if y < 0 {
+		return
+	}
+	if y <= j.Buffer.Len() {
+		if runes == nil {
+			runes = []rune{}
+		}
+		j.record(BufferOp{kind: opInsertLine, y: y, line: runes})
+		j.Buffer.InsertLine(y, runes)
+		j.lineInserted(y)
+		return
+	}
+	// Inserting a line after the end of the buffer adds empty lines in between
+	j.recordReplace(func(b Buffer) {
+		b.InsertLine(y, runes)
+	})
+}
+
+// DeleteLine removes the line at the given index, and records the change
+func (j *Journal) DeleteLine(y int) {
+	oldLine, ok := j.Buffer.Line(y)
+	if !ok {
+		return
+	}
+	j.record(BufferOp{kind: opDeleteLine, y: y, oldLine: oldLine})
+	j.Buffer.DeleteLine(y)
+	j.lineDeleted(y)
+}
+
+// Truncate removes all lines from the given index and out, and records the change
+func (j *Journal) Truncate(y int) {
+	if y >= j.Buffer.Len() {
+		return
+	}
+	j.recordReplace(func(b Buffer) {
+		b.Truncate(y)
+	})
+}
+
+// Replace replaces the entire underlying buffer with the given one, and records the change
+func (j *Journal) Replace(b Buffer) {
+	oldBuffer := j.Buffer
+	j.Buffer = b
+	j.record(BufferOp{kind: opReplace, oldBuffer: oldBuffer.Copy(), buffer: b.Copy()})
+	j.relocateMarks(oldBuffer)
+}
+
+// TakeOps returns the changes that has been recorded so far, and starts with a fresh list of changes
+func (j *Journal) TakeOps() []BufferOp {
+	ops := j.ops
+	j.ops = nil
+	return ops
+}
+
+// Apply performs the given changes on the underlying buffer, without recording them
+func (j *Journal) Apply(ops []BufferOp) {
+	for _, op := range ops {
+		switch op.kind {
+		case opSetLine:
+			j.Buffer.SetLine(op.y, op.line)
+		case opInsertLine:
+			j.Buffer.InsertLine(op.y, op.line)
+			j.lineInserted(op.y)
+		case opDeleteLine:
+			j.Buffer.DeleteLine(op.y)
+			j.lineDeleted(op.y)
+		case opReplace:
+			oldBuffer := j.Buffer
+			j.Buffer = op.buffer.Copy()
+			j.relocateMarks(oldBuffer)
+		}
+	}
+}
+
+// Revert reverts the given changes on the underlying buffer, in reverse order, without recording them
+func (j *Journal) Revert(ops []BufferOp) {
+	for i := len(ops) - 1; i >= 0; i-- {
+		op := ops[i]
+		switch op.kind {
+		case opSetLine:
+			j.Buffer.SetLine(op.y, op.oldLine)
+		case opInsertLine:
+			j.Buffer.DeleteLine(op.y)
+			j.lineDeleted(op.y)
+		case opDeleteLine:
+			j.Buffer.InsertLine(op.y, op.oldLine)
+			j.lineInserted(op.y)
+		case opReplace:
+			oldBuffer := j.Buffer
+			j.Buffer = op.oldBuffer.Copy()
+			j.relocateMarks(oldBuffer)
+		}
+	}
+}
+
+// opsMemoryFootprint returns approximately how many bytes the line contents of the given changes are using.
+// Replaced buffers share most of their contents with the current buffer, and are not counted.
+func opsMemoryFootprint(ops []BufferOp) uint64 {
+	const runeSize = 4
+	var sum uint64
+	for _, op := range ops {
+		sum += uint64(cap(op.line)+cap(op.oldLine)) * runeSize
+	}
+	return sum
+}
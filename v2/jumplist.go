@@ -0,0 +1,145 @@
+package main
+
+import (
+	"github.com/xyproto/vt100"
+)
+
+// maxJumps is the number of locations that are kept in the jump list
+const maxJumps = 100
+
+// Jump is a location in a file that was jumped away from or back to
+type Jump struct {
+	Filename   string // the absolute path, or "" if the file has no name
+	LineIndex  LineIndex
+	X          ColIndex
+	definition bool // the jump was made by going to a definition, and ctrl-t can jump back
+}
+
+// JumpList is the list of locations that the cursor has jumped away from, for going back and forward,
+// also between files
+type JumpList struct {
+	jumps []Jump
+	index int // the position when moving back and forward in the list, or len(jumps)
+}
+
+// jumpList is the jump list that is shared by all open files
+var jumpList JumpList
+
+// sameLine checks if the two jumps are to the same line of the same file
+func (j Jump) sameLine(other Jump) bool {
+	return j.Filename == other.Filename && j.LineIndex == other.LineIndex
+}
+
+// Add records the location that is about to be jumped away from. Locations that were
+// moved back past are forgotten, the same way as in a web browser.
+func (jl *JumpList) Add(from Jump) {
+	jl.jumps = jl.jumps[:jl.index]
+	if n := len(jl.jumps); n > 0 && jl.jumps[n-1].sameLine(from) {
+		jl.jumps[n-1] = from
+	} else {
+		jl.jumps = append(jl.jumps, from)
+	}
+	if len(jl.jumps) > maxJumps {
+		jl.jumps = jl.jumps[len(jl.jumps)-maxJumps:]
+	}
+	jl.index = len(jl.jumps)
+}
+
+// Back returns the previous location, given the current location, which is remembered for going forward again.
+// Returns false if there is nowhere to go back to.
+func (jl *JumpList) Back(current Jump) (Jump, bool) {
+	if jl.index == len(jl.jumps) {
+		if jl.index == 0 {
+			return Jump{}, false
+		}
+		if last := jl.jumps[jl.index-1]; last.sameLine(current) {
+			// Already at the last location, so go back to the one before it
+			jl.index--
+		} else {
+			jl.jumps = append(jl.jumps, current)
+		}
+	} else {
+		current.definition = jl.jumps[jl.index].definition
+		jl.jumps[jl.index] = current
+	}
+	if jl.index == 0 {
+		return Jump{}, false
+	}
+	jl.index--
+	return jl.jumps[jl.index], true
+}
+
+// Forward returns the next location, after having gone back, given the current location.
+// Returns false if there is nowhere to go forward to.
+func (jl *JumpList) Forward(current Jump) (Jump, bool) {
+	if jl.index+1 >= len(jl.jumps) {
+		return Jump{}, false
+	}
+	current.definition = jl.jumps[jl.index].definition
+	jl.jumps[jl.index] = current
+	jl.index++
+	return jl.jumps[jl.index], true
+}
+
+// CanGoBackFromDefinition checks if the previous location is one that a definition was jumped to from
+func (jl *JumpList) CanGoBackFromDefinition() bool {
+	return jl.index > 0 && jl.jumps[jl.index-1].definition
+}
+
+// CurrentJump returns the current file and position, for the jump list
+func (e *Editor) CurrentJump() Jump {
+	x, _ := e.DataX()
+	return Jump{Filename: e.lspFilename(), LineIndex: e.DataY(), X: ColIndex(x)}
+}
+
+// RecordJump adds the current location to the jump list, before jumping away from it
+func (e *Editor) RecordJump() {
+	jumpList.Add(e.CurrentJump())
+}
+
+// RecordDefinitionJump adds the current location to the jump list, before jumping to a definition,
+// so that ctrl-t can jump back to it
+func (e *Editor) RecordDefinitionJump() {
+	from := e.CurrentJump()
+	from.definition = true
+	jumpList.Add(from)
+}
+
+// GoToJump goes to the given location, switching to another file if needed
+func (e *Editor) GoToJump(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, j Jump) error {
+	if j.Filename != "" && j.Filename != e.lspFilename() {
+		if err := e.Switch(c, tty, status, fileLock, j.Filename); err != nil {
+			return err
+		}
+	}
+	e.GoToLineNumberAndCol(j.LineIndex.LineNumber(), j.X.ColNumber(), c, status, true)
+	e.redraw = true
+	e.redrawCursor = true
+	return nil
+}
+
+// JumpBack goes back to the previous location in the jump list. Returns false if there is none.
+func (e *Editor) JumpBack(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) bool {
+	j, ok := jumpList.Back(e.CurrentJump())
+	if !ok {
+		return false
+	}
+	if err := e.GoToJump(c, tty, status, j); err != nil {
+		status.SetError(err)
+		status.ShowNoTimeout(c, e)
+	}
+	return true
+}
+
+// JumpForward goes forward to the next location in the jump list, after having gone back. Returns false if there is none.
+func (e *Editor) JumpForward(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) bool {
+	j, ok := jumpList.Forward(e.CurrentJump())
+	if !ok {
+		return false
+	}
+	if err := e.GoToJump(c, tty, status, j); err != nil {
+		status.SetError(err)
+		status.ShowNoTimeout(c, e)
+	}
+	return true
+}
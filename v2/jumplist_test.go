@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestJumpList(t *testing.T) {
+	var jl JumpList
+	if _, ok := jl.Back(Jump{Filename: "a.go"}); ok {
+		t.Error("expected nowhere to go back to in an empty jump list")
+	}
+
+	// Jump from a.go:1 to a.go:10, then from a.go:10 to the definition in b.go:5, then move to b.go:7
+	jl.Add(Jump{Filename: "a.go", LineIndex: 1})
+	jl.Add(Jump{Filename: "a.go", LineIndex: 10, definition: true})
+	if !jl.CanGoBackFromDefinition() {
+		t.Error("expected to be able to go back from the definition")
+	}
+	j, ok := jl.Back(Jump{Filename: "b.go", LineIndex: 7})
+	if !ok || j.Filename != "a.go" || j.LineIndex != 10 {
+		t.Fatalf("unexpected jump back: %+v, %v", j, ok)
+	}
+	if jl.CanGoBackFromDefinition() {
+		t.Error("expected the previous location to not be a definition jump")
+	}
+	if j, ok := jl.Back(j); !ok || j.LineIndex != 1 {
+		t.Fatalf("unexpected jump back: %+v, %v", j, ok)
+	}
+	if _, ok := jl.Back(Jump{Filename: "a.go", LineIndex: 1}); ok {
+		t.Error("expected nowhere to go back to at the start of the jump list")
+	}
+
+	// Going forward again ends up where the first jump back was made from
+	if j, ok := jl.Forward(Jump{Filename: "a.go", LineIndex: 2}); !ok || j.LineIndex != 10 {
+		t.Fatalf("unexpected jump forward: %+v, %v", j, ok)
+	}
+	if j, ok := jl.Forward(Jump{Filename: "a.go", LineIndex: 10}); !ok || j.Filename != "b.go" || j.LineIndex != 7 {
+		t.Fatalf("unexpected jump forward: %+v, %v", j, ok)
+	}
+	if _, ok := jl.Forward(Jump{Filename: "b.go", LineIndex: 7}); ok {
+		t.Error("expected nowhere to go forward to at the end of the jump list")
+	}
+
+	// The location that was moved to while going back is remembered, and a new jump forgets the locations after it
+	jl.Back(Jump{Filename: "b.go", LineIndex: 7})
+	jl.Add(Jump{Filename: "a.go", LineIndex: 11})
+	if len(jl.jumps) != 2 || jl.jumps[0].LineIndex != 2 || jl.jumps[1].LineIndex != 11 {
+		t.Errorf("unexpected jumps: %+v", jl.jumps)
+	}
+	if _, ok := jl.Forward(Jump{Filename: "c.go"}); ok {
+		t.Error("expected nowhere to go forward to after a new jump")
+	}
+
+	for i := 0; i < maxJumps*2; i++ {
+		jl.Add(Jump{Filename: "a.go", LineIndex: LineIndex(i)})
+	}
+	if len(jl.jumps) != maxJumps || jl.jumps[maxJumps-1].LineIndex != maxJumps*2-1 {
+		t.Errorf("expected the %d most recent jumps to be kept", maxJumps)
+	}
+}
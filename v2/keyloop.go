@@ -10,6 +10,7 @@ import (
 	"strings"
 	"time"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/atotto/clipboard"
 	"github.com/xyproto/digraph"
@@ -31,9 +32,10 @@ var fileLock = NewLockKeeper(defaultLockFile)
 // fnord contains either data or a filename to open
 // a LineNumber (may be 0 or -1)
 // a forceFlag for if the file should be force opened
+// the settings from the configuration files that apply to the file, and the error from reading them, if any
 // If an error and "true" is returned, it is a quit message to the user, and not an error.
 // If an error and "false" is returned, it is an error.
-func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber ColNumber, forceFlag bool, theme Theme, syntaxHighlight bool) (userMessage string, stopParent bool, err error) {
+func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber ColNumber, forceFlag bool, theme Theme, syntaxHighlight bool, cfg *Config, cfgErr error) (userMessage string, stopParent bool, err error) {
 
 	// Create a Canvas for drawing onto the terminal
 	vt100.Init()
@@ -65,7 +67,7 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 	)
 
 	// New editor struct. Scroll 10 lines at a time, no word wrap.
-	e, messageAfterRedraw, displayedImage, err := NewEditor(tty, c, fnord, lineNumber, colNumber, theme, syntaxHighlight, true)
+	e, messageAfterRedraw, displayedImage, err := NewEditor(tty, c, fnord, lineNumber, colNumber, theme, syntaxHighlight, true, cfg, cfgErr)
 	if err != nil {
 		return "", false, err
 	} else if displayedImage {
@@ -79,6 +81,9 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 		if filename, err := e.AbsFilename(); err == nil { // success
 			absFilename = filename
 		}
+		// Load the undo history from the previous session, if the file has not changed since then.
+		// Errors are ignored, since there may be no undo history.
+		undo.LoadHistory(e, absFilename)
 	}
 
 	// Minor adjustments to some modes
@@ -108,6 +113,14 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 		lockTimestamp time.Time
 	)
 
+	// Let other instances of the editor and the og GUI open files in this session. The remote control
+	// socket is recorded for each locked file, so that other instances can redirect to this session.
+	remoteServer, remoteErr := ListenRemote()
+	if remoteErr == nil {
+		defer remoteServer.Close()
+		fileLock.SetOwner(remoteServer.SocketPath())
+	}
+
 	// If the lock keeper does not have an overview already, that's fine. Ignore errors from lk.Load().
 	if err := fileLock.Load(); err != nil {
 		// Could not load an existing lock overview, this might be the first run? Try saving.
@@ -127,6 +140,9 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 		} else {
 			// Lock the current file, if it's not already locked
 			if err := fileLock.Lock(absFilename); err != nil {
+				if _, found := RemoteOwner(fileLock, absFilename); found {
+					return fmt.Sprintf("Already open in another instance of this editor.\nTry: o --remote %s or o -f %s", filepath.Base(absFilename), filepath.Base(absFilename)), false, errors.New(absFilename + " is locked")
+				}
 				return fmt.Sprintf("Locked by another (possibly dead) instance of this editor.\nTry: o -f %s", filepath.Base(absFilename)), false, errors.New(absFilename + " is locked")
 			}
 			// Immediately save the lock file as a signal to other instances of the editor
@@ -134,21 +150,29 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 		}
 		lockTimestamp = fileLock.GetTimestamp(absFilename)
 
-		// Set up a catch for panics, so that the current file can be unlocked
+		// Set up a catch for panics, so that the open files can be unlocked
 		defer func() {
 			if x := recover(); x != nil {
 				// Unlock and save the lock file
-				fileLock.Unlock(absFilename)
+				for _, b := range bufferList.buffers {
+					if !b.lockTimestamp.IsZero() {
+						fileLock.Unlock(b.absFilename)
+					}
+				}
 				fileLock.Save()
 
-				// Save the current file. The assumption is that it's better than not saving, if something crashes.
-				// TODO: Save to a crash file, then let the editor discover this when it starts.
-
-				// Create a suitable error message, depending on if the file is saved or not
-				msg := fmt.Sprintf("Saved the file first!\n%v", x)
-				if err := e.Save(c, tty); err != nil {
-					// Output the error message
-					msg = fmt.Sprintf("Could not save the file first! %v\n%v", err, x)
+				// Write the unsaved changes to swap files, so that they can be recovered the next time the files are opened,
+				// and write the stack trace to a crash file.
+				crashFilename, lost, err := e.writeCrashFiles(x)
+				recovery := "Unsaved changes can be recovered the next time the file is opened."
+				if len(lost) > 0 {
+					recovery = "Unsaved changes to " + strings.Join(lost, ", ") + " were lost."
+				}
+				msg := fmt.Sprintf("%s\n%v", recovery, x)
+				if err != nil {
+					msg = fmt.Sprintf("Could not write the crash report! %v\n%s\n%v", err, recovery, x)
+				} else if crashFilename != "" {
+					msg = fmt.Sprintf("%s\nThe crash report is in %s.\n%v", recovery, crashFilename, x)
 				}
 
 				// Output the error message
@@ -157,21 +181,63 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 		}()
 	}
 
+	// Keep track of this file in the list of open files, which can be switched between
+	bufferList.Add(&OpenBuffer{editor: e, undo: undo, absFilename: absFilename, lockTimestamp: lockTimestamp, stdin: fnord.stdin})
+
+	// Notice if the file is changed by another program
+	if !fnord.stdin {
+		fileWatcher.Watch(absFilename, e.lines.Buffer)
+	}
+
+	// Load the named bookmarks, and let the ones in this file follow their lines
+	bookmarks, _ = LoadBookmarks(bookmarksFilename)
+	e.AttachBookmarks()
+
+	// Offer to recover unsaved changes from a previous session that did not end well
+	if !lockTimestamp.IsZero() {
+		e.OfferSwapRecovery(c, tty, status, absFilename)
+	}
+
 	// Draw everything once, with slightly different behavior if used over ssh
 	e.InitialRedraw(c, status)
 
+	// Watch the open files for changes made by other programs. Files without unsaved changes are reloaded right away.
+	fileWatcher.Start(func(absFilename string) {
+		keyLoopMut.Lock()
+		defer keyLoopMut.Unlock()
+		e.ExternalChange(c, status, absFilename)
+	})
+
+	// Carry out the commands from the remote control socket, while the main loop is waiting for a key
+	if remoteServer != nil {
+		go remoteServer.Serve(func(cmd RemoteCommand) error {
+			keyLoopMut.Lock()
+			defer keyLoopMut.Unlock()
+			return e.HandleRemoteCommand(c, tty, status, cmd)
+		})
+	}
+
+	// The editor may only be changed by other goroutines while the main loop is waiting for a key.
+	// The keys are translated by the key map, so that the keys that are bound to an action are handled as that action.
+	keyLoopMut.Lock()
+	readKey := func() string {
+		keyLoopMut.Unlock()
+		defer keyLoopMut.Lock()
+		return keyMap.Translate(ReadKey(tty))
+	}
+
 	// This is the main loop for the editor
 	for !e.quit {
 
 		if e.macro == nil || (e.playBackMacroCount == 0 && !e.macro.Recording) {
 			// Read the next key in the regular way
-			key = tty.String()
+			key = readKey()
 			undo.IgnoreSnapshots(false)
 		} else {
 			if e.macro.Recording {
 				undo.IgnoreSnapshots(true)
 				// Read and record the next key
-				key = tty.String()
+				key = readKey()
 				if key != "c:20" { // ctrl-t
 					// But never record the macro toggle button
 					e.macro.Add(key)
@@ -183,11 +249,39 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 					e.macro.Home()
 					e.playBackMacroCount--
 					// No more macro keys. Read the next key.
-					key = tty.String()
+					key = readKey()
 				}
 			}
 		}
 
+		// If the file was changed on disk while there are unsaved changes, ask what to do instead of handling the key
+		if e.HandleExternalChange(c, tty, status) {
+			key = ""
+		}
+
+		// If a file with unsaved changes from a previous session was opened remotely, ask what to do instead of handling the key
+		if e.OfferRemoteRecovery(c, tty, status) {
+			key = ""
+		}
+
+		// Let the bookmarks follow their lines, also if another file has been switched to
+		e.AttachBookmarks()
+
+		// Shift and an arrow key moves the cursor while selecting text,
+		// alt, shift and an arrow key moves the cursor while selecting a rectangle of text
+		selecting := strings.HasPrefix(key, "⇧") || strings.HasPrefix(key, "⌥⇧")
+		if strings.HasPrefix(key, "⌥⇧") {
+			e.StartColumnSelection()
+		} else if selecting {
+			e.StartSelection()
+		}
+
+		// Editing a selected rectangle of text keeps it selected, so that the editing can continue
+		keepSelection := false
+
+		// Typing and deleting at several cursors keeps the extra cursors, any other key removes them
+		keepCursors := false
+
 		switch key {
 		case "c:17": // ctrl-q, quit
 			e.quit = true
@@ -308,13 +402,9 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			e.redrawCursor = true
 
 			// Check if we have jumped to a definition and need to go back
-			if len(backFunctions) > 0 {
-				lastIndex := len(backFunctions) - 1
-				// call the function for getting back
-				backFunctions[lastIndex]()
-				// pop a function from the end of backFunctions
-				backFunctions = backFunctions[:lastIndex]
-				if len(backFunctions) == 0 {
+			if jumpList.CanGoBackFromDefinition() {
+				e.JumpBack(c, tty, status)
+				if !jumpList.CanGoBackFromDefinition() {
 					// last possibility to jump back
 					status.SetMessageAfterRedraw("Jumped all the way back")
 				}
@@ -441,17 +531,21 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 				// Play back the macro, once
 				e.playBackMacroCount = 1
 			}
-		case "c:28": // ctrl-\, toggle comment for this block
+		case "c:28": // ctrl-\, toggle comment for this block, or for the selected lines
 			undo.Snapshot(e)
-			e.ToggleCommentBlock(c)
+			if e.HasSelection() {
+				e.ToggleCommentSelection()
+			} else {
+				e.ToggleCommentBlock(c)
+			}
 			e.redraw = true
 			e.redrawCursor = true
 		case "c:15": // ctrl-o, launch the command menu
 			status.ClearAll(c)
 			undo.Snapshot(e)
-			undoBackup := undo
 			lastCommandMenuIndex = e.CommandMenu(c, tty, status, bookmark, undo, lastCommandMenuIndex, forceFlag, fileLock)
-			undo = undoBackup
+			// The command menu may add cursors
+			keepCursors = true
 		case "c:31": // ctrl-_, enter a digraph
 			// Ask the user to type in a digraph
 			if digraphString, ok := e.UserInput(c, tty, status, "Type in a 2-letter digraph", digraph.All(), false); ok {
@@ -471,15 +565,22 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 					e.redraw = true
 				}
 			}
-		case "←": // left arrow
+		case "←", "⇧←", "⌥⇧←": // left arrow (or with shift, to select text)
 
 			// Don't move if ChatGPT is currently generating tokens that are being inserted
 			if e.generatingTokens {
 				break
 			}
 
+			// Move all the cursors, if there are several
+			if !selecting && e.HasCursors() {
+				e.MoveCursors(c, -1)
+				keepCursors = true
+				break
+			}
+
 			// Check if it's a special case
-			if kh.SpecialArrowKeypressWith("←") {
+			if !selecting && kh.SpecialArrowKeypressWith("←") {
 				// Ask the user for a command and run it
 				e.CommandPrompt(c, tty, status, bookmark, undo)
 				// It's important to reset the key history after hitting this combo
@@ -524,15 +625,22 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 				// no other terminal emulator does that
 				e.redraw = true
 			}
-		case "→": // right arrow
+		case "→", "⇧→", "⌥⇧→": // right arrow (or with shift, to select text)
 
 			// Don't move if ChatGPT is currently generating tokens that are being inserted
 			if e.generatingTokens {
 				break
 			}
 
+			// Move all the cursors, if there are several
+			if !selecting && e.HasCursors() {
+				e.MoveCursors(c, 1)
+				keepCursors = true
+				break
+			}
+
 			// Check if it's a special case
-			if kh.SpecialArrowKeypressWith("→") {
+			if !selecting && kh.SpecialArrowKeypressWith("→") {
 				// Ask the user for a command and run it
 				e.CommandPrompt(c, tty, status, bookmark, undo)
 				// It's important to reset the key history after hitting this combo
@@ -559,7 +667,7 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			}
 			e.SaveX(true)
 			e.redrawCursor = true
-		case "↑": // up arrow
+		case "↑", "⇧↑", "⌥⇧↑": // up arrow (or with shift, to select text)
 
 			// Don't move if ChatGPT is currently generating tokens that are being inserted
 			if e.generatingTokens {
@@ -567,7 +675,7 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			}
 
 			// Check if it's a special case
-			if kh.SpecialArrowKeypressWith("↑") {
+			if !selecting && kh.SpecialArrowKeypressWith("↑") {
 				// Ask the user for a command and run it
 				e.CommandPrompt(c, tty, status, bookmark, undo)
 				// It's important to reset the key history after hitting this combo
@@ -604,7 +712,7 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			}
 
 			e.redrawCursor = true
-		case "↓": // down arrow
+		case "↓", "⇧↓", "⌥⇧↓": // down arrow (or with shift, to select text)
 
 			// Don't move if ChatGPT is currently generating tokens that are being inserted
 			if e.generatingTokens {
@@ -612,7 +720,7 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			}
 
 			// Check if it's a special case
-			if kh.SpecialArrowKeypressWith("↓") {
+			if !selecting && kh.SpecialArrowKeypressWith("↓") {
 				// Ask the user for a command and run it
 				e.CommandPrompt(c, tty, status, bookmark, undo)
 				// It's important to reset the key history after hitting this combo
@@ -650,6 +758,28 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 
 			e.redrawCursor = true
 
+		case "⌃↑", "⌃↓": // ctrl and up or down arrow, add a cursor and move to the line above or below
+			if !e.readOnly {
+				e.AddCursorVertically(c, key == "⌃↓")
+			}
+			keepCursors = true
+		case "⌃←", "⌃→": // ctrl and left or right arrow, move all the cursors to the left or right
+			if key == "⌃←" {
+				e.MoveCursors(c, -1)
+			} else {
+				e.MoveCursors(c, 1)
+			}
+			keepCursors = true
+		case "⌥↑", "⌥↓": // alt and up or down arrow, move the focus to the previous or next pane
+			if panes.Split() {
+				e.NextPane(c, key == "⌥↓")
+			}
+		case "⌥←", "⌥→": // alt and left or right arrow, go back or forward in the jump list
+			if key == "⌥←" && !e.JumpBack(c, tty, status) {
+				status.SetMessageAfterRedraw("Nowhere to jump back to")
+			} else if key == "⌥→" && !e.JumpForward(c, tty, status) {
+				status.SetMessageAfterRedraw("Nowhere to jump forward to")
+			}
 		case "c:14": // ctrl-n, scroll down or jump to next match, using the sticky search term
 
 			// If in Debug mode, let ctrl-n mean "next instruction"
@@ -866,6 +996,22 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 				break
 			}
 
+			// Insert a space on all the lines of the selected rectangle
+			if e.HasColumnSelection() {
+				undo.SnapshotGroup(e, undoGroupTyping)
+				e.ReplaceRectangle(c, " ")
+				keepSelection = true
+				break
+			}
+
+			// Insert a space at all the cursors
+			if e.HasCursors() {
+				undo.SnapshotGroup(e, undoGroupTyping)
+				e.InsertAtCursors(c, ' ')
+				keepCursors = true
+				break
+			}
+
 			// Regular behavior, take an undo snapshot and insert a space
 			undo.Snapshot(e)
 			// Place a space
@@ -896,6 +1042,14 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 				break
 			}
 
+			// Split the line at all the cursors
+			if e.HasCursors() {
+				undo.Snapshot(e)
+				e.NewLineAtCursors(c)
+				keepCursors = true
+				break
+			}
+
 			// Regular behavior
 
 			// Modify the paste double-keypress detection to allow for a manual return before pasting the rest
@@ -1086,9 +1240,8 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 					indent = false
 				}
 			}
-			e.MakeConsistent()
 
-			h := int(c.Height())
+			h := viewHeight(c)
 			if e.pos.sy > (h - 1) {
 				e.pos.Down(c)
 				e.redraw = e.ScrollDown(c, status, 1)
@@ -1137,6 +1290,22 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 				break
 			}
 
+			// Delete the selected rectangle, or the column to the left of it
+			if e.HasColumnSelection() {
+				undo.Snapshot(e)
+				e.BackspaceRectangle(c)
+				keepSelection = true
+				break
+			}
+
+			// Delete to the left of all the cursors
+			if e.HasCursors() {
+				undo.Snapshot(e)
+				e.BackspaceAtCursors(c)
+				keepCursors = true
+				break
+			}
+
 			// Just clear the search term, if there is an active search
 			if len(e.SearchTerm()) > 0 {
 				e.ClearSearchTerm()
@@ -1342,6 +1511,20 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			// Prepare to redraw
 			e.redrawCursor = true
 			e.redraw = true
+		case "⌥z": // alt-z, redo
+			// Forget the cut, copy and paste line state
+			lastCutY = -1
+			lastPasteY = -1
+			lastCopyY = -1
+
+			if err := undo.Redo(e); err == nil {
+				e.redrawCursor = true
+				e.redraw = true
+				keepCursors = true
+			} else {
+				status.SetMessage("Nothing more to redo")
+				status.Show(c, e)
+			}
 		case "c:1", "c:25": // ctrl-a, home (or ctrl-y for scrolling up in the st terminal)
 			// Do not reset cut/copy/paste status
 
@@ -1391,6 +1574,18 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			e.SaveX(true)
 		case "c:4": // ctrl-d, delete
 			undo.Snapshot(e)
+			if e.HasColumnSelection() {
+				// Delete the selected rectangle, or the column to the right of it
+				e.DeleteRectangle(c)
+				keepSelection = true
+				break
+			}
+			if e.HasCursors() {
+				// Delete at all the cursors
+				e.DeleteAtCursors(c)
+				keepCursors = true
+				break
+			}
 			if e.Empty() {
 				status.SetMessage("Empty")
 				status.Show(c, e)
@@ -1419,8 +1614,8 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 				break
 			}
 
-			// func prefix must exist for this language/mode for GoToDefinition to be supported
-			jumpedToDefinition := e.FuncPrefix() != "" && e.GoToDefinition(tty, c, status)
+			// A language server, a tag file or a func prefix must exist for this language/mode for GoToDefinition to be supported
+			jumpedToDefinition := (e.FuncPrefix() != "" || e.HasLanguageServer() || e.HasTags()) && e.GoToDefinition(tty, c, status)
 
 			// If the definition could not be found, toggle the status line at the bottom.
 			if !jumpedToDefinition {
@@ -1445,6 +1640,7 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 				vt100.SetXY(uint(x), uint(y))
 				e.redrawCursor = true
 				e.redraw = true
+				keepCursors = true
 			} else {
 				status.SetMessage("Nothing more to undo")
 				status.Show(c, e)
@@ -1494,6 +1690,8 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			}
 			if !cancel {
 				e.ClearSearchTerm()
+				// Remember where to jump back to
+				e.RecordJump()
 			}
 			status.ClearAll(c)
 			if goToTop {
@@ -1529,7 +1727,45 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 				}
 			}
 			e.redrawCursor = true
-		case "c:24": // ctrl-x, cut line
+		case "c:24": // ctrl-x, cut line (or the selected text)
+			if e.HasColumnSelection() {
+				s := strings.Join(e.RectangleLines(), "\n")
+				lastCutY = -1
+				lastCopyY = -1
+				lastPasteY = -1
+				// Copy the selected rectangle internally
+				copyLines = strings.Split(s, "\n")
+				// Place the selected rectangle in the clipboard
+				if runtime.GOOS == "darwin" {
+					pbcopy(s)
+				} else {
+					_ = clipboard.WriteAll(s)
+				}
+				undo.Snapshot(e)
+				// Keep an empty rectangle selected, so that text can be pasted or typed in
+				e.ReplaceRectangle(c, "")
+				keepSelection = true
+				break
+			}
+			if e.HasSelection() {
+				s := e.SelectedText()
+				lastCutY = -1
+				lastCopyY = -1
+				lastPasteY = -1
+				// Copy the selected text internally
+				copyLines = strings.Split(s, "\n")
+				// Place the selected text in the clipboard
+				if runtime.GOOS == "darwin" {
+					pbcopy(s)
+				} else {
+					_ = clipboard.WriteAll(s)
+				}
+				undo.Snapshot(e)
+				e.DeleteSelection(c, status, bookmark)
+				e.redrawCursor = true
+				e.redraw = true
+				break
+			}
 			y := e.DataY()
 			line := e.Line(y)
 			// Prepare to cut
@@ -1634,7 +1870,40 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 
 			e.redraw = true
 			e.redrawCursor = true
-		case "c:3": // ctrl-c, copy the stripped contents of the current line
+		case "c:3": // ctrl-c, copy the stripped contents of the current line (or the selected text)
+
+			if e.HasSelection() {
+				s := e.SelectedText()
+				if e.HasColumnSelection() {
+					s = strings.Join(e.RectangleLines(), "\n")
+				}
+				lastCutY = -1
+				lastCopyY = -1
+				lastPasteY = -1
+				// Copy the selected text to the internal clipboard
+				copyLines = strings.Split(s, "\n")
+				// Prepare a status message
+				plural := ""
+				runeCount := utf8.RuneCountInString(s)
+				if runeCount != 1 {
+					plural = "s"
+				}
+				// Place the selected text in the clipboard
+				var err error
+				if runtime.GOOS == "darwin" {
+					err = pbcopy(s)
+				} else {
+					err = clipboard.WriteAll(s)
+				}
+				status.Clear(c)
+				if err != nil {
+					status.SetMessage(fmt.Sprintf("Copied %d selected character%s", runeCount, plural))
+				} else {
+					status.SetMessage(fmt.Sprintf("Copied %d selected character%s (clipboard)", runeCount, plural))
+				}
+				status.Show(c, e)
+				break
+			}
 
 			// ctrl-c might interrupt the program, but saving at the wrong time might be just as destructive.
 			// e.Save(c, tty)
@@ -1797,6 +2066,29 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 				break
 			}
 
+			// Paste the lines as a rectangle, if a rectangle is selected
+			if e.HasColumnSelection() {
+				undo.Snapshot(e)
+				e.PasteRectangle(c, copyLines)
+				lastCutY = -1
+				lastCopyY = -1
+				lastPasteY = -1
+				keepSelection = true
+				break
+			}
+
+			// Paste over the selected text, if any
+			if e.HasSelection() {
+				undo.Snapshot(e)
+				e.ReplaceSelection(c, status, bookmark, strings.Join(copyLines, "\n"))
+				lastCutY = -1
+				lastCopyY = -1
+				lastPasteY = -1
+				e.redrawCursor = true
+				e.redraw = true
+				break
+			}
+
 			// Now save the contents to "previousCopyLines" and check if they are the same first
 			if !equalStringSlices(copyLines, previousCopyLines) {
 				// Start with single-line paste if the contents are new
@@ -1804,8 +2096,8 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			}
 			previousCopyLines = copyLines
 
-			// Prepare to paste
-			undo.Snapshot(e)
+			// Prepare to paste. Pasting twice on the same line is undone as one action.
+			undo.SnapshotGroup(e, undoGroupPaste)
 			y := e.DataY()
 
 			// Forget the cut and copy line state
@@ -1950,7 +2242,8 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 					bookmark = nil
 				} else {
 					undo.Snapshot(e)
-					// Go to the saved bookmark position
+					// Remember where to jump back to, and go to the saved bookmark position
+					e.RecordJump()
 					e.GoToPosition(c, status, *bookmark)
 					// TODO: Just use status.SetMessageAfterRedraw instead?
 					// Do the redraw manually before showing the status message
@@ -1988,11 +2281,30 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			}
 			e.redrawCursor = true
 		default: // any other key
+			if strings.HasPrefix(key, "⌥") {
+				// Alt and a letter that is not bound to anything
+				break
+			}
 			keyRunes := []rune(key)
+			if e.HasColumnSelection() && len(keyRunes) > 0 && unicode.IsGraphic(keyRunes[0]) {
+				// Type the letter on all the lines of the selected rectangle
+				undo.SnapshotGroup(e, undoGroupTyping)
+				e.ReplaceRectangle(c, string(keyRunes[0]))
+				keepSelection = true
+				break
+			}
+			if e.HasCursors() && len(keyRunes) > 0 && unicode.IsGraphic(keyRunes[0]) {
+				// Type the letter at all the cursors
+				undo.SnapshotGroup(e, undoGroupTyping)
+				e.InsertAtCursors(c, keyRunes[0])
+				keepCursors = true
+				break
+			}
 			// panic(fmt.Sprintf("PRESSED KEY: %v", []rune(key)))
 			if len(keyRunes) > 0 && unicode.IsLetter(keyRunes[0]) { // letter
 
-				undo.Snapshot(e)
+				// A burst of typed letters is undone as one action
+				undo.SnapshotGroup(e, undoGroupTyping)
 
 				if e.mode == mode.Go { // TODO: And e.onlyValidCode
 					if e.Empty() {
@@ -2018,7 +2330,7 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 					e.redraw = true
 				}
 			} else if len(keyRunes) > 0 && unicode.IsGraphic(keyRunes[0]) { // any other key that can be drawn
-				undo.Snapshot(e)
+				undo.SnapshotGroup(e, undoGroupTyping)
 				e.redraw = true
 
 				// Place *something*
@@ -2071,6 +2383,22 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			}
 		}
 
+		if selecting || keepSelection {
+			// Draw the selection
+			e.redraw = true
+		} else if e.ClearSelection() {
+			// Any other key than shift and an arrow key ends the selection
+			e.redraw = true
+		}
+		if !keepCursors && e.ClearCursors() {
+			e.redraw = true
+		}
+
+		// If other files are open, ask what to do about unsaved changes before quitting
+		if e.quit && !e.ConfirmQuit(c, tty, status) {
+			e.quit = false
+		}
+
 		if e.addSpace {
 			e.InsertString(c, " ")
 			e.addSpace = false
@@ -2088,9 +2416,7 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 		if kh.Repeated("c:27", 4-1) { // 4 times, minus the one that was added just now
 			status.ClearAll(c)
 			undo.Snapshot(e)
-			undoBackup := undo
 			lastCommandMenuIndex = e.CommandMenu(c, tty, status, bookmark, undo, lastCommandMenuIndex, forceFlag, fileLock)
-			undo = undoBackup
 			// Reset the key history next iteration
 			clearKeyHistory = true
 		}
@@ -2100,6 +2426,11 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			status.ClearAll(c)
 		}
 
+		// Write the unsaved changes to a swap file, in the background, after a short while
+		if b := bufferList.Current(); b != nil {
+			b.UpdateSwapFile(e.lines.Buffer, e.changed)
+		}
+
 		// Draw and/or redraw everything, with slightly different behavior over ssh
 		e.RedrawAtEndOfKeyLoop(c, status)
 
@@ -2115,29 +2446,11 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 		}
 
 	} // end of main loop
+	keyLoopMut.Unlock()
 
-	if canUseLocks {
-		// Start by loading the lock overview, just in case something has happened in the mean time
-		fileLock.Load()
-
-		// Check if the lock is unchanged
-		fileLockTimestamp := fileLock.GetTimestamp(absFilename)
-		lockUnchanged := lockTimestamp == fileLockTimestamp
-
-		// TODO: If the stored timestamp is older than uptime, unlock and save the lock overview
-
-		// var notime time.Time
-
-		if !forceFlag || lockUnchanged {
-			// If the file has not been locked externally since this instance of the editor was loaded, don't
-			// Unlock the current file and save the lock overview. Ignore errors because they are not critical.
-			fileLock.Unlock(absFilename)
-			fileLock.Save()
-		}
-	}
-
-	// Save the current location in the location history and write it to file
-	e.SaveLocation(absFilename, locationHistory)
+	// Unlock all open files, and save their locations and undo histories
+	e.CloseAllBuffers(fileLock, forceFlag)
+	ShutdownLanguageServers()
 
 	// Clear all status bar messages
 	status.ClearAll(c)
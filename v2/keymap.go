@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/xyproto/vt100"
+)
+
+// KeyAction is a named editor action that can be bound to keys
+type KeyAction struct {
+	Name        string   // the name that is used in the configuration file, like "save"
+	Key         string   // the key that the main loop handles the action as, like "c:19"
+	DefaultKeys []string // the keys that are bound to the action by default
+	Description string
+}
+
+// unboundAction is the action name that is used in the configuration file for removing a key binding
+const unboundAction = "none"
+
+// keyActions are the actions that can be bound to keys, in the order they are listed in the help screen
+var keyActions = []KeyAction{
+	{"quit", "c:17", []string{"c:17"}, "Quit"},
+	{"save", "c:19", []string{"c:19"}, "Save (or step, in debug mode)"},
+	{"menu", "c:15", []string{"c:15"}, "Show the menu"},
+	{"search", "c:6", []string{"c:6"}, "Search, or search and replace"},
+	{"goto-line", "c:12", []string{"c:12"}, "Go to a line number or percentage"},
+	{"goto-definition", "c:7", []string{"c:7"}, "Go to the definition, or toggle the status line"},
+	{"undo", "c:21", []string{"c:21", "c:26"}, "Undo"},
+	{"redo", "⌥z", []string{"⌥z"}, "Redo"},
+	{"cut", "c:24", []string{"c:24"}, "Cut the current line or the selected text"},
+	{"copy", "c:3", []string{"c:3"}, "Copy the current line, the current block or the selected text"},
+	{"paste", "c:22", []string{"c:22"}, "Paste"},
+	{"delete-to-end", "c:11", []string{"c:11"}, "Delete to the end of the line"},
+	{"delete", "c:4", []string{"c:4"}, "Delete the character under the cursor"},
+	{"backspace", "c:127", []string{"c:8", "c:127"}, "Delete the character to the left"},
+	{"join", "c:10", []string{"c:10"}, "Join the current line with the next one"},
+	{"home", "c:1", []string{"c:1"}, "Go to the start of the line"},
+	{"end", "c:5", []string{"c:5"}, "Go to the end of the line"},
+	{"next", "c:14", []string{"c:14"}, "Scroll down, or go to the next match"},
+	{"previous", "c:16", []string{"c:16"}, "Scroll up, or go to the previous match"},
+	{"matching-paren", "c:30", []string{"c:29", "c:30"}, "Jump to the matching parenthesis or bracket"},
+	{"comment", "c:28", []string{"c:28"}, "Toggle comments for the current block or the selected lines"},
+	{"format", "c:23", []string{"c:23"}, "Format the code, or insert a template"},
+	{"build", "c:0", []string{"c:0"}, "Build, export or run"},
+	{"macro", "c:20", []string{"c:20"}, "Record or play back a macro, or jump between header and source"},
+	{"portal", "c:18", []string{"c:18"}, "Open or close a portal (or continue, in debug mode)"},
+	{"bookmark", "c:2", []string{"c:2"}, "Bookmark the current line, or jump to the bookmark"},
+	{"jump-back", "⌥←", []string{"⌥←"}, "Go back in the jump list"},
+	{"jump-forward", "⌥→", []string{"⌥→"}, "Go forward in the jump list"},
+	{"previous-pane", "⌥↑", []string{"⌥↑"}, "Move the focus to the previous pane"},
+	{"next-pane", "⌥↓", []string{"⌥↓"}, "Move the focus to the next pane"},
+	{"digraph", "c:31", []string{"c:31"}, "Insert a digraph"},
+	{"escape", "c:27", []string{"c:27"}, "Clear the search and redraw (press 4 times for the menu)"},
+	{"return", "c:13", []string{"c:13"}, "Insert a new line"},
+	{"tab", "c:9", []string{"c:9"}, "Indent, or insert a tab"},
+}
+
+// namedKeys are the names of keys that can be used in the configuration file, in addition to ctrl-a to ctrl-z
+var namedKeys = map[string]string{
+	"ctrl-space": "c:0",
+	"ctrl-@":     "c:0",
+	"ctrl-\\":    "c:28",
+	"ctrl-]":     "c:29",
+	"ctrl-~":     "c:30",
+	"ctrl-^":     "c:30",
+	"ctrl-_":     "c:31",
+	"ctrl-/":     "c:31",
+	"esc":        "c:27",
+	"return":     "c:13",
+	"enter":      "c:13",
+	"tab":        "c:9",
+	"backspace":  "c:127",
+	"space":      " ",
+	"up":         "↑",
+	"down":       "↓",
+	"left":       "←",
+	"right":      "→",
+}
+
+// keyModifiers are the prefixes of modified arrow keys, as returned by ReadKey, by name
+var keyModifiers = map[string]string{
+	"shift-":     "⇧",
+	"alt-":       "⌥",
+	"alt-shift-": "⌥⇧",
+	"ctrl-":      "⌃",
+}
+
+// KeyMap maps keys, as returned by ReadKey, to the names of actions
+type KeyMap map[string]string
+
+// keyMap is the key map that is used by the main loop
+var keyMap = NewKeyMap(nil)
+
+// findKeyAction finds the action with the given name
+func findKeyAction(name string) (*KeyAction, bool) {
+	for i := range keyActions {
+		if keyActions[i].Name == name {
+			return &keyActions[i], true
+		}
+	}
+	return nil, false
+}
+
+// NewKeyMap creates a key map with the default key bindings, and then the given bindings from key to action name.
+// The given keys must already be parsed with parseKeyName.
+func NewKeyMap(bindings map[string]string) KeyMap {
+	km := make(KeyMap)
+	for _, action := range keyActions {
+		for _, key := range action.DefaultKeys {
+			km[key] = action.Name
+		}
+	}
+	for key, name := range bindings {
+		km[key] = name
+	}
+	return km
+}
+
+// Translate returns the key that the main loop handles the action that the given key is bound to as.
+// Keys that are not bound are returned as they are, and keys that have been unbound are returned as "".
+func (km KeyMap) Translate(key string) string {
+	name, ok := km[key]
+	if !ok {
+		return key
+	}
+	if action, ok := findKeyAction(name); ok {
+		return action.Key
+	}
+	return ""
+}
+
+// KeysFor returns the names of the keys that are bound to the given action, sorted
+func (km KeyMap) KeysFor(name string) []string {
+	var keys []string
+	for key, actionName := range km {
+		if actionName == name {
+			keys = append(keys, keyName(key))
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Bindings returns the effective key bindings as lines of text, for the help screen
+func (km KeyMap) Bindings() []string {
+	const keyColumnWidth = 22
+	var lines []string
+	for _, action := range keyActions {
+		keys := strings.Join(km.KeysFor(action.Name), ", ")
+		if keys == "" {
+			keys = "(none)"
+		}
+		lines = append(lines, fmt.Sprintf("%-*s %-16s %s", keyColumnWidth, keys, action.Name, action.Description))
+	}
+	return lines
+}
+
+// parseKeyName converts a key name from the configuration file, like "ctrl-s", "alt-up" or "esc",
+// to a key as returned by ReadKey. Single characters are used as they are.
+func parseKeyName(name string) (string, error) {
+	lowerName := strings.ToLower(strings.TrimSpace(name))
+	if key, ok := namedKeys[lowerName]; ok {
+		return key, nil
+	}
+	if strings.HasPrefix(lowerName, "ctrl-") && len(lowerName) == len("ctrl-")+1 {
+		if letter := lowerName[len(lowerName)-1]; letter >= 'a' && letter <= 'z' {
+			return "c:" + strconv.Itoa(int(letter-'a'+1)), nil
+		}
+	}
+	if strings.HasPrefix(lowerName, "alt-") && len(lowerName) == len("alt-")+1 {
+		if letter := lowerName[len(lowerName)-1]; letter >= 'a' && letter <= 'z' {
+			return "⌥" + string(rune(letter)), nil
+		}
+	}
+	for prefix, symbol := range keyModifiers {
+		if arrow, ok := namedKeys[strings.TrimPrefix(lowerName, prefix)]; ok && strings.HasPrefix(lowerName, prefix) && strings.ContainsAny(arrow, "↑↓←→") {
+			return symbol + arrow, nil
+		}
+	}
+	if utf8.RuneCountInString(name) == 1 {
+		return name, nil
+	}
+	return "", fmt.Errorf("unknown key: %s", name)
+}
+
+// keyName returns a readable name for the given key, as returned by ReadKey, like "ctrl-s"
+func keyName(key string) string {
+	switch key {
+	case "c:0":
+		return "ctrl-space"
+	case "c:28":
+		return "ctrl-\\"
+	case "c:29":
+		return "ctrl-]"
+	case "c:30":
+		return "ctrl-~"
+	case "c:31":
+		return "ctrl-_"
+	case "c:27":
+		return "esc"
+	case "c:13":
+		return "return"
+	case "c:9":
+		return "tab"
+	case "c:8":
+		return "ctrl-h"
+	case "c:127":
+		return "backspace"
+	case " ":
+		return "space"
+	}
+	if strings.HasPrefix(key, "c:") {
+		if n, err := strconv.Atoi(key[2:]); err == nil && n >= 1 && n <= 26 {
+			return "ctrl-" + string(rune('a'+n-1))
+		}
+	}
+	if strings.HasPrefix(key, "⌥") && len(key) == len("⌥")+1 && key[len(key)-1] >= 'a' && key[len(key)-1] <= 'z' {
+		return "alt-" + key[len(key)-1:]
+	}
+	for name, arrow := range namedKeys {
+		if !strings.ContainsAny(arrow, "↑↓←→") {
+			continue
+		}
+		if key == arrow {
+			return name
+		}
+		for prefix, symbol := range keyModifiers {
+			if key == symbol+arrow {
+				return prefix + name
+			}
+		}
+	}
+	return key
+}
+
+// parseKeyBinding checks a key binding from the configuration file, and returns the key and the action name
+func parseKeyBinding(keyString, actionName string) (string, string, error) {
+	key, err := parseKeyName(keyString)
+	if err != nil {
+		return "", "", err
+	}
+	actionName = strings.ToLower(actionName)
+	if _, ok := findKeyAction(actionName); !ok && actionName != unboundAction {
+		return "", "", fmt.Errorf("unknown action: %s", actionName)
+	}
+	return key, actionName, nil
+}
+
+// ShowKeyBindings displays the effective key bindings in a box that can be scrolled with the arrow keys
+func (e *Editor) ShowKeyBindings(c *vt100.Canvas, tty *vt100.TTY) {
+	e.ShowLines(c, tty, "Key bindings", keyMap.Bindings(), nil)
+}
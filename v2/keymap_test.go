@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeyMapDefaults(t *testing.T) {
+	km := NewKeyMap(nil)
+	// The default key map must leave the keys as they are, so that the main loop works as before
+	for _, action := range keyActions {
+		for _, key := range action.DefaultKeys {
+			if got := km.Translate(key); got != key && !(got == action.Key && len(action.DefaultKeys) > 1) {
+				t.Errorf("expected %q to be translated to itself, got %q", key, got)
+			}
+		}
+	}
+	for _, key := range []string{"a", "↑", "⇧←", "c:26", "c:8"} {
+		if got := km.Translate(key); got != key && km[key] == "" {
+			t.Errorf("expected %q to be left as it is, got %q", key, got)
+		}
+	}
+	// The jump list and the panes have keys of their own, so that both can be used when the view is split
+	if keys := km.KeysFor("jump-back"); len(keys) != 1 || keys[0] != "alt-left" {
+		t.Errorf("expected alt-left to go back in the jump list, got %v", keys)
+	}
+	if keys := km.KeysFor("next-pane"); len(keys) != 1 || keys[0] != "alt-down" {
+		t.Errorf("expected alt-down to move to the next pane, got %v", keys)
+	}
+}
+
+func TestKeyMapOverrides(t *testing.T) {
+	km := NewKeyMap(map[string]string{
+		"c:26": unboundAction, // ctrl-z
+		"c:29": "build",       // ctrl-]
+		"⌥↑":   "save",
+	})
+	if got := km.Translate("c:26"); got != "" {
+		t.Errorf("expected ctrl-z to be unbound, got %q", got)
+	}
+	if got := km.Translate("c:29"); got != "c:0" {
+		t.Errorf("expected ctrl-] to build, got %q", got)
+	}
+	if got := km.Translate("⌥↑"); got != "c:19" {
+		t.Errorf("expected alt-up to save, got %q", got)
+	}
+	if keys := km.KeysFor("undo"); len(keys) != 1 || keys[0] != "ctrl-u" {
+		t.Errorf("expected only ctrl-u to undo, got %v", keys)
+	}
+	if keys := km.KeysFor("build"); len(keys) != 2 || keys[0] != "ctrl-]" || keys[1] != "ctrl-space" {
+		t.Errorf("unexpected keys for building: %v", keys)
+	}
+}
+
+func TestParseKeyName(t *testing.T) {
+	tests := []struct {
+		name, key string
+	}{
+		{"ctrl-s", "c:19"},
+		{"Ctrl-A", "c:1"},
+		{"ctrl-space", "c:0"},
+		{"ctrl-\\", "c:28"},
+		{"esc", "c:27"},
+		{"alt-shift-left", "⌥⇧←"},
+		{"alt-z", "⌥z"},
+		{"ctrl-down", "⌃↓"},
+		{"up", "↑"},
+		{"§", "§"},
+	}
+	for _, test := range tests {
+		key, err := parseKeyName(test.name)
+		if err != nil || key != test.key {
+			t.Errorf("parseKeyName(%q) = %q, %v, expected %q", test.name, key, err, test.key)
+		}
+		if test.name == "ctrl-s" || test.name == "alt-shift-left" || test.name == "ctrl-space" || test.name == "alt-z" {
+			if name := keyName(key); name != test.name {
+				t.Errorf("keyName(%q) = %q, expected %q", key, name, test.name)
+			}
+		}
+	}
+	if _, err := parseKeyName("ctrl-shift-q"); err == nil {
+		t.Error("expected an error for an unknown key")
+	}
+	if _, _, err := parseKeyBinding("ctrl-s", "fly"); err == nil {
+		t.Error("expected an error for an unknown action")
+	}
+}
+
+func TestConfigKeys(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.toml")
+	contents := "[keys]\nctrl-z = \"none\"\n\"ctrl-]\" = \"build\"\nctrl-q = \"fly\"\n"
+	if err := os.WriteFile(configFile, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{}
+	if err := cfg.readFile(configFile, true); err == nil {
+		t.Error("expected an error for the unknown action")
+	}
+	km := NewKeyMap(cfg.KeyBindings())
+	if km.Translate("c:26") != "" || km.Translate("c:29") != "c:0" || km.Translate("c:17") != "c:17" {
+		t.Errorf("unexpected key bindings: %v", cfg.KeyBindings())
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+)
+
+// LineEndings is the style of line endings that a file uses
+type LineEndings int
+
+const (
+	// LF is for line endings like on Linux, BSD and macOS
+	LF LineEndings = iota
+	// CRLF is for line endings like on Windows and DOS
+	CRLF
+	// CR is for line endings like on classic Mac OS
+	CR
+	// MixedLineEndings is for files with both LF and CRLF line endings, which are kept as they are for each line
+	MixedLineEndings
+)
+
+// lineEndingMap remembers the line endings of a file with mixed line endings.
+// For each line contents, there is one entry per line with those contents, in order, that is true if the line ended with CRLF.
+type lineEndingMap map[string][]bool
+
+// String returns the name of the line ending style
+func (le LineEndings) String() string {
+	switch le {
+	case CRLF:
+		return "CRLF"
+	case CR:
+		return "CR"
+	case MixedLineEndings:
+		return "mixed"
+	}
+	return "LF"
+}
+
+// Separator returns the line ending, as a string. Mixed line endings uses LF for lines that are not known.
+func (le LineEndings) Separator() string {
+	switch le {
+	case CRLF:
+		return "\r\n"
+	case CR:
+		return "\r"
+	}
+	return "\n"
+}
+
+// detectLineEndings finds out which line endings the given data uses
+func detectLineEndings(data []byte) LineEndings {
+	crlfCount := bytes.Count(data, []byte{'\r', '\n'})
+	lfCount := bytes.Count(data, []byte{'\n'}) - crlfCount
+	crCount := bytes.Count(data, []byte{'\r'}) - crlfCount
+	switch {
+	case crlfCount > 0 && lfCount > 0:
+		return MixedLineEndings
+	case crlfCount > 0:
+		return CRLF
+	case lfCount == 0 && crCount > 0:
+		return CR
+	}
+	return LF
+}
+
+// add remembers the line ending of a line with the given contents
+func (m lineEndingMap) add(contents string, crlf bool) {
+	m[contents] = append(m[contents], crlf)
+}
+
+// joinLineEndings converts the given text, with LF line endings, to the given line ending style.
+// For mixed line endings, lines that are in the given map get the line endings they had when the file was loaded,
+// while new lines get the same line ending as the line above. Returns the map for the converted text.
+func joinLineEndings(s string, le LineEndings, endings lineEndingMap) (string, lineEndingMap) {
+	switch le {
+	case CRLF, CR:
+		return strings.ReplaceAll(s, "\n", le.Separator()), nil
+	case MixedLineEndings:
+	default:
+		return s, nil
+	}
+	var (
+		sb         strings.Builder
+		used       = make(map[string]int)
+		newEndings = make(lineEndingMap)
+		crlf       bool
+	)
+	lines := strings.SplitAfter(s, "\n")
+	for _, line := range lines {
+		if !strings.HasSuffix(line, "\n") {
+			// The last line, which has no line ending
+			sb.WriteString(line)
+			break
+		}
+		contents := line[:len(line)-1]
+		if known := endings[contents]; used[contents] < len(known) {
+			crlf = known[used[contents]]
+			used[contents]++
+		}
+		newEndings.add(contents, crlf)
+		sb.WriteString(contents)
+		if crlf {
+			sb.WriteString("\r\n")
+		} else {
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String(), newEndings
+}
+
+// ConvertLineEndings makes the file be saved with the given line ending style from now on
+func (e *Editor) ConvertLineEndings(le LineEndings) {
+	if e.lineEndings == le {
+		return
+	}
+	e.lineEndings = le
+	e.mixedEndings = nil
+	e.changed = true
+}
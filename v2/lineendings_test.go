@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDetectLineEndings(t *testing.T) {
+	tests := []struct {
+		data     string
+		expected LineEndings
+	}{
+		{"a\nb\n", LF},
+		{"a\r\nb\r\n", CRLF},
+		{"a\rb\r", CR},
+		{"a\r\nb\nc\r\n", MixedLineEndings},
+		{"no line endings", LF},
+	}
+	for _, test := range tests {
+		if le := detectLineEndings([]byte(test.data)); le != test.expected {
+			t.Errorf("expected %v for %q, got %v", test.expected, test.data, le)
+		}
+	}
+}
+
+func TestKeepLineEndings(t *testing.T) {
+	dir := t.TempDir()
+	for _, contents := range []string{"a\r\nb\r\n", "a\rb\r", "a\r\nb\nc\r\nd\n", "a\nb\n"} {
+		filename := filepath.Join(dir, "lineendings.txt")
+		if err := os.WriteFile(filename, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		e := NewSimpleEditor(80)
+		if err := e.ReadFileAndProcessLines(filename); err != nil {
+			t.Fatal(err)
+		}
+		if e.Line(0) != "a" || e.Line(1) != "b" {
+			t.Errorf("unexpected lines for %q: %q", contents, e.String())
+		}
+		// The trailing blank line is removed when saving
+		s, _ := joinLineEndings(strings.TrimRight(e.String(), "\n")+"\n", e.lineEndings, e.mixedEndings)
+		if s != contents {
+			t.Errorf("expected %q to be kept, got %q", contents, s)
+		}
+	}
+}
+
+func TestMixedLineEndingsNewLines(t *testing.T) {
+	endings := make(lineEndingMap)
+	endings.add("a", true)
+	endings.add("b", false)
+	s, newEndings := joinLineEndings("a\nnew\nb\nnewer\n", MixedLineEndings, endings)
+	if s != "a\r\nnew\r\nb\nnewer\n" {
+		t.Errorf("expected new lines to get the line ending of the line above, got %q", s)
+	}
+	if len(newEndings["new"]) != 1 || !newEndings["new"][0] {
+		t.Errorf("expected the new line endings to be remembered, got %v", newEndings)
+	}
+}
+
+func TestSaveKeepsCarriageReturns(t *testing.T) {
+	defer func(bl *BufferList, noWrite bool) {
+		bufferList, noWriteToCache = bl, noWrite
+	}(bufferList, noWriteToCache)
+	bufferList = &BufferList{}
+	noWriteToCache = true
+
+	dir := t.TempDir()
+	for _, contents := range []string{"a\rb\nc\n", "a\r\nb\rc\r\n", "a\rb\r", "a\r\nb\rc\nd\n"} {
+		filename := filepath.Join(dir, "carriagereturns.txt")
+		if err := os.WriteFile(filename, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		e := NewSimpleEditor(80)
+		e.filename = filename
+		if err := e.ReadFileAndProcessLines(filename); err != nil {
+			t.Fatal(err)
+		}
+		e.changed = true
+		if err := e.Save(nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != contents {
+			t.Errorf("expected %q to be saved as it was, got %q", contents, data)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 )
@@ -14,6 +15,8 @@ var defaultLockFile = filepath.Join(userCacheDir, "o", "lockfile.txt")
 // LockKeeper keeps track of which files are currently being edited by o
 type LockKeeper struct {
 	lockedFiles  map[string]time.Time // from filename to lockfilestamp
+	owners       map[string]string    // from filename to the remote control socket of the owning session
+	owner        string               // the remote control socket of this session, if any
 	mut          *sync.RWMutex
 	lockFilename string
 }
@@ -22,7 +25,14 @@ type LockKeeper struct {
 // and creates a new LockKeeper struct, without loading the given lock file.
 func NewLockKeeper(lockFilename string) *LockKeeper {
 	lockMap := make(map[string]time.Time)
-	return &LockKeeper{lockMap, &sync.RWMutex{}, lockFilename}
+	return &LockKeeper{lockedFiles: lockMap, owners: make(map[string]string), mut: &sync.RWMutex{}, lockFilename: lockFilename}
+}
+
+// ownersFilename returns the name of the file that lists which session owns each lock.
+// It is kept apart from the main lockfile, so that the format of that file stays the same.
+func (lk *LockKeeper) ownersFilename() string {
+	ext := filepath.Ext(lk.lockFilename)
+	return strings.TrimSuffix(lk.lockFilename, ext) + "-owners" + ext
 }
 
 // Load loads the contents of the main lockfile
@@ -41,8 +51,15 @@ func (lk *LockKeeper) Load() error {
 	if err != nil {
 		return err
 	}
+	// The owners file may be missing, for instance if it was written by an older version of the editor
+	ownerMap := make(map[string]string)
+	if f, err := os.Open(lk.ownersFilename()); err == nil {
+		gob.NewDecoder(f).Decode(&ownerMap)
+		f.Close()
+	}
 	lk.mut.Lock()
 	lk.lockedFiles = lockMap
+	lk.owners = ownerMap
 	lk.mut.Unlock()
 	return nil
 }
@@ -71,6 +88,24 @@ func (lk *LockKeeper) Save() error {
 
 	f.Sync()
 
+	if err != nil {
+		return err
+	}
+	return lk.saveOwners()
+}
+
+// saveOwners writes the file that lists which session owns each lock
+func (lk *LockKeeper) saveOwners() error {
+	f, err := os.OpenFile(lk.ownersFilename(), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	lk.mut.RLock()
+	err = gob.NewEncoder(f).Encode(lk.owners)
+	lk.mut.RUnlock()
+
 	return err
 }
 
@@ -92,6 +127,9 @@ func (lk *LockKeeper) Lock(filename string) error {
 	// Add the file to the map
 	lk.mut.Lock()
 	lk.lockedFiles[filename] = time.Now()
+	if lk.owner != "" {
+		lk.owners[filename] = lk.owner
+	}
 	lk.mut.Unlock()
 
 	return nil
@@ -113,11 +151,44 @@ func (lk *LockKeeper) Unlock(filename string) error {
 	// Remove the file from the map
 	lk.mut.Lock()
 	delete(lk.lockedFiles, filename)
+	delete(lk.owners, filename)
 	lk.mut.Unlock()
 
 	return nil
 }
 
+// Move moves the lock from one absolute filename to another, for when a file is renamed or saved under a new name.
+// If the new filename is already locked, an error is returned and the old lock is kept.
+func (lk *LockKeeper) Move(oldFilename, newFilename string) error {
+	lk.mut.Lock()
+	defer lk.mut.Unlock()
+	if _, has := lk.lockedFiles[newFilename]; has {
+		return errors.New("already locked: " + newFilename)
+	}
+	delete(lk.lockedFiles, oldFilename)
+	lk.lockedFiles[newFilename] = time.Now()
+	if owner, has := lk.owners[oldFilename]; has {
+		delete(lk.owners, oldFilename)
+		lk.owners[newFilename] = owner
+	}
+	return nil
+}
+
+// SetOwner sets the remote control socket of this session, which is recorded for the files that are locked from now on,
+// so that other instances of the editor can ask this session to open them instead
+func (lk *LockKeeper) SetOwner(socketPath string) {
+	lk.mut.Lock()
+	lk.owner = socketPath
+	lk.mut.Unlock()
+}
+
+// Owner returns the remote control socket of the session that has locked the given file, or a blank string
+func (lk *LockKeeper) Owner(filename string) string {
+	lk.mut.RLock()
+	defer lk.mut.RUnlock()
+	return lk.owners[filename]
+}
+
 // GetTimestamp assumes that the file is locked. A blank timestamp may be returned if not.
 func (lk *LockKeeper) GetTimestamp(filename string) time.Time {
 	var timestamp time.Time
@@ -0,0 +1,795 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/xyproto/mode"
+)
+
+const (
+	// lspStartTimeout is how long to wait for a language server to be initialized, which may take a while for large projects
+	lspStartTimeout = 20 * time.Second
+
+	// lspTimeout is how long to wait for a reply from a language server
+	lspTimeout = 10 * time.Second
+
+	// lspShutdownTimeout is how long to wait for a language server to shut down, before it is killed
+	lspShutdownTimeout = time.Second
+)
+
+// The severities of LSP diagnostics
+const (
+	lspSeverityError = iota + 1
+	lspSeverityWarning
+	lspSeverityInformation
+	lspSeverityHint
+)
+
+var (
+	// defaultLanguageServers are the language servers that are used if none is configured for a mode
+	defaultLanguageServers = map[mode.Mode][]string{
+		mode.C:      {"clangd"},
+		mode.Cpp:    {"clangd"},
+		mode.Go:     {"gopls"},
+		mode.Python: {"pyright-langserver", "--stdio"},
+		mode.Rust:   {"rust-analyzer"},
+	}
+
+	// lspLanguageIDs are the language identifiers that language servers expect, for the modes that differ from the mode name
+	lspLanguageIDs = map[mode.Mode]string{
+		mode.Cpp: "cpp",
+	}
+
+	// lspRootMarkers are the files and directories that are looked for when finding the root of a project
+	lspRootMarkers = []string{"go.mod", "go.work", "Cargo.toml", "compile_commands.json", "pyproject.toml", "setup.py", ".git"}
+
+	errNoLanguageServer = errors.New("no language server")
+)
+
+// LSPPosition is a position in a document, where the character counts UTF-16 code units, as in the LSP specification
+type LSPPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// LSPRange is a range in a document, where the end is exclusive
+type LSPRange struct {
+	Start LSPPosition `json:"start"`
+	End   LSPPosition `json:"end"`
+}
+
+// LSPLocation is a range in a file
+type LSPLocation struct {
+	URI   string   `json:"uri"`
+	Range LSPRange `json:"range"`
+}
+
+// lspLocationLink is a location as returned by some language servers, instead of LSPLocation
+type lspLocationLink struct {
+	TargetURI            string   `json:"targetUri"`
+	TargetSelectionRange LSPRange `json:"targetSelectionRange"`
+}
+
+// LSPDiagnostic is an error, warning or hint from a language server
+type LSPDiagnostic struct {
+	Range    LSPRange `json:"range"`
+	Severity int      `json:"severity,omitempty"`
+	Source   string   `json:"source,omitempty"`
+	Message  string   `json:"message"`
+}
+
+// LSPTextEdit is a change to a range of a document
+type LSPTextEdit struct {
+	Range   LSPRange `json:"range"`
+	NewText string   `json:"newText"`
+}
+
+// LSPWorkspaceEdit is a set of changes to several documents, as returned when renaming
+type LSPWorkspaceEdit struct {
+	Changes         map[string][]LSPTextEdit `json:"changes,omitempty"`
+	DocumentChanges []struct {
+		TextDocument struct {
+			URI string `json:"uri"`
+		} `json:"textDocument"`
+		Edits []LSPTextEdit `json:"edits"`
+	} `json:"documentChanges,omitempty"`
+}
+
+// lspError is an error that is returned by a language server
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// lspMessage is a request, a notification or a response, as sent by a language server
+type lspMessage struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *lspError       `json:"error,omitempty"`
+}
+
+// lspResponse is the result of a request, or an error
+type lspResponse struct {
+	result json.RawMessage
+	err    error
+}
+
+// LSPClient is a client for a language server that is started as a process and talked to over stdio
+type LSPClient struct {
+	cmd           *exec.Cmd
+	stdin         io.WriteCloser
+	languageID    string
+	rootDir       string
+	onDiagnostics func(absFilename string) // called in a new goroutine when diagnostics are published
+	done          chan struct{}            // closed when the language server has stopped
+	nextID        int
+	pending       map[int]chan lspResponse   // the requests that are waiting for a response, by ID
+	diagnostics   map[string][]LSPDiagnostic // the published diagnostics, by absolute filename
+	diagnosed     map[string]chan struct{}   // closed when diagnostics are published for a file
+	versions      map[string]int             // the version numbers of the open documents, by absolute filename
+	texts         map[string]string          // the contents that were last sent, by absolute filename
+	mut           sync.Mutex                 // for the fields above
+	writeMut      sync.Mutex                 // for writing messages
+	stderr        *lspStderr                 // the last of the error output, for when the server stops
+}
+
+// filenameToURI converts an absolute filename to a file:// URI
+func filenameToURI(absFilename string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(absFilename)}).String()
+}
+
+// uriToFilename converts a file:// URI to an absolute filename
+func uriToFilename(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "file" {
+		return "", errors.New("not a file URI: " + uri)
+	}
+	return filepath.FromSlash(u.Path), nil
+}
+
+// utf16Index converts an index of a rune in the given line to the index in UTF-16 code units, which LSP uses
+func utf16Index(line string, runeIndex int) int {
+	n := 0
+	for i, r := range []rune(line) {
+		if i >= runeIndex {
+			break
+		}
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// runeIndexFromUTF16 converts an index in UTF-16 code units in the given line to the index of a rune
+func runeIndexFromUTF16(line string, utf16Index int) int {
+	n := 0
+	for i, r := range []rune(line) {
+		if n >= utf16Index {
+			return i
+		}
+		n += utf16.RuneLen(r)
+	}
+	return utf8.RuneCountInString(line)
+}
+
+// lspRootDir finds the root directory of the project that the given file belongs to,
+// by looking for files like go.mod or Cargo.toml in the directories above it
+func lspRootDir(absFilename string) string {
+	fileDir := filepath.Dir(absFilename)
+	for dir := fileDir; ; dir = filepath.Dir(dir) {
+		for _, marker := range lspRootMarkers {
+			if exists(filepath.Join(dir, marker)) {
+				return dir
+			}
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			return fileDir
+		}
+	}
+}
+
+// lspLanguageID returns the language identifier that language servers use for the given mode, like "go" or "cpp"
+func lspLanguageID(m mode.Mode) string {
+	if id, ok := lspLanguageIDs[m]; ok {
+		return id
+	}
+	return strings.ToLower(m.String())
+}
+
+// writeLSPMessage writes a message with a Content-Length header, as used by the Language Server Protocol
+func writeLSPMessage(w io.Writer, msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(data)); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// readLSPMessage reads a message with a Content-Length header, as used by the Language Server Protocol
+func readLSPMessage(r *bufio.Reader) ([]byte, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return nil, errors.New("invalid Content-Length in a message from the language server")
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// StartLSP starts the given language server command in the given project directory and initializes it.
+// The given function is called in a new goroutine each time diagnostics are published for a file.
+func StartLSP(command []string, rootDir, languageID string, onDiagnostics func(absFilename string)) (*LSPClient, error) {
+	if len(command) == 0 {
+		return nil, errNoLanguageServer
+	}
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Dir = rootDir
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr := &lspStderr{}
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	client := &LSPClient{
+		cmd:           cmd,
+		stdin:         stdin,
+		languageID:    languageID,
+		rootDir:       rootDir,
+		onDiagnostics: onDiagnostics,
+		done:          make(chan struct{}),
+		pending:       make(map[int]chan lspResponse),
+		diagnostics:   make(map[string][]LSPDiagnostic),
+		diagnosed:     make(map[string]chan struct{}),
+		versions:      make(map[string]int),
+		texts:         make(map[string]string),
+		stderr:        stderr,
+	}
+	go client.readLoop(bufio.NewReader(stdout))
+
+	params := map[string]interface{}{
+		"processId": os.Getpid(),
+		"rootUri":   filenameToURI(rootDir),
+		"workspaceFolders": []map[string]string{
+			{"uri": filenameToURI(rootDir), "name": filepath.Base(rootDir)},
+		},
+		"capabilities": map[string]interface{}{
+			"textDocument": map[string]interface{}{
+				"synchronization":    map[string]interface{}{"didSave": true},
+				"definition":         map[string]interface{}{"linkSupport": true},
+				"references":         map[string]interface{}{},
+				"hover":              map[string]interface{}{"contentFormat": []string{"plaintext", "markdown"}},
+				"rename":             map[string]interface{}{},
+				"publishDiagnostics": map[string]interface{}{},
+			},
+			"workspace": map[string]interface{}{
+				"workspaceEdit":    map[string]interface{}{"documentChanges": true},
+				"workspaceFolders": true,
+			},
+		},
+	}
+	if err := client.request("initialize", params, nil, lspStartTimeout); err != nil {
+		client.kill()
+		return nil, fmt.Errorf("could not start %s: %w", filepath.Base(command[0]), err)
+	}
+	if err := client.Notify("initialized", map[string]interface{}{}); err != nil {
+		client.kill()
+		return nil, err
+	}
+	return client, nil
+}
+
+// lspStderr keeps the last line of the error output of a language server
+type lspStderr struct {
+	lastLine string
+	mut      sync.Mutex
+}
+
+// Write stores the last non-empty line of the given output
+func (ls *lspStderr) Write(p []byte) (int, error) {
+	lines := strings.Split(strings.TrimSpace(string(p)), "\n")
+	if lastLine := strings.TrimSpace(lines[len(lines)-1]); lastLine != "" {
+		ls.mut.Lock()
+		ls.lastLine = lastLine
+		ls.mut.Unlock()
+	}
+	return len(p), nil
+}
+
+// LastLine returns the last line of the error output
+func (ls *lspStderr) LastLine() string {
+	ls.mut.Lock()
+	defer ls.mut.Unlock()
+	return ls.lastLine
+}
+
+// readLoop reads messages from the language server until it stops
+func (client *LSPClient) readLoop(r *bufio.Reader) {
+	defer func() {
+		client.mut.Lock()
+		for id, ch := range client.pending {
+			ch <- lspResponse{err: errors.New("the language server stopped")}
+			delete(client.pending, id)
+		}
+		client.mut.Unlock()
+		close(client.done)
+		client.cmd.Wait()
+	}()
+	for {
+		data, err := readLSPMessage(r)
+		if err != nil {
+			return
+		}
+		var msg lspMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+		switch {
+		case msg.Method != "" && len(msg.ID) > 0:
+			// A request from the server, which must be replied to
+			client.replyToServer(msg)
+		case msg.Method == "textDocument/publishDiagnostics":
+			client.handleDiagnostics(msg.Params)
+		case msg.Method == "":
+			// A response to one of our requests
+			id, err := strconv.Atoi(string(msg.ID))
+			if err != nil {
+				continue
+			}
+			client.mut.Lock()
+			ch, ok := client.pending[id]
+			delete(client.pending, id)
+			client.mut.Unlock()
+			if !ok {
+				continue
+			}
+			if msg.Error != nil {
+				ch <- lspResponse{err: errors.New(msg.Error.Message)}
+			} else {
+				ch <- lspResponse{result: msg.Result}
+			}
+		}
+	}
+}
+
+// replyToServer replies to a request from the language server. Only workspace/configuration is answered
+// with something else than null, since some servers wait for it.
+func (client *LSPClient) replyToServer(msg lspMessage) {
+	var result interface{}
+	if msg.Method == "workspace/configuration" {
+		var params struct {
+			Items []interface{} `json:"items"`
+		}
+		json.Unmarshal(msg.Params, &params)
+		result = make([]interface{}, len(params.Items))
+	}
+	client.writeMut.Lock()
+	defer client.writeMut.Unlock()
+	writeLSPMessage(client.stdin, map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID, "result": result})
+}
+
+// handleDiagnostics stores the diagnostics that are published for a file
+func (client *LSPClient) handleDiagnostics(params json.RawMessage) {
+	var p struct {
+		URI         string          `json:"uri"`
+		Diagnostics []LSPDiagnostic `json:"diagnostics"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return
+	}
+	absFilename, err := uriToFilename(p.URI)
+	if err != nil {
+		return
+	}
+	client.mut.Lock()
+	client.diagnostics[absFilename] = p.Diagnostics
+	if ch, ok := client.diagnosed[absFilename]; ok {
+		close(ch)
+		delete(client.diagnosed, absFilename)
+	}
+	onDiagnostics := client.onDiagnostics
+	client.mut.Unlock()
+	if onDiagnostics != nil {
+		// The editor may be waiting for a response from this goroutine, so do not block it
+		go onDiagnostics(absFilename)
+	}
+}
+
+// Alive checks if the language server is still running
+func (client *LSPClient) Alive() bool {
+	select {
+	case <-client.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// Notify sends a notification to the language server
+func (client *LSPClient) Notify(method string, params interface{}) error {
+	client.writeMut.Lock()
+	defer client.writeMut.Unlock()
+	return writeLSPMessage(client.stdin, map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+// request sends a request to the language server and waits for the response, which is decoded into result, if it is not nil
+func (client *LSPClient) request(method string, params, result interface{}, timeout time.Duration) error {
+	ch := make(chan lspResponse, 1)
+	client.mut.Lock()
+	client.nextID++
+	id := client.nextID
+	client.pending[id] = ch
+	client.mut.Unlock()
+
+	client.writeMut.Lock()
+	err := writeLSPMessage(client.stdin, map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method, "params": params})
+	client.writeMut.Unlock()
+	if err != nil {
+		client.mut.Lock()
+		delete(client.pending, id)
+		client.mut.Unlock()
+		return err
+	}
+
+	select {
+	case response := <-ch:
+		if response.err != nil {
+			return response.err
+		}
+		if result != nil && len(response.result) > 0 && string(response.result) != "null" {
+			return json.Unmarshal(response.result, result)
+		}
+		return nil
+	case <-time.After(timeout):
+		client.mut.Lock()
+		delete(client.pending, id)
+		client.mut.Unlock()
+		client.Notify("$/cancelRequest", map[string]int{"id": id})
+		return fmt.Errorf("%s timed out", method)
+	case <-client.done:
+		msg := client.stderr.LastLine()
+		if msg == "" {
+			msg = "the language server stopped"
+		}
+		return errors.New(msg)
+	}
+}
+
+// Request sends a request to the language server and waits for the response
+func (client *LSPClient) Request(method string, params, result interface{}) error {
+	return client.request(method, params, result, lspTimeout)
+}
+
+// SyncDocument sends the given contents of the given file to the language server, if they have changed since last time
+func (client *LSPClient) SyncDocument(absFilename, text string) error {
+	uri := filenameToURI(absFilename)
+	client.mut.Lock()
+	version, open := client.versions[absFilename]
+	unchanged := open && client.texts[absFilename] == text
+	if !unchanged {
+		version++
+		client.versions[absFilename] = version
+		client.texts[absFilename] = text
+		client.diagnosed[absFilename] = make(chan struct{})
+	}
+	client.mut.Unlock()
+	if unchanged {
+		return nil
+	}
+	if !open {
+		return client.Notify("textDocument/didOpen", map[string]interface{}{
+			"textDocument": map[string]interface{}{"uri": uri, "languageId": client.languageID, "version": version, "text": text},
+		})
+	}
+	return client.Notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": uri, "version": version},
+		"contentChanges": []map[string]string{{"text": text}},
+	})
+}
+
+// DidSave tells the language server that the given file has been saved with the given contents
+func (client *LSPClient) DidSave(absFilename, text string) error {
+	if err := client.SyncDocument(absFilename, text); err != nil {
+		return err
+	}
+	return client.Notify("textDocument/didSave", map[string]interface{}{
+		"textDocument": map[string]string{"uri": filenameToURI(absFilename)},
+	})
+}
+
+// IsOpen checks if the given file has been sent to the language server
+func (client *LSPClient) IsOpen(absFilename string) bool {
+	client.mut.Lock()
+	defer client.mut.Unlock()
+	_, open := client.versions[absFilename]
+	return open
+}
+
+// textDocumentPosition returns the parameters for requests about a position in a document
+func textDocumentPosition(absFilename string, pos LSPPosition) map[string]interface{} {
+	return map[string]interface{}{
+		"textDocument": map[string]string{"uri": filenameToURI(absFilename)},
+		"position":     pos,
+	}
+}
+
+// parseLocations parses a Location, a list of Location or a list of LocationLink, as returned by textDocument/definition
+func parseLocations(result json.RawMessage) ([]LSPLocation, error) {
+	if len(result) == 0 || string(result) == "null" {
+		return nil, nil
+	}
+	if strings.HasPrefix(strings.TrimSpace(string(result)), "{") {
+		var location LSPLocation
+		if err := json.Unmarshal(result, &location); err != nil {
+			return nil, err
+		}
+		return []LSPLocation{location}, nil
+	}
+	var links []lspLocationLink
+	if err := json.Unmarshal(result, &links); err == nil && len(links) > 0 && links[0].TargetURI != "" {
+		locations := make([]LSPLocation, len(links))
+		for i, link := range links {
+			locations[i] = LSPLocation{URI: link.TargetURI, Range: link.TargetSelectionRange}
+		}
+		return locations, nil
+	}
+	var locations []LSPLocation
+	err := json.Unmarshal(result, &locations)
+	return locations, err
+}
+
+// Definition returns the locations of the definition of the symbol at the given position
+func (client *LSPClient) Definition(absFilename string, pos LSPPosition) ([]LSPLocation, error) {
+	var result json.RawMessage
+	if err := client.Request("textDocument/definition", textDocumentPosition(absFilename, pos), &result); err != nil {
+		return nil, err
+	}
+	return parseLocations(result)
+}
+
+// References returns the locations where the symbol at the given position is used, including the declaration
+func (client *LSPClient) References(absFilename string, pos LSPPosition) ([]LSPLocation, error) {
+	params := textDocumentPosition(absFilename, pos)
+	params["context"] = map[string]bool{"includeDeclaration": true}
+	var result json.RawMessage
+	if err := client.Request("textDocument/references", params, &result); err != nil {
+		return nil, err
+	}
+	return parseLocations(result)
+}
+
+// Hover returns the documentation or type information for the symbol at the given position, as plain text or Markdown
+func (client *LSPClient) Hover(absFilename string, pos LSPPosition) (string, error) {
+	var result struct {
+		Contents json.RawMessage `json:"contents"`
+	}
+	if err := client.Request("textDocument/hover", textDocumentPosition(absFilename, pos), &result); err != nil {
+		return "", err
+	}
+	return hoverText(result.Contents), nil
+}
+
+// hoverText returns the text of hover contents, which may be a MarkupContent, a MarkedString or a list of MarkedString
+func hoverText(contents json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(contents, &s); err == nil {
+		return strings.TrimSpace(s)
+	}
+	var markup struct {
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal(contents, &markup); err == nil && markup.Value != "" {
+		return strings.TrimSpace(markup.Value)
+	}
+	var list []json.RawMessage
+	if err := json.Unmarshal(contents, &list); err == nil {
+		var parts []string
+		for _, item := range list {
+			if text := hoverText(item); text != "" {
+				parts = append(parts, text)
+			}
+		}
+		return strings.Join(parts, "\n\n")
+	}
+	return ""
+}
+
+// Rename returns the changes that are needed for renaming the symbol at the given position to the given name
+func (client *LSPClient) Rename(absFilename string, pos LSPPosition, newName string) (*LSPWorkspaceEdit, error) {
+	params := textDocumentPosition(absFilename, pos)
+	params["newName"] = newName
+	var edit LSPWorkspaceEdit
+	if err := client.Request("textDocument/rename", params, &edit); err != nil {
+		return nil, err
+	}
+	return &edit, nil
+}
+
+// Diagnostics returns the diagnostics that were last published for the given file
+func (client *LSPClient) Diagnostics(absFilename string) []LSPDiagnostic {
+	client.mut.Lock()
+	defer client.mut.Unlock()
+	return client.diagnostics[absFilename]
+}
+
+// WaitForDiagnostics waits until diagnostics are published for the contents of the given file
+// that were last sent, or until the timeout. Returns the diagnostics.
+func (client *LSPClient) WaitForDiagnostics(absFilename string, timeout time.Duration) []LSPDiagnostic {
+	client.mut.Lock()
+	ch, waiting := client.diagnosed[absFilename]
+	client.mut.Unlock()
+	if waiting {
+		select {
+		case <-ch:
+		case <-time.After(timeout):
+		case <-client.done:
+		}
+	}
+	return client.Diagnostics(absFilename)
+}
+
+// Shutdown asks the language server to shut down and exit, and kills it if it does not
+func (client *LSPClient) Shutdown() {
+	if !client.Alive() {
+		return
+	}
+	if client.request("shutdown", nil, nil, lspShutdownTimeout) == nil {
+		client.Notify("exit", nil)
+	}
+	client.stdin.Close()
+	select {
+	case <-client.done:
+	case <-time.After(lspShutdownTimeout):
+		client.kill()
+	}
+}
+
+// kill stops the language server process
+func (client *LSPClient) kill() {
+	if client.cmd.Process != nil {
+		client.cmd.Process.Kill()
+	}
+}
+
+// severityName returns a name for the severity of a diagnostic
+func severityName(severity int) string {
+	switch severity {
+	case lspSeverityError:
+		return "error"
+	case lspSeverityWarning:
+		return "warning"
+	case lspSeverityInformation:
+		return "info"
+	case lspSeverityHint:
+		return "hint"
+	}
+	return "error"
+}
+
+// lspOffset returns the byte index of the given position in the given text, where lineStarts are the byte indices
+// of the start of each line. A character index past the end of a line means the end of the line, as in the
+// LSP specification. Returns false if the position is not in the text.
+func lspOffset(text string, lineStarts []int, pos LSPPosition) (int, bool) {
+	if pos.Line < 0 || pos.Character < 0 {
+		return 0, false
+	}
+	if pos.Line >= len(lineStarts) {
+		// The position right after the last line is the end of the text
+		return len(text), pos.Line == len(lineStarts) && pos.Character == 0
+	}
+	lineEnd := len(text)
+	if pos.Line+1 < len(lineStarts) {
+		lineEnd = lineStarts[pos.Line+1] - 1
+	}
+	line := text[lineStarts[pos.Line]:lineEnd]
+	return lineStarts[pos.Line] + len(string([]rune(line)[:runeIndexFromUTF16(line, pos.Character)])), true
+}
+
+// applyTextEdits applies the given edits to the given lines and returns the new lines.
+// Edits that start at the same position are applied in the given order. Returns an error if an edit
+// is outside of the lines, ends before it starts or overlaps another edit, as required by the LSP specification.
+func applyTextEdits(lines []string, edits []LSPTextEdit) ([]string, error) {
+	text := strings.Join(lines, "\n")
+	lineStarts := make([]int, len(lines))
+	for y, offset := 0, 0; y < len(lines); y++ {
+		lineStarts[y] = offset
+		offset += len(lines[y]) + 1
+	}
+	type span struct {
+		start, end int
+		newText    string
+	}
+	spans := make([]span, len(edits))
+	for i, edit := range edits {
+		start, ok := lspOffset(text, lineStarts, edit.Range.Start)
+		if !ok {
+			return nil, fmt.Errorf("the edit starts outside of the document, at line %d, character %d", edit.Range.Start.Line+1, edit.Range.Start.Character)
+		}
+		end, ok := lspOffset(text, lineStarts, edit.Range.End)
+		if !ok {
+			return nil, fmt.Errorf("the edit ends outside of the document, at line %d, character %d", edit.Range.End.Line+1, edit.Range.End.Character)
+		}
+		if end < start {
+			return nil, fmt.Errorf("the edit at line %d ends before it starts", edit.Range.Start.Line+1)
+		}
+		spans[i] = span{start, end, edit.NewText}
+	}
+	// Keep the given order for edits that start at the same position, so that several inserts are kept in order
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].start < spans[j].start
+	})
+	var sb strings.Builder
+	last := 0
+	for _, sp := range spans {
+		if sp.start < last {
+			return nil, errors.New("the edits overlap")
+		}
+		sb.WriteString(text[last:sp.start])
+		sb.WriteString(sp.newText)
+		last = sp.end
+	}
+	sb.WriteString(text[last:])
+	return strings.Split(sb.String(), "\n"), nil
+}
+
+// FileEdits returns the edits in a workspace edit, by absolute filename
+func (we *LSPWorkspaceEdit) FileEdits() (map[string][]LSPTextEdit, error) {
+	fileEdits := make(map[string][]LSPTextEdit)
+	add := func(uri string, edits []LSPTextEdit) error {
+		absFilename, err := uriToFilename(uri)
+		if err != nil {
+			return err
+		}
+		fileEdits[absFilename] = append(fileEdits[absFilename], edits...)
+		return nil
+	}
+	for _, dc := range we.DocumentChanges {
+		if err := add(dc.TextDocument.URI, dc.Edits); err != nil {
+			return nil, err
+		}
+	}
+	if len(we.DocumentChanges) == 0 {
+		for uri, edits := range we.Changes {
+			if err := add(uri, edits); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return fileEdits, nil
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xyproto/mode"
+)
+
+// TestFakeLanguageServer is not a real test, but a small language server that the other tests start
+// by running the test binary again with O_FAKE_LSP set
+func TestFakeLanguageServer(t *testing.T) {
+	if os.Getenv("O_FAKE_LSP") == "" {
+		t.Skip("only used as a fake language server by the other tests")
+	}
+	runFakeLanguageServer(os.Stdin, os.Stdout)
+	os.Exit(0)
+}
+
+// fakeWordAt returns the word at the given position, and where it starts
+func fakeWordAt(text string, pos LSPPosition) (string, int) {
+	lines := strings.Split(text, "\n")
+	if pos.Line >= len(lines) {
+		return "", 0
+	}
+	line := lines[pos.Line]
+	isWordByte := func(b byte) bool {
+		return b == '_' || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9')
+	}
+	start, end := pos.Character, pos.Character
+	for start > 0 && isWordByte(line[start-1]) {
+		start--
+	}
+	for end < len(line) && isWordByte(line[end]) {
+		end++
+	}
+	return line[start:end], start
+}
+
+// fakeOccurrences returns the ranges where the given word is used in the given text
+func fakeOccurrences(text, word string) []LSPRange {
+	var ranges []LSPRange
+	for y, line := range strings.Split(text, "\n") {
+		for x := 0; ; {
+			i := strings.Index(line[x:], word)
+			if i < 0 {
+				break
+			}
+			x += i
+			ranges = append(ranges, LSPRange{LSPPosition{y, x}, LSPPosition{y, x + len(word)}})
+			x += len(word)
+		}
+	}
+	return ranges
+}
+
+// runFakeLanguageServer answers LSP requests about Go-like code, by looking at the words in the text
+func runFakeLanguageServer(in io.Reader, out io.Writer) {
+	r := bufio.NewReader(in)
+	texts := make(map[string]string)
+	for {
+		data, err := readLSPMessage(r)
+		if err != nil {
+			return
+		}
+		var msg struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params struct {
+				TextDocument struct {
+					URI  string `json:"uri"`
+					Text string `json:"text"`
+				} `json:"textDocument"`
+				ContentChanges []struct {
+					Text string `json:"text"`
+				} `json:"contentChanges"`
+				Position LSPPosition `json:"position"`
+				NewName  string      `json:"newName"`
+			} `json:"params"`
+		}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return
+		}
+		reply := func(result interface{}) {
+			writeLSPMessage(out, map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID, "result": result})
+		}
+		uri := msg.Params.TextDocument.URI
+		word, _ := fakeWordAt(texts[uri], msg.Params.Position)
+		switch msg.Method {
+		case "initialize":
+			// Some language servers ask for the configuration before replying
+			writeLSPMessage(out, map[string]interface{}{"jsonrpc": "2.0", "id": "config", "method": "workspace/configuration", "params": map[string]interface{}{"items": []interface{}{map[string]string{}}}})
+			reply(map[string]interface{}{"capabilities": map[string]interface{}{}})
+		case "textDocument/didOpen", "textDocument/didChange":
+			text := msg.Params.TextDocument.Text
+			if len(msg.Params.ContentChanges) > 0 {
+				text = msg.Params.ContentChanges[0].Text
+			}
+			texts[uri] = text
+			diagnostics := []LSPDiagnostic{}
+			for _, r := range fakeOccurrences(text, "bug") {
+				diagnostics = append(diagnostics, LSPDiagnostic{Range: r, Severity: lspSeverityWarning, Message: "found a bug"})
+			}
+			writeLSPMessage(out, map[string]interface{}{"jsonrpc": "2.0", "method": "textDocument/publishDiagnostics", "params": map[string]interface{}{"uri": uri, "diagnostics": diagnostics}})
+		case "textDocument/definition":
+			var result interface{}
+			for _, r := range fakeOccurrences(texts[uri], "func "+word+"(") {
+				result = LSPLocation{uri, LSPRange{LSPPosition{r.Start.Line, 5}, LSPPosition{r.Start.Line, 5 + len(word)}}}
+				break
+			}
+			reply(result)
+		case "textDocument/references":
+			locations := []LSPLocation{}
+			for _, r := range fakeOccurrences(texts[uri], word) {
+				locations = append(locations, LSPLocation{uri, r})
+			}
+			reply(locations)
+		case "textDocument/hover":
+			reply(map[string]interface{}{"contents": map[string]string{"kind": "markdown", "value": "func " + word + "()"}})
+		case "textDocument/rename":
+			edits := []LSPTextEdit{}
+			for _, r := range fakeOccurrences(texts[uri], word) {
+				edits = append(edits, LSPTextEdit{r, msg.Params.NewName})
+			}
+			reply(map[string]interface{}{"changes": map[string][]LSPTextEdit{uri: edits}})
+		case "shutdown":
+			reply(nil)
+		case "exit":
+			return
+		}
+	}
+}
+
+// startFakeLanguageServer starts the test binary as a fake language server
+func startFakeLanguageServer(t *testing.T, onDiagnostics func(absFilename string)) *LSPClient {
+	t.Setenv("O_FAKE_LSP", "1")
+	client, err := StartLSP([]string{os.Args[0], "-test.run=^TestFakeLanguageServer$"}, t.TempDir(), "go", onDiagnostics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestLSPClient(t *testing.T) {
+	diagnosed := make(chan string, 10)
+	client := startFakeLanguageServer(t, func(absFilename string) {
+		diagnosed <- absFilename
+	})
+	defer client.Shutdown()
+
+	absFilename := filepath.Join(t.TempDir(), "main.go")
+	text := "package main\n\nfunc hello() {}\n\nfunc main() {\n\thello() // bug\n}\n"
+	if err := client.SyncDocument(absFilename, text); err != nil {
+		t.Fatal(err)
+	}
+	diagnostics := client.WaitForDiagnostics(absFilename, 5*time.Second)
+	if len(diagnostics) != 1 || diagnostics[0].Range.Start.Line != 5 || severityName(diagnostics[0].Severity) != "warning" {
+		t.Errorf("unexpected diagnostics: %+v", diagnostics)
+	}
+	select {
+	case f := <-diagnosed:
+		if f != absFilename {
+			t.Errorf("diagnostics for the wrong file: %s", f)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("the diagnostics handler was not called")
+	}
+
+	callPos := LSPPosition{5, 2}
+	locations, err := client.Definition(absFilename, callPos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locations) != 1 || locations[0].Range.Start != (LSPPosition{2, 5}) {
+		t.Errorf("unexpected definition: %+v", locations)
+	}
+	if f, err := uriToFilename(locations[0].URI); err != nil || f != absFilename {
+		t.Errorf("unexpected filename for the definition: %s, %v", f, err)
+	}
+
+	if locations, err := client.References(absFilename, callPos); err != nil || len(locations) != 2 {
+		t.Errorf("expected two references, got %+v, %v", locations, err)
+	}
+
+	if text, err := client.Hover(absFilename, callPos); err != nil || text != "func hello()" {
+		t.Errorf("unexpected hover text: %q, %v", text, err)
+	}
+
+	edit, err := client.Rename(absFilename, callPos, "greet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileEdits, err := edit.FileEdits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines, err := applyTextEdits(strings.Split(text, "\n"), fileEdits[absFilename])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renamed := strings.Join(lines, "\n"); renamed != strings.ReplaceAll(text, "hello", "greet") {
+		t.Errorf("unexpected result of renaming: %q", renamed)
+	}
+
+	// Sending the same contents again does nothing, while new contents are diagnosed again
+	client.SyncDocument(absFilename, text)
+	if err := client.SyncDocument(absFilename, strings.ReplaceAll(text, "bug", "fix")); err != nil {
+		t.Fatal(err)
+	}
+	if diagnostics := client.WaitForDiagnostics(absFilename, 5*time.Second); len(diagnostics) != 0 {
+		t.Errorf("expected no diagnostics, got %+v", diagnostics)
+	}
+
+	client.Shutdown()
+	if client.Alive() {
+		t.Error("expected the language server to have stopped")
+	}
+	if _, err := client.Definition(absFilename, callPos); err == nil {
+		t.Error("expected an error after the language server stopped")
+	}
+}
+
+func TestApplyTextEdits(t *testing.T) {
+	lines := []string{"a := 1", "b := a + a", "ø🙂a"}
+	edits := []LSPTextEdit{
+		{LSPRange{LSPPosition{0, 0}, LSPPosition{0, 1}}, "x"},
+		{LSPRange{LSPPosition{1, 5}, LSPPosition{1, 6}}, "x"},
+		{LSPRange{LSPPosition{1, 9}, LSPPosition{1, 10}}, "x"},
+		// The emoji is two UTF-16 code units
+		{LSPRange{LSPPosition{2, 3}, LSPPosition{2, 4}}, "x"},
+		// Join the first two lines
+		{LSPRange{LSPPosition{0, 6}, LSPPosition{1, 0}}, "; "},
+	}
+	got, err := applyTextEdits(lines, edits)
+	expected := []string{"x := 1; b := x + x", "ø🙂x"}
+	if err != nil || !equalStrings(got, expected) {
+		t.Errorf("expected %q, got %q, %v", expected, got, err)
+	}
+
+	// Inserts at the same position are applied in the given order, also before a replacement that starts there
+	edits = []LSPTextEdit{
+		{LSPRange{LSPPosition{0, 0}, LSPPosition{0, 0}}, "var "},
+		{LSPRange{LSPPosition{0, 0}, LSPPosition{0, 0}}, "x"},
+		{LSPRange{LSPPosition{0, 0}, LSPPosition{0, 1}}, ", a"},
+		{LSPRange{LSPPosition{2, 0}, LSPPosition{2, 99}}, "end"}, // past the end of the line means the end of the line
+		{LSPRange{LSPPosition{2, 4}, LSPPosition{3, 0}}, "\n"},   // the position after the last line is the end
+	}
+	got, err = applyTextEdits(lines, edits)
+	expected = []string{"var x, a := 1", "b := a + a", "end", ""}
+	if err != nil || !equalStrings(got, expected) {
+		t.Errorf("expected %q, got %q, %v", expected, got, err)
+	}
+
+	// Malformed and out of range edits are rejected
+	for _, edit := range []LSPTextEdit{
+		{LSPRange{LSPPosition{-1, 0}, LSPPosition{0, 0}}, "x"},
+		{LSPRange{LSPPosition{0, -1}, LSPPosition{0, 0}}, "x"},
+		{LSPRange{LSPPosition{1, 4}, LSPPosition{1, 2}}, "x"},
+		{LSPRange{LSPPosition{2, 0}, LSPPosition{0, 0}}, "x"},
+		{LSPRange{LSPPosition{0, 0}, LSPPosition{3, 1}}, "x"},
+		{LSPRange{LSPPosition{7, 0}, LSPPosition{7, 0}}, "x"},
+	} {
+		if got, err := applyTextEdits(lines, []LSPTextEdit{edit}); err == nil {
+			t.Errorf("expected an error for %+v, got %q", edit.Range, got)
+		}
+	}
+	overlapping := []LSPTextEdit{
+		{LSPRange{LSPPosition{1, 0}, LSPPosition{1, 6}}, "x"},
+		{LSPRange{LSPPosition{1, 5}, LSPPosition{1, 7}}, "y"},
+	}
+	if _, err := applyTextEdits(lines, overlapping); err == nil {
+		t.Error("expected an error for overlapping edits")
+	}
+
+	if utf16Index("ø🙂a", 2) != 3 || runeIndexFromUTF16("ø🙂a", 3) != 2 {
+		t.Error("unexpected conversion between rune and UTF-16 indices")
+	}
+	if f, err := uriToFilename(filenameToURI("/tmp/a b#c.go")); err != nil || f != "/tmp/a b#c.go" {
+		t.Errorf("unexpected filename after converting to a URI and back: %q, %v", f, err)
+	}
+}
+
+func TestApplyWorkspaceEdit(t *testing.T) {
+	dir := t.TempDir()
+	e := NewSimpleEditor(80)
+	e.filename = filepath.Join(dir, "main.go")
+	e.lines = NewJournal(NewLineRope(runeLines([]string{"func hello() {}", "", "func main() { hello() }"})))
+	otherFilename := filepath.Join(dir, "other.go")
+	if err := os.WriteFile(otherFilename, []byte("var x = hello\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	edit := &LSPWorkspaceEdit{Changes: map[string][]LSPTextEdit{
+		filenameToURI(e.filename): {
+			{LSPRange{LSPPosition{0, 5}, LSPPosition{0, 10}}, "greet"},
+			{LSPRange{LSPPosition{2, 14}, LSPPosition{2, 19}}, "greet"},
+		},
+		filenameToURI(otherFilename): {
+			{LSPRange{LSPPosition{0, 8}, LSPPosition{0, 13}}, "greet"},
+		},
+	}}
+	count, err := e.applyWorkspaceEdit(edit)
+	if err != nil || count != 2 {
+		t.Fatalf("expected two changed files, got %d, %v", count, err)
+	}
+	if got := bufferLines(e.lines.Buffer); !equalStrings(got, []string{"func greet() {}", "", "func main() { greet() }"}) || !e.changed {
+		t.Errorf("unexpected lines: %q", got)
+	}
+	data, err := os.ReadFile(otherFilename)
+	if err != nil || string(data) != "var x = greet\n" {
+		t.Errorf("unexpected contents of the file that is not open: %q, %v", data, err)
+	}
+	if fi, err := os.Stat(otherFilename); err != nil || fi.Mode().Perm() != 0o640 {
+		t.Error("expected the permissions to be kept")
+	}
+}
+
+func TestSyncOpenBuffers(t *testing.T) {
+	defer func(bl *BufferList) {
+		bufferList = bl
+	}(bufferList)
+	bufferList = &BufferList{}
+	client := startFakeLanguageServer(t, nil)
+	defer client.Shutdown()
+
+	dir := t.TempDir()
+	e := NewSimpleEditor(80)
+	e.mode = mode.Go
+	bufferList.Add(&OpenBuffer{editor: e, absFilename: filepath.Join(dir, "main.go")})
+	changed, unchanged, other := NewSimpleEditor(80), NewSimpleEditor(80), NewSimpleEditor(80)
+	changed.mode, unchanged.mode, other.mode = mode.Go, mode.Go, mode.Markdown
+	changed.SetLine(0, "var x = hello")
+	unchanged.changed = false
+	other.SetLine(0, "# hello")
+	bufferList.Add(&OpenBuffer{editor: changed, absFilename: filepath.Join(dir, "changed.go")})
+	bufferList.Add(&OpenBuffer{editor: unchanged, absFilename: filepath.Join(dir, "unchanged.go")})
+	bufferList.Add(&OpenBuffer{editor: other, absFilename: filepath.Join(dir, "README.md")})
+	bufferList.current = 0
+
+	if err := e.syncOpenBuffers(client); err != nil {
+		t.Fatal(err)
+	}
+	if !client.IsOpen(filepath.Join(dir, "changed.go")) {
+		t.Error("expected the file with unsaved changes to be sent to the language server")
+	}
+	if client.IsOpen(filepath.Join(dir, "main.go")) || client.IsOpen(filepath.Join(dir, "unchanged.go")) || client.IsOpen(filepath.Join(dir, "README.md")) {
+		t.Error("expected only the other changed files in the same language to be sent")
+	}
+}
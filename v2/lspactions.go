@@ -0,0 +1,497 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/xyproto/vt100"
+)
+
+// diagnosticsWait is how long to wait for a language server to publish diagnostics, when they are asked for
+const diagnosticsWait = 3 * time.Second
+
+var (
+	// lspClients are the language servers that have been started, by project directory and command
+	lspClients = make(map[string]*LSPClient)
+
+	// lspProblemCounts are the number of errors and warnings that were last reported for each file
+	lspProblemCounts = make(map[string]int)
+)
+
+// languageServerCommand returns the language server command for the current mode, or nil if there is none.
+// A language server can be configured per mode, and "none" turns it off.
+func (e *Editor) languageServerCommand() []string {
+	if command := e.config.LanguageServer(e.mode); len(command) > 0 {
+		if command[0] == "none" {
+			return nil
+		}
+		return command
+	}
+	return defaultLanguageServers[e.mode]
+}
+
+// lspFilename returns the absolute filename of the current file, or a blank string if the data was read from stdin
+func (e *Editor) lspFilename() string {
+	if b := bufferList.Current(); b != nil {
+		if b.stdin {
+			return ""
+		}
+		return b.absFilename
+	}
+	absFilename, err := e.AbsFilename()
+	if err != nil {
+		return ""
+	}
+	return absFilename
+}
+
+// HasLanguageServer checks if there is a language server for the current file, that is installed
+func (e *Editor) HasLanguageServer() bool {
+	command := e.languageServerCommand()
+	return len(command) > 0 && which(command[0]) != "" && e.lspFilename() != ""
+}
+
+// languageServer returns the language server for the current file, after sending it the current contents.
+// The language server is started if it is not already running. Returns errNoLanguageServer if there is none.
+func (e *Editor) languageServer(c *vt100.Canvas, status *StatusBar) (*LSPClient, string, error) {
+	if !e.HasLanguageServer() {
+		return nil, "", errNoLanguageServer
+	}
+	command := e.languageServerCommand()
+	absFilename := e.lspFilename()
+	rootDir := lspRootDir(absFilename)
+	key := rootDir + "\x00" + strings.Join(command, " ")
+	client, ok := lspClients[key]
+	if !ok || !client.Alive() {
+		status.ClearAll(c)
+		status.SetMessage("Starting " + filepath.Base(command[0]) + "...")
+		status.ShowNoTimeout(c, e)
+		// The initialization may take a while, so let the other goroutines use the editor in the meantime,
+		// the same way as when the main loop is waiting for a key
+		keyLoopMut.Unlock()
+		started, err := StartLSP(command, rootDir, lspLanguageID(e.mode), func(absFilename string) {
+			keyLoopMut.Lock()
+			defer keyLoopMut.Unlock()
+			e.DiagnosticsPublished(c, status, absFilename)
+		})
+		keyLoopMut.Lock()
+		status.ClearAll(c)
+		if err != nil {
+			return nil, "", err
+		}
+		if running, ok := lspClients[key]; ok && running != client && running.Alive() {
+			// Another language server was started for the same project while this one was being initialized
+			started.Shutdown()
+			started = running
+		}
+		client = started
+		lspClients[key] = client
+		// Another file may have been switched to while the editor was unlocked
+		if e.lspFilename() != absFilename {
+			return nil, "", errors.New(filepath.Base(absFilename) + " is no longer the current file")
+		}
+	}
+	if err := client.SyncDocument(absFilename, e.String()); err != nil {
+		return nil, "", err
+	}
+	return client, absFilename, nil
+}
+
+// languageServerError shows an error from a language server, or explains why there is no language server
+func (e *Editor) languageServerError(c *vt100.Canvas, status *StatusBar, err error) {
+	if errors.Is(err, errNoLanguageServer) {
+		if command := e.languageServerCommand(); len(command) > 0 {
+			err = errors.New(command[0] + " is not installed")
+		} else {
+			err = errors.New("no language server is configured for " + e.mode.String())
+		}
+	}
+	status.ClearAll(c)
+	status.SetError(err)
+	status.ShowNoTimeout(c, e)
+}
+
+// notifyLanguageServers tells the running language servers that have the given file open that it has been saved
+func notifyLanguageServers(absFilename, text string) {
+	for _, client := range lspClients {
+		if client.Alive() && client.IsOpen(absFilename) {
+			client.DidSave(absFilename, text)
+		}
+	}
+}
+
+// ShutdownLanguageServers stops all running language servers
+func ShutdownLanguageServers() {
+	for key, client := range lspClients {
+		client.Shutdown()
+		delete(lspClients, key)
+	}
+}
+
+// lspPosition returns the current position, as a position that can be sent to a language server
+func (e *Editor) lspPosition() LSPPosition {
+	y := e.DataY()
+	line := e.Line(y)
+	x, err := e.DataX()
+	if err != nil {
+		x = utf8.RuneCountInString(line)
+	}
+	return LSPPosition{Line: int(y), Character: utf16Index(line, x)}
+}
+
+// fileLines returns the lines of the given file, from the editor if it is open, or else from disk
+func (e *Editor) fileLines(absFilename string) []string {
+	if absFilename == e.lspFilename() {
+		return bufferLines(e.lines.Buffer)
+	}
+	if i := bufferList.Index(absFilename); i >= 0 {
+		return bufferLines(bufferList.buffers[i].editor.lines.Buffer)
+	}
+	data, err := os.ReadFile(absFilename)
+	if err != nil {
+		return nil
+	}
+	return strings.Split(string(data), "\n")
+}
+
+// jumpToLSPLocation goes to the start of the given location, opening the file if needed,
+// and adds the current location to the jump list
+func (e *Editor) jumpToLSPLocation(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, location LSPLocation) error {
+	absFilename, err := uriToFilename(location.URI)
+	if err != nil {
+		return err
+	}
+	var x int
+	if lines := e.fileLines(absFilename); location.Range.Start.Line < len(lines) {
+		x = runeIndexFromUTF16(lines[location.Range.Start.Line], location.Range.Start.Character)
+	}
+	return e.jumpToFileLocation(c, tty, status, absFilename, LineIndex(location.Range.Start.Line), ColIndex(x))
+}
+
+// pickLocation lets the user choose one of the given locations, which are described by the given choices, and jumps to it
+func (e *Editor) pickLocation(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, title string, choices []string, locations []LSPLocation) {
+	const maxChoices = 20
+	if len(choices) > maxChoices {
+		title = fmt.Sprintf("%s (the first %d of %d)", title, maxChoices, len(choices))
+		choices = choices[:maxChoices]
+	}
+	choice := e.Menu(status, tty, title, choices, e.Background, e.MenuTitleColor, e.MenuArrowColor, e.MenuTextColor, e.MenuHighlightColor, e.MenuSelectedColor, 0, false)
+	e.redraw = true
+	e.redrawCursor = true
+	if choice < 0 {
+		return
+	}
+	if err := e.jumpToLSPLocation(c, tty, status, locations[choice]); err != nil {
+		status.SetError(err)
+		status.ShowNoTimeout(c, e)
+	}
+}
+
+// locationChoices describes the given locations as "filename:line: text", for choosing between them
+func (e *Editor) locationChoices(locations []LSPLocation) []string {
+	var (
+		choices   = make([]string, len(locations))
+		fileLines = make(map[string][]string)
+	)
+	for i, location := range locations {
+		absFilename, err := uriToFilename(location.URI)
+		if err != nil {
+			choices[i] = location.URI
+			continue
+		}
+		lines, ok := fileLines[absFilename]
+		if !ok {
+			lines = e.fileLines(absFilename)
+			fileLines[absFilename] = lines
+		}
+		var text string
+		if y := location.Range.Start.Line; y < len(lines) {
+			text = strings.TrimSpace(lines[y])
+		}
+		choices[i] = fmt.Sprintf("%s:%d: %s", shortPath(absFilename), location.Range.Start.Line+1, shortenText(text, 60))
+	}
+	return choices
+}
+
+// LSPGoToDefinition asks the language server for the definition of the symbol at the cursor, and jumps to it.
+// If there are several definitions, the user can choose between them.
+// Returns false if there is no language server for the current file, or if no definition was found.
+func (e *Editor) LSPGoToDefinition(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) bool {
+	client, absFilename, err := e.languageServer(c, status)
+	if err != nil {
+		if !errors.Is(err, errNoLanguageServer) {
+			e.languageServerError(c, status, err)
+		}
+		return false
+	}
+	locations, err := client.Definition(absFilename, e.lspPosition())
+	if err != nil || len(locations) == 0 {
+		return false
+	}
+	if len(locations) > 1 {
+		e.pickLocation(c, tty, status, "Definitions of "+e.WordAtCursor(), e.locationChoices(locations), locations)
+		return true
+	}
+	if err := e.jumpToLSPLocation(c, tty, status, locations[0]); err != nil {
+		e.languageServerError(c, status, err)
+	}
+	return true
+}
+
+// FindReferences asks the language server where the symbol at the cursor is used, and lets the user jump to one of the places
+func (e *Editor) FindReferences(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) {
+	client, absFilename, err := e.languageServer(c, status)
+	if err != nil {
+		e.languageServerError(c, status, err)
+		return
+	}
+	locations, err := client.References(absFilename, e.lspPosition())
+	if err != nil {
+		e.languageServerError(c, status, err)
+		return
+	}
+	word := e.WordAtCursor()
+	if len(locations) == 0 {
+		status.SetMessageAfterRedraw("Found no references to " + word)
+		return
+	}
+	e.pickLocation(c, tty, status, "References to "+word, e.locationChoices(locations), locations)
+}
+
+// ShowHover shows the documentation or type information for the symbol at the cursor, as given by the language server
+func (e *Editor) ShowHover(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) {
+	client, absFilename, err := e.languageServer(c, status)
+	if err != nil {
+		e.languageServerError(c, status, err)
+		return
+	}
+	text, err := client.Hover(absFilename, e.lspPosition())
+	if err != nil {
+		e.languageServerError(c, status, err)
+		return
+	}
+	word := e.WordAtCursor()
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		// Skip the start and end of Markdown code blocks
+		if !strings.HasPrefix(strings.TrimSpace(line), "```") {
+			lines = append(lines, line)
+		}
+	}
+	switch {
+	case len(lines) == 0 || strings.TrimSpace(strings.Join(lines, "")) == "":
+		status.SetMessageAfterRedraw("No information about " + word)
+	case len(lines) == 1 && len(lines[0]) < int(c.W())-10:
+		status.ClearAll(c)
+		status.SetMessage(lines[0])
+		status.ShowNoTimeout(c, e)
+	default:
+		e.ShowLines(c, tty, word, lines, nil)
+	}
+}
+
+// applyLSPLines replaces the contents of this editor with the given lines, as an action that can be undone
+func (e *Editor) applyLSPLines(u *Undo, lines []string) {
+	u.Snapshot(e)
+	e.lines.Replace(NewLineRope(runeLines(lines)))
+	e.changed = true
+	if e.DataY() >= LineIndex(e.Len()) {
+		e.pos.sy = 0
+		e.pos.offsetY = 0
+	}
+	e.redraw = true
+	e.redrawCursor = true
+}
+
+// syncOpenBuffers sends the contents of the other open files in the same language to the given language server,
+// if they have unsaved changes or have been sent before, so that the server does not rely on the files on disk
+func (e *Editor) syncOpenBuffers(client *LSPClient) error {
+	for i, b := range bufferList.buffers {
+		if i == bufferList.current || b.stdin || b.editor == nil || b.editor.mode != e.mode {
+			continue
+		}
+		if b.editor.changed || client.IsOpen(b.absFilename) {
+			if err := client.SyncDocument(b.absFilename, b.editor.String()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// applyWorkspaceEdit applies the given changes to the open files, as actions that can be undone,
+// and writes the changes to the files that are not open. Returns the number of changed files.
+// Nothing is changed if any of the edits are invalid.
+func (e *Editor) applyWorkspaceEdit(edit *LSPWorkspaceEdit) (int, error) {
+	fileEdits, err := edit.FileEdits()
+	if err != nil {
+		return 0, err
+	}
+	type fileChange struct {
+		editor *Editor // the editor of the open file, or nil
+		undo   *Undo
+		mode   os.FileMode // the permissions of a file that is not open
+		lines  []string    // the new contents
+	}
+	currentFilename := e.lspFilename()
+	changes := make(map[string]fileChange)
+	for absFilename, edits := range fileEdits {
+		if len(edits) == 0 {
+			continue
+		}
+		var change fileChange
+		var lines []string
+		if absFilename == currentFilename {
+			change.editor, change.undo = e, undo
+			lines = bufferLines(e.lines.Buffer)
+		} else if i := bufferList.Index(absFilename); i >= 0 {
+			b := bufferList.buffers[i]
+			change.editor, change.undo = b.editor, b.undo
+			lines = bufferLines(b.editor.lines.Buffer)
+		} else {
+			fi, err := os.Stat(absFilename)
+			if err != nil {
+				return 0, err
+			}
+			data, err := os.ReadFile(absFilename)
+			if err != nil {
+				return 0, err
+			}
+			change.mode = fi.Mode().Perm()
+			lines = strings.Split(string(data), "\n")
+		}
+		if change.lines, err = applyTextEdits(lines, edits); err != nil {
+			return 0, fmt.Errorf("%s: %w", filepath.Base(absFilename), err)
+		}
+		changes[absFilename] = change
+	}
+	count := 0
+	for absFilename, change := range changes {
+		if change.editor != nil {
+			change.editor.applyLSPLines(change.undo, change.lines)
+		} else if err := WriteFileAtomic(absFilename, []byte(strings.Join(change.lines, "\n")), change.mode, false); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// RenameSymbol asks for a new name for the symbol at the cursor, and renames it everywhere with the language server
+func (e *Editor) RenameSymbol(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) {
+	client, absFilename, err := e.languageServer(c, status)
+	if err != nil {
+		e.languageServerError(c, status, err)
+		return
+	}
+	word := e.WordAtCursor()
+	if i := strings.LastIndex(word, "."); i >= 0 {
+		word = word[i+1:]
+	}
+	if word == "" {
+		status.SetMessageAfterRedraw("Nothing to rename")
+		return
+	}
+	pos := e.lspPosition()
+	newName, ok := e.UserInput(c, tty, status, "Rename "+word+" to", []string{}, false)
+	newName = strings.TrimSpace(newName)
+	if !ok || newName == "" || newName == word {
+		status.ClearAll(c)
+		return
+	}
+	// The edits for the other open files must match their unsaved contents
+	if err := e.syncOpenBuffers(client); err != nil {
+		e.languageServerError(c, status, err)
+		return
+	}
+	edit, err := client.Rename(absFilename, pos, newName)
+	if err != nil {
+		e.languageServerError(c, status, err)
+		return
+	}
+	count, err := e.applyWorkspaceEdit(edit)
+	if err != nil {
+		e.languageServerError(c, status, err)
+		return
+	}
+	if count == 1 {
+		status.SetMessageAfterRedraw("Renamed " + word + " to " + newName)
+	} else {
+		status.SetMessageAfterRedraw(fmt.Sprintf("Renamed %s to %s in %d files", word, newName, count))
+	}
+}
+
+// ShowDiagnostics lists the errors and warnings that the language server has found in the current file,
+// and lets the user jump to one of them
+func (e *Editor) ShowDiagnostics(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) {
+	client, absFilename, err := e.languageServer(c, status)
+	if err != nil {
+		e.languageServerError(c, status, err)
+		return
+	}
+	diagnostics := client.WaitForDiagnostics(absFilename, diagnosticsWait)
+	if len(diagnostics) == 0 {
+		status.SetMessageAfterRedraw("No problems in " + filepath.Base(absFilename))
+		return
+	}
+	choices := make([]string, len(diagnostics))
+	locations := make([]LSPLocation, len(diagnostics))
+	for i, d := range diagnostics {
+		message := strings.SplitN(d.Message, "\n", 2)[0]
+		choices[i] = fmt.Sprintf("%d:%d: %s: %s", d.Range.Start.Line+1, d.Range.Start.Character+1, severityName(d.Severity), message)
+		locations[i] = LSPLocation{URI: filenameToURI(absFilename), Range: d.Range}
+	}
+	e.pickLocation(c, tty, status, "Problems in "+filepath.Base(absFilename), choices, locations)
+}
+
+// DiagnosticsPublished is called from a background goroutine, with keyLoopMut locked, when a language server
+// has published diagnostics for a file. The number of errors and warnings is shown if it changed for the current file.
+func (e *Editor) DiagnosticsPublished(c *vt100.Canvas, status *StatusBar, absFilename string) {
+	if absFilename != e.lspFilename() {
+		return
+	}
+	var errorCount, warningCount int
+	for _, client := range lspClients {
+		for _, d := range client.Diagnostics(absFilename) {
+			if d.Severity == lspSeverityWarning {
+				warningCount++
+			} else if d.Severity == lspSeverityError || d.Severity == 0 {
+				errorCount++
+			}
+		}
+	}
+	count := errorCount + warningCount
+	previousCount, known := lspProblemCounts[absFilename]
+	lspProblemCounts[absFilename] = count
+	if count == previousCount && (known || count == 0) {
+		return
+	}
+	name := filepath.Base(absFilename)
+	var msg string
+	switch {
+	case count == 0:
+		msg = "No problems in " + name
+	case warningCount == 0:
+		msg = fmt.Sprintf("%s: %s", name, pluralize(errorCount, "error"))
+	case errorCount == 0:
+		msg = fmt.Sprintf("%s: %s", name, pluralize(warningCount, "warning"))
+	default:
+		msg = fmt.Sprintf("%s: %s and %s", name, pluralize(errorCount, "error"), pluralize(warningCount, "warning"))
+	}
+	status.ClearAll(c)
+	status.SetMessageAfterRedraw(msg)
+	e.RedrawAtEndOfKeyLoop(c, status)
+}
+
+// pluralize returns the given number and word, like "1 error" or "2 errors"
+func pluralize(n int, word string) string {
+	if n == 1 {
+		return "1 " + word
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
@@ -35,6 +35,8 @@ func main() {
 		pasteFlag      = flag.Bool("p", false, "paste the clipboard into the file and quit")
 		clearLocksFlag = flag.Bool("r", false, "clear all file locks")
 		noCacheFlag    = flag.Bool("n", false, "don't write anything to "+cacheDirForDoc)
+		backupFlag     = flag.Bool("b", false, "keep the previous version of a file as FILENAME~ when saving")
+		remoteFlag     = flag.Bool("remote", false, "open the file in an already running instance, if there is one")
 		versionFlag    = flag.Bool("version", false, "version information")
 	)
 
@@ -83,10 +85,19 @@ ctrl-v      to paste one line, press twice to paste the rest
 ctrl-x      to cut the current line, press twice to cut the current block
 ctrl-b      to toggle a bookmark for the current line, or jump to a bookmark
 ctrl-u      to undo (ctrl-z is also possible, but may background the application)
+alt-z       to redo, after undoing
 ctrl-l      to jump to a specific line (press return to jump to the top or bottom)
 ctrl-f      to find a string, press Tab after the text to search and replace
 ctrl-\      to toggle single-line comments for a block of code
 ctrl-~      to jump to matching parenthesis
+shift-arrow to select text, then copy, cut, paste over, comment, sort or search
+            and replace within the selection
+alt-shift-arrow to select a rectangle of text, then type, delete, copy, cut
+            or paste on all of the selected lines
+ctrl-up/down to add a cursor on the line above or below, then type or delete
+            at all of the cursors at once
+alt-up/down to move to the previous or next pane, if the view is split
+alt-left/right to go back or forward in the jump list
 esc         to redraw the screen and clear the last search
 
 Set NO_COLOR=1 to disable colors.
@@ -96,8 +107,11 @@ Flags:
   -c FILENAME                - just copy a file into the clipboard
   -p FILENAME                - just paste the contents of the clipboard into a file
   -f                         - force, ignore file locks or combine with -p to overwrite files
-  -n                         - avoid writing the location history, search history, highscore,
-                               compilation and format command to ` + cacheDirForDoc + `
+  -b                         - keep the previous version of a file as FILENAME~ when saving
+  --remote FILENAME[:LINE]   - open the file in the running instance that has it open, or else in the
+                               most recently started one, or here if no other instance is running
+  -n                         - avoid writing the location history, search history, undo history,
+                               swap files, highscore, compilation and format command to ` + cacheDirForDoc + `
   --version                  - show the current version
 
 See the man page for more information.
@@ -107,6 +121,7 @@ See the man page for more information.
 	}
 
 	noWriteToCache = *noCacheFlag
+	backupOnSave = *backupFlag
 
 	// If the -p flag is given, just paste the clipboard to the given filename and exit
 	if filename := flag.Arg(0); filename != "" && *pasteFlag {
@@ -269,6 +284,29 @@ See the man page for more information.
 		}
 	}
 
+	// Open the file in an already running instance of the editor instead, if asked to and if there is one
+	if *remoteFlag && !fnord.stdin {
+		if found, err := OpenRemote(fileLock, fnord.filename, lineNumber, colNumber); found {
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				quitMut.Lock()
+				defer quitMut.Unlock()
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	// Use the settings from the configuration files that apply to the given file.
+	// Errors are shown in the status bar when the file is loaded.
+	cfg, cfgErr := FindConfig(fnord.filename)
+	if !cfg.WriteToCache() {
+		noWriteToCache = true
+	}
+	undoSize = cfg.UndoSize(defaultUndoCount)
+	undo = NewUndo(undoSize, defaultUndoMemory)
+	keyMap = NewKeyMap(cfg.KeyBindings())
+
 	// Set the terminal title, if the current terminal emulator supports it, and NO_COLOR is not set
 	fnord.SetTitle()
 
@@ -312,7 +350,7 @@ See the man page for more information.
 	defer tty.Close()
 
 	// Run the main editor loop
-	userMessage, stopParent, err := Loop(tty, fnord, lineNumber, colNumber, *forceFlag, theme, syntaxHighlight)
+	userMessage, stopParent, err := Loop(tty, fnord, lineNumber, colNumber, *forceFlag, theme, syntaxHighlight, cfg, cfgErr)
 
 	// SIGQUIT the parent PID. Useful if being opened repeatedly by a find command.
 	if stopParent {
@@ -0,0 +1,124 @@
+package main
+
+// Conflict markers, like the ones used by git
+const (
+	conflictStartMarker  = "<<<<<<< my changes"
+	conflictMiddleMarker = "======="
+	conflictEndMarker    = ">>>>>>> changes on disk"
+)
+
+// diffHunk is a change to a range of lines, from start to end, where the lines are replaced by the given lines
+type diffHunk struct {
+	start, end int
+	lines      []string
+}
+
+// diffHunks collects the changes in the given diff, with the line numbers of the old text
+func diffHunks(diff []DiffLine) []diffHunk {
+	var (
+		hunks   []diffHunk
+		current *diffHunk
+		y       int
+	)
+	for _, dl := range diff {
+		switch dl.Op {
+		case ' ':
+			if current != nil {
+				hunks = append(hunks, *current)
+				current = nil
+			}
+			y++
+		case '-':
+			if current == nil {
+				current = &diffHunk{start: y, end: y}
+			}
+			current.end++
+			y++
+		case '+':
+			if current == nil {
+				current = &diffHunk{start: y, end: y}
+			}
+			current.lines = append(current.lines, dl.Text)
+		}
+	}
+	if current != nil {
+		hunks = append(hunks, *current)
+	}
+	return hunks
+}
+
+// applyHunks applies the given hunks, which must be sorted and within the range, to the base lines from start to end
+func applyHunks(base []string, start, end int, hunks []diffHunk) []string {
+	var lines []string
+	y := start
+	for _, h := range hunks {
+		lines = append(lines, base[y:h.start]...)
+		lines = append(lines, h.lines...)
+		y = h.end
+	}
+	return append(lines, base[y:end]...)
+}
+
+// MergeLines does a three-way merge of two changed versions of the same lines.
+// Changes that only one of the versions made are kept, and so are changes that both made in the same way.
+// Other changes are placed between conflict markers. Returns the merged lines and the number of conflicts.
+func MergeLines(base, mine, theirs []string) ([]string, int) {
+	var (
+		mineHunks   = diffHunks(LineDiff(base, mine))
+		theirsHunks = diffHunks(LineDiff(base, theirs))
+		merged      []string
+		conflicts   int
+		y           int
+	)
+	for len(mineHunks) > 0 || len(theirsHunks) > 0 {
+		// Start with the first hunk of either version
+		var first diffHunk
+		if len(theirsHunks) == 0 || (len(mineHunks) > 0 && mineHunks[0].start <= theirsHunks[0].start) {
+			first = mineHunks[0]
+		} else {
+			first = theirsHunks[0]
+		}
+		start, end := first.start, first.end
+
+		// Collect the hunks from both versions that overlap with the changed range
+		var myGroup, theirGroup []diffHunk
+		for {
+			if len(mineHunks) > 0 && (mineHunks[0].start < end || mineHunks[0].start == start) {
+				myGroup = append(myGroup, mineHunks[0])
+				if mineHunks[0].end > end {
+					end = mineHunks[0].end
+				}
+				mineHunks = mineHunks[1:]
+				continue
+			}
+			if len(theirsHunks) > 0 && (theirsHunks[0].start < end || theirsHunks[0].start == start) {
+				theirGroup = append(theirGroup, theirsHunks[0])
+				if theirsHunks[0].end > end {
+					end = theirsHunks[0].end
+				}
+				theirsHunks = theirsHunks[1:]
+				continue
+			}
+			break
+		}
+
+		merged = append(merged, base[y:start]...)
+		myLines := applyHunks(base, start, end, myGroup)
+		theirLines := applyHunks(base, start, end, theirGroup)
+		switch {
+		case len(theirGroup) == 0:
+			merged = append(merged, myLines...)
+		case len(myGroup) == 0 || equalStrings(myLines, theirLines):
+			merged = append(merged, theirLines...)
+		default:
+			merged = append(merged, conflictStartMarker)
+			merged = append(merged, myLines...)
+			merged = append(merged, conflictMiddleMarker)
+			merged = append(merged, theirLines...)
+			merged = append(merged, conflictEndMarker)
+			conflicts++
+		}
+		y = end
+	}
+	return append(merged, base[y:]...), conflicts
+}
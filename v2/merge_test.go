@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestMergeLines(t *testing.T) {
+	base := []string{"a", "b", "c", "d", "e"}
+
+	// Changes to different lines are both kept
+	mine := []string{"a", "B", "c", "d", "e"}
+	theirs := []string{"a", "b", "c", "d", "E", "f"}
+	merged, conflicts := MergeLines(base, mine, theirs)
+	if expected := []string{"a", "B", "c", "d", "E", "f"}; conflicts != 0 || !equalStrings(merged, expected) {
+		t.Errorf("expected %q without conflicts, got %q with %d conflicts", expected, merged, conflicts)
+	}
+
+	// The same change on both sides is not a conflict
+	merged, conflicts = MergeLines(base, mine, mine)
+	if conflicts != 0 || !equalStrings(merged, mine) {
+		t.Errorf("expected %q without conflicts, got %q with %d conflicts", mine, merged, conflicts)
+	}
+
+	// Different changes to the same line are placed between conflict markers
+	theirs = []string{"a", "bee", "c", "d", "e"}
+	merged, conflicts = MergeLines(base, mine, theirs)
+	expected := []string{"a", conflictStartMarker, "B", conflictMiddleMarker, "bee", conflictEndMarker, "c", "d", "e"}
+	if conflicts != 1 || !equalStrings(merged, expected) {
+		t.Errorf("expected %q with 1 conflict, got %q with %d conflicts", expected, merged, conflicts)
+	}
+}
@@ -53,28 +53,21 @@ func (e *Editor) exportPandocPDF(c *vt100.Canvas, tty *vt100.TTY, status *Status
 	// The reason for writing to a temporary file is to be able to export without saving
 	// the currently edited file.
 
-	tempFilename := ""
 	f, err := os.CreateTemp(tempDir, "_o*.md")
 	if err != nil {
 		return err
 	}
+	tempFilename := f.Name()
+	f.Close()
 	defer os.Remove(tempFilename)
-	tempFilename = f.Name()
-
-	// TODO: Implement a SaveAs function
 
 	// Save to tmpfn
-	oldFilename := e.filename
-	e.filename = tempFilename
-	err = e.Save(c, tty)
-	if err != nil {
-		e.filename = oldFilename
+	if err := e.SaveCopy(c, tty, tempFilename); err != nil {
 		status.ClearAll(c)
 		status.SetError(err)
 		status.Show(c, e)
 		return err
 	}
-	e.filename = oldFilename
 
 	// Check if the PAPERSIZE environment variable is set. Default to "a4".
 	papersize := env.Str("PAPERSIZE", "a4")
@@ -100,14 +93,15 @@ func (e *Editor) exportPandocPDF(c *vt100.Canvas, tty *vt100.TTY, status *Status
 	// use the listings package
 	pandocCommand.Args = append(pandocCommand.Args, "--listings", "-H"+expandedTexFilename)
 
-	// add output and input filenames
-	pandocCommand.Args = append(pandocCommand.Args, "-o"+pdfFilename, oldFilename)
+	// add the output filename
+	pandocCommand.Args = append(pandocCommand.Args, "-o"+pdfFilename)
 
 	// Save the command in a temporary file, using the current filename
-	saveCommand(pandocCommand)
+	savedArgs := append(append([]string{}, pandocCommand.Args[1:]...), e.filename)
+	saveCommand(exec.Command(pandocPath, savedArgs...))
 
-	// Use the temporary filename for the last argument, now that the command has been saved
-	pandocCommand.Args[len(pandocCommand.Args)-1] = tempFilename
+	// Render the copy of the current contents, that may have unsaved changes
+	pandocCommand.Args = append(pandocCommand.Args, tempFilename)
 
 	if output, err := pandocCommand.CombinedOutput(); err != nil {
 		status.ClearAll(c)
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"github.com/xyproto/vt100"
+)
+
+const (
+	// the smallest size of a pane, when splitting the view
+	minPaneWidth  = 10
+	minPaneHeight = 3
+)
+
+// Pane is a part of the canvas that shows one of the open files, with its own cursor position and scroll offsets
+type Pane struct {
+	buffer *OpenBuffer // the file that is shown in this pane
+	pos    Position    // the cursor position and scroll offsets, for when this pane is not in focus
+}
+
+// PaneLayout is a list of panes that the canvas is split into, either above each other or side by side.
+// The pane that is in focus is the one that is edited by the main loop.
+type PaneLayout struct {
+	panes    []*Pane
+	vertical bool // are the panes side by side, instead of above each other?
+	focus    int  // the index of the pane that is in focus
+	view     Box  // where the pane in focus was last drawn, for placing the cursor
+}
+
+// The panes that the canvas is split into, if any
+var panes = &PaneLayout{}
+
+// Split checks if the canvas is split into two or more panes
+func (pl *PaneLayout) Split() bool {
+	return len(pl.panes) > 1
+}
+
+// Box returns the part of the canvas that the pane with the given index is drawn in.
+// There is one line or column between each pane, for drawing a border.
+func (pl *PaneLayout) Box(c *vt100.Canvas, i int) Box {
+	return pl.box(int(c.W()), int(c.H()), i)
+}
+
+// box returns the part of a canvas of the given size that the pane with the given index is drawn in
+func (pl *PaneLayout) box(w, h, i int) Box {
+	n := len(pl.panes)
+	if n < 2 {
+		return Box{0, 0, w, h}
+	}
+	size := h
+	if pl.vertical {
+		size = w
+	}
+	// Divide the available lines or columns evenly, and give what is left over to the last pane
+	paneSize := (size - (n - 1)) / n
+	start := i * (paneSize + 1)
+	if i == n-1 {
+		paneSize = size - start
+	}
+	if pl.vertical {
+		return Box{start, 0, paneSize, h}
+	}
+	return Box{0, start, w, paneSize}
+}
+
+// viewBox returns the part of the canvas where the file that is being edited is drawn.
+// This is the entire canvas, unless the canvas is split into panes.
+func viewBox(c *vt100.Canvas) Box {
+	return panes.Box(c, panes.focus)
+}
+
+// viewWidth returns the width of the part of the canvas where the file that is being edited is drawn
+func viewWidth(c *vt100.Canvas) int {
+	return viewBox(c).W
+}
+
+// viewHeight returns the height of the part of the canvas where the file that is being edited is drawn
+func viewHeight(c *vt100.Canvas) int {
+	return viewBox(c).H
+}
+
+// fitInView scrolls the view, if needed, so that the cursor is within the current pane
+func (e *Editor) fitInView(c *vt100.Canvas) {
+	if h := viewHeight(c); e.pos.sy >= h {
+		e.pos.offsetY += e.pos.sy - (h - 1)
+		e.pos.sy = h - 1
+	}
+	e.pos.SetX(c, e.pos.sx+e.pos.offsetX)
+	e.redraw = true
+	e.redrawCursor = true
+}
+
+// SplitPane splits the pane that is in focus in two, where both panes show the current file.
+// The panes are placed side by side if vertical is true, or above each other if not.
+// If the canvas is already split the other way, all panes are rearranged.
+// The new pane is placed after the current one, and is given focus.
+func (e *Editor) SplitPane(c *vt100.Canvas, status *StatusBar, vertical bool) bool {
+	if !panes.Split() {
+		panes.panes = []*Pane{{buffer: bufferList.Current(), pos: e.pos}}
+		panes.focus = 0
+	}
+	// Check that there is enough room for one more pane
+	n := len(panes.panes) + 1
+	if (vertical && int(c.W())-(n-1) < n*minPaneWidth) || (!vertical && int(c.H())-(n-1) < n*minPaneHeight) {
+		if !panes.Split() {
+			panes.panes = nil
+		}
+		status.SetErrorMessage("Not enough room for another pane")
+		status.Show(c, e)
+		return false
+	}
+	panes.vertical = vertical
+	pane := &Pane{buffer: bufferList.Current(), pos: e.pos}
+	i := panes.focus + 1
+	panes.panes = append(panes.panes[:i], append([]*Pane{pane}, panes.panes[i:]...)...)
+	panes.focus = i
+	e.fitInView(c)
+	return true
+}
+
+// FocusPane moves the focus to the pane with the given index, and lets the main loop edit the file in that pane
+func (e *Editor) FocusPane(c *vt100.Canvas, i int) bool {
+	if !panes.Split() || i < 0 || i >= len(panes.panes) || i == panes.focus {
+		return false
+	}
+	// Remember the file and position of the pane that loses focus
+	current := panes.panes[panes.focus]
+	current.buffer = bufferList.Current()
+	current.pos = e.pos
+	bufferList.Stash(e)
+
+	panes.focus = i
+	pane := panes.panes[i]
+	if j := bufferList.IndexOf(pane.buffer); j >= 0 {
+		if j != bufferList.current {
+			e.use(j)
+		}
+		e.pos = pane.pos
+	}
+	// If the file in the pane has been closed, the pane shows the current file instead
+	pane.buffer = bufferList.Current()
+	e.fitInView(c)
+	return true
+}
+
+// NextPane moves the focus to the next or the previous pane
+func (e *Editor) NextPane(c *vt100.Canvas, forward bool) bool {
+	if forward {
+		return e.FocusPane(c, panes.focus+1)
+	}
+	return e.FocusPane(c, panes.focus-1)
+}
+
+// ClosePane removes the pane that is in focus, and moves the focus to the pane before it.
+// The file that was shown in the pane is kept open.
+func (e *Editor) ClosePane(c *vt100.Canvas) bool {
+	if !panes.Split() {
+		return false
+	}
+	i := panes.focus
+	next := i - 1
+	if next < 0 {
+		next = 1
+	}
+	e.FocusPane(c, next)
+	panes.panes = append(panes.panes[:i], panes.panes[i+1:]...)
+	if panes.focus > i {
+		panes.focus--
+	}
+	if !panes.Split() {
+		panes.panes = nil
+		panes.focus = 0
+	}
+	e.fitInView(c)
+	return true
+}
+
+// drawPanes draws the panes that are not in focus, and the borders between the panes
+func (e *Editor) drawPanes(c *vt100.Canvas) {
+	if !panes.Split() {
+		return
+	}
+	current := bufferList.Current()
+	for i, pane := range panes.panes {
+		if i == panes.focus {
+			continue
+		}
+		// Draw a copy of the editor for the file in this pane, at the position of this pane
+		var pe Editor
+		if pane.buffer == current || bufferList.IndexOf(pane.buffer) < 0 {
+			pe = *e
+		} else {
+			pe = *pane.buffer.editor
+		}
+		pe.pos = pane.pos
+		pe.selectionAnchor = nil
+		pe.cursors = nil
+		box := panes.Box(c, i)
+		pe.WriteLines(c, LineIndex(pe.pos.offsetY), LineIndex(pe.pos.offsetY+box.H), uint(box.X), uint(box.Y), uint(box.W))
+	}
+	// Draw the borders between the panes
+	for i := range panes.panes[1:] {
+		box := panes.Box(c, i+1)
+		if panes.vertical {
+			for y := 0; y < box.H; y++ {
+				c.WriteRune(uint(box.X-1), uint(y), e.Foreground, e.Background, '│')
+			}
+		} else {
+			for x := 0; x < box.W; x++ {
+				c.WriteRune(uint(x), uint(box.Y-1), e.Foreground, e.Background, '─')
+			}
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestPaneLayoutBox(t *testing.T) {
+	pl := &PaneLayout{}
+	if box := pl.box(80, 25, 0); box != (Box{0, 0, 80, 25}) {
+		t.Errorf("expected a single pane to fill the canvas, got %v", box)
+	}
+
+	// Three panes above each other, with a border line between them
+	pl.panes = []*Pane{{}, {}, {}}
+	expected := []Box{{0, 0, 80, 7}, {0, 8, 80, 7}, {0, 16, 80, 9}}
+	for i, e := range expected {
+		if box := pl.box(80, 25, i); box != e {
+			t.Errorf("pane %d: expected %v, got %v", i, e, box)
+		}
+	}
+
+	// Two panes side by side, with a border column between them
+	pl.panes = pl.panes[:2]
+	pl.vertical = true
+	expected = []Box{{0, 0, 39, 25}, {40, 0, 40, 25}}
+	for i, e := range expected {
+		if box := pl.box(80, 25, i); box != e {
+			t.Errorf("pane %d: expected %v, got %v", i, e, box)
+		}
+	}
+}
@@ -51,7 +51,7 @@ func (p *Position) SetX(c *vt100.Canvas, x int) {
 	p.sx = x
 	w := 80 // default width
 	if c != nil {
-		w = int(c.W())
+		w = viewWidth(c)
 	}
 	if x < w {
 		p.offsetX = 0
@@ -78,7 +78,7 @@ func (p *Position) DecY() {
 func (p *Position) IncY(c *vt100.Canvas) {
 	h := 25 // default height
 	if c != nil {
-		h = int(c.H())
+		h = viewHeight(c)
 	}
 
 	p.sy++
@@ -110,7 +110,7 @@ func (p *Position) Up() error {
 func (p *Position) Down(c *vt100.Canvas) error {
 	h := 25 // default height
 	if c != nil {
-		h = int(c.H())
+		h = viewHeight(c)
 	}
 	if p.sy >= h-1 {
 		return errors.New("already at the bottom of the canvas")
@@ -149,7 +149,7 @@ func (p *Position) ColNumber() ColNumber {
 func (p *Position) Right(c *vt100.Canvas) {
 	w := 80 // default width
 	if c != nil {
-		w = int(c.Width())
+		w = viewWidth(c)
 	}
 	if p.sx < (w - 1) {
 		p.sx++
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/xyproto/env/v2"
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt100"
+)
+
+// elevationCommands are the commands that are looked for when saving files that can only be written by another user
+var elevationCommands = []string{"sudo", "doas", "run0"}
+
+// elevationCommand returns the command and arguments for running a command as root.
+// The command can be given in the O_SUDO environment variable, like "doas" or "sudo -A",
+// and if not, the first one of sudo, doas and run0 that is found is used.
+// Returns nil if none is available.
+func elevationCommand() []string {
+	if fields := strings.Fields(env.Str("O_SUDO")); len(fields) > 0 {
+		return fields
+	}
+	for _, name := range elevationCommands {
+		if which(name) != "" {
+			return []string{name}
+		}
+	}
+	return nil
+}
+
+// elevationName returns the name of the command that is used for saving files as root, like "sudo"
+func elevationName() string {
+	if args := elevationCommand(); len(args) > 0 {
+		return filepath.Base(args[0])
+	}
+	return ""
+}
+
+// CanEditPrivileged checks if the current file is read-only because it can only be written by another user,
+// and if it can be saved with sudo, doas or run0 instead
+func (e *Editor) CanEditPrivileged() bool {
+	if !e.readOnly || e.privileged || e.mode == mode.ManPage || elevationName() == "" {
+		return false
+	}
+	if b := bufferList.Current(); b != nil && b.stdin {
+		return false
+	}
+	f, err := os.OpenFile(e.filename, os.O_WRONLY, 0)
+	if err == nil {
+		f.Close()
+		return false
+	}
+	return errors.Is(err, fs.ErrPermission)
+}
+
+// EditPrivileged makes it possible to edit a file that can only be written by another user,
+// by turning off read-only mode and saving the file with sudo, doas or run0 from now on
+func (e *Editor) EditPrivileged() {
+	e.readOnly = false
+	e.privileged = true
+	// Use the regular text color and syntax highlighting, instead of the red text for read-only files
+	if t, ok := themeByName(e.Theme.Name, e.Theme.Light); ok {
+		e.Foreground = t.Foreground
+	}
+	e.syntaxHighlight = !envNoColor && e.mode != mode.Text && (e.mode != mode.Blank || filepath.Ext(e.filename) != "")
+	e.redraw = true
+	e.redrawCursor = true
+}
+
+// writePrivileged writes the given data to a temporary file, and then copies it over the given file
+// with sudo, doas or run0, in the same way as sudoedit. Copying the file in place keeps its owner and
+// permissions, new files are created with the given permissions, and the editor itself never runs as root,
+// so that nothing is written to the cache dir of root.
+func (e *Editor) writePrivileged(c *vt100.Canvas, filename string, data []byte, perm os.FileMode) error {
+	args := elevationCommand()
+	if len(args) == 0 {
+		return errors.New("found no sudo, doas or run0 for saving " + filename)
+	}
+	absFilename, err := filepath.Abs(filename)
+	if err != nil {
+		return err
+	}
+
+	// Write the contents to a temporary file that only the current user can read
+	f, err := os.CreateTemp(tempDir, "__o*"+filepath.Base(filename))
+	if err != nil {
+		return err
+	}
+	tempFilename := f.Name()
+	defer os.Remove(tempFilename)
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	// Let the elevation command use the terminal, since it may ask for a password
+	cmd := exec.Command(args[0], append(args[1:], privilegedCopyCommand(tempFilename, absFilename, perm)...)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if c != nil {
+		vt100.Close()
+		vt100.Clear()
+		vt100.Home()
+		fmt.Printf("Saving %s with %s\n", filename, filepath.Base(args[0]))
+	}
+	err = cmd.Run()
+	if c != nil {
+		const drawLines = true
+		e.FullResetRedraw(c, nil, drawLines)
+	}
+	if err != nil {
+		return fmt.Errorf("could not save %s with %s: %w", filename, filepath.Base(args[0]), err)
+	}
+	e.redraw = true
+	return nil
+}
+
+// privilegedCopyCommand returns the command for copying the given temporary file over the given file.
+// An existing file is copied over with cp, which keeps its owner and permissions, while a new file is
+// created with install, with the given permissions.
+func privilegedCopyCommand(tempFilename, absFilename string, perm os.FileMode) []string {
+	if _, err := os.Stat(absFilename); !errors.Is(err, fs.ErrNotExist) {
+		return []string{"cp", tempFilename, absFilename}
+	}
+	return []string{"install", "-m", fmt.Sprintf("%04o", perm.Perm()), tempFilename, absFilename}
+}
+
+// OfferPrivilegedSave asks if a file that could not be saved because of its permissions
+// should be saved with sudo, doas or run0 instead. Returns true if it should be saved again.
+func (e *Editor) OfferPrivilegedSave(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, err error) bool {
+	name := elevationName()
+	if !errors.Is(err, fs.ErrPermission) || e.privileged || name == "" {
+		return false
+	}
+	if b := bufferList.Current(); b != nil && b.stdin {
+		return false
+	}
+	menuChoices := []string{"Save with " + name, "Cancel"}
+	if e.Menu(status, tty, "Permission denied when saving "+filepath.Base(e.filename), menuChoices, e.Background, e.MenuTitleColor, e.MenuArrowColor, e.MenuTextColor, e.MenuHighlightColor, e.MenuSelectedColor, 0, false) != 0 {
+		e.redraw = true
+		return false
+	}
+	e.EditPrivileged()
+	return true
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xyproto/env/v2"
+)
+
+func TestSavePrivileged(t *testing.T) {
+	defer func(bl *BufferList, noWrite bool, elevation string) {
+		bufferList, noWriteToCache = bl, noWrite
+		env.Set("O_SUDO", elevation)
+	}(bufferList, noWriteToCache, env.Str("O_SUDO"))
+	bufferList = &BufferList{}
+	noWriteToCache = true
+
+	// Use "env" as the elevation command, since it runs the given command as the current user
+	env.Set("O_SUDO", "env")
+
+	filename := filepath.Join(t.TempDir(), "fstab")
+	if err := os.WriteFile(filename, []byte("old\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewSimpleEditor(80)
+	e.filename = filename
+	e.SetLine(0, "UUID=1234 / ext4 defaults 0 1")
+	e.readOnly = true
+	e.EditPrivileged()
+	if e.readOnly || !e.privileged {
+		t.Fatal("expected the editor to be editable and to save with the elevation command")
+	}
+	if err := e.Save(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if e.changed {
+		t.Error("expected the contents to be marked as saved")
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "UUID=1234 / ext4 defaults 0 1\n" {
+		t.Errorf("unexpected contents: %q", data)
+	}
+	// The file was copied in place, so the permissions should be the same
+	if fi, err := os.Stat(filename); err != nil {
+		t.Error(err)
+	} else if fi.Mode().Perm() != 0o640 {
+		t.Errorf("expected the permissions to be kept, got %v", fi.Mode().Perm())
+	}
+
+	// A new file is created with the usual permissions, instead of the ones of the temporary file
+	newFilename := filepath.Join(filepath.Dir(filename), "hosts")
+	e.filename = newFilename
+	e.changed = true
+	if err := e.Save(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(newFilename); err != nil {
+		t.Error(err)
+	} else if fi.Mode().Perm() != 0o644 {
+		t.Errorf("expected a new file to be readable by everyone, got %v", fi.Mode().Perm())
+	}
+
+	// The permissions of a new file are decided by its name and contents, as when saving as the current user
+	scriptFilename := filepath.Join(filepath.Dir(filename), "hello")
+	e.filename = scriptFilename
+	e.SetLine(0, "#!/bin/sh")
+	e.SetLine(1, "echo hello")
+	e.syntaxHighlight = true
+	e.changed = true
+	if err := e.Save(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(scriptFilename); err != nil {
+		t.Error(err)
+	} else if fi.Mode().Perm() != 0o755 {
+		t.Errorf("expected a new script to be executable, got %v", fi.Mode().Perm())
+	}
+
+	env.Set("O_SUDO", "false")
+	e.changed = true
+	if err := e.Save(nil, nil); err == nil {
+		t.Error("expected an error when the elevation command fails")
+	}
+}
@@ -23,14 +23,31 @@ func (e *Editor) ReadFileAndProcessLines(filename string) error {
 			return err
 		}
 	}
+	// Find out which charset the data is encoded with, unless .editorconfig says which one to use,
+	// then decode the data to UTF-8 for editing
+	if e.charset == "" {
+		e.charset = detectCharset(data)
+	}
+	if data, err = decodeCharset(data, e.charset); err != nil {
+		return err
+	}
 	e.binaryFile = binary.Data(data)
 
+	// Find out which line endings the file uses, so that they can be kept when saving
+	e.lineEndings, e.mixedEndings = LF, nil
+	if !e.binaryFile {
+		e.lineEndings = detectLineEndings(data)
+		switch e.lineEndings {
+		case CR:
+			data = bytes.ReplaceAll(data, []byte{'\r'}, []byte{'\n'})
+		case MixedLineEndings:
+			e.mixedEndings = make(lineEndingMap)
+		}
+	}
+
 	var (
-		reader           = bufio.NewReader(bytes.NewReader(data))
-		lines            = make(map[int][]rune)
-		index            int
-		tabIndentCounter int64
-		first            byte
+		reader = bufio.NewReader(bytes.NewReader(data))
+		lines  [][]rune
 	)
 
 	for {
@@ -43,99 +60,66 @@ func (e *Editor) ReadFileAndProcessLines(filename string) error {
 			line = line[:len(line)-1]
 		}
 		if e.binaryFile {
-			lines[index] = []rune(line)
+			lines = append(lines, []rune(line))
 		} else {
-			line = opinionatedStringReplacer.Replace(line)
-			if len(line) > 2 {
-				first = line[0]
-				if first == '\t' {
-					tabIndentCounter++
-				} else if first == ' ' && line[1] == ' ' {
-					tabIndentCounter--
-				}
+			// Remove the carriage return at the end of the line, for CRLF line endings
+			crlf := e.lineEndings != LF && strings.HasSuffix(line, "\r") && err != io.EOF
+			if crlf {
+				line = line[:len(line)-1]
+			}
+			line = opinionatedLineReplacer.Replace(line)
+			if e.mixedEndings != nil {
+				e.mixedEndings.add(line, crlf)
 			}
-			lines[index] = []rune(line)
+			lines = append(lines, []rune(line))
 		}
-		index++
 
 		if err == io.EOF {
 			break
 		}
 	}
-	e.Clear()
-	e.lines = lines
-	if detectedTabs := tabIndentCounter > 0; !e.binaryFile && e.indentation.Spaces {
-		e.detectedTabs = &detectedTabs
-		e.indentation.Spaces = !detectedTabs
-	}
+	e.lines.Replace(NewLineRope(lines))
+	// Indent like the file is indented
+	e.detectIndentation(lines)
 	e.changed = true
 	return nil
 }
 
-// LoadByteLine loads a single byte line
-func (e *Editor) LoadByteLine(ib IndexByteLine, eMut, tcMut *sync.RWMutex, tabIndentCounter, numLines *int, wg *sync.WaitGroup) {
-	// Require at least two bytes. Ignore lines with a single tab indentation or a single space
-	if len(ib.byteLine) > 2 {
-		first := ib.byteLine[0]
-		if first == '\t' {
-			tcMut.Lock()
-			*tabIndentCounter++ // a tab indentation counts like a positive tab indentation
-			tcMut.Unlock()
-		} else if first == ' ' && ib.byteLine[1] == ' ' { // assume that two spaces is the smallest space indentation
-			tcMut.Lock()
-			*tabIndentCounter-- // a space indentation counts like a negative tab indentation
-			tcMut.Unlock()
-		}
-	}
-	eMut.Lock()
-	e.lines[ib.index] = []rune(string(ib.byteLine))
-	*numLines++
-	eMut.Unlock()
+// LoadByteLine loads a single byte line into the given slice of lines
+func (e *Editor) LoadByteLine(ib IndexByteLine, lines [][]rune, wg *sync.WaitGroup) {
+	// Each goroutine writes to a different index, so no mutex is needed
+	lines[ib.index] = []rune(string(ib.byteLine))
 	wg.Done()
 }
 
 // LoadBytes replaces the current editor contents with the given bytes
 func (e *Editor) LoadBytes(data []byte) {
-	// Prepare an empty map to load the lines into
-	e.Clear()
-	e.lines = make(map[int][]rune, 0)
-
 	e.binaryFile = binary.Data(data)
 
 	var (
 		// Split the bytes into lines
 		byteLines = bytes.Split(data, []byte{'\n'})
-
-		// Place the lines into the editor, while counting tab indentations vs space indentations
-		tabIndentCounter int
-
-		// Count the number of lines as the lines are being processed
-		numLines int
-
-		// Mutex for the editor lines and the numLines counter
-		eMut sync.RWMutex
-
-		// Mutex for the tabIndentCounter
-		tcMut sync.RWMutex
 	)
 
+	// Prepare a slice to load the lines into
+	lines := make([][]rune, len(byteLines))
+
 	var wg sync.WaitGroup
 	for index, byteLine := range byteLines {
 		wg.Add(1)
-		go e.LoadByteLine(IndexByteLine{byteLine, index}, &eMut, &tcMut, &tabIndentCounter, &numLines, &wg)
+		go e.LoadByteLine(IndexByteLine{byteLine, index}, lines, &wg)
 	}
 	wg.Wait()
 
 	// If the last line is empty, delete it
-	if numLines > 0 && len(e.lines[numLines-1]) == 0 {
-		delete(e.lines, numLines-1)
+	if numLines := len(lines); numLines > 0 && len(lines[numLines-1]) == 0 {
+		lines = lines[:numLines-1]
 	}
 
-	if detectedTabs := tabIndentCounter > 0; detectedTabs && e.indentation.Spaces {
-		// Check if there were more tab indentations than space indentations
-		e.detectedTabs = &detectedTabs
-		e.indentation.Spaces = !detectedTabs
-	}
+	e.lines.Replace(NewLineRope(lines))
+
+	// Indent like the data is indented
+	e.detectIndentation(lines)
 
 	// Mark the editor contents as "changed"
 	e.changed = true
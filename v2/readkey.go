@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strconv"
+	"unicode"
+
+	"github.com/xyproto/vt100"
+)
+
+var (
+	// arrowKeys maps the last byte of the "ESC [ 1 ; M X" sequences that are sent for modified arrow keys
+	arrowKeys = map[byte]string{
+		'A': "↑",
+		'B': "↓",
+		'C': "→",
+		'D': "←",
+	}
+
+	// arrowKeyModifiers maps the modifier byte (M) of the "ESC [ 1 ; M X" sequences to a key prefix
+	arrowKeyModifiers = map[byte]string{
+		'2': "⇧",  // shift
+		'3': "⌥",  // alt
+		'4': "⌥⇧", // alt and shift
+		'5': "⌃",  // ctrl
+	}
+)
+
+// ReadKey will block and then return a string, just like tty.String,
+// but shift and an arrow key is also recognized, and returned as ⇧←, ⇧→, ⇧↑ or ⇧↓.
+// Alt, shift and an arrow key is returned as ⌥⇧←, ⌥⇧→, ⌥⇧↑ or ⌥⇧↓, and ctrl and an arrow key as ⌃←, ⌃→, ⌃↑ or ⌃↓.
+// Alt and an arrow key is returned as ⌥←, ⌥→, ⌥↑ or ⌥↓, and alt and a letter from a to z as ⌥a to ⌥z.
+// Returns an empty string if the pressed key could not be interpreted.
+func ReadKey(tty *vt100.TTY) string {
+	t := tty.Term()
+	bytes := make([]byte, 3)
+	tty.RawMode()
+	tty.SetTimeout(0)
+	numRead, err := t.Read(bytes)
+	if err != nil {
+		return ""
+	}
+	if numRead == 3 && bytes[0] == 27 && bytes[1] == 91 && bytes[2] == '1' {
+		// Possibly a modified arrow key, "ESC [ 1 ; M X", read the rest of the sequence
+		rest := make([]byte, 3)
+		n, err := t.Read(rest)
+		tty.Restore()
+		t.Flush()
+		if err != nil {
+			return ""
+		}
+		return modifiedKey(rest[:n])
+	}
+	tty.Restore()
+	t.Flush()
+	if numRead == 3 && bytes[0] == 27 && bytes[1] == 91 {
+		// Three-character control sequence, beginning with "ESC-["
+		switch bytes[2] {
+		case 65:
+			return "↑"
+		case 66:
+			return "↓"
+		case 67:
+			return "→"
+		case 68:
+			return "←"
+		}
+	} else if numRead == 1 {
+		r := rune(bytes[0])
+		if unicode.IsPrint(r) {
+			return string(r)
+		}
+		return "c:" + strconv.Itoa(int(r))
+	} else if numRead == 2 && bytes[0] == 27 && bytes[1] >= 'a' && bytes[1] <= 'z' {
+		// Alt and a letter, sent as "ESC" followed by the letter
+		return "⌥" + string(rune(bytes[1]))
+	} else if numRead > 1 {
+		// Two or more bytes, a unicode character (or mashing several keys)
+		return string([]rune(string(bytes[:numRead]))[0])
+	}
+	return ""
+}
+
+// modifiedKey interprets the rest of a key sequence that starts with "ESC [ 1".
+// An arrow key with a modifier that is not recognized is returned as the arrow key alone,
+// and "ESC [ 1 ~", which some terminals send for the home key, is returned as ctrl-a.
+// Returns an empty string if the sequence could not be interpreted.
+func modifiedKey(rest []byte) string {
+	if len(rest) == 3 && rest[0] == ';' && arrowKeys[rest[2]] != "" {
+		return arrowKeyModifiers[rest[1]] + arrowKeys[rest[2]]
+	}
+	if len(rest) > 0 && rest[0] == '~' {
+		return "c:1"
+	}
+	return ""
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestModifiedKey(t *testing.T) {
+	tests := []struct {
+		rest, key string
+	}{
+		{";2A", "⇧↑"},
+		{";4D", "⌥⇧←"},
+		{";5B", "⌃↓"},
+		{";6C", "→"}, // ctrl and shift is not recognized, so the arrow key is used as it is
+		{"~", "c:1"},
+		{";5H", ""},
+		{"5~", ""},
+	}
+	for _, test := range tests {
+		if key := modifiedKey([]byte(test.rest)); key != test.key {
+			t.Errorf("modifiedKey(%q) = %q, expected %q", test.rest, key, test.key)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/xyproto/vt100"
+)
+
+// StartColumnSelection starts selecting a rectangle of text at the current cursor position.
+// If text is already being selected, the selection is turned into a rectangle.
+// For a rectangular selection, the x position of the selection anchor is a screen column.
+func (e *Editor) StartColumnSelection() {
+	if e.selectionAnchor == nil {
+		e.selectionAnchor = &TextPosition{e.pos.sx + e.pos.offsetX, e.DataY()}
+	} else if !e.columnSelection {
+		e.selectionAnchor.x = e.ScreenColumn(e.selectionAnchor.x, e.selectionAnchor.y)
+	}
+	e.columnSelection = true
+}
+
+// SelectionRectangle returns the first and last line index and the first and after-last screen column of the
+// selected rectangle. The rectangle may have a width of 0, which can be used for inserting text on several lines.
+// Returns false if no rectangle is selected.
+func (e *Editor) SelectionRectangle() (LineIndex, LineIndex, int, int, bool) {
+	if e.selectionAnchor == nil || !e.columnSelection {
+		return 0, 0, 0, 0, false
+	}
+	fromY, toY := e.selectionAnchor.y, e.DataY()
+	if toY < fromY {
+		fromY, toY = toY, fromY
+	}
+	fromCol, toCol := e.selectionAnchor.x, e.pos.sx+e.pos.offsetX
+	if toCol < fromCol {
+		fromCol, toCol = toCol, fromCol
+	}
+	return fromY, toY, fromCol, toCol, fromY != toY || fromCol != toCol
+}
+
+// HasColumnSelection checks if a rectangle of text is selected
+func (e *Editor) HasColumnSelection() bool {
+	_, _, _, _, ok := e.SelectionRectangle()
+	return ok
+}
+
+// runeColumns returns how many screen columns the given rune is drawn as
+func (e *Editor) runeColumns(r rune) int {
+	if r == '\t' {
+		return e.indentation.PerTab
+	}
+	return 1
+}
+
+// textColumns returns how many screen columns the given text is drawn as
+func (e *Editor) textColumns(s string) int {
+	columns := 0
+	for _, r := range s {
+		columns += e.runeColumns(r)
+	}
+	return columns
+}
+
+// columnIndex finds the index of the rune that starts at the given screen column, for the given line.
+// Also returns how many columns into a rune the column is (when in the middle of a tab),
+// or how many columns after the end of the line it is (when the line is too short).
+func (e *Editor) columnIndex(line []rune, col int) (int, int) {
+	column := 0
+	for i, r := range line {
+		if column >= col {
+			return i, 0
+		}
+		w := e.runeColumns(r)
+		if column+w > col {
+			return i, col - column
+		}
+		column += w
+	}
+	return len(line), col - column
+}
+
+// columnSlice returns the part of the given line that is between the two screen columns.
+// Tabs that are only partly within the columns are returned as spaces.
+func (e *Editor) columnSlice(line []rune, fromCol, toCol int) string {
+	var sb strings.Builder
+	column := 0
+	for _, r := range line {
+		if column >= toCol {
+			break
+		}
+		w := e.runeColumns(r)
+		switch {
+		case column >= fromCol && column+w <= toCol:
+			sb.WriteRune(r)
+		case column+w > fromCol:
+			// Only a part of a tab is within the columns
+			start, end := column, column+w
+			if start < fromCol {
+				start = fromCol
+			}
+			if end > toCol {
+				end = toCol
+			}
+			sb.WriteString(strings.Repeat(" ", end-start))
+		}
+		column += w
+	}
+	return sb.String()
+}
+
+// splitAtColumn makes sure that a rune starts at the given screen column of the given line, and returns its index.
+// A tab that covers the column is replaced with spaces. If pad is true, a line that is too short is padded with
+// whitespace, where tabs are used for indentation if the editor is configured to indent with tabs.
+func (e *Editor) splitAtColumn(y LineIndex, col int, pad bool) int {
+	line, _ := e.lines.Line(int(y))
+	i, rest := e.columnIndex(line, col)
+	if rest == 0 {
+		return i
+	}
+	if i < len(line) {
+		// The column is in the middle of a tab, replace the tab with spaces
+		newLine := make([]rune, 0, len(line)+e.indentation.PerTab)
+		newLine = append(newLine, line[:i]...)
+		newLine = append(newLine, []rune(strings.Repeat(" ", e.indentation.PerTab))...)
+		newLine = append(newLine, line[i+1:]...)
+		e.lines.SetLine(int(y), newLine)
+		e.changed = true
+		return i + rest
+	}
+	if !pad {
+		return len(line)
+	}
+	// The line is too short, pad it
+	padding := strings.Repeat(" ", rest)
+	if !e.indentation.Spaces && e.indentation.PerTab > 0 && strings.TrimSpace(string(line)) == "" {
+		padding = strings.Repeat("\t", rest/e.indentation.PerTab) + strings.Repeat(" ", rest%e.indentation.PerTab)
+	}
+	paddingRunes := []rune(padding)
+	e.lines.SetLine(int(y), append(line[:len(line):len(line)], paddingRunes...))
+	e.changed = true
+	return len(line) + len(paddingRunes)
+}
+
+// replaceColumns replaces the text between the two screen columns, for each line from fromY to toY,
+// with the text that is returned by the given function. The function is given the line number within
+// the rectangle, starting at 0. If trimEnd is true, trailing spaces are not added to the end of a line.
+func (e *Editor) replaceColumns(fromY, toY LineIndex, fromCol, toCol int, text func(i int) string, trimEnd bool) {
+	for y := fromY; y <= toY; y++ {
+		s := text(int(y - fromY))
+		end := e.splitAtColumn(y, toCol, false)
+		line, _ := e.lines.Line(int(y))
+		lenBefore := len(line)
+		start := e.splitAtColumn(y, fromCol, s != "")
+		line, _ = e.lines.Line(int(y))
+		end += len(line) - lenBefore
+		if end < start {
+			end = start
+		}
+		suffix := line[end:]
+		if trimEnd && len(suffix) == 0 {
+			s = strings.TrimRight(s, " ")
+		}
+		if start == end && s == "" {
+			continue
+		}
+		newLine := make([]rune, 0, len(line)+len(s))
+		newLine = append(newLine, line[:start]...)
+		newLine = append(newLine, []rune(s)...)
+		newLine = append(newLine, suffix...)
+		e.lines.SetLine(int(y), newLine)
+		e.changed = true
+	}
+}
+
+// moveColumnSelection changes the selected rectangle to have a width of 0, at the given screen column
+func (e *Editor) moveColumnSelection(c *vt100.Canvas, col int) {
+	if e.selectionAnchor == nil {
+		return
+	}
+	e.selectionAnchor.x = col
+	e.pos.SetX(c, col)
+	e.redraw = true
+	e.redrawCursor = true
+}
+
+// RectangleLines returns the text that is within the selected rectangle, one string per line
+func (e *Editor) RectangleLines() []string {
+	fromY, toY, fromCol, toCol, ok := e.SelectionRectangle()
+	if !ok {
+		return []string{}
+	}
+	lines := make([]string, 0, toY-fromY+1)
+	for y := fromY; y <= toY; y++ {
+		line, _ := e.lines.Line(int(y))
+		lines = append(lines, e.columnSlice(line, fromCol, toCol))
+	}
+	return lines
+}
+
+// ReplaceRectangle replaces the selected rectangle with the given text, on each of the selected lines.
+// Afterwards, an empty rectangle is selected right after the inserted text, so that typing can continue.
+func (e *Editor) ReplaceRectangle(c *vt100.Canvas, s string) {
+	fromY, toY, fromCol, toCol, ok := e.SelectionRectangle()
+	if !ok {
+		return
+	}
+	e.replaceColumns(fromY, toY, fromCol, toCol, func(int) string { return s }, false)
+	e.moveColumnSelection(c, fromCol+e.textColumns(s))
+}
+
+// PasteRectangle inserts the given lines as a rectangle at the start of the selected rectangle, one line per line
+// in the document, starting at the first selected line. The selected text is removed first. If only one line is
+// given, it is inserted on all of the selected lines.
+func (e *Editor) PasteRectangle(c *vt100.Canvas, lines []string) {
+	fromY, toY, fromCol, toCol, ok := e.SelectionRectangle()
+	if !ok {
+		return
+	}
+	// Skip the empty line after a trailing newline
+	if len(lines) > 1 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 1 {
+		e.ReplaceRectangle(c, lines[0])
+		return
+	}
+	// Pad the lines with spaces, so that the text after the rectangle stays aligned
+	width := 0
+	for _, line := range lines {
+		if w := e.textColumns(line); w > width {
+			width = w
+		}
+	}
+	lastY := fromY + LineIndex(len(lines)-1)
+	if toY > lastY {
+		lastY = toY
+	}
+	e.replaceColumns(fromY, lastY, fromCol, toCol, func(i int) string {
+		if i >= len(lines) {
+			return ""
+		}
+		return lines[i] + strings.Repeat(" ", width-e.textColumns(lines[i]))
+	}, true)
+	e.moveColumnSelection(c, fromCol+width)
+}
+
+// BackspaceRectangle removes the selected rectangle, or if it is empty, the column to the left of it
+func (e *Editor) BackspaceRectangle(c *vt100.Canvas) {
+	fromY, toY, fromCol, toCol, ok := e.SelectionRectangle()
+	if !ok {
+		return
+	}
+	if fromCol == toCol {
+		if fromCol == 0 {
+			return
+		}
+		fromCol--
+	}
+	e.replaceColumns(fromY, toY, fromCol, toCol, func(int) string { return "" }, false)
+	e.moveColumnSelection(c, fromCol)
+}
+
+// DeleteRectangle removes the selected rectangle, or if it is empty, the column to the right of it
+func (e *Editor) DeleteRectangle(c *vt100.Canvas) {
+	fromY, toY, fromCol, toCol, ok := e.SelectionRectangle()
+	if !ok {
+		return
+	}
+	if fromCol == toCol {
+		toCol++
+	}
+	e.replaceColumns(fromY, toY, fromCol, toCol, func(int) string { return "" }, false)
+	e.moveColumnSelection(c, fromCol)
+}
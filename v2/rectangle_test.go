@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/xyproto/mode"
+)
+
+// selectRectangle selects a rectangle from the given screen column and line index to another one
+func selectRectangle(e *Editor, fromCol int, fromY LineIndex, toCol int, toY LineIndex) {
+	e.ClearSelection()
+	e.pos.sy, e.pos.sx = int(fromY), fromCol
+	e.StartColumnSelection()
+	e.pos.sy, e.pos.sx = int(toY), toCol
+}
+
+func TestRectangleLines(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.indentation = mode.TabsSpaces{PerTab: 4, Spaces: false}
+	e.SetLine(0, "abcdef")
+	e.SetLine(1, "\tx")
+	e.SetLine(2, "ab")
+	selectRectangle(e, 2, 0, 5, 2)
+	lines := e.RectangleLines()
+	if len(lines) != 3 || lines[0] != "cde" || lines[1] != "  x" || lines[2] != "" {
+		t.Errorf("unexpected rectangle: %q", lines)
+	}
+}
+
+func TestReplaceRectangle(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.indentation = mode.TabsSpaces{PerTab: 4, Spaces: true}
+	e.SetLine(0, "| a | b |")
+	e.SetLine(1, "| c | d |")
+	e.SetLine(2, "| e")
+	selectRectangle(e, 4, 0, 4, 2)
+	e.ReplaceRectangle(nil, "x")
+	e.ReplaceRectangle(nil, "y")
+	if s := e.String(); s != "| a xy| b |\n| c xy| d |\n| e xy\n" {
+		t.Errorf("unexpected contents after typing: %q", s)
+	}
+	e.BackspaceRectangle(nil)
+	if s := e.String(); s != "| a x| b |\n| c x| d |\n| e x\n" {
+		t.Errorf("unexpected contents after backspace: %q", s)
+	}
+	// Select the column with the "x" and delete it
+	selectRectangle(e, 4, 0, 5, 2)
+	e.DeleteRectangle(nil)
+	if s := e.String(); s != "| a | b |\n| c | d |\n| e \n" {
+		t.Errorf("unexpected contents after deleting: %q", s)
+	}
+}
+
+func TestPasteRectangle(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.indentation = mode.TabsSpaces{PerTab: 4, Spaces: true}
+	e.SetLine(0, "ab")
+	e.SetLine(1, "cd")
+	selectRectangle(e, 1, 0, 1, 1)
+	e.PasteRectangle(nil, []string{"1", "22", "333", ""})
+	if s := e.String(); s != "a1  b\nc22 d\n 333\n" {
+		t.Errorf("unexpected contents after pasting: %q", s)
+	}
+}
+
+func TestSplitTab(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.indentation = mode.TabsSpaces{PerTab: 4, Spaces: false}
+	e.SetLine(0, "\tx")
+	e.SetLine(1, "")
+	selectRectangle(e, 2, 0, 2, 1)
+	e.ReplaceRectangle(nil, "|")
+	if s := e.String(); s != "  |  x\n  |\n" {
+		t.Errorf("unexpected contents: %q", s)
+	}
+	// Indentation is padded with tabs, when indenting with tabs
+	e.SetLine(2, "")
+	e.SetLine(3, "")
+	selectRectangle(e, 5, 2, 5, 3)
+	e.ReplaceRectangle(nil, "y")
+	if s := e.String(); s != "  |  x\n  |\n\t y\n\t y\n" {
+		t.Errorf("unexpected contents after padding: %q", s)
+	}
+}
@@ -87,8 +87,8 @@ func (e *Editor) RedrawIfNeeded(c *vt100.Canvas) {
 
 // RepositionCursor will send the VT100 commands needed to position the cursor
 func (e *Editor) RepositionCursor(x, y int) {
-	// Redraw the cursor
-	vt100.SetXY(uint(x), uint(y))
+	// Redraw the cursor, within the pane that is in focus
+	vt100.SetXY(uint(panes.view.X+x), uint(panes.view.Y+y))
 	e.previousX = x
 	e.previousY = y
 }
@@ -104,15 +104,22 @@ func (e *Editor) RepositionCursorIfNeeded() {
 	}
 }
 
-// DrawLines will draw a screen full of lines on the given canvas
-func (e *Editor) DrawLines(c *vt100.Canvas, respectOffset, redrawCanvas bool) {
-	h := int(c.Height())
+// WriteView will draw a screen full of lines on the given canvas, without drawing the canvas to the terminal.
+// If the canvas is split into panes, all of them are drawn.
+func (e *Editor) WriteView(c *vt100.Canvas, respectOffset bool) {
+	e.drawPanes(c)
+	view := viewBox(c)
+	panes.view = view
+	offsetY := 0
 	if respectOffset {
-		offsetY := e.pos.OffsetY()
-		e.WriteLines(c, LineIndex(offsetY), LineIndex(h+offsetY), 0, 0)
-	} else {
-		e.WriteLines(c, LineIndex(0), LineIndex(h), 0, 0)
+		offsetY = e.pos.OffsetY()
 	}
+	e.WriteLines(c, LineIndex(offsetY), LineIndex(view.H+offsetY), uint(view.X), uint(view.Y), uint(view.W))
+}
+
+// DrawLines will draw a screen full of lines on the given canvas
+func (e *Editor) DrawLines(c *vt100.Canvas, respectOffset, redrawCanvas bool) {
+	e.WriteView(c, respectOffset)
 	if redrawCanvas {
 		c.Redraw()
 	} else {
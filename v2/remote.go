@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xyproto/env/v2"
+	"github.com/xyproto/vt100"
+)
+
+const (
+	// remoteDialTimeout is how long to wait when connecting to another session
+	remoteDialTimeout = 500 * time.Millisecond
+
+	// remoteReplyTimeout is how long to wait for another session to carry out a command.
+	// The session may be busy, for instance if a menu is being shown.
+	remoteReplyTimeout = 5 * time.Second
+)
+
+// The commands that are accepted over the remote control socket
+const (
+	remoteOpen       = "open"
+	remoteGotoLine   = "goto-line"
+	remoteInsertText = "insert-text"
+	remoteSave       = "save"
+)
+
+var (
+	// remoteSocketDir is the directory with one remote control socket per running session.
+	// $XDG_RUNTIME_DIR is only readable by the current user, while the temporary directory is shared.
+	remoteSocketDir = remoteSocketDirectory()
+
+	// remoteRecovery is a file that was opened by a remote command, which has unsaved changes from a previous session
+	// that can be recovered. The user is asked when the next key is pressed, since menus need to read keys.
+	remoteRecovery string
+)
+
+// RemoteCommand is a command that is sent to a running session over the remote control socket,
+// as one JSON object per line, like {"command":"open","filename":"main.go","line":42}
+type RemoteCommand struct {
+	Command  string `json:"command"`
+	Filename string `json:"filename,omitempty"` // the file to switch to before carrying out the command, if any
+	Line     int    `json:"line,omitempty"`     // the line number, counting from 1
+	Col      int    `json:"col,omitempty"`      // the column number, counting from 1
+	Text     string `json:"text,omitempty"`     // the text to insert
+}
+
+// RemoteReply is the reply to a RemoteCommand, which contains an error message if the command failed
+type RemoteReply struct {
+	Error string `json:"error,omitempty"`
+}
+
+// RemoteServer accepts remote control commands for this session over a Unix domain socket
+type RemoteServer struct {
+	listener   net.Listener
+	socketPath string
+}
+
+// remoteSocketDirectory returns the directory for the remote control sockets
+func remoteSocketDirectory() string {
+	if runtimeDir := env.Dir("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		return filepath.Join(runtimeDir, "o")
+	}
+	return filepath.Join(tempDir, "o-"+strconv.Itoa(os.Getuid()))
+}
+
+// checkRemoteSocketDir creates the directory for the remote control sockets, if needed, and checks that
+// it can only be used by the current user, since the sockets can be used for changing files
+func checkRemoteSocketDir() error {
+	if err := os.MkdirAll(remoteSocketDir, 0o700); err != nil {
+		return err
+	}
+	fi, err := os.Lstat(remoteSocketDir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() || fi.Mode().Perm()&0o077 != 0 {
+		return errors.New(remoteSocketDir + " must be a directory that only the current user has access to")
+	}
+	if uid, _, _, ok := fileOwner(fi); ok && uid != os.Getuid() {
+		return errors.New(remoteSocketDir + " belongs to another user")
+	}
+	return nil
+}
+
+// ListenRemote creates the remote control socket for this session
+func ListenRemote() (*RemoteServer, error) {
+	if err := checkRemoteSocketDir(); err != nil {
+		return nil, err
+	}
+	socketPath := filepath.Join(remoteSocketDir, strconv.Itoa(os.Getpid())+".sock")
+	// A socket with the same name can only be left over from an earlier process with the same PID
+	os.Remove(socketPath)
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+	return &RemoteServer{listener, socketPath}, nil
+}
+
+// SocketPath returns the path to the remote control socket of this session
+func (rs *RemoteServer) SocketPath() string {
+	return rs.socketPath
+}
+
+// Serve accepts connections until the server is closed. The given function is called
+// from a background goroutine for each command, and the error it returns is sent as the reply.
+func (rs *RemoteServer) Serve(handle func(cmd RemoteCommand) error) {
+	for {
+		conn, err := rs.listener.Accept()
+		if err != nil {
+			return
+		}
+		go rs.serveConn(conn, handle)
+	}
+}
+
+// serveConn reads commands from the given connection until it is closed, and replies to each of them
+func (rs *RemoteServer) serveConn(conn net.Conn, handle func(cmd RemoteCommand) error) {
+	defer conn.Close()
+	dec := json.NewDecoder(conn)
+	enc := json.NewEncoder(conn)
+	for {
+		var cmd RemoteCommand
+		if err := dec.Decode(&cmd); err != nil {
+			return
+		}
+		var reply RemoteReply
+		if err := handle(cmd); err != nil {
+			reply.Error = err.Error()
+		}
+		if err := enc.Encode(reply); err != nil {
+			return
+		}
+	}
+}
+
+// Close stops accepting commands and removes the remote control socket
+func (rs *RemoteServer) Close() error {
+	return rs.listener.Close()
+}
+
+// SendRemote sends the given commands to the session with the given remote control socket, one by one,
+// and stops at the first command that fails
+func SendRemote(socketPath string, cmds ...RemoteCommand) error {
+	conn, err := net.DialTimeout("unix", socketPath, remoteDialTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(remoteReplyTimeout))
+	enc := json.NewEncoder(conn)
+	dec := json.NewDecoder(conn)
+	for _, cmd := range cmds {
+		if err := enc.Encode(cmd); err != nil {
+			return err
+		}
+		var reply RemoteReply
+		if err := dec.Decode(&reply); err != nil {
+			return fmt.Errorf("no reply from the editor session: %w", err)
+		}
+		if reply.Error != "" {
+			return errors.New(reply.Error)
+		}
+	}
+	return nil
+}
+
+// remoteAlive checks if there is a session listening on the given remote control socket
+func remoteAlive(socketPath string) bool {
+	conn, err := net.DialTimeout("unix", socketPath, remoteDialTimeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// remoteSessions returns the remote control sockets of the running sessions, the most recently started first.
+// Sockets that are left over from sessions that did not end well are removed.
+func remoteSessions() []string {
+	matches, err := filepath.Glob(filepath.Join(remoteSocketDir, "*.sock"))
+	if err != nil {
+		return nil
+	}
+	modTimes := make(map[string]time.Time, len(matches))
+	var sockets []string
+	for _, socketPath := range matches {
+		fi, err := os.Stat(socketPath)
+		if err != nil {
+			continue
+		}
+		if !remoteAlive(socketPath) {
+			os.Remove(socketPath)
+			continue
+		}
+		modTimes[socketPath] = fi.ModTime()
+		sockets = append(sockets, socketPath)
+	}
+	sort.SliceStable(sockets, func(i, j int) bool {
+		return modTimes[sockets[i]].After(modTimes[sockets[j]])
+	})
+	return sockets
+}
+
+// RemoteOwner returns the remote control socket of the running session that has locked the given file,
+// if that session can be reached
+func RemoteOwner(lk *LockKeeper, absFilename string) (string, bool) {
+	lk.Load()
+	if socketPath := lk.Owner(absFilename); socketPath != "" && remoteAlive(socketPath) {
+		return socketPath, true
+	}
+	return "", false
+}
+
+// OpenRemote asks a running session to open the given file and go to the given line and column.
+// The session that has locked the file is used if there is one, and if not, the most recently started session.
+// Returns false if no session is running.
+func OpenRemote(lk *LockKeeper, filename string, lineNumber LineNumber, colNumber ColNumber) (bool, error) {
+	absFilename, err := filepath.Abs(filename)
+	if err != nil {
+		return false, err
+	}
+	absFilename = filepath.Clean(absFilename)
+	socketPath, found := RemoteOwner(lk, absFilename)
+	if !found {
+		sessions := remoteSessions()
+		if len(sessions) == 0 {
+			return false, nil
+		}
+		socketPath = sessions[0]
+	}
+	cmd := RemoteCommand{Command: remoteOpen, Filename: absFilename, Line: int(lineNumber), Col: int(colNumber)}
+	return true, SendRemote(socketPath, cmd)
+}
+
+// HandleRemoteCommand carries out a command from the remote control socket. It is called
+// from a background goroutine, with keyLoopMut locked, and redraws the editor afterwards.
+func (e *Editor) HandleRemoteCommand(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, cmd RemoteCommand) error {
+	switch cmd.Command {
+	case remoteOpen:
+		if strings.TrimSpace(cmd.Filename) == "" {
+			return errors.New("no filename given")
+		}
+	case remoteGotoLine:
+		if cmd.Line < 1 {
+			return errors.New("no line number given")
+		}
+	case remoteInsertText, remoteSave:
+	default:
+		return fmt.Errorf("unknown command: %s", cmd.Command)
+	}
+
+	if cmd.Filename != "" {
+		const offerRecovery = false
+		if err := e.switchTo(c, tty, status, fileLock, cmd.Filename, offerRecovery); err != nil {
+			return err
+		}
+		if b := bufferList.Current(); b != nil && !b.lockTimestamp.IsZero() {
+			if _, ok := recoverableSwapFile(b.absFilename, bufferLines(e.lines.Buffer)); ok {
+				remoteRecovery = b.absFilename
+				status.SetMessageAfterRedraw("Found unsaved changes to " + filepath.Base(b.absFilename) + ". Press any key to recover or discard them.")
+			}
+		}
+	}
+
+	var err error
+	switch cmd.Command {
+	case remoteOpen, remoteGotoLine:
+		if cmd.Line > 0 {
+			e.GoToLineNumberAndCol(LineNumber(cmd.Line), ColNumber(cmd.Col), c, status, true)
+		}
+	case remoteInsertText:
+		if e.readOnly {
+			err = errors.New(filepath.Base(e.filename) + " is read-only")
+			break
+		}
+		undo.Snapshot(e)
+		e.InsertText(c, status, cmd.Text)
+	case remoteSave:
+		if err = e.Save(c, tty); err == nil {
+			status.SetMessageAfterRedraw("Saved " + filepath.Base(e.filename))
+		}
+	}
+
+	e.redraw = true
+	e.redrawCursor = true
+	e.RedrawAtEndOfKeyLoop(c, status)
+	return err
+}
+
+// OfferRemoteRecovery offers to recover unsaved changes from a previous session, for a file that was opened
+// by a remote command. Returns true if the user was asked.
+func (e *Editor) OfferRemoteRecovery(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) bool {
+	absFilename := remoteRecovery
+	remoteRecovery = ""
+	if b := bufferList.Current(); absFilename == "" || b == nil || b.absFilename != absFilename {
+		return false
+	}
+	if _, ok := recoverableSwapFile(absFilename, bufferLines(e.lines.Buffer)); !ok {
+		return false
+	}
+	e.OfferSwapRecovery(c, tty, status, absFilename)
+	return true
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestRemoteServer(t *testing.T) {
+	oldSocketDir := remoteSocketDir
+	remoteSocketDir = filepath.Join(t.TempDir(), "o")
+	defer func() { remoteSocketDir = oldSocketDir }()
+
+	rs, err := ListenRemote()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		received []RemoteCommand
+		mut      sync.Mutex
+	)
+	go rs.Serve(func(cmd RemoteCommand) error {
+		mut.Lock()
+		defer mut.Unlock()
+		if cmd.Command == "fail" {
+			return errors.New("failed")
+		}
+		received = append(received, cmd)
+		return nil
+	})
+
+	if sessions := remoteSessions(); len(sessions) != 1 || sessions[0] != rs.SocketPath() {
+		t.Fatalf("expected one session, got %v", sessions)
+	}
+	err = SendRemote(rs.SocketPath(), RemoteCommand{Command: remoteGotoLine, Line: 3}, RemoteCommand{Command: remoteInsertText, Text: "hi\nthere"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SendRemote(rs.SocketPath(), RemoteCommand{Command: "fail"}, RemoteCommand{Command: remoteSave}); err == nil || err.Error() != "failed" {
+		t.Errorf("expected the error from the session, got %v", err)
+	}
+
+	// The session that has locked the file is asked to open it
+	lk := NewLockKeeper(filepath.Join(t.TempDir(), "lockfile.txt"))
+	lk.SetOwner(rs.SocketPath())
+	absFilename := filepath.Join(t.TempDir(), "main.go")
+	lk.Lock(absFilename)
+	lk.Save()
+	if found, err := OpenRemote(lk, absFilename, 42, 0); !found || err != nil {
+		t.Errorf("expected the file to be opened remotely, got %v, %v", found, err)
+	}
+
+	mut.Lock()
+	if len(received) != 3 || received[0].Line != 3 || received[1].Text != "hi\nthere" || received[2].Command != remoteOpen || received[2].Filename != absFilename || received[2].Line != 42 {
+		t.Errorf("unexpected commands: %+v", received)
+	}
+	mut.Unlock()
+
+	rs.Close()
+	if sessions := remoteSessions(); len(sessions) != 0 {
+		t.Errorf("expected no sessions after closing, got %v", sessions)
+	}
+	if found, _ := OpenRemote(lk, absFilename, 1, 1); found {
+		t.Error("expected no session to be found")
+	}
+}
+
+func TestLockKeeperOwner(t *testing.T) {
+	lockFilename := filepath.Join(t.TempDir(), "lockfile.txt")
+	lk := NewLockKeeper(lockFilename)
+	lk.SetOwner("/run/o/1.sock")
+	lk.Lock("/a.txt")
+	lk.Lock("/b.txt")
+	lk.Unlock("/b.txt")
+	lk.Move("/a.txt", "/c.txt")
+	if err := lk.Save(); err != nil {
+		t.Fatal(err)
+	}
+	lk2 := NewLockKeeper(lockFilename)
+	if err := lk2.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if owner := lk2.Owner("/c.txt"); owner != "/run/o/1.sock" {
+		t.Errorf("expected the owner to be kept, got %q", owner)
+	}
+	if lk2.Owner("/a.txt") != "" || lk2.Owner("/b.txt") != "" {
+		t.Error("expected no owner for moved and unlocked files")
+	}
+}
+
+func TestInsertText(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.lines = NewJournal(NewLineRope(runeLines([]string{"one", "two"})))
+	e.GoToLineNumberAndCol(2, 2, nil, nil, false)
+	e.InsertText(nil, nil, "X\r\nY")
+	if got := bufferLines(e.lines.Buffer); !equalStrings(got, []string{"one", "tX", "Ywo"}) {
+		t.Errorf("unexpected lines: %q", got)
+	}
+	if x, _ := e.DataX(); x != 1 || e.DataY() != 2 {
+		t.Errorf("expected the cursor to be after the inserted text, got %d, %d", x, e.DataY())
+	}
+	if !e.changed {
+		t.Error("expected the editor to be marked as changed")
+	}
+	e.InsertText(nil, nil, "Z\r")
+	if got := bufferLines(e.lines.Buffer); !equalStrings(got, []string{"one", "tX", "YZ", "wo"}) {
+		t.Errorf("expected a lone carriage return to split the line, got %q", got)
+	}
+	// The selected text is replaced
+	e.GoToLineNumberAndCol(1, 1, nil, nil, false)
+	e.StartSelection()
+	e.GoToLineNumberAndCol(2, 2, nil, nil, false)
+	e.InsertText(nil, nil, "1")
+	if got := bufferLines(e.lines.Buffer); !equalStrings(got, []string{"1X", "YZ", "wo"}) || e.HasSelection() {
+		t.Errorf("expected the selection to be replaced, got %q", got)
+	}
+	// The text is inserted at each cursor
+	e.GoToLineNumberAndCol(2, 1, nil, nil, false)
+	e.AddCursor(TextPosition{0, 2})
+	e.InsertText(nil, nil, "-")
+	if got := bufferLines(e.lines.Buffer); !equalStrings(got, []string{"1X", "-YZ", "-wo"}) {
+		t.Errorf("expected the text to be inserted at each cursor, got %q", got)
+	}
+}
@@ -16,3 +16,13 @@ var opinionatedStringReplacer = strings.NewReplacer(
 	// Replace any remaining \r characters with \n
 	string([]byte{'\r'}), string([]byte{'\n'}),
 )
+
+// opinionatedLineReplacer is a Replacer that can be used for fixing nonbreaking spaces and annoying tildes
+// when loading and saving files. Unlike opinionatedStringReplacer, \r is kept, since the line endings are
+// handled by detectLineEndings and joinLineEndings, and a \r within a line is a part of the contents.
+var opinionatedLineReplacer = strings.NewReplacer(
+	// Replace non-breaking space with regular space
+	string([]byte{0xc2, 0xa0}), string([]byte{0x20}),
+	// Fix annoying tilde
+	string([]byte{0xcc, 0x88}), string([]byte{'~'}),
+)
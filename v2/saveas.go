@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/xyproto/env/v2"
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt100"
+)
+
+// errMissingDirectory is returned by SaveAs if the directory of the new filename does not exist
+var errMissingDirectory = errors.New("the directory does not exist")
+
+// detectModeAgain detects the mode for the current filename, for when the file has been given a new name,
+// and sets up the indentation, syntax highlighting, configuration file and .editorconfig settings for the new mode
+func (e *Editor) detectModeAgain() {
+	m := mode.Detect(stripGZ(e.filename))
+	if m == mode.Blank || m == mode.Prolog || m == mode.Config {
+		firstLine := e.Line(0)
+		// The first 100 bytes are enough when trying to detect the contents
+		if len(firstLine) > 100 {
+			firstLine = firstLine[:100]
+		}
+		if m2, found := mode.DetectFromContents(m, firstLine, e.String); found {
+			m = m2
+		}
+	}
+	// The configuration files that apply may be different in the new location
+	e.config, _ = FindConfig(e.filename)
+	if m != e.mode {
+		e.mode = m
+		adjustSyntaxHighlightingKeywords(m)
+		e.indentation = e.config.Indentation(m, m.TabsSpaces())
+		e.useDetectedIndentation()
+		e.syntaxHighlight = !envNoColor && m != mode.Text && (m != mode.Blank || filepath.Ext(e.filename) != "")
+		switch m {
+		case mode.Blank, mode.Doc, mode.Email, mode.Markdown, mode.Text, mode.ReStructured:
+			e.rainbowParenthesis = false
+		default:
+			e.rainbowParenthesis = e.syntaxHighlight
+		}
+		e.rainbowParenthesis = e.config.RainbowParentheses(m, e.rainbowParenthesis) && e.syntaxHighlight
+		e.wrapWidth = e.config.WrapWidth(m, e.wrapWidth)
+	}
+	// The .editorconfig files that apply may be different in the new location too
+	changed := e.changed
+	e.editorConfig = FindEditorConfig(e.filename)
+	e.applyEditorConfig()
+	e.changed = changed
+	e.redraw = true
+}
+
+// SaveAs saves the current contents to a new file, which is then edited instead of the current file.
+// If rename is true, the current file is moved to the new filename instead of being left as it is.
+// The mode is detected again for the new filename, and the lock and the location history entry are moved to it.
+// Missing parent directories are created if createDirs is true, and otherwise errMissingDirectory is returned.
+func (e *Editor) SaveAs(c *vt100.Canvas, tty *vt100.TTY, lk *LockKeeper, newFilename string, rename, createDirs bool) error {
+	b := bufferList.Current()
+	if b == nil {
+		return errors.New("no file is being edited")
+	}
+	if rename && b.stdin {
+		return errors.New("can not rename data that was read from stdin")
+	}
+	newAbsFilename, err := filepath.Abs(newFilename)
+	if err != nil {
+		return err
+	}
+	newAbsFilename = filepath.Clean(newAbsFilename)
+	oldAbsFilename := b.absFilename
+	if newAbsFilename == oldAbsFilename && !b.stdin {
+		return e.Save(c, tty)
+	}
+	if bufferList.Index(newAbsFilename) >= 0 {
+		return errors.New(filepath.Base(newFilename) + " is already open")
+	}
+
+	// Create the missing parent directories, if asked to
+	if dir := filepath.Dir(newAbsFilename); !exists(dir) {
+		if !createDirs {
+			return errMissingDirectory
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+
+	// Move the lock to the new filename, or lock it if the current file was not locked by this session
+	lk.Load()
+	if b.lockTimestamp.IsZero() {
+		err = lk.Lock(newAbsFilename)
+	} else {
+		err = lk.Move(oldAbsFilename, newAbsFilename)
+	}
+	if err != nil {
+		return errors.New(filepath.Base(newFilename) + " is locked by another instance of this editor")
+	}
+	lk.Save()
+	undoLock := func() {
+		if b.lockTimestamp.IsZero() {
+			lk.Unlock(newAbsFilename)
+		} else {
+			lk.Move(newAbsFilename, oldAbsFilename)
+		}
+		lk.Save()
+	}
+
+	// Move the file first, so that it keeps its permissions, then save the current contents to it
+	renamed := false
+	if rename && exists(oldAbsFilename) {
+		renamed = os.Rename(oldAbsFilename, newAbsFilename) == nil
+	}
+	oldFilename := e.filename
+	e.filename = newFilename
+	e.detectModeAgain()
+	if err := e.Save(c, tty); err != nil {
+		if renamed {
+			os.Rename(newAbsFilename, oldAbsFilename)
+		}
+		e.filename = oldFilename
+		e.detectModeAgain()
+		undoLock()
+		return err
+	}
+	if rename && !renamed && exists(oldAbsFilename) {
+		// Moving the file was not possible, for instance because it was on another file system
+		os.Remove(oldAbsFilename)
+	}
+
+	// The old file is no longer being edited
+	swapWriter.Remove(oldAbsFilename)
+	fileWatcher.Unwatch(oldAbsFilename)
+	b.absFilename = newAbsFilename
+	b.lockTimestamp = lk.GetTimestamp(newAbsFilename)
+	b.stdin = false
+	e.readOnly = false
+
+	// Remember the location for the new filename, and forget the old filename if it was renamed
+	if rename {
+		delete(locationHistory, oldAbsFilename)
+	}
+	if locationHistory != nil {
+		e.SaveLocation(newAbsFilename, locationHistory)
+	}
+
+	fnord := FilenameOrData{newFilename, []byte{}, 0, false}
+	fnord.SetTitle()
+	e.redraw = true
+	e.redrawCursor = true
+	return nil
+}
+
+// SaveAsPrompt saves the current contents to a new file, or renames the current file if rename is true.
+// If the given filename is blank, the user is asked for one. The user is asked before an existing
+// file is overwritten, and before missing directories are created.
+func (e *Editor) SaveAsPrompt(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *LockKeeper, newFilename string, rename bool) {
+	title, verb := "Save as", "Saved as "
+	if rename {
+		title, verb = "Rename to", "Renamed to "
+	}
+	if strings.TrimSpace(newFilename) == "" {
+		var ok bool
+		newFilename, ok = e.UserInput(c, tty, status, title, []string{}, false)
+		if !ok || strings.TrimSpace(newFilename) == "" {
+			status.ClearAll(c)
+			return
+		}
+	}
+	newFilename = strings.TrimSpace(newFilename)
+	if strings.HasPrefix(newFilename, "~") {
+		newFilename = env.ExpandUser(newFilename)
+	}
+	menu := func(title string, choices ...string) int {
+		return e.Menu(status, tty, title, choices, e.Background, e.MenuTitleColor, e.MenuArrowColor, e.MenuTextColor, e.MenuHighlightColor, e.MenuSelectedColor, 0, false)
+	}
+
+	// Ask before overwriting another file
+	if absFilename, err := filepath.Abs(newFilename); err == nil && exists(absFilename) {
+		if b := bufferList.Current(); b == nil || b.stdin || filepath.Clean(absFilename) != b.absFilename {
+			if menu(filepath.Base(newFilename)+" already exists", "Overwrite "+filepath.Base(newFilename), "Cancel") != 0 {
+				e.redraw = true
+				return
+			}
+		}
+	}
+
+	err := e.SaveAs(c, tty, lk, newFilename, rename, false)
+	if errors.Is(err, errMissingDirectory) {
+		dir := filepath.Dir(newFilename)
+		if menu(dir+" does not exist", "Create "+dir+" and save", "Cancel") != 0 {
+			e.redraw = true
+			return
+		}
+		err = e.SaveAs(c, tty, lk, newFilename, rename, true)
+	}
+	status.ClearAll(c)
+	if err != nil {
+		status.SetError(fmt.Errorf("%s %s: %w", strings.ToLower(title), newFilename, err))
+		status.ShowNoTimeout(c, e)
+		return
+	}
+	status.SetMessageAfterRedraw(verb + newFilename)
+	e.redraw = true
+}
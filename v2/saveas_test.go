@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xyproto/mode"
+)
+
+func TestSaveAs(t *testing.T) {
+	defer func(bl *BufferList, u *Undo, noWrite bool) {
+		bufferList, undo, noWriteToCache = bl, u, noWrite
+	}(bufferList, undo, noWriteToCache)
+	bufferList = &BufferList{}
+	noWriteToCache = true
+
+	dir := t.TempDir()
+	oldFilename := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(oldFilename, []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	lk := NewLockKeeper(filepath.Join(dir, "lockfile.txt"))
+	lk.Lock(oldFilename)
+
+	e := NewSimpleEditor(80)
+	e.filename = oldFilename
+	e.SetLine(0, "package main")
+	e.SetLine(1, "")
+	e.SetLine(2, "func main() {}")
+	undo = NewUndo(10, 0)
+	bufferList.Add(&OpenBuffer{editor: e, undo: undo, absFilename: oldFilename, lockTimestamp: lk.GetTimestamp(oldFilename)})
+
+	newFilename := filepath.Join(dir, "cmd", "main.go")
+	if err := e.SaveAs(nil, nil, lk, newFilename, true, false); !errors.Is(err, errMissingDirectory) {
+		t.Fatalf("expected the missing directory to be reported, got %v", err)
+	}
+	if err := e.SaveAs(nil, nil, lk, newFilename, true, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, err := os.ReadFile(newFilename); err != nil || string(data) != "package main\n\nfunc main() {}\n" {
+		t.Errorf("unexpected contents of the new file: %q %v", data, err)
+	}
+	if exists(oldFilename) {
+		t.Error("expected the old file to be renamed")
+	}
+	if e.mode != mode.Go {
+		t.Errorf("expected the mode to be detected again, got %v", e.mode)
+	}
+	if b := bufferList.Current(); b.absFilename != newFilename || b.lockTimestamp.IsZero() {
+		t.Error("expected the buffer to be for the new file, and locked")
+	}
+	if !lk.GetTimestamp(oldFilename).IsZero() || lk.GetTimestamp(newFilename).IsZero() {
+		t.Error("expected the lock to be moved to the new file")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/xyproto/vt100"
 )
@@ -27,7 +28,7 @@ func (e *Editor) SetSearchTerm(c *vt100.Canvas, status *StatusBar, s string) boo
 	// Go to the first instance after the current line, if found
 	e.lineBeforeSearch = e.DataY()
 	for y := e.DataY(); y < LineIndex(e.Len()); y++ {
-		if strings.Contains(e.Line(y), s) {
+		if searchOptions.Contains(e.Line(y), s) {
 			// Found an instance, scroll there
 			// GoTo returns true if the screen should be redrawn
 			redraw, _ := e.GoTo(y, c, status)
@@ -96,14 +97,14 @@ func (e *Editor) forwardSearch(startIndex, stopIndex LineIndex) (int, LineIndex)
 			if x >= len(lineContents) {
 				continue
 			}
-			if strings.Contains(lineContents[x:], s) {
-				foundX = x + strings.Index(lineContents[x:], s)
+			if i := searchOptions.Index(lineContents, s, x); i >= 0 {
+				foundX = i
 				foundY = y
 				break
 			}
 		} else {
-			if strings.Contains(lineContents, s) {
-				foundX = strings.Index(lineContents, s)
+			if i := searchOptions.Index(lineContents, s, 0); i >= 0 {
+				foundX = i
 				foundY = y
 				break
 			}
@@ -140,14 +141,14 @@ func (e *Editor) backwardSearch(startIndex, stopIndex LineIndex) (int, LineIndex
 			if x >= len(lineContents) {
 				continue
 			}
-			if strings.Contains(lineContents[x:], s) {
-				foundX = x + strings.Index(lineContents[x:], s)
+			if i := searchOptions.Index(lineContents, s, x); i >= 0 {
+				foundX = i
 				foundY = y
 				break
 			}
 		} else {
-			if strings.Contains(lineContents, s) {
-				foundX = strings.Index(lineContents, s)
+			if i := searchOptions.Index(lineContents, s, 0); i >= 0 {
+				foundX = i
 				foundY = y
 				break
 			}
@@ -159,7 +160,7 @@ func (e *Editor) backwardSearch(startIndex, stopIndex LineIndex) (int, LineIndex
 // GoToNextMatch will go to the next match, searching for "e.SearchTerm()".
 // * The search wraps around if wrap is true.
 // * The search is backawards if forward is false.
-// * The search is case-sensitive.
+// * The search is case-sensitive, unless ignore case has been toggled on in the search prompt.
 // Returns an error if the search was successful but no match was found.
 func (e *Editor) GoToNextMatch(c *vt100.Canvas, status *StatusBar, wrap, forward bool) error {
 	var (
@@ -207,7 +208,10 @@ func (e *Editor) GoToNextMatch(c *vt100.Canvas, status *StatusBar, wrap, forward
 		return errNoSearchMatch
 	}
 
-	// Go to the found match
+	// Remember where the search started, if the match is on another line, and go to the found match
+	if foundY != e.DataY() {
+		e.RecordJump()
+	}
 	e.redraw, _ = e.GoTo(foundY, c, status)
 	if foundX != -1 {
 		tabs := strings.Count(e.Line(foundY), "\t")
@@ -226,13 +230,20 @@ func (e *Editor) GoToNextMatch(c *vt100.Canvas, status *StatusBar, wrap, forward
 // SearchMode will enter the interactive "search mode" where the user can type in a string and then press return to search
 func (e *Editor) SearchMode(c *vt100.Canvas, status *StatusBar, tty *vt100.TTY, clear bool, undo *Undo) {
 	var (
-		searchPrompt       = "Search:"
+		searchPrompt       = "Search"
 		previousSearch     string
 		key                string
 		initialLocation    = e.DataY().LineNumber()
 		searchHistoryIndex int
 	)
 
+	// If text is selected, only search and replace within the selection
+	selectionFrom, selectionTo, hasSelection := e.SelectionRange()
+	inSelection := ""
+	if hasSelection {
+		inSelection = ", in the selection"
+	}
+
 AGAIN:
 	doneCollectingLetters := false
 	pressedReturn := false
@@ -244,9 +255,9 @@ AGAIN:
 	s := e.SearchTerm()
 	status.ClearAll(c)
 	if s == "" {
-		status.SetMessage(searchPrompt)
+		status.SetMessage(searchOptions.Prompt(searchPrompt))
 	} else {
-		status.SetMessage(searchPrompt + " " + s)
+		status.SetMessage(searchOptions.Prompt(searchPrompt) + " " + s)
 	}
 	status.ShowNoTimeout(c, e)
 	for !doneCollectingLetters {
@@ -281,7 +292,7 @@ AGAIN:
 					e.SetSearchTerm(c, status, s)
 				}
 				e.GoToLineNumber(initialLocation, c, status, false)
-				status.SetMessage(searchPrompt + " " + s)
+				status.SetMessage(searchOptions.Prompt(searchPrompt) + " " + s)
 				status.ShowNoTimeout(c, e)
 			}
 		case "c:27", "c:17": // esc or ctrl-q
@@ -297,6 +308,28 @@ AGAIN:
 		case "c:13": // return
 			pressedReturn = true
 			doneCollectingLetters = true
+		case "c:18", "c:5", "c:23", "c:25": // ctrl-r, ctrl-e, ctrl-w or ctrl-y
+			switch key {
+			case "c:18": // ctrl-r, toggle regex search
+				searchOptions.Regex = !searchOptions.Regex
+			case "c:5": // ctrl-e, toggle case sensitivity
+				searchOptions.IgnoreCase = !searchOptions.IgnoreCase
+			case "c:23": // ctrl-w, toggle matching whole words only
+				searchOptions.WholeWord = !searchOptions.WholeWord
+			case "c:25": // ctrl-y, toggle confirming each replacement
+				searchOptions.ConfirmEach = !searchOptions.ConfirmEach
+			}
+			if previousSearch == "" {
+				// search again from the start, with the new search options
+				e.GoToLineNumber(initialLocation, c, status, false)
+				e.SetSearchTerm(c, status, s)
+			} else {
+				// highlight the matches of the search term with the new search options
+				e.DrawLines(c, true, false)
+			}
+			status.ClearAll(c)
+			status.SetMessage(searchOptions.Prompt(searchPrompt) + " " + s)
+			status.ShowNoTimeout(c, e)
 		case "↑": // previous in the search history
 			if len(searchHistory) == 0 {
 				break
@@ -310,7 +343,7 @@ AGAIN:
 			if previousSearch == "" {
 				e.SetSearchTerm(c, status, s)
 			}
-			status.SetMessage(searchPrompt + " " + s)
+			status.SetMessage(searchOptions.Prompt(searchPrompt) + " " + s)
 			status.ShowNoTimeout(c, e)
 		case "↓": // next in the search history
 			if len(searchHistory) == 0 {
@@ -325,7 +358,7 @@ AGAIN:
 			if previousSearch == "" {
 				e.SetSearchTerm(c, status, s)
 			}
-			status.SetMessage(searchPrompt + " " + s)
+			status.SetMessage(searchOptions.Prompt(searchPrompt) + " " + s)
 			status.ShowNoTimeout(c, e)
 		default:
 			if key != "" && !strings.HasPrefix(key, "c:") {
@@ -333,7 +366,7 @@ AGAIN:
 				if previousSearch == "" {
 					e.SetSearchTerm(c, status, s)
 				}
-				status.SetMessage(searchPrompt + " " + s)
+				status.SetMessage(searchOptions.Prompt(searchPrompt) + " " + s)
 				status.ShowNoTimeout(c, e)
 			}
 		}
@@ -353,19 +386,51 @@ AGAIN:
 		forward = false
 	}
 
+	// Check that the search term is a valid regular expression, if regex search is enabled
+	searchFor := s
+	if previousSearch != "" {
+		searchFor = previousSearch
+	}
+	if _, err := searchOptions.Compile(searchFor); err != nil && !searchOptions.Plain() && searchFor != "" {
+		e.SetSearchTerm(c, status, "")
+		status.SetError(err)
+		status.ShowNoTimeout(c, e)
+		return
+	}
+
 	if pressedTab && previousSearch == "" { // search text -> tab
 		// got the search text, now gather the replace text
 		previousSearch = e.searchTerm
-		searchPrompt = "Replace with:"
+		searchPrompt = "Replace with"
 		goto AGAIN
 	} else if pressedTab && previousSearch != "" { // search text -> tab -> replace text- > tab
-		undo.Snapshot(e)
 		// replace once
-		searchFor := previousSearch
 		replaceWith := s
-		replaced := strings.Replace(e.String(), searchFor, replaceWith, 1)
-		e.LoadBytes([]byte(replaced))
-		status.messageAfterRedraw = "Replaced " + searchFor + " with " + replaceWith + ", once"
+		var (
+			replaced string
+			count    int
+		)
+		if hasSelection {
+			// The lines are matched as a whole, and only a match within the selection is replaced
+			undo.Snapshot(e)
+			count = e.ReplaceInRange(searchFor, replaceWith, selectionFrom, selectionTo, 1)
+		} else if text := e.String(); searchOptions.Plain() {
+			replaced = strings.Replace(text, searchFor, replaceWith, 1)
+			if strings.Contains(text, searchFor) {
+				count = 1
+			}
+		} else {
+			replaced, count = searchOptions.Replace(text, searchFor, replaceWith, 1)
+		}
+		if count == 0 {
+			status.messageAfterRedraw = "No match for " + searchFor + inSelection
+		} else {
+			if !hasSelection {
+				undo.Snapshot(e)
+				e.LoadBytes([]byte(replaced))
+			}
+			status.messageAfterRedraw = "Replaced " + searchFor + " with " + replaceWith + ", once" + inSelection
+		}
 		// Save "searchFor" to the search history
 		if trimmedSearchString := strings.TrimSpace(searchFor); trimmedSearchString != "" {
 			if lastEntryIsNot(searchHistory, trimmedSearchString) {
@@ -386,24 +451,53 @@ AGAIN:
 		searchForBytes := []byte(previousSearch)
 		replaceWithBytes := []byte(s)
 		// check if we're searching and replacing an unicode character, like "U+0047" or "u+0000"
-		if r, err := runeFromUBytes(searchForBytes); err == nil { // success
-			searchForBytes = []byte(string(r))
-		}
-		if r, err := runeFromUBytes(replaceWithBytes); err == nil { // success
-			replaceWithBytes = []byte(string(r))
+		if !searchOptions.Regex {
+			if r, err := runeFromUBytes(searchForBytes); err == nil { // success
+				searchForBytes = []byte(string(r))
+			}
+			if r, err := runeFromUBytes(replaceWithBytes); err == nil { // success
+				replaceWithBytes = []byte(string(r))
+			}
 		}
-		// perform the replacements, and count the number of instances
-		allBytes := []byte(e.String())
-		instanceCount := bytes.Count(allBytes, searchForBytes)
-		allReplaced := bytes.ReplaceAll(allBytes, searchForBytes, replaceWithBytes)
-		// replace the contents
-		e.LoadBytes(allReplaced)
-		// build a status message
-		extraS := ""
-		if instanceCount != 1 {
-			extraS = "s"
+		if searchOptions.ConfirmEach {
+			// ask before replacing each instance
+			from, to := selectionFrom, selectionTo
+			if !hasSelection {
+				lastIndex := LineIndex(e.Len() - 1)
+				from, to = TextPosition{0, 0}, TextPosition{utf8.RuneCountInString(e.Line(lastIndex)), lastIndex}
+			}
+			replacedCount, instanceCount := e.ReplaceEach(c, tty, status, string(searchForBytes), string(replaceWithBytes), from, to)
+			extraS := ""
+			if instanceCount != 1 {
+				extraS = "s"
+			}
+			status.messageAfterRedraw = fmt.Sprintf("Replaced %d of %d instance%s of %s with %s%s", replacedCount, instanceCount, extraS, previousSearch, s, inSelection)
+		} else {
+			// perform the replacements, and count the number of instances
+			var instanceCount int
+			if hasSelection {
+				// The lines are matched as a whole, and only the matches within the selection are replaced
+				instanceCount = e.ReplaceInRange(string(searchForBytes), string(replaceWithBytes), selectionFrom, selectionTo, -1)
+			} else {
+				allBytes := []byte(e.String())
+				var allReplaced []byte
+				if searchOptions.Plain() {
+					instanceCount = bytes.Count(allBytes, searchForBytes)
+					allReplaced = bytes.ReplaceAll(allBytes, searchForBytes, replaceWithBytes)
+				} else {
+					replaced, n := searchOptions.Replace(string(allBytes), string(searchForBytes), string(replaceWithBytes), -1)
+					instanceCount, allReplaced = n, []byte(replaced)
+				}
+				// replace the contents
+				e.LoadBytes(allReplaced)
+			}
+			// build a status message
+			extraS := ""
+			if instanceCount != 1 {
+				extraS = "s"
+			}
+			status.messageAfterRedraw = fmt.Sprintf("Replaced %d instance%s of %s with %s%s", instanceCount, extraS, previousSearch, s, inSelection)
 		}
-		status.messageAfterRedraw = fmt.Sprintf("Replaced %d instance%s of %s with %s", instanceCount, extraS, previousSearch, s)
 		// Save "searchFor" to the search history
 		if trimmedSearchString := strings.TrimSpace(string(searchForBytes)); trimmedSearchString != "" {
 			if lastEntryIsNot(searchHistory, trimmedSearchString) {
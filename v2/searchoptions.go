@@ -0,0 +1,366 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/xyproto/vt100"
+)
+
+// SearchOptions are the flags that can be toggled in the search prompt, and that change how the search term is matched
+type SearchOptions struct {
+	Regex       bool // the search term is a Go regular expression, and the replacement text can refer to groups with $1
+	IgnoreCase  bool // the search is not case sensitive
+	WholeWord   bool // only match whole words, that are not preceded or followed by a letter, digit or underscore
+	ConfirmEach bool // ask before replacing each match, when replacing all matches
+}
+
+// compiledSearch is the last search term that was compiled to a regular expression
+type compiledSearch struct {
+	term    string
+	options SearchOptions
+	re      *regexp.Regexp
+	err     error
+}
+
+var (
+	searchOptions      SearchOptions // the search options are kept when switching between files
+	lastCompiledSearch compiledSearch
+)
+
+// Plain checks if the search term is matched as a plain, case sensitive string
+func (o SearchOptions) Plain() bool {
+	return !o.Regex && !o.IgnoreCase && !o.WholeWord
+}
+
+// String returns a comma separated list of the active flags, or an empty string
+func (o SearchOptions) String() string {
+	var flags []string
+	if o.Regex {
+		flags = append(flags, "regex")
+	}
+	if o.IgnoreCase {
+		flags = append(flags, "ignore case")
+	}
+	if o.WholeWord {
+		flags = append(flags, "whole word")
+	}
+	if o.ConfirmEach {
+		flags = append(flags, "confirm each")
+	}
+	return strings.Join(flags, ", ")
+}
+
+// Prompt returns the given prompt, with the active flags in brackets before the colon
+func (o SearchOptions) Prompt(prompt string) string {
+	if flags := o.String(); flags != "" {
+		return prompt + " [" + flags + "]:"
+	}
+	return prompt + ":"
+}
+
+// Compile returns a regular expression that matches the given search term, according to the search options
+func (o SearchOptions) Compile(term string) (*regexp.Regexp, error) {
+	c := lastCompiledSearch
+	if c.term == term && c.options == o && (c.re != nil || c.err != nil) {
+		return c.re, c.err
+	}
+	pattern := term
+	if !o.Regex {
+		pattern = regexp.QuoteMeta(term)
+	}
+	if o.IgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		err = fmt.Errorf("invalid regular expression: %s", strings.TrimPrefix(err.Error(), "error parsing regexp: "))
+	}
+	lastCompiledSearch = compiledSearch{term, o, re, err}
+	return re, err
+}
+
+// isWordRune checks if the given rune can be a part of a word, in any language
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// wholeWord checks if the given match in the given line is not preceded or followed by a letter, digit or underscore
+func wholeWord(line string, match []int) bool {
+	if before, _ := utf8.DecodeLastRuneInString(line[:match[0]]); match[0] > 0 && isWordRune(before) {
+		return false
+	}
+	if after, _ := utf8.DecodeRuneInString(line[match[1]:]); match[1] < len(line) && isWordRune(after) {
+		return false
+	}
+	return true
+}
+
+// findAll returns the start and end byte index of each match of the given regular expression in the given line,
+// followed by the start and end of each group, as for regexp.FindAllStringSubmatchIndex.
+// If only whole words should be matched, the other matches are left out.
+func (o SearchOptions) findAll(re *regexp.Regexp, line string) [][]int {
+	matches := re.FindAllStringSubmatchIndex(line, -1)
+	if !o.WholeWord {
+		return matches
+	}
+	wholeWords := matches[:0]
+	for _, m := range matches {
+		if wholeWord(line, m) {
+			wholeWords = append(wholeWords, m)
+		}
+	}
+	return wholeWords
+}
+
+// FindAll returns the start and end byte index of each match of the search term in the given line.
+// An invalid regular expression matches nothing.
+func (o SearchOptions) FindAll(line, term string) [][]int {
+	if term == "" {
+		return nil
+	}
+	if o.Plain() {
+		var matches [][]int
+		for offset := 0; ; {
+			i := strings.Index(line[offset:], term)
+			if i < 0 {
+				break
+			}
+			matches = append(matches, []int{offset + i, offset + i + len(term)})
+			offset += i + len(term)
+		}
+		return matches
+	}
+	re, err := o.Compile(term)
+	if err != nil {
+		return nil
+	}
+	return o.findAll(re, line)
+}
+
+// Index returns the byte index of the first match of the search term in the given line,
+// that starts at or after the given byte index. Returns -1 if there is none.
+func (o SearchOptions) Index(line, term string, from int) int {
+	if o.Plain() {
+		if from > len(line) {
+			return -1
+		}
+		if i := strings.Index(line[from:], term); i >= 0 {
+			return from + i
+		}
+		return -1
+	}
+	// The whole line is matched, so that ^, $ and \b work as expected when starting in the middle of the line
+	for _, m := range o.FindAll(line, term) {
+		if m[0] >= from {
+			return m[0]
+		}
+	}
+	return -1
+}
+
+// Contains checks if the search term matches the given line
+func (o SearchOptions) Contains(line, term string) bool {
+	if o.Plain() {
+		return strings.Contains(line, term)
+	}
+	return o.Index(line, term, 0) >= 0
+}
+
+// expand returns the replacement text for the given match, where $1 and ${name} refer to the groups
+// of the regular expression, if the search is a regex search
+func (o SearchOptions) expand(re *regexp.Regexp, replacement, line string, match []int) string {
+	if !o.Regex {
+		return replacement
+	}
+	return string(re.ExpandString(nil, replacement, line, match))
+}
+
+// Replace replaces the first n matches of the search term in the given text, or all of them if n is negative.
+// The text is matched one line at a time. Returns the new text and the number of replacements.
+func (o SearchOptions) Replace(text, term, replacement string, n int) (string, int) {
+	re, err := o.Compile(term)
+	if err != nil || term == "" {
+		return text, 0
+	}
+	count := 0
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if n >= 0 && count >= n {
+			break
+		}
+		var (
+			sb      strings.Builder
+			last    int
+			matched bool
+		)
+		for _, m := range o.findAll(re, line) {
+			if n >= 0 && count >= n {
+				break
+			}
+			sb.WriteString(line[last:m[0]])
+			sb.WriteString(o.expand(re, replacement, line, m))
+			last = m[1]
+			matched = true
+			count++
+		}
+		if matched {
+			sb.WriteString(line[last:])
+			lines[i] = sb.String()
+		}
+	}
+	return strings.Join(lines, "\n"), count
+}
+
+// searchMatchRunes returns the rune index and rune count of each match of the search term in the given runes,
+// for highlighting the matches
+func (e *Editor) searchMatchRunes(runes []rune) map[int]int {
+	line := string(runes)
+	matches := searchOptions.FindAll(line, e.searchTerm)
+	if len(matches) == 0 {
+		return nil
+	}
+	found := make(map[int]int, len(matches))
+	for _, m := range matches {
+		start := utf8.RuneCountInString(line[:m[0]])
+		found[start] = utf8.RuneCountInString(line[m[0]:m[1]])
+	}
+	return found
+}
+
+// ReplaceInRange replaces the first n matches of the search term from the given position up to the given position,
+// or all of them if n is negative. Each line is matched as a whole, so that ^, $ and whole words work as expected
+// when the range starts or ends in the middle of a line, and only the matches that are within the range are replaced.
+// Returns the number of replacements.
+func (e *Editor) ReplaceInRange(term, replacement string, from, to TextPosition, n int) int {
+	re, err := searchOptions.Compile(term)
+	if err != nil || term == "" {
+		return 0
+	}
+	count := 0
+	for y := from.y; y <= to.y && y < LineIndex(e.Len()); y++ {
+		if n >= 0 && count >= n {
+			break
+		}
+		line := e.Line(y)
+		// matches must start at or after start, and end at or before end
+		start, end := 0, len(line)
+		if y == from.y {
+			start = byteOffset(line, from.x)
+		}
+		if y == to.y {
+			end = byteOffset(line, to.x)
+		}
+		var (
+			sb      strings.Builder
+			last    int
+			matched bool
+		)
+		for _, m := range searchOptions.findAll(re, line) {
+			if m[0] < start {
+				continue
+			}
+			if m[1] > end || (n >= 0 && count >= n) {
+				break
+			}
+			sb.WriteString(line[last:m[0]])
+			sb.WriteString(searchOptions.expand(re, replacement, line, m))
+			last = m[1]
+			matched = true
+			count++
+		}
+		if matched {
+			sb.WriteString(line[last:])
+			e.SetLine(y, sb.String())
+		}
+	}
+	return count
+}
+
+// ReplaceEach goes through the matches of the search term, from the given position up to the given position,
+// and asks the user if each one should be replaced. Returns the number of replacements and the number of matches
+// that were seen. Pressing "a" replaces the rest of the matches without asking, while "q" or esc stops.
+func (e *Editor) ReplaceEach(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, term, replacement string, from, to TextPosition) (int, int) {
+	re, err := searchOptions.Compile(term)
+	if err != nil || term == "" {
+		return 0, 0
+	}
+	var (
+		replaced, seen int
+		all            bool
+	)
+	// The search term is highlighted while asking
+	previousSearchTerm := e.searchTerm
+	e.searchTerm = term
+	defer func() {
+		e.searchTerm = previousSearchTerm
+	}()
+	for y := from.y; y <= to.y && y < LineIndex(e.Len()); y++ {
+		// The matches are found once per line, in the line as it was before any replacements were made
+		original := e.Line(y)
+		// matches must start at or after start, and end at or before the given number of bytes from the end of the line
+		start, fromEnd := 0, 0
+		if y == from.y {
+			start = byteOffset(original, from.x)
+		}
+		if y == to.y {
+			fromEnd = len(original) - byteOffset(original, to.x)
+		}
+		line := original
+		delta := 0 // how much longer the line has become because of the replacements so far
+		for _, match := range searchOptions.findAll(re, original) {
+			if match[0] < start {
+				continue
+			}
+			if match[1] > len(original)-fromEnd {
+				break
+			}
+			seen++
+			expanded := searchOptions.expand(re, replacement, original, match)
+			replaceThis := all
+			if !all {
+				e.GoToTextPosition(c, status, TextPosition{utf8.RuneCountInString(line[:match[0]+delta]), y})
+				e.Center(c)
+				e.DrawLines(c, true, false)
+				status.ClearAll(c)
+				status.SetMessage(fmt.Sprintf("Replace %s with %s? (y)es, (n)o, (a)ll or (q)uit", original[match[0]:match[1]], expanded))
+				status.ShowNoTimeout(c, e)
+				e.RepositionCursorIfNeeded()
+				switch tty.String() {
+				case "y", "Y", "c:13": // yes or return
+					replaceThis = true
+				case "a", "A", "!":
+					replaceThis = true
+					all = true
+				case "q", "Q", "c:27", "c:17": // quit, esc or ctrl-q
+					status.ClearAll(c)
+					return replaced, seen
+				}
+			}
+			if !replaceThis {
+				continue
+			}
+			line = line[:match[0]+delta] + expanded + line[match[1]+delta:]
+			delta += len(expanded) - (match[1] - match[0])
+			e.SetLine(y, line)
+			replaced++
+		}
+	}
+	status.ClearAll(c)
+	return replaced, seen
+}
+
+// byteOffset returns the byte index of the given rune index in the given line,
+// or the length of the line if the rune index is past the end of it
+func byteOffset(line string, runeIndex int) int {
+	for i := range line {
+		if runeIndex == 0 {
+			return i
+		}
+		runeIndex--
+	}
+	return len(line)
+}
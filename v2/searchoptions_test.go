@@ -0,0 +1,120 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSearchOptionsFind(t *testing.T) {
+	const line = "Foo(foo, food) // FOO"
+	if got := (SearchOptions{}).FindAll(line, "foo"); len(got) != 2 || got[0][0] != 4 || got[1][0] != 9 {
+		t.Errorf("unexpected plain matches: %v", got)
+	}
+	if got := (SearchOptions{IgnoreCase: true}).FindAll(line, "foo"); len(got) != 4 {
+		t.Errorf("expected four matches when ignoring the case, got %v", got)
+	}
+	if got := (SearchOptions{IgnoreCase: true, WholeWord: true}).FindAll(line, "foo"); len(got) != 3 || got[2][0] != 18 {
+		t.Errorf("expected three whole word matches, got %v", got)
+	}
+	// Letters that are not ASCII are also a part of words
+	if got := (SearchOptions{WholeWord: true}).FindAll("østers og østersen, blåbærsyltetøy", "østers"); len(got) != 1 || got[0][0] != 0 {
+		t.Errorf("expected one whole word match for a word that is not ASCII, got %v", got)
+	}
+	if got := (SearchOptions{WholeWord: true, Regex: true}).FindAll("blåbær_syltetøy tøy 1tøy", "t.y"); len(got) != 1 || got[0][0] != len("blåbær_syltetøy ") {
+		t.Errorf("expected matches within words to be left out, got %v", got)
+	}
+	if got := (SearchOptions{WholeWord: true}).FindAll("a.b a.bc", "a.b"); len(got) != 1 {
+		t.Errorf("expected the search term to be matched literally, got %v", got)
+	}
+	regex := SearchOptions{Regex: true}
+	if i := regex.Index(line, `^\w+`, 1); i != -1 {
+		t.Errorf("expected ^ to only match at the start of the line, got %d", i)
+	}
+	if i := regex.Index(line, `fo+d?\b`, 5); i != 9 {
+		t.Errorf("expected a match at byte index 9, got %d", i)
+	}
+	if _, err := regex.Compile("foo("); err == nil || regex.Contains(line, "foo(") {
+		t.Error("expected an invalid regular expression to give an error and to match nothing")
+	}
+	if !(SearchOptions{}).Contains(line, "Foo(") {
+		t.Error("expected a plain search to match the parenthesis")
+	}
+}
+
+func TestSearchOptionsReplace(t *testing.T) {
+	const text = "a := f(x)\nb := f(y)\nf(z)"
+	regex := SearchOptions{Regex: true}
+	if got, n := regex.Replace(text, `f\((\w)\)`, "g($1, ${1}2)", -1); n != 3 || got != "a := g(x, x2)\nb := g(y, y2)\ng(z, z2)" {
+		t.Errorf("unexpected replacement: %q, %d", got, n)
+	}
+	if got, n := regex.Replace(text, `^(\w) :=`, "var $1 =", 1); n != 1 || got != "var a = f(x)\nb := f(y)\nf(z)" {
+		t.Errorf("expected only the first match to be replaced, got %q, %d", got, n)
+	}
+	if got, n := (SearchOptions{IgnoreCase: true}).Replace("Price: $1, PRICE: $2", "price", "$cost", -1); n != 2 || got != "$cost: $1, $cost: $2" {
+		t.Errorf("expected the replacement to be literal when not using regex search, got %q, %d", got, n)
+	}
+	if got, n := (SearchOptions{WholeWord: true}).Replace("østersen", "østers", "skjell", 1); n != 0 || got != "østersen" {
+		t.Errorf("expected nothing to be replaced within a word, got %q, %d", got, n)
+	}
+	if got, n := regex.Replace(text, "(", "", -1); n != 0 || got != text {
+		t.Errorf("expected an invalid regular expression to replace nothing, got %q, %d", got, n)
+	}
+}
+
+func TestReplaceInRange(t *testing.T) {
+	defer func(o SearchOptions) {
+		searchOptions = o
+	}(searchOptions)
+
+	e := NewSimpleEditor(80)
+	e.SetLine(0, "foo foo")
+	e.SetLine(1, "foo foobar foo")
+	e.SetLine(2, "foo foo")
+
+	// The selection starts in the middle of a line, so ^ must not match there
+	searchOptions = SearchOptions{Regex: true}
+	if n := e.ReplaceInRange("^foo", "x", TextPosition{4, 0}, TextPosition{2, 2}, -1); n != 1 {
+		t.Errorf("expected one replacement, got %d", n)
+	}
+	if got := e.String(); got != "foo foo\nx foobar foo\nfoo foo\n" {
+		t.Errorf("unexpected contents: %q", got)
+	}
+
+	// A match that is only partly within the selection is not a whole word, nor within the selection
+	searchOptions = SearchOptions{WholeWord: true}
+	if n := e.ReplaceInRange("foo", "y", TextPosition{2, 1}, TextPosition{2, 2}, -1); n != 1 {
+		t.Errorf("expected one replacement, got %d", n)
+	}
+	if got := e.String(); got != "foo foo\nx foobar y\nfoo foo\n" {
+		t.Errorf("unexpected contents: %q", got)
+	}
+
+	// Only the first match within the selection is replaced, when replacing once
+	searchOptions = SearchOptions{}
+	if n := e.ReplaceInRange("foo", "z", TextPosition{1, 0}, TextPosition{7, 2}, 1); n != 1 {
+		t.Errorf("expected one replacement, got %d", n)
+	}
+	if got := e.String(); got != "foo z\nx foobar y\nfoo foo\n" {
+		t.Errorf("unexpected contents: %q", got)
+	}
+}
+
+func TestSearchOptionsPrompt(t *testing.T) {
+	if got := (SearchOptions{}).Prompt("Search"); got != "Search:" {
+		t.Errorf("unexpected prompt: %q", got)
+	}
+	if got := (SearchOptions{Regex: true, WholeWord: true, ConfirmEach: true}).Prompt("Replace with"); got != "Replace with [regex, whole word, confirm each]:" {
+		t.Errorf("unexpected prompt: %q", got)
+	}
+}
+
+func TestSearchMatchRunes(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.searchTerm = "ø+"
+	defer func(o SearchOptions) {
+		searchOptions = o
+	}(searchOptions)
+	searchOptions = SearchOptions{Regex: true}
+	if got := e.searchMatchRunes([]rune("blåbærsyltetøy, øø")); len(got) != 2 || got[12] != 1 || got[16] != 2 {
+		t.Errorf("unexpected rune indices and lengths: %v", got)
+	}
+}
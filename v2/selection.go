@@ -0,0 +1,296 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/xyproto/vt100"
+)
+
+// TextPosition is a position in the document, given as a rune index and a line index.
+// Unlike Position, it does not depend on tab expansion or on how far the view has scrolled.
+type TextPosition struct {
+	x int       // the rune index within the line
+	y LineIndex // the line index
+}
+
+// Before checks if this position comes before the given position in the document
+func (p TextPosition) Before(other TextPosition) bool {
+	return p.y < other.y || (p.y == other.y && p.x < other.x)
+}
+
+// CursorTextPosition returns the current cursor position, as a TextPosition
+func (e *Editor) CursorTextPosition() TextPosition {
+	// If the cursor is after the end of the line, x is the length of the line
+	x, _ := e.DataX()
+	return TextPosition{x, e.DataY()}
+}
+
+// ScreenColumn returns the screen column for the given rune index on the given line, with tabs expanded
+func (e *Editor) ScreenColumn(x int, y LineIndex) int {
+	line, _ := e.lines.Line(int(y))
+	column := 0
+	for i, r := range line {
+		if i >= x {
+			break
+		}
+		if r == '\t' {
+			column += e.indentation.PerTab
+		} else {
+			column++
+		}
+	}
+	if x > len(line) {
+		column += x - len(line)
+	}
+	return column
+}
+
+// GoToTextPosition moves the cursor to the given position in the document
+func (e *Editor) GoToTextPosition(c *vt100.Canvas, status *StatusBar, p TextPosition) {
+	e.redraw, _ = e.GoTo(p.y, c, status)
+	e.pos.SetX(c, e.ScreenColumn(p.x, p.y))
+	e.SaveX(true)
+	e.redrawCursor = true
+}
+
+// TextRange returns the text from one position in the document up to (but not including) another position
+func (e *Editor) TextRange(from, to TextPosition) string {
+	var sb strings.Builder
+	for y := from.y; y <= to.y; y++ {
+		line, _ := e.lines.Line(int(y))
+		start, end := 0, len(line)
+		if y == from.y && from.x < end {
+			start = from.x
+		} else if y == from.y {
+			start = end
+		}
+		if y == to.y && to.x < end {
+			end = to.x
+		}
+		if start < end {
+			sb.WriteString(string(line[start:end]))
+		}
+		if y < to.y {
+			sb.WriteRune('\n')
+		}
+	}
+	return sb.String()
+}
+
+// ReplaceRange replaces the text from one position in the document up to (but not including) another position
+// with the given string, which may contain newlines. The bookmark is moved if lines before it are removed.
+// Returns the position right after the inserted text.
+func (e *Editor) ReplaceRange(from, to TextPosition, s string, bookmark *Position) TextPosition {
+	firstLine, _ := e.lines.Line(int(from.y))
+	lastLine, _ := e.lines.Line(int(to.y))
+	if from.x > len(firstLine) {
+		from.x = len(firstLine)
+	}
+	if to.x > len(lastLine) {
+		to.x = len(lastLine)
+	}
+	prefix := firstLine[:from.x:from.x]
+	suffix := lastLine[to.x:]
+
+	// Remove the lines after the first one that are part of the range
+	for y := to.y; y > from.y; y-- {
+		e.DeleteLineMoveBookmark(from.y+1, bookmark)
+	}
+
+	// Then insert the new lines, where the first one is joined with the prefix and the last one with the suffix
+	newLines := strings.Split(s, "\n")
+	lastIndex := len(newLines) - 1
+	var end TextPosition
+	for i, newLine := range newLines {
+		runes := []rune(newLine)
+		if i == 0 {
+			runes = append(prefix, runes...)
+		}
+		if i == lastIndex {
+			end = TextPosition{len(runes), from.y + LineIndex(i)}
+			runes = append(runes[:len(runes):len(runes)], suffix...)
+		}
+		if i == 0 {
+			e.lines.SetLine(int(from.y), runes)
+		} else {
+			e.lines.InsertLine(int(from.y)+i, runes)
+		}
+	}
+	e.changed = true
+	return end
+}
+
+// StartSelection starts selecting text at the current cursor position, unless a selection has already been started.
+// If a rectangle is being selected, the selection is turned into a regular selection.
+func (e *Editor) StartSelection() {
+	if e.selectionAnchor == nil {
+		p := e.CursorTextPosition()
+		e.selectionAnchor = &p
+	} else if e.columnSelection {
+		line, _ := e.lines.Line(int(e.selectionAnchor.y))
+		e.selectionAnchor.x, _ = e.columnIndex(line, e.selectionAnchor.x)
+	}
+	e.columnSelection = false
+}
+
+// ClearSelection forgets the current selection, if any. Returns true if there was one.
+func (e *Editor) ClearSelection() bool {
+	hadSelection := e.selectionAnchor != nil
+	e.selectionAnchor = nil
+	e.columnSelection = false
+	return hadSelection
+}
+
+// SelectionRange returns the start and end of the text that is selected, from the anchor to the cursor,
+// with the first position first. Returns false if no text is selected.
+// If a rectangle is selected, the range covers all the lines that the rectangle is on.
+func (e *Editor) SelectionRange() (TextPosition, TextPosition, bool) {
+	if e.selectionAnchor == nil {
+		return TextPosition{}, TextPosition{}, false
+	}
+	if e.columnSelection {
+		fromY, toY, _, _, ok := e.SelectionRectangle()
+		line, _ := e.lines.Line(int(toY))
+		return TextPosition{0, fromY}, TextPosition{len(line), toY}, ok
+	}
+	from, to := *e.selectionAnchor, e.CursorTextPosition()
+	if to.Before(from) {
+		from, to = to, from
+	}
+	return from, to, from != to
+}
+
+// HasSelection checks if any text is selected
+func (e *Editor) HasSelection() bool {
+	_, _, ok := e.SelectionRange()
+	return ok
+}
+
+// SelectedText returns the text that is selected, or an empty string
+func (e *Editor) SelectedText() string {
+	from, to, ok := e.SelectionRange()
+	if !ok {
+		return ""
+	}
+	return e.TextRange(from, to)
+}
+
+// SelectedLines returns the first and last line index of the lines that are part of the selection.
+// If the selection ends at the very start of a line, that line is not included.
+func (e *Editor) SelectedLines() (LineIndex, LineIndex, bool) {
+	from, to, ok := e.SelectionRange()
+	if !ok {
+		return 0, 0, false
+	}
+	if to.x == 0 && to.y > from.y {
+		to.y--
+	}
+	return from.y, to.y, true
+}
+
+// ReplaceSelection replaces the selected text with the given string, and places the cursor after the new text
+func (e *Editor) ReplaceSelection(c *vt100.Canvas, status *StatusBar, bookmark *Position, s string) {
+	from, to, ok := e.SelectionRange()
+	if !ok {
+		return
+	}
+	end := e.ReplaceRange(from, to, s, bookmark)
+	e.ClearSelection()
+	e.GoToTextPosition(c, status, end)
+	e.redraw = true
+}
+
+// DeleteSelection removes the selected text, and places the cursor where the selection started
+func (e *Editor) DeleteSelection(c *vt100.Canvas, status *StatusBar, bookmark *Position) {
+	e.ReplaceSelection(c, status, bookmark, "")
+}
+
+// ToggleCommentSelection toggles comments for the selected lines. If most of the lines are commented out,
+// the comments are removed, if not, the lines are commented out.
+func (e *Editor) ToggleCommentSelection() {
+	fromY, toY, ok := e.SelectedLines()
+	if !ok {
+		return
+	}
+	commentMarker := e.SingleLineCommentMarker()
+	lineCount, commentCounter := 0, 0
+	for y := fromY; y <= toY; y++ {
+		if e.TrimmedLineAt(y) == "" {
+			continue
+		}
+		lineCount++
+		if strings.HasPrefix(e.TrimmedLineAt(y), commentMarker) {
+			commentCounter++
+		}
+	}
+	mostLinesAreComments := lineCount > 0 && commentCounter*2 >= lineCount
+	for y := fromY; y <= toY; y++ {
+		line := e.Line(y)
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if mostLinesAreComments {
+			if newLine, changed := e.uncommented(line, commentMarker); changed {
+				e.SetLine(y, newLine)
+			}
+		} else {
+			e.SetLine(y, e.commented(line, commentMarker))
+		}
+	}
+	// If a line was shortened and the cursor ended up after the line, move it
+	if e.AfterEndOfLine() {
+		e.End(nil)
+	}
+}
+
+// SortSelection sorts the selected lines
+func (e *Editor) SortSelection(c *vt100.Canvas, status *StatusBar) {
+	fromY, toY, ok := e.SelectedLines()
+	if !ok {
+		status.SetErrorMessage("no lines are selected")
+		return
+	}
+	var lines sort.StringSlice
+	for y := fromY; y <= toY; y++ {
+		lines = append(lines, e.Line(y))
+	}
+	lines.Sort()
+	for i, line := range lines {
+		e.SetLine(fromY+LineIndex(i), line)
+	}
+	e.ClearSelection()
+	e.GoTo(fromY, c, status)
+}
+
+// selectedColumns returns the first screen column that is selected on the given line, and the screen column
+// right after the last one, given the start and end of the selection. The newline at the end of a line is
+// shown as one selected column after the line. Returns false if nothing is selected on this line.
+func (e *Editor) selectedColumns(y LineIndex, from, to TextPosition) (int, int, bool) {
+	if e.columnSelection {
+		fromY, toY, fromCol, toCol, ok := e.SelectionRectangle()
+		if !ok || y < fromY || y > toY {
+			return 0, 0, false
+		}
+		if fromCol == toCol {
+			// Show an empty rectangle as one column
+			toCol++
+		}
+		return fromCol, toCol, true
+	}
+	if y < from.y || y > to.y || (y == to.y && to.x == 0 && y > from.y) {
+		return 0, 0, false
+	}
+	start := 0
+	if y == from.y {
+		start = e.ScreenColumn(from.x, y)
+	}
+	var end int
+	if y == to.y {
+		end = e.ScreenColumn(to.x, y)
+	} else {
+		line, _ := e.lines.Line(int(y))
+		end = e.ScreenColumn(len(line), y) + 1
+	}
+	return start, end, start < end
+}
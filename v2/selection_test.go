@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+)
+
+func newSelectionTestEditor() *Editor {
+	e := NewSimpleEditor(80)
+	e.SetLine(0, "one two")
+	e.SetLine(1, "three")
+	e.SetLine(2, "four five")
+	return e
+}
+
+func TestSelectionRange(t *testing.T) {
+	e := newSelectionTestEditor()
+	if e.HasSelection() {
+		t.Fatal("expected no selection")
+	}
+	// Select from "four" and backwards to "two"
+	e.pos.sy = 2
+	e.pos.sx = 4
+	e.StartSelection()
+	e.pos.sy = 0
+	e.pos.sx = 4
+	from, to, ok := e.SelectionRange()
+	if !ok {
+		t.Fatal("expected a selection")
+	}
+	if from != (TextPosition{4, 0}) || to != (TextPosition{4, 2}) {
+		t.Errorf("unexpected selection range: %v - %v", from, to)
+	}
+	if s := e.SelectedText(); s != "two\nthree\nfour" {
+		t.Errorf("unexpected selected text: %q", s)
+	}
+	if !e.ClearSelection() || e.HasSelection() {
+		t.Error("expected the selection to be cleared")
+	}
+}
+
+func TestReplaceRange(t *testing.T) {
+	e := newSelectionTestEditor()
+	end := e.ReplaceRange(TextPosition{4, 0}, TextPosition{4, 2}, "2\n3", nil)
+	if s := e.String(); s != "one 2\n3 five\n" {
+		t.Errorf("unexpected contents: %q", s)
+	}
+	if end != (TextPosition{1, 1}) {
+		t.Errorf("unexpected end position: %v", end)
+	}
+	e.ReplaceRange(TextPosition{0, 0}, TextPosition{0, 1}, "", nil)
+	if s := e.String(); s != "3 five\n" {
+		t.Errorf("unexpected contents after removing a line: %q", s)
+	}
+}
+
+func TestToggleCommentSelection(t *testing.T) {
+	e := newSelectionTestEditor()
+	e.selectionAnchor = &TextPosition{0, 0}
+	e.pos.sy = 2
+	e.pos.sx = 0 // the selection ends at the start of the last line, which is then not included
+	e.ToggleCommentSelection()
+	if s := e.String(); s != "// one two\n// three\nfour five\n" {
+		t.Errorf("unexpected contents: %q", s)
+	}
+	e.ToggleCommentSelection()
+	if s := e.String(); s != "one two\nthree\nfour five\n" {
+		t.Errorf("unexpected contents after toggling twice: %q", s)
+	}
+}
@@ -37,7 +37,9 @@ func NewStatusBar(fg, bg, errfg, errbg vt100.AttributeColor, editor *Editor, sho
 
 // Draw will draw the status bar to the canvas
 func (sb *StatusBar) Draw(c *vt100.Canvas, offsetY int) {
-	w := int(c.W())
+	// The status bar is drawn at the bottom of the pane that is in focus
+	view := viewBox(c)
+	w := view.W
 
 	// Shorten the status message if it's longer than the terminal width
 	if len(sb.msg) >= w && w > 4 {
@@ -46,11 +48,11 @@ func (sb *StatusBar) Draw(c *vt100.Canvas, offsetY int) {
 
 	if sb.IsError() {
 		mut.RLock()
-		c.Write(uint((w-len(sb.msg))/2), c.H()-1, sb.errfg, sb.errbg, sb.msg)
+		c.Write(uint(view.X+(w-len(sb.msg))/2), uint(view.Y+view.H-1), sb.errfg, sb.errbg, sb.msg)
 		mut.RUnlock()
 	} else {
 		mut.RLock()
-		c.Write(uint((w-len(sb.msg))/2), c.H()-1, sb.fg, sb.bg, sb.msg)
+		c.Write(uint(view.X+(w-len(sb.msg))/2), uint(view.Y+view.H-1), sb.fg, sb.bg, sb.msg)
 		mut.RUnlock()
 	}
 
@@ -135,10 +137,8 @@ func (sb *StatusBar) Clear(c *vt100.Canvas) error {
 	}
 
 	// Then clear/redraw the bottom line
-	h := int(c.H())
 	mut.RLock()
-	offsetY := sb.editor.pos.OffsetY()
-	sb.editor.WriteLines(c, LineIndex(offsetY), LineIndex(h+offsetY), 0, 0)
+	sb.editor.WriteView(c, true)
 	mut.RUnlock()
 	c.Draw()
 	return err
@@ -159,10 +159,8 @@ func (sb *StatusBar) ClearAll(c *vt100.Canvas) {
 	}
 
 	// Then clear/redraw the bottom line
-	h := int(c.H())
 	mut.RLock()
-	offsetY := sb.editor.pos.OffsetY()
-	sb.editor.WriteLines(c, LineIndex(offsetY), LineIndex(h+offsetY), 0, 0)
+	sb.editor.WriteView(c, true)
 	mut.RUnlock()
 	c.Draw()
 }
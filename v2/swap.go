@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/xyproto/vt100"
+)
+
+const (
+	// swapDelay is how long to wait after the last change before writing a swap file
+	swapDelay = 2 * time.Second
+
+	// maxSwapDelay is the longest time that writing a swap file is postponed, when changes keep coming
+	maxSwapDelay = 10 * time.Second
+)
+
+var (
+	swapDir = filepath.Join(userCacheDir, "o", "swap")
+
+	// crashFilename is where the stack trace is written if the editor crashes
+	crashFilename = filepath.Join(userCacheDir, "o", "crash.txt")
+
+	// swapWriter writes the unsaved changes of all open files to swap files, in the background
+	swapWriter = NewSwapWriter()
+)
+
+// SwapFile is the unsaved contents of a file, in a form that can be written to disk
+type SwapFile struct {
+	AbsFilename string
+	Lines       []string
+	Saved       time.Time
+}
+
+// SwapWriter writes swap files in the background, a short while after the last change
+type SwapWriter struct {
+	timer    *time.Timer
+	pending  map[string]Buffer // the buffers that are waiting to be written, by absolute filename
+	latest   map[string]Buffer // the last buffer that was scheduled for each file
+	since    time.Time         // when the oldest pending buffer was scheduled
+	mut      sync.Mutex        // for the fields above
+	writeMut sync.Mutex        // for writing and removing swap files
+}
+
+// NewSwapWriter creates a new SwapWriter
+func NewSwapWriter() *SwapWriter {
+	return &SwapWriter{pending: make(map[string]Buffer), latest: make(map[string]Buffer)}
+}
+
+// swapFilename returns the name of the swap file for the given absolute filename
+func swapFilename(absFilename string) string {
+	return filepath.Join(swapDir, fmt.Sprintf("%x.gob", sha256.Sum256([]byte(absFilename))))
+}
+
+// sameBuffer checks if the two buffers are copies of each other, that have not been changed since they were copied
+func sameBuffer(a, b Buffer) bool {
+	ra, ok1 := a.(*LineRope)
+	rb, ok2 := b.(*LineRope)
+	return ok1 && ok2 && ra.root == rb.root
+}
+
+// Update schedules a swap file to be written for the given file, if it has changed since last time.
+// If the file has no unsaved changes, the swap file is removed instead.
+func (sw *SwapWriter) Update(absFilename string, b Buffer, changed bool) {
+	if noWriteToCache || !ShouldKeep(absFilename) {
+		return
+	}
+	sw.mut.Lock()
+	latest, known := sw.latest[absFilename]
+	if !changed {
+		sw.mut.Unlock()
+		if known {
+			sw.Remove(absFilename)
+		}
+		return
+	}
+	if known && sameBuffer(latest, b) {
+		sw.mut.Unlock()
+		return
+	}
+	b = b.Copy()
+	sw.latest[absFilename] = b
+	if len(sw.pending) == 0 {
+		sw.since = time.Now()
+	}
+	sw.pending[absFilename] = b
+	// Wait until the changes stop, but not for longer than maxSwapDelay
+	delay := swapDelay
+	if left := maxSwapDelay - time.Since(sw.since); left < delay {
+		delay = left
+	}
+	if sw.timer == nil {
+		sw.timer = time.AfterFunc(delay, sw.Flush)
+	} else {
+		sw.timer.Reset(delay)
+	}
+	sw.mut.Unlock()
+}
+
+// UpdateSwapFile schedules a swap file to be written with the given contents of the buffer, or removed if there
+// are no unsaved changes. Nothing is written if the file is locked by another instance of the editor, since the
+// swap file may then contain unsaved changes from that instance.
+func (b *OpenBuffer) UpdateSwapFile(contents Buffer, changed bool) {
+	if b.stdin || b.lockedElsewhere {
+		return
+	}
+	swapWriter.Update(b.absFilename, contents, changed)
+}
+
+// Flush writes all pending swap files right away
+func (sw *SwapWriter) Flush() {
+	sw.writeMut.Lock()
+	defer sw.writeMut.Unlock()
+	sw.mut.Lock()
+	pending := sw.pending
+	sw.pending = make(map[string]Buffer)
+	sw.mut.Unlock()
+	for absFilename, b := range pending {
+		writeSwapFile(absFilename, b)
+	}
+}
+
+// Remove removes the swap file for the given file, for when it has been saved or closed
+func (sw *SwapWriter) Remove(absFilename string) {
+	sw.mut.Lock()
+	_, known := sw.latest[absFilename]
+	delete(sw.pending, absFilename)
+	delete(sw.latest, absFilename)
+	sw.mut.Unlock()
+	if known && !noWriteToCache {
+		sw.writeMut.Lock()
+		os.Remove(swapFilename(absFilename))
+		sw.writeMut.Unlock()
+	}
+}
+
+// writeSwapFile writes the given buffer to the swap file for the given file
+func writeSwapFile(absFilename string, b Buffer) error {
+	if noWriteToCache {
+		return nil
+	}
+	sf := SwapFile{AbsFilename: absFilename, Lines: bufferLines(b), Saved: time.Now()}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(sf); err != nil {
+		return err
+	}
+	// First create the folder, if needed, in a best effort attempt
+	os.MkdirAll(swapDir, 0o700)
+	// Write the swap file, with strict permissions
+	return WriteFileAtomic(swapFilename(absFilename), buf.Bytes(), 0o600, false)
+}
+
+// LoadSwapFile reads the swap file for the given file
+func LoadSwapFile(absFilename string) (*SwapFile, error) {
+	data, err := os.ReadFile(swapFilename(absFilename))
+	if err != nil {
+		return nil, err
+	}
+	var sf SwapFile
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&sf); err != nil {
+		return nil, err
+	}
+	if sf.AbsFilename != absFilename {
+		return nil, fmt.Errorf("the swap file for %s belongs to %s", absFilename, sf.AbsFilename)
+	}
+	return &sf, nil
+}
+
+// writeCrashFiles writes swap files for all open files with unsaved changes, together with the given
+// stack trace, for when the editor has crashed. Returns the name of the file with the stack trace, if it was
+// written, and the names of the files with unsaved changes that could not be written to swap files.
+func (e *Editor) writeCrashFiles(x interface{}) (string, []string, error) {
+	bufferList.Stash(e)
+	var lost []string
+	swapWriter.writeMut.Lock()
+	for _, b := range bufferList.Unsaved() {
+		if noWriteToCache || b.lockedElsewhere || !ShouldKeep(b.absFilename) || writeSwapFile(b.absFilename, b.editor.lines.Buffer) != nil {
+			lost = append(lost, filepath.Base(b.absFilename))
+		}
+	}
+	swapWriter.writeMut.Unlock()
+	if noWriteToCache {
+		return "", lost, nil
+	}
+	os.MkdirAll(filepath.Dir(crashFilename), 0o700)
+	report := fmt.Sprintf("%s\n%v\n\n%s", time.Now().Format(time.RFC3339), x, debug.Stack())
+	return crashFilename, lost, os.WriteFile(crashFilename, []byte(report), 0o600)
+}
+
+// recoverableSwapFile loads the swap file for the given file, if it has unsaved changes that are newer than the file
+// and that differ from the given lines. Swap files that are no longer needed are removed.
+func recoverableSwapFile(absFilename string, current []string) (*SwapFile, bool) {
+	if noWriteToCache {
+		return nil, false
+	}
+	sf, err := LoadSwapFile(absFilename)
+	if err != nil {
+		return nil, false
+	}
+	if fi, err := os.Stat(absFilename); (err == nil && !sf.Saved.After(fi.ModTime())) || equalStrings(sf.Lines, current) {
+		os.Remove(swapFilename(absFilename))
+		return nil, false
+	}
+	return sf, true
+}
+
+// OfferSwapRecovery checks if there is a swap file for the given file that is newer than the file,
+// and asks the user if the unsaved changes in it should be recovered, shown or discarded.
+// Swap files that are older than the file, or that contain the same lines as the file, are removed.
+func (e *Editor) OfferSwapRecovery(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, absFilename string) {
+	current := bufferLines(e.lines.Buffer)
+	sf, ok := recoverableSwapFile(absFilename, current)
+	if !ok {
+		return
+	}
+	title := fmt.Sprintf("Found unsaved changes to %s from %s", filepath.Base(absFilename), sf.Saved.Format("2006-01-02 15:04"))
+	menuChoices := []string{"Recover the unsaved changes", "Show the differences", "Discard the unsaved changes"}
+	for {
+		choice := e.Menu(status, tty, title, menuChoices, e.Background, e.MenuTitleColor, e.MenuArrowColor, e.MenuTextColor, e.MenuHighlightColor, e.MenuSelectedColor, 0, false)
+		switch choice {
+		case 0:
+			undo.Snapshot(e)
+			e.lines.Replace(NewLineRope(runeLines(sf.Lines)))
+			e.changed = true
+			if e.DataY() >= LineIndex(e.Len()) {
+				e.GoToEnd(c, nil)
+			}
+			status.SetMessageAfterRedraw("Recovered the unsaved changes")
+		case 1:
+			e.ShowDiff(c, tty, "Saved file → unsaved changes", current, sf.Lines)
+			continue
+		case 2:
+			os.Remove(swapFilename(absFilename))
+			status.SetMessageAfterRedraw("Discarded the unsaved changes")
+		}
+		break
+	}
+	e.redraw = true
+	e.redrawCursor = true
+}
+
+// equalStrings checks if the two slices contain the same strings
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSwapWriter(t *testing.T) {
+	defer func(dir string, noWrite bool) {
+		swapDir = dir
+		noWriteToCache = noWrite
+	}(swapDir, noWriteToCache)
+	swapDir = t.TempDir()
+	noWriteToCache = false
+
+	const absFilename = "/home/user/project/main.go"
+	b := NewLineRope(runeLines([]string{"package main", "", "func main() {}"}))
+	sw := NewSwapWriter()
+	sw.Update(absFilename, b, true)
+	sw.Flush()
+
+	sf, err := LoadSwapFile(absFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalStrings(sf.Lines, bufferLines(b)) {
+		t.Errorf("unexpected swap file contents: %q", sf.Lines)
+	}
+
+	// The same buffer is not scheduled again
+	sw.Update(absFilename, b.Copy(), true)
+	if len(sw.pending) != 0 {
+		t.Error("expected an unchanged buffer to not be scheduled again")
+	}
+	b.SetLine(1, []rune("// changed"))
+	sw.Update(absFilename, b, true)
+	if len(sw.pending) != 1 {
+		t.Error("expected a changed buffer to be scheduled")
+	}
+
+	// The swap file is removed when there are no unsaved changes
+	sw.Update(absFilename, b, false)
+	if _, err := os.Stat(swapFilename(absFilename)); !os.IsNotExist(err) {
+		t.Error("expected the swap file to be removed")
+	}
+	if len(sw.pending) != 0 {
+		t.Error("expected nothing to be pending")
+	}
+}
+
+func TestSwapFileLockedElsewhere(t *testing.T) {
+	defer func(dir string, noWrite bool, sw *SwapWriter) {
+		swapDir = dir
+		noWriteToCache = noWrite
+		swapWriter = sw
+	}(swapDir, noWriteToCache, swapWriter)
+	swapDir = t.TempDir()
+	noWriteToCache = false
+	swapWriter = NewSwapWriter()
+
+	contents := NewLineRope(runeLines([]string{"package main"}))
+	b := &OpenBuffer{absFilename: "/home/user/project/main.go", lockedElsewhere: true}
+	b.UpdateSwapFile(contents, true)
+	swapWriter.Flush()
+	if _, err := LoadSwapFile(b.absFilename); err == nil {
+		t.Error("expected no swap file for a file that is locked by another instance")
+	}
+
+	b.lockedElsewhere = false
+	b.UpdateSwapFile(contents, true)
+	swapWriter.Flush()
+	if _, err := LoadSwapFile(b.absFilename); err != nil {
+		t.Errorf("expected a swap file, got %v", err)
+	}
+}
+
+func TestWriteCrashFiles(t *testing.T) {
+	defer func(bl *BufferList, dir, crash string, noWrite bool) {
+		bufferList = bl
+		swapDir = dir
+		crashFilename = crash
+		noWriteToCache = noWrite
+	}(bufferList, swapDir, crashFilename, noWriteToCache)
+	bufferList = &BufferList{}
+	swapDir = t.TempDir()
+	crashFilename = filepath.Join(t.TempDir(), "crash.txt")
+
+	e := NewSimpleEditor(80)
+	e.SetLine(0, "package main")
+	bufferList.Add(&OpenBuffer{editor: e, absFilename: "/home/user/project/main.go"})
+
+	noWriteToCache = true
+	if filename, lost, err := e.writeCrashFiles("crash"); err != nil || filename != "" || len(lost) != 1 || lost[0] != "main.go" {
+		t.Errorf("expected the unsaved changes to be lost, got %q, %q, %v", filename, lost, err)
+	}
+
+	noWriteToCache = false
+	if filename, lost, err := e.writeCrashFiles("crash"); err != nil || filename != crashFilename || len(lost) != 0 {
+		t.Errorf("expected the unsaved changes to be recoverable, got %q, %q, %v", filename, lost, err)
+	}
+	if _, err := LoadSwapFile("/home/user/project/main.go"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,495 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/xyproto/vt100"
+)
+
+// tagFilenames are the names of the tag files that are looked for, in the directory of the edited file and above.
+// "tags" files are written by ctags, while "TAGS" files are written by etags or by ctags -e.
+var tagFilenames = []string{"tags", ".tags", "TAGS"}
+
+// ctagsCandidates are the names that universal-ctags may be installed as
+var ctagsCandidates = []string{"ctags", "universal-ctags", "uctags"}
+
+// tagKinds are descriptions of the most common one-letter kinds that ctags writes
+var tagKinds = map[string]string{
+	"c": "class",
+	"d": "macro",
+	"e": "enumerator",
+	"f": "function",
+	"g": "enum",
+	"i": "interface",
+	"m": "member",
+	"n": "namespace",
+	"p": "prototype",
+	"s": "struct",
+	"t": "type",
+	"u": "union",
+	"v": "variable",
+}
+
+var (
+	// ctagsPath is the path to universal-ctags, once it has been looked for
+	ctagsPath string
+
+	// ctagsSearched is true when universal-ctags has been looked for
+	ctagsSearched bool
+)
+
+// Tag is a definition that is listed in a ctags or etags file
+type Tag struct {
+	Name     string
+	Filename string     // the absolute path to the file with the definition
+	Line     LineNumber // the line number, or 0 if only the pattern is known
+	Pattern  string     // the text of the line with the definition, or a part of it
+	Kind     string     // like "function" or "struct", if known
+	anchored bool       // the pattern must match at the start of the line
+	whole    bool       // the pattern must match the whole line
+}
+
+// TagLocation is where a tag was found, in a file that may have changed since the tag file was written
+type TagLocation struct {
+	Tag
+	LineIndex LineIndex
+	X         ColIndex
+	Text      string
+}
+
+// findTagFiles returns the tag files in the given directory and in all directories above it, the closest first
+func findTagFiles(dir string) []string {
+	var found []string
+	for {
+		for _, tagFilename := range tagFilenames {
+			if fullFilename := filepath.Join(dir, tagFilename); isFile(fullFilename) {
+				found = append(found, fullFilename)
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return found
+		}
+		dir = parent
+	}
+}
+
+// symbolName returns the last part of a word like "package.Function", "Class::method" or "p->field"
+func symbolName(word string) string {
+	for _, sep := range []string{".", "::", "->"} {
+		if i := strings.LastIndex(word, sep); i >= 0 {
+			word = word[i+len(sep):]
+		}
+	}
+	return word
+}
+
+// unescapeTagPattern removes the delimiters, anchors and escapes from a ctags search pattern like /^func main() {$/
+func unescapeTagPattern(address string) (pattern string, anchored, whole bool) {
+	delimiter := address[:1]
+	address = strings.TrimSuffix(address[1:], delimiter)
+	if strings.HasPrefix(address, "^") {
+		anchored = true
+		address = address[1:]
+	}
+	if strings.HasSuffix(address, "$") && !strings.HasSuffix(address, "\\$") {
+		whole = true
+		address = address[:len(address)-1]
+	}
+	var sb strings.Builder
+	for i := 0; i < len(address); i++ {
+		if address[i] == '\\' && i+1 < len(address) {
+			i++
+		}
+		sb.WriteByte(address[i])
+	}
+	return sb.String(), anchored, whole
+}
+
+// parseCtagsLine parses a line from a ctags file, like "main\tmain.go\t/^func main() {$/;\"\tf".
+// Returns false if the line is not a tag.
+func parseCtagsLine(line, dir string) (Tag, bool) {
+	if strings.HasPrefix(line, "!_TAG_") {
+		return Tag{}, false
+	}
+	fields := strings.SplitN(line, "\t", 3)
+	if len(fields) != 3 || fields[0] == "" || fields[1] == "" {
+		return Tag{}, false
+	}
+	t := Tag{Name: fields[0], Filename: fields[1]}
+	if !filepath.IsAbs(t.Filename) {
+		t.Filename = filepath.Join(dir, t.Filename)
+	}
+
+	// The address may be followed by ;" and extension fields, separated by tabs
+	address, extensionFields := fields[2], ""
+	if i := strings.LastIndex(address, ";\"\t"); i >= 0 {
+		address, extensionFields = address[:i], address[i+3:]
+	} else {
+		address = strings.TrimSuffix(address, ";\"")
+	}
+	switch {
+	case address == "":
+		return Tag{}, false
+	case address[0] == '/' || address[0] == '?':
+		t.Pattern, t.anchored, t.whole = unescapeTagPattern(address)
+	default:
+		n, err := strconv.Atoi(address)
+		if err != nil {
+			return Tag{}, false
+		}
+		t.Line = LineNumber(n)
+	}
+
+	for _, field := range strings.Split(extensionFields, "\t") {
+		key, value := "kind", field
+		if i := strings.Index(field, ":"); i >= 0 {
+			key, value = field[:i], field[i+1:]
+		}
+		switch key {
+		case "kind":
+			if description, ok := tagKinds[value]; ok {
+				value = description
+			}
+			t.Kind = value
+		case "line":
+			if n, err := strconv.Atoi(value); err == nil {
+				t.Line = LineNumber(n)
+			}
+		}
+	}
+	return t, true
+}
+
+// etagsImplicitName returns the name of an etags tag that has no explicit name, which is the last identifier in the text
+func etagsImplicitName(text string) string {
+	text = strings.TrimRightFunc(text, func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune("({=;,", r)
+	})
+	start := len(text)
+	for start > 0 {
+		r, size := utf8.DecodeLastRuneInString(text[:start])
+		if r != '_' && r != '$' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			break
+		}
+		start -= size
+	}
+	return text[start:]
+}
+
+// readCtags returns the tags with the given name from a ctags file
+func readCtags(r io.Reader, dir, name string) ([]Tag, error) {
+	var tags []Tag
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	prefix := name + "\t"
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, prefix) {
+			continue
+		}
+		if t, ok := parseCtagsLine(line, dir); ok {
+			tags = append(tags, t)
+		}
+	}
+	return tags, scanner.Err()
+}
+
+// readEtags returns the tags with the given name from an etags file, which consists of one section per source file
+func readEtags(r io.Reader, dir, name string) ([]Tag, error) {
+	var (
+		tags     []Tag
+		filename string
+		header   bool
+	)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "\f" {
+			header = true
+			continue
+		}
+		if header {
+			// The section header is "filename,size" or "filename,include"
+			header = false
+			filename = ""
+			if i := strings.LastIndex(line, ","); i > 0 && line[i+1:] != "include" {
+				filename = line[:i]
+				if !filepath.IsAbs(filename) {
+					filename = filepath.Join(dir, filename)
+				}
+			}
+			continue
+		}
+		if filename == "" {
+			continue
+		}
+		// A tag is "text\x7fname\x01line,offset" or "text\x7fline,offset"
+		i := strings.Index(line, "\x7f")
+		if i < 0 {
+			continue
+		}
+		text, position := line[:i], line[i+1:]
+		tagName := etagsImplicitName(text)
+		if j := strings.Index(position, "\x01"); j >= 0 {
+			tagName, position = position[:j], position[j+1:]
+		}
+		if tagName != name {
+			continue
+		}
+		lineString := position
+		if j := strings.Index(position, ","); j >= 0 {
+			lineString = position[:j]
+		}
+		n, _ := strconv.Atoi(lineString)
+		tags = append(tags, Tag{Name: tagName, Filename: filename, Line: LineNumber(n), Pattern: text, anchored: true})
+	}
+	return tags, scanner.Err()
+}
+
+// readTags returns the tags with the given name from the given ctags or etags file
+func readTags(tagFilename, name string) ([]Tag, error) {
+	f, err := os.Open(tagFilename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	dir := filepath.Dir(tagFilename)
+	// etags files start with a form feed
+	if first, err := r.Peek(1); err == nil && first[0] == '\f' {
+		return readEtags(r, dir, name)
+	}
+	return readCtags(r, dir, name)
+}
+
+// FindTags returns the definitions of the given name, from the tag files in the given directory and above
+func FindTags(dir, name string) []Tag {
+	var tags []Tag
+	for _, tagFilename := range findTagFiles(dir) {
+		if found, err := readTags(tagFilename, name); err == nil {
+			tags = append(tags, found...)
+		}
+	}
+	return tags
+}
+
+// matches checks if the given line matches the pattern of the tag
+func (t Tag) matches(line string) bool {
+	switch {
+	case t.whole:
+		return line == t.Pattern
+	case t.anchored:
+		return strings.HasPrefix(line, t.Pattern)
+	}
+	return strings.Contains(line, t.Pattern)
+}
+
+// Locate finds the tag in the given lines. The line with the pattern that is closest to the line number
+// of the tag is used, since the file may have changed after the tag file was written.
+func (t Tag) Locate(lines []string) (LineIndex, ColIndex, bool) {
+	found := -1
+	if t.Pattern == "" {
+		if t.Line < 1 || int(t.Line) > len(lines) {
+			return 0, 0, false
+		}
+		found = int(t.Line.LineIndex())
+	} else {
+		hint := int(t.Line.LineIndex())
+		for y, line := range lines {
+			if !t.matches(line) {
+				continue
+			}
+			if found < 0 || abs(y-hint) < abs(found-hint) {
+				found = y
+			}
+			if y >= hint {
+				break
+			}
+		}
+		if found < 0 {
+			return 0, 0, false
+		}
+	}
+	var x int
+	if i := strings.Index(lines[found], t.Name); i >= 0 {
+		x = utf8.RuneCountInString(lines[found][:i])
+	}
+	return LineIndex(found), ColIndex(x), true
+}
+
+// universalCtags returns the path to universal-ctags, or "" if it is not installed.
+// Other ctags implementations do not support all the flags that are used.
+func universalCtags() string {
+	if ctagsSearched {
+		return ctagsPath
+	}
+	ctagsSearched = true
+	for _, name := range ctagsCandidates {
+		path := which(name)
+		if path == "" {
+			continue
+		}
+		if output, err := exec.Command(path, "--version").Output(); err == nil && strings.Contains(string(output), "Universal Ctags") {
+			ctagsPath = path
+			break
+		}
+	}
+	return ctagsPath
+}
+
+// GenerateTags writes a tag file with universal-ctags for the project that the given file is in,
+// or updates the closest existing tag file. Returns the name of the tag file.
+func GenerateTags(absFilename string) (string, error) {
+	ctags := universalCtags()
+	if ctags == "" {
+		return "", errors.New("universal-ctags is not installed")
+	}
+	tagFilename := filepath.Join(lspRootDir(absFilename), "tags")
+	if found := findTagFiles(filepath.Dir(absFilename)); len(found) > 0 {
+		tagFilename = found[0]
+	}
+	args := []string{"-R", "-f", filepath.Base(tagFilename)}
+	if filepath.Base(tagFilename) == "TAGS" {
+		args = append([]string{"-e"}, args...)
+	}
+	cmd := exec.Command(ctags, args...)
+	cmd.Dir = filepath.Dir(tagFilename)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(output)); msg != "" {
+			return "", errors.New(firstLine(msg))
+		}
+		return "", err
+	}
+	return tagFilename, nil
+}
+
+// firstLine returns the first line of the given string
+func firstLine(s string) string {
+	if i := strings.Index(s, "\n"); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// HasTags checks if there is a tag file in the directory of the current file, or above it
+func (e *Editor) HasTags() bool {
+	absFilename := e.lspFilename()
+	return absFilename != "" && len(findTagFiles(filepath.Dir(absFilename))) > 0
+}
+
+// locateTags finds the given tags in the files they belong to. Tags that can not be found are left out,
+// and definitions that are listed in several tag files are only returned once.
+func (e *Editor) locateTags(tags []Tag) []TagLocation {
+	var (
+		locations []TagLocation
+		fileLines = make(map[string][]string)
+		seen      = make(map[string]bool)
+	)
+	for _, t := range tags {
+		lines, ok := fileLines[t.Filename]
+		if !ok {
+			lines = e.fileLines(t.Filename)
+			fileLines[t.Filename] = lines
+		}
+		y, x, ok := t.Locate(lines)
+		key := fmt.Sprintf("%s:%d", t.Filename, y)
+		if !ok || seen[key] {
+			continue
+		}
+		seen[key] = true
+		locations = append(locations, TagLocation{t, y, x, strings.TrimSpace(lines[y])})
+	}
+	return locations
+}
+
+// TagsGoToDefinition looks up the word at the cursor in the tag files, and jumps to the definition.
+// If there are several definitions, the user can choose between them.
+// Returns false if there are no tag files, or if no definition was found.
+func (e *Editor) TagsGoToDefinition(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) bool {
+	absFilename := e.lspFilename()
+	name := symbolName(e.WordAtCursor())
+	if absFilename == "" || name == "" {
+		return false
+	}
+	locations := e.locateTags(FindTags(filepath.Dir(absFilename), name))
+	switch len(locations) {
+	case 0:
+		return false
+	case 1:
+		if err := e.jumpToFileLocation(c, tty, status, locations[0].Filename, locations[0].LineIndex, locations[0].X); err != nil {
+			status.SetError(err)
+			status.ShowNoTimeout(c, e)
+		}
+	default:
+		e.pickTagLocation(c, tty, status, "Definitions of "+name, locations)
+	}
+	return true
+}
+
+// pickTagLocation lets the user choose one of the given definitions of a symbol with the SymbolMenu,
+// one definition per row, and jumps to it
+func (e *Editor) pickTagLocation(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, title string, locations []TagLocation) {
+	const maxChoices = 20
+	if len(locations) > maxChoices {
+		title = fmt.Sprintf("%s (the first %d of %d)", title, maxChoices, len(locations))
+		locations = locations[:maxChoices]
+	}
+	menuChoices := make([][]string, len(locations))
+	for i, location := range locations {
+		text := shortenText(location.Text, 60)
+		choice := fmt.Sprintf("%s:%d: ", shortPath(location.Filename), location.LineIndex.LineNumber())
+		if location.Kind != "" {
+			choice += location.Kind + ": "
+		}
+		menuChoices[i] = []string{choice + text}
+	}
+	_, selectedY, cancel := e.SymbolMenu(tty, status, title, menuChoices, e.MenuTitleColor, e.MenuTextColor, e.MenuArrowColor)
+
+	// Full redraw
+	const drawLines = true
+	e.FullResetRedraw(c, status, drawLines)
+	e.redraw = true
+	e.redrawCursor = true
+
+	if cancel || selectedY < 0 || selectedY >= len(locations) {
+		return
+	}
+	location := locations[selectedY]
+	if err := e.jumpToFileLocation(c, tty, status, location.Filename, location.LineIndex, location.X); err != nil {
+		status.SetError(err)
+		status.ShowNoTimeout(c, e)
+	}
+}
+
+// GenerateTagsFile writes or updates the tag file for the current project with universal-ctags
+func (e *Editor) GenerateTagsFile(c *vt100.Canvas, status *StatusBar) {
+	absFilename := e.lspFilename()
+	if absFilename == "" {
+		status.SetErrorMessage("No filename")
+		status.ShowNoTimeout(c, e)
+		return
+	}
+	status.ClearAll(c)
+	status.SetMessage("Generating tags...")
+	status.ShowNoTimeout(c, e)
+	tagFilename, err := GenerateTags(absFilename)
+	status.ClearAll(c)
+	if err != nil {
+		status.SetError(err)
+		status.ShowNoTimeout(c, e)
+		return
+	}
+	status.SetMessageAfterRedraw("Wrote " + shortPath(tagFilename))
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseCtagsLine(t *testing.T) {
+	tag, ok := parseCtagsLine("main\tcmd/main.go\t/^func main() {$/;\"\tf\tline:12", "/src")
+	if !ok {
+		t.Fatal("expected a tag")
+	}
+	if tag.Name != "main" || tag.Filename != "/src/cmd/main.go" || tag.Pattern != "func main() {" || tag.Kind != "function" || tag.Line != 12 || !tag.anchored || !tag.whole {
+		t.Errorf("unexpected tag: %+v", tag)
+	}
+	tag, ok = parseCtagsLine("path\t/abs/a.c\t/^char *path = \"\\/tmp\";$/;\"\tkind:variable", "/src")
+	if !ok || tag.Filename != "/abs/a.c" || tag.Pattern != "char *path = \"/tmp\";" || tag.Kind != "variable" {
+		t.Errorf("unexpected tag: %+v", tag)
+	}
+	if tag, ok := parseCtagsLine("MAX\tdefs.h\t3;\"\td", "/src"); !ok || tag.Line != 3 || tag.Pattern != "" || tag.Kind != "macro" {
+		t.Errorf("unexpected tag: %+v", tag)
+	}
+	if _, ok := parseCtagsLine("!_TAG_FILE_FORMAT\t2\t/extended format/", "/src"); ok {
+		t.Error("expected the pseudo tag to be skipped")
+	}
+}
+
+func TestReadEtags(t *testing.T) {
+	const etags = "\f\nmain.c,60\nint add(int a, int b)\x7fadd\x011,0\nstatic int counter \x7f5,40\n\f\nsys.h,include\n"
+	tags, err := readEtags(strings.NewReader(etags), "/src", "counter")
+	if err != nil || len(tags) != 1 {
+		t.Fatalf("expected one tag, got %+v, %v", tags, err)
+	}
+	if tags[0].Filename != "/src/main.c" || tags[0].Line != 5 || tags[0].Pattern != "static int counter " {
+		t.Errorf("unexpected tag: %+v", tags[0])
+	}
+	if tags, _ := readEtags(strings.NewReader(etags), "/src", "add"); len(tags) != 1 || tags[0].Line != 1 {
+		t.Errorf("expected the tag with an explicit name, got %+v", tags)
+	}
+}
+
+func TestFindTags(t *testing.T) {
+	root := t.TempDir()
+	subDir := filepath.Join(root, "pkg", "sub")
+	if err := os.MkdirAll(subDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	lines := []string{"package sub", "", "// Greet greets", "func Greet() {}"}
+	if err := os.WriteFile(filepath.Join(subDir, "sub.go"), []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// The same definition is listed in two tag files, and the line number in the outer one is outdated
+	if err := os.WriteFile(filepath.Join(root, "tags"), []byte("!_TAG_FILE_SORTED\t1\t//\nGreet\tpkg/sub/sub.go\t/^func Greet() {}$/;\"\tf\tline:1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(subDir, "TAGS"), []byte("\f\nsub.go,30\nfunc Greet() {}\x7fGreet\x011,0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if found := findTagFiles(subDir); len(found) < 2 || found[0] != filepath.Join(subDir, "TAGS") || found[1] != filepath.Join(root, "tags") {
+		t.Errorf("unexpected tag files: %v", found)
+	}
+	tags := FindTags(subDir, symbolName("sub.Greet"))
+	if len(tags) != 2 {
+		t.Fatalf("expected two tags, got %+v", tags)
+	}
+	for _, tag := range tags {
+		y, x, ok := tag.Locate(lines)
+		if !ok || y != 3 || x != 5 {
+			t.Errorf("expected %+v to be found at line index 3 and column index 5, got %d, %d, %v", tag, y, x, ok)
+		}
+	}
+	e := NewSimpleEditor(80)
+	if locations := e.locateTags(tags); len(locations) != 1 || locations[0].Text != "func Greet() {}" {
+		t.Errorf("expected the definition to be listed once, got %+v", locations)
+	}
+	if _, _, ok := (Tag{Name: "Gone", Pattern: "func Gone() {}", anchored: true, whole: true}).Locate(lines); ok {
+		t.Error("expected a tag that is no longer in the file to not be found")
+	}
+}
+
+func TestSymbolName(t *testing.T) {
+	for word, expected := range map[string]string{"fmt.Println": "Println", "std::string": "string", "p->next": "next", "main": "main"} {
+		if got := symbolName(word); got != expected {
+			t.Errorf("expected %q for %q, got %q", expected, word, got)
+		}
+	}
+}
@@ -94,6 +94,7 @@ type Theme struct {
 	DebugRegistersBackground    vt100.AttributeColor
 	DebugOutputBackground       vt100.AttributeColor
 	TableBackground             vt100.AttributeColor
+	SelectionBackground         vt100.AttributeColor
 	StatusMode                  bool
 	Light                       bool
 }
@@ -159,6 +160,7 @@ func NewDefaultTheme() Theme {
 		CheckboxColor:               vt100.Default,
 		XColor:                      vt100.LightYellow,
 		TableBackground:             vt100.BackgroundDefault,
+		SelectionBackground:         vt100.BackgroundBlue,
 		UnmatchedParenColor:         vt100.White,
 		MenuTitleColor:              vt100.LightYellow,
 		MenuArrowColor:              vt100.Red,
@@ -242,6 +244,7 @@ func NewSynthwaveTheme() Theme {
 		CheckboxColor:               vt100.Default,
 		XColor:                      vt100.LightGray,
 		TableBackground:             vt100.BackgroundDefault,
+		SelectionBackground:         vt100.BackgroundMagenta,
 		UnmatchedParenColor:         vt100.LightRed, // to really stand out
 		MenuTitleColor:              vt100.LightGray,
 		MenuArrowColor:              vt100.Magenta,
@@ -324,6 +327,7 @@ func NewRedBlackTheme() Theme {
 		TableColor:                  vt100.White,
 		CheckboxColor:               vt100.Default,
 		XColor:                      vt100.Red,
+		SelectionBackground:         vt100.BackgroundRed,
 		TableBackground:             vt100.BackgroundBlack, // Dark gray background, as opposed to vt100.BackgroundDefault
 		UnmatchedParenColor:         vt100.LightCyan,       // To really stand out
 		MenuTitleColor:              vt100.LightRed,
@@ -408,6 +412,7 @@ func NewLightBlueEditTheme() Theme {
 		CheckboxColor:               vt100.White,
 		XColor:                      vt100.LightYellow,
 		TableBackground:             vt100.BackgroundBlue,
+		SelectionBackground:         vt100.BackgroundCyan,
 		UnmatchedParenColor:         vt100.White,
 		MenuTitleColor:              vt100.LightYellow,
 		MenuArrowColor:              vt100.LightRed,
@@ -491,6 +496,7 @@ func NewDarkBlueEditTheme() Theme {
 		CheckboxColor:               vt100.White,
 		XColor:                      vt100.White,
 		TableBackground:             vt100.BackgroundBlue,
+		SelectionBackground:         vt100.BackgroundCyan,
 		UnmatchedParenColor:         vt100.LightRed,
 		MenuTitleColor:              vt100.LightYellow,
 		MenuArrowColor:              vt100.White,
@@ -573,6 +579,7 @@ func NewLightVSTheme() Theme {
 		CheckboxColor:               vt100.Default,
 		XColor:                      vt100.Blue,
 		TableBackground:             vt100.BackgroundDefault,
+		SelectionBackground:         vt100.BackgroundGray,
 		UnmatchedParenColor:         vt100.Red,
 		MenuTitleColor:              vt100.Blue,
 		MenuArrowColor:              vt100.Red,
@@ -655,6 +662,7 @@ func NewDarkVSTheme() Theme {
 		CheckboxColor:               vt100.Black,
 		XColor:                      vt100.Blue,
 		TableBackground:             vt100.DarkGray,
+		SelectionBackground:         vt100.BackgroundBlue,
 		UnmatchedParenColor:         vt100.Red,
 		MenuTitleColor:              vt100.Blue,
 		MenuArrowColor:              vt100.Red,
@@ -764,6 +772,7 @@ func NewNoColorDarkBackgroundTheme() Theme {
 		CheckboxColor:               vt100.Default,
 		XColor:                      vt100.White,
 		TableBackground:             vt100.BackgroundDefault,
+		SelectionBackground:         vt100.Reverse,
 		UnmatchedParenColor:         vt100.White,
 		MenuTitleColor:              vt100.White,
 		MenuArrowColor:              vt100.White,
@@ -846,6 +855,7 @@ func NewNoColorLightBackgroundTheme() Theme {
 		CheckboxColor:               vt100.Default,
 		XColor:                      vt100.Black,
 		TableBackground:             vt100.BackgroundDefault,
+		SelectionBackground:         vt100.Reverse,
 		UnmatchedParenColor:         vt100.Black,
 		MenuTitleColor:              vt100.Black,
 		MenuArrowColor:              vt100.Black,
@@ -867,6 +877,44 @@ func NewNoColorLightBackgroundTheme() Theme {
 	}
 }
 
+// themeConstructors are the functions that create each of the available themes
+var themeConstructors = []func() Theme{
+	NewDefaultTheme,
+	NewSynthwaveTheme,
+	NewRedBlackTheme,
+	NewLightBlueEditTheme,
+	NewDarkBlueEditTheme,
+	NewLightVSTheme,
+	NewDarkVSTheme,
+	NewAmberTheme,
+	NewGreenTheme,
+	NewBlueTheme,
+	NewNoColorDarkBackgroundTheme,
+	NewNoColorLightBackgroundTheme,
+}
+
+// themeByName returns the theme with the given name, as given by the Name field of the theme.
+// Several themes may have the same name, like the light and dark variants of a theme.
+func themeByName(name string, light bool) (Theme, bool) {
+	var (
+		found Theme
+		ok    bool
+	)
+	for _, newTheme := range themeConstructors {
+		t := newTheme()
+		if t.Name != name {
+			continue
+		}
+		if t.Light == light {
+			return t, true
+		}
+		if !ok {
+			found, ok = t, true
+		}
+	}
+	return found, ok
+}
+
 // TextConfig returns a TextConfig struct that can be used for settings
 // the syntax highlighting colors in the public TextConfig variable that is
 // exported from the syntax package.
@@ -2,47 +2,63 @@ package main
 
 import (
 	"errors"
-	"fmt"
 	"sync"
+	"time"
 	"unsafe"
 )
 
-// Undo is a struct that can store several states of the editor and position
+// UndoTransaction is a group of changes that are undone and redone together,
+// along with the cursor position and "changed" state before and after the changes
+type UndoTransaction struct {
+	timestamp     time.Time      // when the last snapshot was added to this transaction
+	group         string         // snapshots that belong to the same group may be joined into one transaction
+	ops           []BufferOp     // the changes to the document
+	before        Position       // the cursor position before the changes
+	after         Position       // the cursor position after the changes
+	changedBefore bool           // was the document changed since the last save, before the changes?
+	changedAfter  bool           // was the document changed since the last save, after the changes?
+	cursorsBefore []TextPosition // the extra cursors before the changes
+	cursorsAfter  []TextPosition // the extra cursors after the changes
+}
+
+// Undo is a struct that records changes to the editor contents, so that they can be undone and redone.
+// Instead of storing copies of the document, the changes are recorded as operations that can be reverted.
 type Undo struct {
-	mut                  *sync.RWMutex
-	editorCopies         []Editor
-	editorLineCopies     []map[int][]rune
-	editorPositionCopies []Position
-	index                int
-	size                 int
-	maxMemoryUse         uint64 // can be <= 0 to not check for memory use
-	ignoreSnapshots      bool   // used when playing back macros
+	mut             *sync.RWMutex
+	transactions    []UndoTransaction
+	index           int    // the number of transactions that are currently applied, the rest can be redone
+	size            int    // the maximum number of transactions
+	maxMemoryUse    uint64 // can be <= 0 to not check for memory use
+	open            bool   // can more changes be added to the last applied transaction?
+	ignoreSnapshots bool   // used when playing back macros
 }
 
 const (
-	// number of undo actions possible to store in the circular buffer
+	// number of undo actions possible to store
 	defaultUndoCount = 1024
 
-	// maximum amount of memory the undo buffers can use before re-using buffers, 0 to disable
+	// maximum amount of memory the undo buffers can use before dropping the oldest actions, 0 to disable
 	defaultUndoMemory = 0 // 32 * 1024 * 1024
+
+	// snapshots in the same group that are taken within this duration are joined into one undo action
+	undoGroupTimeout = 1500 * time.Millisecond
+
+	// undo snapshot groups
+	undoGroupTyping = "typing"
+	undoGroupPaste  = "paste"
 )
 
 var (
-	// Circular undo buffer with room for N actions, change false to true to check for too limit memory use
-	undo = NewUndo(defaultUndoCount, defaultUndoMemory)
-
-	// Save the contents of one switch.
-	// Used when switching between a .c or .cpp file to the corresponding .h file.
-	switchBuffer = NewUndo(1, defaultUndoMemory)
+	// the number of undo actions to keep for each file, which can be changed in the configuration file
+	undoSize = defaultUndoCount
 
-	// Save a copy of the undo stack when switching between files
-	switchUndoBackup = NewUndo(defaultUndoCount, defaultUndoMemory)
+	// Undo stack with room for N actions
+	undo = NewUndo(undoSize, defaultUndoMemory)
 )
 
-// NewUndo takes arguments that are only for initializing the undo buffers.
-// The *Position and *vt100.Canvas is used only as a default values for the elements in the undo buffers.
+// NewUndo takes arguments that are only for initializing the undo buffers
 func NewUndo(size int, maxMemoryUse uint64) *Undo {
-	return &Undo{&sync.RWMutex{}, make([]Editor, size), make([]map[int][]rune, size), make([]Position, size), 0, size, maxMemoryUse, false}
+	return &Undo{mut: &sync.RWMutex{}, transactions: make([]UndoTransaction, 0), size: size, maxMemoryUse: maxMemoryUse}
 }
 
 // IgnoreSnapshots is used when playing back macros, to snapshot the macro playback as a whole instead
@@ -50,32 +66,58 @@ func (u *Undo) IgnoreSnapshots(b bool) {
 	u.ignoreSnapshots = b
 }
 
-func lineMapMemoryFootprint(m map[int][]rune) uint64 {
+// MemoryFootprint returns how much memory one Undo struct is using
+func (u *Undo) MemoryFootprint() uint64 {
 	var sum uint64
-	for _, v := range m {
-		sum += uint64(cap(v))
+	for _, t := range u.transactions {
+		sum += uint64(unsafe.Sizeof(t))
+		sum += uint64(len(t.ops)) * uint64(unsafe.Sizeof(BufferOp{}))
+		sum += opsMemoryFootprint(t.ops)
 	}
+	sum += uint64(unsafe.Sizeof(*u))
 	return sum
 }
 
-// MemoryFootprint returns how much memory one Undo struct is using
-// TODO: Check if the size of the slices that contains structs are correct
-func (u *Undo) MemoryFootprint() uint64 {
-	var sum uint64
-	for _, m := range u.editorLineCopies {
-		sum += lineMapMemoryFootprint(m)
+// flush moves the changes that has been recorded by the editor so far into the undo history.
+// If there is no open transaction, the changes are added as a new transaction, and nothing can be redone after that.
+func (u *Undo) flush(e *Editor) {
+	ops := e.lines.TakeOps()
+	if u.open && u.index > 0 {
+		t := &u.transactions[u.index-1]
+		t.ops = append(t.ops, ops...)
+		t.after = e.pos
+		t.changedAfter = e.changed
+		t.cursorsAfter = copyCursors(e.cursors)
+		return
 	}
-	sum += uint64(unsafe.Sizeof(u.index))
-	sum += uint64(unsafe.Sizeof(u.size))
-	sum += uint64(unsafe.Sizeof(u.editorCopies))
-	sum += uint64(unsafe.Sizeof(u.editorPositionCopies))
-	sum += uint64(unsafe.Sizeof(u.mut))
-	sum += uint64(unsafe.Sizeof(u.maxMemoryUse))
-	return sum
+	if len(ops) == 0 {
+		return
+	}
+	// The document has been changed without a snapshot being taken first
+	u.add(UndoTransaction{timestamp: time.Now(), ops: ops, before: e.pos, after: e.pos, changedBefore: e.changed, changedAfter: e.changed, cursorsBefore: copyCursors(e.cursors), cursorsAfter: copyCursors(e.cursors)})
+	u.open = false
+}
+
+// add adds a transaction after the currently applied transactions, and forgets the ones that could be redone
+func (u *Undo) add(t UndoTransaction) {
+	u.transactions = append(u.transactions[:u.index], t)
+	// Forget the oldest transactions if there are too many of them, or if they use too much memory
+	for len(u.transactions) > u.size || (u.maxMemoryUse > 0 && len(u.transactions) > 1 && u.MemoryFootprint() > u.maxMemoryUse) {
+		u.transactions = u.transactions[1:]
+	}
+	u.index = len(u.transactions)
 }
 
-// Snapshot will store a snapshot, and move to the next position in the circular buffer
+// Snapshot marks the start of a new undoable action. The changes that are made to the editor contents
+// until the next snapshot are undone together.
 func (u *Undo) Snapshot(e *Editor) {
+	u.SnapshotGroup(e, "")
+}
+
+// SnapshotGroup marks the start of a new undoable action, but if the previous action belongs to the same
+// (non-empty) group, was made on the same line and was recent enough, the two are joined into one action.
+// This is used for letting one undo remove a burst of typed letters, or a double paste.
+func (u *Undo) SnapshotGroup(e *Editor, group string) {
 	if u.ignoreSnapshots {
 		return
 	}
@@ -83,92 +125,85 @@ func (u *Undo) Snapshot(e *Editor) {
 	u.mut.Lock()
 	defer u.mut.Unlock()
 
-	u.editorCopies[u.index] = *e
-	u.editorLineCopies[u.index] = e.CopyLines()
-	u.editorPositionCopies[u.index] = e.pos
+	u.flush(e)
 
-	// Go forward 1 step in the circular buffer
-	u.index++
-	// Circular buffer wrap
-	if u.index >= u.size {
-		u.index = 0
+	if group != "" && u.open && u.index > 0 {
+		t := &u.transactions[u.index-1]
+		if t.group == group && t.before.LineIndex() == e.pos.LineIndex() && time.Since(t.timestamp) < undoGroupTimeout {
+			t.timestamp = time.Now()
+			return
+		}
 	}
 
-	// If the undo buffer uses too much memory, reduce the size to 10
-	if u.maxMemoryUse > 0 && u.MemoryFootprint() > u.maxMemoryUse {
-		newSize := 10
-
-		smallest := newSize
-		if u.size < smallest {
-			smallest = u.size
-		}
+	u.add(UndoTransaction{timestamp: time.Now(), group: group, before: e.pos, after: e.pos, changedBefore: e.changed, changedAfter: e.changed, cursorsBefore: copyCursors(e.cursors), cursorsAfter: copyCursors(e.cursors)})
+	u.open = true
+}
 
-		newUndo := NewUndo(newSize, u.maxMemoryUse)
-		newUndo.index = u.index
-		if newUndo.index >= newUndo.size {
-			newUndo.index = 0
-		}
-		newUndo.mut = u.mut
-
-		u.mut.Lock()
-		defer u.mut.Unlock()
-
-		// Copy over the contents to the new undo struct
-		offset := u.index
-		for i := 0; i < smallest; i++ {
-			copyFromPos := i + offset
-			if copyFromPos > u.size {
-				copyFromPos -= u.size
-			}
-			copyToPos := i
-			fmt.Println(copyFromPos, copyToPos)
-
-			newUndo.editorCopies[copyToPos] = u.editorCopies[copyFromPos]
-			newUndo.editorLineCopies[copyToPos] = u.editorLineCopies[copyFromPos]
-			newUndo.editorPositionCopies[copyToPos] = u.editorPositionCopies[copyFromPos]
-		}
+// Restore will undo the last action, and restore the cursor position to where it was before that action
+func (u *Undo) Restore(e *Editor) error {
+	u.mut.Lock()
+	defer u.mut.Unlock()
 
-		// Replace the undo struct
-		*u = *newUndo
+	u.flush(e)
 
-		// Adjust the index after the size has been changed
-		if u.index >= u.size {
-			u.index = 0
-		}
+	if u.index == 0 {
+		return errors.New("nothing to undo")
 	}
+
+	t := u.transactions[u.index-1]
+	e.lines.Revert(t.ops)
+	e.pos = t.before
+	e.changed = t.changedBefore
+	e.cursors = copyCursors(t.cursorsBefore)
+
+	u.index--
+	u.open = false
+	return nil
 }
 
-// Restore will restore a previous snapshot, and move to the previous position in the circular buffer
-func (u *Undo) Restore(e *Editor) error {
+// Redo will redo the last action that was undone, and move the cursor to where it was after that action
+func (u *Undo) Redo(e *Editor) error {
 	u.mut.Lock()
 	defer u.mut.Unlock()
 
-	// Go back 1 step in the circular buffer
-	u.index--
-	// Circular buffer wrap
-	if u.index < 0 {
-		u.index = u.size - 1
+	u.flush(e)
+
+	if u.index >= len(u.transactions) {
+		return errors.New("nothing to redo")
 	}
 
-	// Restore the state from this index, if there is something there
-	if lines := u.editorLineCopies[u.index]; len(lines) > 0 {
+	t := u.transactions[u.index]
+	e.lines.Apply(t.ops)
+	e.pos = t.after
+	e.changed = t.changedAfter
+	e.cursors = copyCursors(t.cursorsAfter)
 
-		*e = u.editorCopies[u.index]
-		e.lines = lines
-		e.pos = u.editorPositionCopies[u.index]
+	u.index++
+	u.open = false
+	return nil
+}
 
-		return nil
-	}
-	return errors.New("no undo state at this index")
+// CanRedo returns true if there are actions that have been undone and that can be redone
+func (u *Undo) CanRedo() bool {
+	u.mut.RLock()
+	defer u.mut.RUnlock()
+	return u.index < len(u.transactions)
 }
 
-// Index will return the current undo index, in the undo buffers
+// Index will return the current undo index, which is the number of actions that can be undone
 func (u *Undo) Index() int {
 	return u.index
 }
 
-// Len will return the current number of stored undo snapshots.
-// This is the same as the index int that points to the next free slot.
+// Len will return the current number of stored undo actions, including the ones that can be redone
 func (u *Undo) Len() int {
-	return u.index
+	return len(u.transactions)
+}
+
+// copyCursors returns a copy of the given extra cursors, or nil if there are none
+func copyCursors(cursors []TextPosition) []TextPosition {
+	if len(cursors) == 0 {
+		return nil
+	}
+	return append([]TextPosition{}, cursors...)
 }
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestUndoRedo(t *testing.T) {
+	e := NewSimpleEditor(80)
+	u := NewUndo(defaultUndoCount, defaultUndoMemory)
+
+	u.Snapshot(e)
+	e.InsertStringAndMove(nil, "hello")
+	u.Snapshot(e)
+	e.InsertLineBelow()
+	e.SetLine(1, "world")
+
+	if s := e.String(); s != "hello\nworld\n" {
+		t.Fatalf("unexpected contents: %q", s)
+	}
+	if err := u.Restore(e); err != nil {
+		t.Fatal(err)
+	}
+	if s := e.String(); s != "hello\n" {
+		t.Errorf("unexpected contents after one undo: %q", s)
+	}
+	if err := u.Restore(e); err != nil {
+		t.Fatal(err)
+	}
+	if !e.Empty() {
+		t.Errorf("expected an empty document after two undos, got %q", e.String())
+	}
+	if err := u.Restore(e); err == nil {
+		t.Error("expected nothing more to undo")
+	}
+	if err := u.Redo(e); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.Redo(e); err != nil {
+		t.Fatal(err)
+	}
+	if s := e.String(); s != "hello\nworld\n" {
+		t.Errorf("unexpected contents after two redos: %q", s)
+	}
+	if u.CanRedo() {
+		t.Error("expected nothing more to redo")
+	}
+}
+
+func TestUndoGroup(t *testing.T) {
+	e := NewSimpleEditor(80)
+	u := NewUndo(defaultUndoCount, defaultUndoMemory)
+
+	for _, r := range "abc" {
+		u.SnapshotGroup(e, undoGroupTyping)
+		e.InsertRune(nil, r)
+		e.Next(nil)
+	}
+	if s := e.String(); s != "abc\n" {
+		t.Fatalf("unexpected contents: %q", s)
+	}
+	if err := u.Restore(e); err != nil {
+		t.Fatal(err)
+	}
+	if !e.Empty() {
+		t.Errorf("expected the typed letters to be undone at once, got %q", e.String())
+	}
+	if u.Index() != 0 {
+		t.Errorf("expected undo index 0, got %d", u.Index())
+	}
+}
+
+func TestUndoHistory(t *testing.T) {
+	undoHistoryDir = t.TempDir()
+
+	e := NewSimpleEditor(80)
+	u := NewUndo(defaultUndoCount, defaultUndoMemory)
+	u.Snapshot(e)
+	e.InsertStringAndMove(nil, "hello")
+	e.changed = false // as if it was just saved
+
+	const absFilename = "/home/user/hello.txt"
+	if err := u.SaveHistory(e, absFilename); err != nil {
+		t.Fatal(err)
+	}
+
+	// Load the undo history into a new editor with the same contents
+	e2 := NewSimpleEditor(80)
+	e2.LoadBytes([]byte("hello\n"))
+	e2.lines.TakeOps() // loading the contents can not be undone
+	u2 := NewUndo(defaultUndoCount, defaultUndoMemory)
+	if err := u2.LoadHistory(e2, absFilename); err != nil {
+		t.Fatal(err)
+	}
+	if e2.changed {
+		t.Error("expected the document to be unchanged after loading the undo history")
+	}
+	if err := u2.Restore(e2); err != nil {
+		t.Fatal(err)
+	}
+	if !e2.Empty() || !e2.changed {
+		t.Errorf("expected an empty and changed document after undoing, got %q", e2.String())
+	}
+	if err := u2.Redo(e2); err != nil {
+		t.Fatal(err)
+	}
+	if e2.changed {
+		t.Error("expected the document to be unchanged after redoing what was undone")
+	}
+
+	// The undo history should be dropped if the contents differ
+	e3 := NewSimpleEditor(80)
+	e3.LoadBytes([]byte("goodbye\n"))
+	if err := NewUndo(defaultUndoCount, defaultUndoMemory).LoadHistory(e3, absFilename); err == nil {
+		t.Error("expected the undo history to be outdated")
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	// the undo history is not written to disk if it is larger than this
+	maxUndoHistoryFileSize = 16 * 1024 * 1024
+
+	// the maximum number of files that undo histories are kept for
+	maxUndoHistoryFiles = 256
+)
+
+var undoHistoryDir = filepath.Join(userCacheDir, "o", "undo")
+
+// SavedPosition is a cursor position, in a form that can be written to disk
+type SavedPosition struct {
+	SX, SY, OffsetX, OffsetY, ScrollSpeed, SavedX int
+}
+
+// SavedBufferOp is a single change to the document, in a form that can be written to disk
+type SavedBufferOp struct {
+	Line, OldLine   string
+	Lines, OldLines []string // only used for replacing the entire buffer
+	Kind            int
+	Y               int
+}
+
+// SavedUndoTransaction is an undoable action, in a form that can be written to disk
+type SavedUndoTransaction struct {
+	Ops           []SavedBufferOp
+	Before, After SavedPosition
+}
+
+// UndoHistory is the undo history for one file, in a form that can be written to disk.
+// It is only valid for as long as the contents of the file has the same hash.
+type UndoHistory struct {
+	AbsFilename  string
+	ContentHash  string
+	Transactions []SavedUndoTransaction
+	Index        int
+}
+
+// undoHistoryFilename returns the name of the file in the cache directory that is used for
+// storing the undo history for the given absolute filename
+func undoHistoryFilename(absFilename string) string {
+	return filepath.Join(undoHistoryDir, fmt.Sprintf("%x.gob", sha256.Sum256([]byte(absFilename))))
+}
+
+// contentHash returns a hash of the current editor contents
+func (e *Editor) contentHash() string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(e.String())))
+}
+
+func savePosition(p Position) SavedPosition {
+	return SavedPosition{p.sx, p.sy, p.offsetX, p.offsetY, p.scrollSpeed, p.savedX}
+}
+
+func (sp SavedPosition) position() Position {
+	return Position{sp.SX, sp.SY, sp.OffsetX, sp.OffsetY, sp.ScrollSpeed, sp.SavedX}
+}
+
+// bufferLines returns all lines in the given buffer, as strings
+func bufferLines(b Buffer) []string {
+	l := b.Len()
+	lines := make([]string, l)
+	for y := 0; y < l; y++ {
+		line, _ := b.Line(y)
+		lines[y] = string(line)
+	}
+	return lines
+}
+
+// runeLines converts a slice of strings to a slice of rune slices
+func runeLines(lines []string) [][]rune {
+	runes := make([][]rune, len(lines))
+	for i, line := range lines {
+		runes[i] = []rune(line)
+	}
+	return runes
+}
+
+func saveBufferOp(op BufferOp) SavedBufferOp {
+	sop := SavedBufferOp{Kind: int(op.kind), Y: op.y, Line: string(op.line), OldLine: string(op.oldLine)}
+	if op.kind == opReplace {
+		sop.Lines = bufferLines(op.buffer)
+		sop.OldLines = bufferLines(op.oldBuffer)
+	}
+	return sop
+}
+
+func (sop SavedBufferOp) bufferOp() BufferOp {
+	op := BufferOp{kind: bufferOpKind(sop.Kind), y: sop.Y, line: []rune(sop.Line), oldLine: []rune(sop.OldLine)}
+	if op.kind == opReplace {
+		op.buffer = NewLineRope(runeLines(sop.Lines))
+		op.oldBuffer = NewLineRope(runeLines(sop.OldLines))
+	}
+	return op
+}
+
+// SaveHistory writes the undo history for the given file to the cache directory, so that it can be
+// loaded the next time the file is opened. The history is only saved if the current contents of the
+// editor has been saved, since it must correspond to the contents of the file.
+func (u *Undo) SaveHistory(e *Editor, absFilename string) error {
+	if noWriteToCache || !ShouldKeep(absFilename) {
+		return nil
+	}
+
+	u.mut.Lock()
+	u.flush(e)
+	u.open = false
+	uh := UndoHistory{AbsFilename: absFilename, Index: u.index}
+	for _, t := range u.transactions {
+		st := SavedUndoTransaction{Before: savePosition(t.before), After: savePosition(t.after)}
+		for _, op := range t.ops {
+			st.Ops = append(st.Ops, saveBufferOp(op))
+		}
+		uh.Transactions = append(uh.Transactions, st)
+	}
+	u.mut.Unlock()
+
+	if e.changed || len(uh.Transactions) == 0 {
+		return nil
+	}
+	uh.ContentHash = e.contentHash()
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(uh); err != nil {
+		return err
+	}
+	if buf.Len() > maxUndoHistoryFileSize {
+		return errors.New("the undo history is too large to be saved")
+	}
+
+	// First create the folder, if needed, in a best effort attempt
+	os.MkdirAll(undoHistoryDir, os.ModePerm)
+
+	// Then remove the oldest undo histories, if there are too many of them
+	removeOldUndoHistories()
+
+	// Write the undo history, with strict permissions
+	return os.WriteFile(undoHistoryFilename(absFilename), buf.Bytes(), 0o600)
+}
+
+// LoadHistory tries to load the undo history for the given file from the cache directory.
+// If the file has been changed since the undo history was saved, the undo history is removed instead.
+func (u *Undo) LoadHistory(e *Editor, absFilename string) error {
+	filename := undoHistoryFilename(absFilename)
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var uh UndoHistory
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&uh); err != nil {
+		return err
+	}
+	if uh.AbsFilename != absFilename || uh.ContentHash != e.contentHash() {
+		// The file has been changed outside of the editor, the undo history is no longer valid
+		if !noWriteToCache {
+			os.Remove(filename)
+		}
+		return errors.New("the undo history for " + absFilename + " is outdated")
+	}
+
+	u.mut.Lock()
+	defer u.mut.Unlock()
+
+	u.transactions = make([]UndoTransaction, 0, len(uh.Transactions))
+	for _, st := range uh.Transactions {
+		// Undoing or redoing any of the previous actions will change the file from what is on disk
+		t := UndoTransaction{before: st.Before.position(), after: st.After.position(), changedBefore: true, changedAfter: true}
+		for _, sop := range st.Ops {
+			t.ops = append(t.ops, sop.bufferOp())
+		}
+		u.transactions = append(u.transactions, t)
+	}
+	u.index = uh.Index
+	if u.index > len(u.transactions) {
+		u.index = len(u.transactions)
+	}
+	// The contents are the same as on disk at the current position in the undo history
+	if u.index > 0 {
+		u.transactions[u.index-1].changedAfter = false
+	}
+	if u.index < len(u.transactions) {
+		u.transactions[u.index].changedBefore = false
+	}
+	u.open = false
+	// Loading the undo history does not change the contents
+	e.changed = false
+	return nil
+}
+
+// removeOldUndoHistories removes the undo histories that were least recently written to,
+// so that there is room for at least one more
+func removeOldUndoHistories() {
+	entries, err := os.ReadDir(undoHistoryDir)
+	if err != nil || len(entries) < maxUndoHistoryFiles {
+		return
+	}
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil {
+			infos = append(infos, info)
+		}
+	}
+	if len(infos) < maxUndoHistoryFiles {
+		return
+	}
+	// Sort from newest to oldest
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().After(infos[j].ModTime())
+	})
+	for _, info := range infos[maxUndoHistoryFiles-1:] {
+		os.Remove(filepath.Join(undoHistoryDir, info.Name()))
+	}
+}
@@ -214,6 +214,17 @@ func runeCount(s string, r rune) int {
 	return counter
 }
 
+// shortenText returns the first n runes of the given text, followed by "…" if the text is longer than that
+func shortenText(text string, n int) string {
+	for i := range text {
+		if n == 0 {
+			return text[:i] + "…"
+		}
+		n--
+	}
+	return text
+}
+
 // abs returns the absolute value of the given int
 func abs(a int) int {
 	if a < 0 {
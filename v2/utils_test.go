@@ -13,3 +13,12 @@ func TestCapitalizeWords(t *testing.T) {
 // func TestGetFullName(t *testing.T) {
 // 	fmt.Println(getFullName())
 // }
+
+func TestShortenText(t *testing.T) {
+	if s := shortenText("blåbærsyltetøy", 6); s != "blåbær…" {
+		t.Errorf("expected the text to be shortened to 6 runes, got %q", s)
+	}
+	if s := shortenText("blåbær", 6); s != "blåbær" {
+		t.Errorf("expected the text to be kept as it is, got %q", s)
+	}
+}